@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+const (
+	ACOUSTID_LOOKUP_URL = "https://api.acoustid.org/v2/lookup"
+	// Lower scores are often another version or a different track.
+	DEFAULT_ACOUSTID_MIN_SCORE = 0.8
+)
+
+// Fingerprinting of recorded tracks, needs fpcalc of Chromaprint.
+type go101FingerprintConfig struct {
+	// AcoustID application API key, see https://acoustid.org/new-application.
+	APIKey string `json:"api_key"`
+	// Minimal match score 0..1, 0.8 by default.
+	MinScore float64 `json:"min_score"`
+}
+
+// Canonical metadata of the recording, found by fingerprint.
+type go101AcoustIDMeta struct {
+	AcoustID      string
+	RecordingMBID string
+	ArtistMBID    string
+	// Release group (album regardless of edition) of the recording, if any.
+	ReleaseGroupMBID string
+	Artist           string
+	Title            string
+	Album            string
+}
+
+// Output of "fpcalc -json".
+type go101Fpcalc struct {
+	Duration    float64 `json:"duration"`
+	Fingerprint string  `json:"fingerprint"`
+}
+
+// Output of "fpcalc -raw -json", fingerprint items are unsigned.
+type go101FpcalcRaw struct {
+	Duration    float64 `json:"duration"`
+	Fingerprint []int64 `json:"fingerprint"`
+}
+
+// AcoustID lookup response with recordings and release groups meta.
+type go101AcoustIDResponse struct {
+	Status string `json:"status"`
+	Error  struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Results []struct {
+		Id         string  `json:"id"`
+		Score      float64 `json:"score"`
+		Recordings []struct {
+			Id      string `json:"id"`
+			Title   string `json:"title"`
+			Artists []struct {
+				Id   string `json:"id"`
+				Name string `json:"name"`
+				// Separator before the next artist, ex: " feat. ".
+				JoinPhrase string `json:"joinphrase"`
+			} `json:"artists"`
+			ReleaseGroups []struct {
+				Id    string `json:"id"`
+				Title string `json:"title"`
+				Type  string `json:"type"`
+			} `json:"releasegroups"`
+		} `json:"recordings"`
+	} `json:"results"`
+}
+
+// Computes fingerprint of the audio file.
+func Fingerprint(filename string) (*go101Fpcalc, error) {
+	out, err := exec.Command("fpcalc", "-json", filename).Output()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't run fpcalc (install chromaprint): %s", err.Error())
+	}
+	fp := &go101Fpcalc{}
+	if err = json.Unmarshal(out, fp); err != nil {
+		return nil, err
+	}
+	if fp.Fingerprint == "" {
+		return nil, fmt.Errorf("empty fingerprint of %s", filename)
+	}
+	return fp, nil
+}
+
+// Computes raw fingerprint of the audio file, to compare files without AcoustID.
+func RawFingerprint(filename string) ([]uint32, float64, error) {
+	out, err := exec.Command("fpcalc", "-raw", "-json", filename).Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("couldn't run fpcalc (install chromaprint): %s", err.Error())
+	}
+	fp := &go101FpcalcRaw{}
+	if err = json.Unmarshal(out, fp); err != nil {
+		return nil, 0, err
+	}
+	if len(fp.Fingerprint) == 0 {
+		return nil, 0, fmt.Errorf("empty fingerprint of %s", filename)
+	}
+	raw := make([]uint32, len(fp.Fingerprint))
+	for i, v := range fp.Fingerprint {
+		raw[i] = uint32(v)
+	}
+	return raw, fp.Duration, nil
+}
+
+// Looks up the audio file in AcoustID, returns nil if there's no confident match.
+func (c *go101FingerprintConfig) Lookup(filename string) (*go101AcoustIDMeta, error) {
+	key, err := ResolveSecret(c.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := Fingerprint(filename)
+	if err != nil {
+		return nil, err
+	}
+	// Fingerprints are too long for query string.
+	resp, err := httpClient.PostForm(ACOUSTID_LOOKUP_URL, url.Values{
+		"client":      {key},
+		"meta":        {"recordings releasegroups"},
+		"duration":    {fmt.Sprintf("%d", int(fp.Duration))},
+		"fingerprint": {fp.Fingerprint},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var r go101AcoustIDResponse
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("couldn't parse AcoustID response: %s", err.Error())
+	}
+	if r.Status != "ok" {
+		return nil, fmt.Errorf("AcoustID lookup failed: %s", r.Error.Message)
+	}
+	minScore := c.MinScore
+	if minScore <= 0 {
+		minScore = DEFAULT_ACOUSTID_MIN_SCORE
+	}
+	// Results are sorted by score.
+	for _, result := range r.Results {
+		if result.Score < minScore {
+			break
+		}
+		for _, rec := range result.Recordings {
+			if rec.Title == "" || len(rec.Artists) == 0 {
+				continue
+			}
+			meta := &go101AcoustIDMeta{
+				AcoustID:      result.Id,
+				RecordingMBID: rec.Id,
+				ArtistMBID:    rec.Artists[0].Id,
+				Title:         rec.Title,
+			}
+			var artist strings.Builder
+			for _, a := range rec.Artists {
+				artist.WriteString(a.Name + a.JoinPhrase)
+			}
+			meta.Artist = artist.String()
+			// Prefer album over single or compilation.
+			for _, rg := range rec.ReleaseGroups {
+				if meta.ReleaseGroupMBID == "" || rg.Type == "Album" {
+					meta.ReleaseGroupMBID, meta.Album = rg.Id, rg.Title
+				}
+				if rg.Type == "Album" {
+					break
+				}
+			}
+			return meta, nil
+		}
+	}
+	return nil, nil
+}
+
+// Replaces station-provided tags with canonical ones and adds MusicBrainz IDs the way Picard does.
+func (t *go101ID3Tag) ApplyAcoustID(meta *go101AcoustIDMeta) {
+	t.Artist, t.Title = meta.Artist, meta.Title
+	if meta.Album != "" {
+		t.Album = meta.Album
+	}
+	t.RecordingMBID = meta.RecordingMBID
+	t.Extra = map[string]string{
+		"Acoustid Id":                  meta.AcoustID,
+		"MusicBrainz Artist Id":        meta.ArtistMBID,
+		"MusicBrainz Release Group Id": meta.ReleaseGroupMBID,
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Player actions, may be bound to hotkeys.
+const (
+	ACTION_PAUSE          = "pause"
+	ACTION_STOP           = "stop"
+	ACTION_QUIET_OVERRIDE = "quiet-override"
+	ACTION_NEXT           = "next"
+	ACTION_PREV           = "prev"
+	ACTION_VOLUME_UP      = "volume-up"
+	ACTION_VOLUME_DOWN    = "volume-down"
+	ACTION_REPLAY         = "replay"
+	ACTION_SUGGEST        = "suggest"
+	ACTION_OPEN           = "open"
+	ACTION_BOOKMARK       = "bookmark"
+	ACTION_ROTATION       = "rotation"
+	ACTION_NEXT_FAVORITE  = "next-favorite"
+	// Toggles pass-through of hotkeys to other programs.
+	ACTION_SUSPEND_HOTKEYS = "suspend-hotkeys"
+	// Followed by favorite position, ex: fav-1.
+	ACTION_FAVORITE = "fav-"
+)
+
+// Action description, used by help and man page.
+type go101ActionInfo struct {
+	Name string
+	Desc string
+}
+
+var actions = []go101ActionInfo{
+	{ACTION_PAUSE, "Play/pause."},
+	{ACTION_STOP, "Pause if playing (live radio can't be stopped)."},
+	{ACTION_QUIET_OVERRIDE, "Disable/re-engage quiet hours until the end of the current quiet period."},
+	{ACTION_NEXT, "Next channel of the current group."},
+	{ACTION_PREV, "Previous channel of the current group."},
+	{ACTION_VOLUME_UP, "Volume up."},
+	{ACTION_VOLUME_DOWN, "Volume down."},
+	{ACTION_REPLAY, "Replay previous track from cache, then return to live."},
+	{ACTION_SUGGEST, "Switch to the suggested channel."},
+	{ACTION_OPEN, "Open the channel page in the browser."},
+	{ACTION_BOOKMARK, "Bookmark the channel, time and track, see \"101ply bookmarks\"."},
+	{ACTION_ROTATION, "Turn channel rotation off, or back on switching to the channel of the current part of the day."},
+	{ACTION_SUSPEND_HOTKEYS, "Release all hotkeys but this one, so other programs get them (games, apps using Pause), or grab them back."},
+	{ACTION_NEXT_FAVORITE, "Switch to the favorite channel after the last one switched to, the first one after the last."},
+	{ACTION_FAVORITE + "N", "Switch to the favorite channel N (fav-1, fav-2, ...)."},
+}
+
+// Checks if action name is known.
+func KnownAction(action string) bool {
+	if strings.HasPrefix(action, ACTION_FAVORITE) {
+		pos, err := strconv.Atoi(strings.TrimPrefix(action, ACTION_FAVORITE))
+		return err == nil && pos > 0
+	}
+	for _, a := range actions {
+		if a.Name == action {
+			return true
+		}
+	}
+	return false
+}
+
+const VOLUME_STEP = 5
+
+// Returns volume getter and setter: of the backend if it has own volume, of the mixer otherwise.
+func (p *go101) VolumeControl() (func() (int, error), func(int) error) {
+	if b, ok := BaseBackend(p.Backend).(go101VolumeBackend); ok {
+		return b.Volume, b.SetVolume
+	}
+	return GetVolume, SetVolume
+}
+
+// Performs player action by name.
+func (p *go101) Action(action string) {
+	if p.BigMode && !bigModeActions[action] {
+		Debug("Action %s disabled in car mode", action)
+		return
+	}
+	switch action {
+	case ACTION_PAUSE, "":
+		if p.Muted() {
+			p.Resume()
+		} else {
+			p.Pause()
+		}
+	case ACTION_STOP:
+		// Live radio can't be stopped, so stop works like pause.
+		if p.Status() == STATUS_PLAY {
+			p.Pause()
+		}
+	case ACTION_QUIET_OVERRIDE:
+		p.ToggleQuietOverride()
+	case ACTION_NEXT:
+		p.StepChannel(1)
+	case ACTION_PREV:
+		p.StepChannel(-1)
+	case ACTION_VOLUME_UP, ACTION_VOLUME_DOWN:
+		get, set := p.VolumeControl()
+		volume, err := get()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if action == ACTION_VOLUME_UP {
+			volume += VOLUME_STEP
+		} else {
+			volume -= VOLUME_STEP
+		}
+		if err = set(volume); err != nil {
+			log.Println(err)
+		}
+		p.ApplyQuietHours()
+	case ACTION_REPLAY:
+		if !p.Replaying() {
+			go Safe("replay", p.Replay)
+		}
+	case ACTION_SUGGEST:
+		p.PlaySuggestion()
+	case ACTION_OPEN:
+		if err := OpenBrowser(p.ChannelURL(p.ChannelId())); err != nil {
+			log.Println(err)
+		}
+	case ACTION_BOOKMARK:
+		if _, err := p.Bookmark(""); err != nil {
+			log.Println("Couldn't bookmark: ", err.Error())
+		}
+	case ACTION_ROTATION:
+		p.ToggleRotation()
+	case ACTION_SUSPEND_HOTKEYS:
+		SuspendHotkeys(!HotkeysSuspended())
+	case ACTION_NEXT_FAVORITE:
+		p.NextFavorite()
+	default:
+		if strings.HasPrefix(action, ACTION_FAVORITE) {
+			pos, _ := strconv.Atoi(strings.TrimPrefix(action, ACTION_FAVORITE))
+			p.PlayFavorite(pos)
+			return
+		}
+		log.Printf("Unknown action %s", action)
+	}
+}
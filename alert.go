@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const ALERT_CHECK_INTERVAL = 30 * time.Second
+
+// Alert rules, alerts are sent through notifiers as "alert" events.
+type go101AlertConfig struct {
+	// Alert if stream has been erroring for that many minutes, 0 disables.
+	StreamErrorMinutes int `json:"stream_error_minutes"`
+	// Alert if scheduled recording failed.
+	RecordingFailed bool `json:"recording_failed"`
+}
+
+// Stream errors streak.
+type go101ErrorStreak struct {
+	mux       sync.Mutex
+	since     time.Time
+	lastError string
+	alerted   bool
+}
+
+var (
+	errorStreak go101ErrorStreak
+	alertsOnce  sync.Once
+)
+
+// Tracks stream errors and sends alerts according to the rules. Runs forever.
+func (p *go101) AlertLoop() {
+	alertsOnce.Do(func() {
+		p.Subscribe(func(e go101Event) {
+			errorStreak.mux.Lock()
+			defer errorStreak.mux.Unlock()
+			switch {
+			case e.Type == EVENT_ERROR:
+				if errorStreak.since.IsZero() {
+					errorStreak.since = e.Time
+				}
+				errorStreak.lastError = e.Error
+			case e.Type == EVENT_TRACK || e.Type == EVENT_STATUS && e.Status == STATUS_PLAY:
+				if errorStreak.alerted {
+					p.Alert("Stream recovered", fmt.Sprintf("%s plays again.", e.Channel.Title))
+				}
+				errorStreak.since, errorStreak.alerted = time.Time{}, false
+			}
+		})
+	})
+	limit := time.Duration(p.Config.Alerts.StreamErrorMinutes) * time.Minute
+	for true {
+		time.Sleep(ALERT_CHECK_INTERVAL)
+		if limit <= 0 {
+			continue
+		}
+		errorStreak.mux.Lock()
+		if !errorStreak.since.IsZero() && !errorStreak.alerted && time.Since(errorStreak.since) >= limit {
+			errorStreak.alerted = true
+			p.Alert("Stream is failing", fmt.Sprintf("Errors for %s: %s", time.Since(errorStreak.since).Round(time.Minute), errorStreak.lastError))
+		}
+		errorStreak.mux.Unlock()
+	}
+}
+
+// Reports failed scheduled recording, if the rule is enabled.
+func (p *go101) RecordingFailed(name string, err error) {
+	if p.Config.Alerts == nil || !p.Config.Alerts.RecordingFailed {
+		return
+	}
+	p.Alert("Recording failed", fmt.Sprintf("%s: %s", name, err.Error()))
+}
+
+// Sends alert through the notifiers. Without notifiers alert is only logged.
+func (p *go101) Alert(title, message string) {
+	Debug("Alert: %s: %s", title, message)
+	if len(Notifiers()) == 0 {
+		fmt.Printf("%s: %s\n", Paint(theme.Error, title), message)
+		return
+	}
+	p.Notify(EVENT_ALERT, "101ply: "+title, message)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/bits"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// Share of equal fingerprint bits of the same recording. Re-encodes score above 0.9, different tracks about 0.5.
+	FINGERPRINT_MATCH = 0.85
+	// Max difference of durations in seconds of the same recording.
+	FINGERPRINT_DURATION_DIFF = 3
+	// Fingerprint items compared with shift, encoders add own delay. Item is about 0.12 second.
+	FINGERPRINT_MAX_SHIFT = 3
+)
+
+// Recorded file indexed by audio content.
+type go101ArchiveFile struct {
+	Path    string
+	Size    int64
+	ModTime int64
+	// Hash of audio without tags, same for the audio tagged differently.
+	Hash string
+	// Chromaprint raw fingerprint and duration, empty unless fingerprints were requested.
+	Duration    float64
+	Fingerprint []uint32
+}
+
+// Cuts ID3v1 tag from the end of the audio file, if any.
+func StripID3v1(audio []byte) []byte {
+	if len(audio) >= 128 && string(audio[len(audio)-128:len(audio)-125]) == "TAG" {
+		return audio[:len(audio)-128]
+	}
+	return audio
+}
+
+// Returns hash of the audio content, tags aren't counted.
+func ContentHash(audio []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(StripID3v1(StripID3(audio))))
+}
+
+// Returns share of equal bits of the fingerprints, best of the small shifts.
+func FingerprintSimilarity(a, b []uint32) float64 {
+	best := 0.0
+	for shift := -FINGERPRINT_MAX_SHIFT; shift <= FINGERPRINT_MAX_SHIFT; shift++ {
+		x, y := a, b
+		if shift > 0 && shift < len(x) {
+			x = x[shift:]
+		} else if shift < 0 && -shift < len(y) {
+			y = y[-shift:]
+		}
+		n := len(x)
+		if len(y) < n {
+			n = len(y)
+		}
+		if n == 0 {
+			continue
+		}
+		diff := 0
+		for i := 0; i < n; i++ {
+			diff += bits.OnesCount32(x[i] ^ y[i])
+		}
+		if s := 1 - float64(diff)/float64(n*32); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+func encodeFingerprint(fp []uint32) []byte {
+	if len(fp) == 0 {
+		return nil
+	}
+	b := make([]byte, 4*len(fp))
+	for i, v := range fp {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+func decodeFingerprint(b []byte) []uint32 {
+	fp := make([]uint32, len(b)/4)
+	for i := range fp {
+		fp[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return fp
+}
+
+// Adds the file to the archive index.
+func (p *go101) IndexArchiveFile(f go101ArchiveFile) error {
+	_, err := p.DB.Exec(`INSERT OR REPLACE INTO archive_files (path, size, mod_time, hash, duration, fingerprint)
+		VALUES (?, ?, ?, ?, ?, ?)`, f.Path, f.Size, f.ModTime, f.Hash, f.Duration, encodeFingerprint(f.Fingerprint))
+	return err
+}
+
+// Indexes just recorded file, its audio is at hand.
+func (p *go101) IndexRecording(filename string, data []byte) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return p.IndexArchiveFile(go101ArchiveFile{Path: filename, Size: fi.Size(), ModTime: fi.ModTime().Unix(), Hash: ContentHash(data)})
+}
+
+// Returns existing recording with the same audio, empty if there's none.
+func (p *go101) RecordedContent(hash string) string {
+	rows, err := p.DB.Query(`SELECT path FROM archive_files WHERE hash = ?`, hash)
+	if err != nil {
+		return ""
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if rows.Scan(&path) == nil {
+			paths = append(paths, path)
+		}
+	}
+	_ = rows.Close()
+	for _, path := range paths {
+		if _, err = os.Stat(path); err == nil {
+			return path
+		}
+		_, _ = p.DB.Exec(`DELETE FROM archive_files WHERE path = ?`, path)
+	}
+	return ""
+}
+
+// Updates the index of the directory: new and changed files are hashed (and fingerprinted if asked), removed
+// ones are forgotten. Returns all files of the directory.
+func (p *go101) IndexArchive(dir string, fingerprint bool) ([]go101ArchiveFile, error) {
+	indexed := make(map[string]go101ArchiveFile)
+	rows, err := p.DB.Query(`SELECT path, size, mod_time, hash, duration, fingerprint FROM archive_files`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			f  go101ArchiveFile
+			fp []byte
+		)
+		if err = rows.Scan(&f.Path, &f.Size, &f.ModTime, &f.Hash, &f.Duration, &fp); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		f.Fingerprint = decodeFingerprint(fp)
+		indexed[f.Path] = f
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	files := make([]go101ArchiveFile, 0)
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Temporary files of recordings in progress are hidden.
+		if strings.HasPrefix(fi.Name(), ".") && path != dir {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, ok := indexed[path]
+		delete(indexed, path)
+		if !ok || f.Size != fi.Size() || f.ModTime != fi.ModTime().Unix() {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			f = go101ArchiveFile{Path: path, Size: fi.Size(), ModTime: fi.ModTime().Unix(), Hash: ContentHash(data)}
+			ok = false
+		}
+		if fingerprint && len(f.Fingerprint) == 0 {
+			if f.Fingerprint, f.Duration, err = RawFingerprint(path); err != nil {
+				// Not an audio file, or broken one.
+				Debug("Couldn't fingerprint %s: %s", path, err)
+			} else {
+				ok = false
+			}
+		}
+		if !ok {
+			if err = p.IndexArchiveFile(f); err != nil {
+				return err
+			}
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Clean(dir) + string(os.PathSeparator)
+	for path := range indexed {
+		if strings.HasPrefix(path, prefix) {
+			_, _ = p.DB.Exec(`DELETE FROM archive_files WHERE path = ?`, path)
+		}
+	}
+	return files, nil
+}
+
+// Groups files with the same audio, and re-encodes of it if fingerprints are given. The first file of each group
+// is the one to keep: the biggest (re-encodes with higher bitrate win), older one of equal ones.
+func ArchiveDuplicates(files []go101ArchiveFile) [][]go101ArchiveFile {
+	// Union of files by hash and fingerprint matches.
+	parent := make([]int, len(files))
+	for i := range parent {
+		parent[i] = i
+	}
+	root := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	byHash := make(map[string]int)
+	for i, f := range files {
+		if j, ok := byHash[f.Hash]; ok {
+			parent[root(i)] = root(j)
+		} else {
+			byHash[f.Hash] = i
+		}
+	}
+	order := make([]int, 0, len(files))
+	for i, f := range files {
+		if len(f.Fingerprint) > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return files[order[a]].Duration < files[order[b]].Duration
+	})
+	for a := range order {
+		for b := a + 1; b < len(order); b++ {
+			x, y := files[order[a]], files[order[b]]
+			if y.Duration-x.Duration > FINGERPRINT_DURATION_DIFF {
+				break
+			}
+			if root(order[a]) != root(order[b]) && FingerprintSimilarity(x.Fingerprint, y.Fingerprint) >= FINGERPRINT_MATCH {
+				parent[root(order[a])] = root(order[b])
+			}
+		}
+	}
+
+	grouped := make(map[int][]go101ArchiveFile)
+	for i, f := range files {
+		grouped[root(i)] = append(grouped[root(i)], f)
+	}
+	groups := make([][]go101ArchiveFile, 0)
+	for _, g := range grouped {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool {
+			if g[i].Size != g[j].Size {
+				return g[i].Size > g[j].Size
+			}
+			if g[i].ModTime != g[j].ModTime {
+				return g[i].ModTime < g[j].ModTime
+			}
+			return g[i].Path < g[j].Path
+		})
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0].Path < groups[j][0].Path
+	})
+	return groups
+}
+
+// Replaces the file with hard link to the kept one. Link is made aside and renamed over the file, so the file
+// is never lost.
+func linkDuplicate(keep, dup string) error {
+	tmp := filepath.Join(filepath.Dir(dup), "."+filepath.Base(dup)+".link.tmp")
+	_ = os.Remove(tmp)
+	if err := os.Link(keep, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dup); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Browse recordings archive or find duplicates in it.
+func CmdArchive(args []string) {
+	if len(args) == 0 || args[0] != "dedupe" {
+		go101o.BrowseArchive(strings.Join(args, " "), os.Stdin)
+		return
+	}
+	fs := flag.NewFlagSet("archive dedupe", flag.ExitOnError)
+	dir := fs.String("dir", "", "Archive directory, \"dir\" of \"record\" config by default.")
+	fingerprint := fs.Bool("fingerprint", false, "Find re-encodes of the same audio by Chromaprint fingerprints, needs fpcalc.")
+	link := fs.Bool("link", false, "Replace duplicates with hard links to the kept file.")
+	remove := fs.Bool("rm", false, "Remove duplicates.")
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	if *link && *remove {
+		log.Fatal("Use either -link or -rm")
+	}
+	if *dir == "" {
+		c := go101o.Config.Record
+		if c == nil {
+			c = &go101RecordConfig{}
+		}
+		*dir = c.GetDir()
+	}
+	// Index keeps absolute paths, as recordings do.
+	if abs, err := filepath.Abs(*dir); err == nil {
+		*dir = abs
+	}
+	if _, err := exec.LookPath("fpcalc"); *fingerprint && err != nil {
+		log.Fatal("Fingerprints need fpcalc, install chromaprint")
+	}
+	files, err := go101o.IndexArchive(*dir, *fingerprint)
+	if err != nil {
+		log.Fatal("Couldn't index archive: ", err.Error())
+	}
+	var (
+		count, failed int
+		size          int64
+	)
+	for _, g := range ArchiveDuplicates(files) {
+		keep := g[0]
+		keepInfo, err := os.Stat(keep.Path)
+		if err != nil {
+			continue
+		}
+		header := false
+		for _, f := range g[1:] {
+			fi, err := os.Stat(f.Path)
+			if err != nil || os.SameFile(keepInfo, fi) {
+				// Linked before.
+				continue
+			}
+			if !header {
+				fmt.Println(go101o.ConsoleText(keep.Path))
+				header = true
+			}
+			kind := "same audio"
+			if f.Hash != keep.Hash {
+				kind = fmt.Sprintf("re-encode, %s", FormatSize(f.Size))
+			}
+			fmt.Printf("  %s (%s)\n", go101o.ConsoleText(f.Path), kind)
+			switch {
+			case *link:
+				err = linkDuplicate(keep.Path, f.Path)
+				if err == nil {
+					linked := keep
+					linked.Path = f.Path
+					err = go101o.IndexArchiveFile(linked)
+				}
+			case *remove:
+				if err = os.Remove(f.Path); err == nil {
+					_, _ = go101o.DB.Exec(`DELETE FROM archive_files WHERE path = ?`, f.Path)
+					_, err = go101o.DB.Exec(`DELETE FROM recordings WHERE path = ?`, f.Path)
+				}
+			}
+			if err != nil {
+				log.Println("Couldn't dedupe "+f.Path+": ", err.Error())
+				failed++
+				continue
+			}
+			count++
+			size += f.Size
+		}
+	}
+	switch {
+	case count == 0 && failed == 0:
+		fmt.Printf("No duplicates among %d files.\n", len(files))
+	case *link:
+		fmt.Printf("%d duplicates linked, %s freed.\n", count, FormatSize(size))
+	case *remove:
+		fmt.Printf("%d duplicates removed, %s freed.\n", count, FormatSize(size))
+	default:
+		fmt.Printf("%d duplicates, %s. Run with -link to replace them with hard links or -rm to remove them.\n", count, FormatSize(size))
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ARCHIVE_PAGE_SIZE = 20
+	MAX_RATING        = 5
+	ARCHIVE_SKIP      = 15 * time.Second
+	ARCHIVE_MIN_SPEED = 0.5
+	ARCHIVE_MAX_SPEED = 2.0
+)
+
+// Recorded track of the archive.
+type go101ArchiveTrack struct {
+	Path       string
+	Track      go101TrackInfo
+	Channel    string
+	RecordedAt time.Time
+	Rating     int
+}
+
+// Returns recorded tracks, newest first. Track info comes from the history, tracks missing there are named
+// by file. Records of removed files are forgotten.
+func (p *go101) ArchiveTracks() ([]go101ArchiveTrack, error) {
+	rows, err := p.DB.Query(`SELECT r.path, r.track_uid, r.recorded_at, COALESCE(h.artist, ''), COALESCE(h.title, ''),
+		COALESCE(h.album, ''), COALESCE(h.channel_id, 0), COALESCE(g.rating, 0)
+		FROM recordings r
+		LEFT JOIN history h ON h.rowid = (SELECT rowid FROM history WHERE track_uid = r.track_uid AND channel_id != 0
+			ORDER BY played_at DESC LIMIT 1)
+		LEFT JOIN ratings g ON g.path = r.path
+		ORDER BY r.recorded_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		tracks   []go101ArchiveTrack
+		channels []uint64
+	)
+	for rows.Next() {
+		var (
+			t        go101ArchiveTrack
+			recorded int64
+			cid      uint64
+		)
+		if err = rows.Scan(&t.Path, &t.Track.TrackUid, &recorded, &t.Track.Artist, &t.Track.Title, &t.Track.Album,
+			&cid, &t.Rating); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		t.RecordedAt = time.Unix(recorded, 0)
+		tracks = append(tracks, t)
+		channels = append(channels, cid)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	found := make([]go101ArchiveTrack, 0, len(tracks))
+	for i, t := range tracks {
+		if _, err = os.Stat(t.Path); err != nil {
+			_ = p.ForgetRecording(t.Path)
+			continue
+		}
+		if t.Track.Title == "" {
+			t.Track.Title = strings.TrimSuffix(filepath.Base(t.Path), filepath.Ext(t.Path))
+		}
+		if channels[i] != 0 {
+			t.Channel = p.channelTitle(channels[i])
+		}
+		found = append(found, t)
+	}
+	return found, nil
+}
+
+// Removes records of the file: recording, content index and rating.
+func (p *go101) ForgetRecording(path string) error {
+	for _, table := range []string{"recordings", "archive_files", "ratings"} {
+		if _, err := p.DB.Exec(`DELETE FROM `+table+` WHERE path = ?`, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rates recorded track from 1 to 5, 0 removes the rating.
+func (p *go101) RateRecording(path string, rating int) error {
+	if rating < 0 || rating > MAX_RATING {
+		return fmt.Errorf("rating should be 0-%d", MAX_RATING)
+	}
+	if rating == 0 {
+		_, err := p.DB.Exec(`DELETE FROM ratings WHERE path = ?`, path)
+		return err
+	}
+	_, err := p.DB.Exec(`INSERT OR REPLACE INTO ratings (path, rating) VALUES (?, ?)`, path, rating)
+	return err
+}
+
+// Checks if the track matches all words of the query: artist, title, album, channel or recording date.
+func (t go101ArchiveTrack) Matches(query string) bool {
+	text := strings.ToLower(strings.Join([]string{t.Track.Artist, t.Track.Title, t.Track.Album, t.Channel,
+		t.RecordedAt.Format("2006-01-02"), FormatDate(t.RecordedAt)}, "\n"))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns stars of the rating.
+func ratingStars(rating int) string {
+	if rating == 0 {
+		return ""
+	}
+	return strings.Repeat("*", rating) + strings.Repeat(".", MAX_RATING-rating)
+}
+
+// Copies the file into the directory, name is suffixed if the directory has such file. Returns new path.
+func exportRecording(path, dir string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	target := UniqueFileName(filepath.Join(dir, filepath.Base(path)), nil)
+	return target, WriteFileAtomic(target, data, 0644)
+}
+
+// Browses recorded tracks: search, local playback, ratings, delete and export.
+func (p *go101) BrowseArchive(query string, in io.Reader) {
+	all, err := p.ArchiveTracks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(all) == 0 {
+		fmt.Println("No recordings yet, see \"record\" in \"101ply help config\".")
+		return
+	}
+	filter := func() []go101ArchiveTrack {
+		tracks := make([]go101ArchiveTrack, 0)
+		for _, t := range all {
+			if t.Matches(query) {
+				tracks = append(tracks, t)
+			}
+		}
+		return tracks
+	}
+	tracks, page := filter(), 0
+	var backend go101Backend
+	defer func() {
+		if backend != nil {
+			backend.Close()
+		}
+	}()
+	reader := bufio.NewReader(in)
+	for {
+		pages := (len(tracks) + ARCHIVE_PAGE_SIZE - 1) / ARCHIVE_PAGE_SIZE
+		if page >= pages {
+			page = pages - 1
+		}
+		if page < 0 {
+			page = 0
+		}
+		fmt.Printf("\n%s: %d of %d", Paint(theme.Info, "Recordings"), len(tracks), len(all))
+		if query != "" {
+			fmt.Printf(" matching \"%s\"", query)
+		}
+		if pages > 1 {
+			fmt.Printf(", page %d/%d", page+1, pages)
+		}
+		fmt.Println()
+		for i := page * ARCHIVE_PAGE_SIZE; i < len(tracks) && i < (page+1)*ARCHIVE_PAGE_SIZE; i++ {
+			t := tracks[i]
+			line := Paint(theme.Artist, t.Track.Artist) + " - " + Paint(theme.Title, t.Track.Title)
+			if t.Track.Artist == "" {
+				line = Paint(theme.Title, t.Track.Title)
+			}
+			if t.Channel != "" {
+				line += " [" + Paint(theme.Channel, t.Channel) + "]"
+			}
+			fmt.Printf("%4d. %s %s %s\n", i+1, Paint(theme.Time, FormatDate(t.RecordedAt)), p.ConsoleText(line),
+				ratingStars(t.Rating))
+		}
+		// Skip and speed are offered once the backend playing recordings supports them (mpv).
+		playback := "p <n> play, s stop, "
+		if _, ok := BaseBackend(backend).(go101SeekBackend); ok {
+			playback += "< > skip 15s, "
+		}
+		if _, ok := BaseBackend(backend).(go101SpeedBackend); ok {
+			playback += "x <speed> speed, "
+		}
+		fmt.Print("\n/<words> search, " + playback + "r <n> <0-5> rate, d <n> delete, e <n|all> <dir> export, n/b page, q quit: ")
+		line, err := reader.ReadString('\n')
+		fields := strings.Fields(line)
+		if err != nil && len(fields) == 0 {
+			fmt.Println()
+			return
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		// Returns track by its number in the list.
+		pick := func() (int, bool) {
+			if len(fields) < 2 {
+				fmt.Println("Track number is missing.")
+				return 0, false
+			}
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 || n > len(tracks) {
+				fmt.Println("Wrong track number: ", fields[1])
+				return 0, false
+			}
+			return n - 1, true
+		}
+		// Updates the track in the whole list too, filtered one is a copy.
+		update := func(t go101ArchiveTrack, removed bool) {
+			for i := range all {
+				if all[i].Path != t.Path {
+					continue
+				}
+				if removed {
+					all = append(all[:i], all[i+1:]...)
+				} else {
+					all[i] = t
+				}
+				break
+			}
+			tracks = filter()
+		}
+		switch cmd := fields[0]; {
+		case strings.HasPrefix(cmd, "/"):
+			query, page = strings.TrimSpace(strings.TrimSpace(line)[1:]), 0
+			tracks = filter()
+		case cmd == "n":
+			page++
+		case cmd == "b":
+			page--
+		case cmd == "q":
+			return
+		case cmd == "s":
+			if backend != nil {
+				backend.Stop()
+			}
+		case (cmd == "<" || cmd == ">" || cmd == "x") && backend == nil:
+			fmt.Println("Nothing is playing.")
+		case cmd == "<" || cmd == ">":
+			b, ok := BaseBackend(backend).(go101SeekBackend)
+			if !ok {
+				fmt.Println("Skip needs mpv audio backend, see \"audio_backend\" in \"101ply help config\".")
+				break
+			}
+			offset := ARCHIVE_SKIP
+			if cmd == "<" {
+				offset = -offset
+			}
+			if err = b.Seek(offset); err != nil {
+				log.Println("Couldn't skip: ", err.Error())
+			}
+		case cmd == "x":
+			b, ok := BaseBackend(backend).(go101SpeedBackend)
+			if !ok {
+				fmt.Println("Speed needs mpv audio backend, see \"audio_backend\" in \"101ply help config\".")
+				break
+			}
+			speed := 1.0
+			var perr error
+			if len(fields) > 1 {
+				speed, perr = strconv.ParseFloat(strings.TrimSuffix(fields[1], "x"), 64)
+			}
+			if perr != nil || speed < ARCHIVE_MIN_SPEED || speed > ARCHIVE_MAX_SPEED {
+				fmt.Printf("Speed should be %.1f to %.1f, ex: 1.25, 1.5, 2.\n", ARCHIVE_MIN_SPEED, ARCHIVE_MAX_SPEED)
+				break
+			}
+			if err = b.SetSpeed(speed); err != nil {
+				log.Println("Couldn't change speed: ", err.Error())
+				break
+			}
+			fmt.Printf("%s: %gx\n", Paint(theme.Info, "Speed"), speed)
+		case cmd == "p":
+			i, ok := pick()
+			if !ok {
+				break
+			}
+			if backend == nil {
+				if backend, err = NewBackend(p.Config.AudioBackend, p.Config); err != nil {
+					log.Printf("Couldn't start audio backend: %s, falling back to %s", err.Error(), BACKEND_MP3LIB)
+					backend, _ = NewBackend(BACKEND_MP3LIB, p.Config)
+				}
+			}
+			backend.Stop()
+			if err = backend.Play(tracks[i].Path); err != nil {
+				log.Println("Couldn't play recording: ", err.Error())
+				break
+			}
+			fmt.Printf("%s: %s\n", Paint(theme.Info, "Playing"), p.ConsoleText(tracks[i].Track.Artist+" - "+tracks[i].Track.Title))
+		case cmd == "r":
+			i, ok := pick()
+			if !ok {
+				break
+			}
+			rating := -1
+			if len(fields) > 2 {
+				rating, _ = strconv.Atoi(fields[2])
+			}
+			if err = p.RateRecording(tracks[i].Path, rating); err != nil {
+				fmt.Println(err.Error())
+				break
+			}
+			t := tracks[i]
+			t.Rating = rating
+			update(t, false)
+		case cmd == "d":
+			i, ok := pick()
+			if !ok {
+				break
+			}
+			t := tracks[i]
+			fmt.Printf("Delete %s? [y/N] ", p.ConsoleText(t.Path))
+			if answer, _ := reader.ReadString('\n'); strings.ToLower(strings.TrimSpace(answer)) != "y" {
+				break
+			}
+			if err = os.Remove(t.Path); err != nil && !os.IsNotExist(err) {
+				log.Println("Couldn't delete recording: ", err.Error())
+				break
+			}
+			if err = p.ForgetRecording(t.Path); err != nil {
+				log.Println("Couldn't delete recording: ", err.Error())
+			}
+			update(t, true)
+		case cmd == "e":
+			if len(fields) < 3 {
+				fmt.Println("Usage: e <n|all> <dir>")
+				break
+			}
+			export := tracks
+			if fields[1] != "all" {
+				i, ok := pick()
+				if !ok {
+					break
+				}
+				export = tracks[i : i+1]
+			}
+			dir := strings.Join(fields[2:], " ")
+			n := 0
+			for _, t := range export {
+				if _, err = exportRecording(t.Path, dir); err != nil {
+					log.Println("Couldn't export recording: ", err.Error())
+					break
+				}
+				n++
+			}
+			fmt.Printf("%d recordings exported to %s\n", n, dir)
+		default:
+			fmt.Println("Unknown command: ", cmd)
+		}
+	}
+}
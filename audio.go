@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mp3 "github.com/koykov/mp3lib"
+)
+
+const (
+	BACKEND_MP3LIB = "mp3lib"
+	BACKEND_ALSA   = "alsa"
+	// Needs build with "gstreamer" tag.
+	BACKEND_GSTREAMER = "gstreamer"
+	// Time given to the audio process to confirm stop or exit before it's killed.
+	ALSA_STOP_TIMEOUT = 2 * time.Second
+)
+
+// Audio backends built into the binary.
+var audioBackends = []string{BACKEND_MP3LIB, BACKEND_ALSA, BACKEND_MPV}
+
+// Audio output backend.
+type go101Backend interface {
+	// Starts playing the URL, previous stream should be stopped before.
+	Play(url string) error
+	Mute()
+	Unmute()
+	Stop()
+	// Releases backend resources on exit.
+	Close()
+}
+
+// Constructors of backends enabled by build tags.
+var taggedBackends = map[string]func(config *go101Config) (go101Backend, error){}
+
+// Backend with own volume control, used instead of the system mixer.
+type go101VolumeBackend interface {
+	Volume() (int, error)
+	SetVolume(percent int) error
+}
+
+// Backend with own equalizer, used by gain profiles.
+type go101EqualizerBackend interface {
+	// Sets bass and treble gain in dB, zero gains turn the equalizer off.
+	SetEqualizer(bass, treble float64) error
+}
+
+// Backend able to seek in local files.
+type go101SeekBackend interface {
+	Seek(offset time.Duration) error
+}
+
+// Backend able to change playback speed of local files keeping the pitch.
+type go101SpeedBackend interface {
+	SetSpeed(speed float64) error
+}
+
+// Backend able to pause playback. Live streams are muted instead, local files are paused.
+type go101PauseBackend interface {
+	SetPaused(paused bool) error
+}
+
+// Backend reporting playback progress, watched by the watchdog.
+type go101ProgressBackend interface {
+	// Returns counter changing while audio is consumed, ex: decoded frames or playback time.
+	Progress() (uint64, error)
+}
+
+// Backend running external player process, which may hang.
+type go101RestartBackend interface {
+	// Kills the process, the next Play starts a fresh one.
+	Restart()
+}
+
+// Returns backend wrapped by stream proxy, if any.
+func BaseBackend(b go101Backend) go101Backend {
+	if buffered, ok := b.(*go101BufferedBackend); ok {
+		return buffered.go101Backend
+	}
+	return b
+}
+
+// Returns backend by name.
+func NewBackend(name string, config *go101Config) (go101Backend, error) {
+	switch name {
+	case BACKEND_MP3LIB, "":
+		return &go101Mp3libBackend{}, nil
+	case BACKEND_ALSA:
+		device := config.AlsaDevice
+		if device == "" {
+			device = "default"
+		}
+		return &go101AlsaBackend{Device: device}, nil
+	case BACKEND_MPV:
+		if _, err := exec.LookPath("mpv"); err != nil {
+			return nil, fmt.Errorf("mpv backend needs mpv installed: %s", err.Error())
+		}
+		return &go101MpvBackend{}, nil
+	default:
+		if newBackend, ok := taggedBackends[name]; ok {
+			return newBackend(config)
+		}
+		if name == BACKEND_GSTREAMER {
+			return nil, fmt.Errorf("audio backend %s isn't built in, build with -tags gstreamer", name)
+		}
+		return nil, fmt.Errorf("unknown audio backend %s", name)
+	}
+}
+
+// Default backend using mp3lib.
+type go101Mp3libBackend struct{}
+
+func (b *go101Mp3libBackend) Play(url string) error {
+	mp3.PlayProcess(url)
+	return nil
+}
+
+func (b *go101Mp3libBackend) Mute() {
+	mp3.MuteProcess()
+}
+
+func (b *go101Mp3libBackend) Unmute() {
+	mp3.UnmuteProcess()
+}
+
+func (b *go101Mp3libBackend) Stop() {
+	// Library owns the process and doesn't expose it, so call stop proc twice, just in case.
+	mp3.StopProcess()
+	mp3.StopProcess()
+}
+
+func (b *go101Mp3libBackend) Close() {
+	b.Stop()
+}
+
+// Backend writing directly to ALSA device via mpg123 in remote control mode. Doesn't need X or PulseAudio,
+// intended for headless boards like Raspberry Pi.
+type go101AlsaBackend struct {
+	Device string
+
+	mux   sync.Mutex
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	// Closed once the process exited.
+	exited chan struct{}
+	// Receives stop confirmation reported by mpg123.
+	stopped chan struct{}
+	playing bool
+	// Frame status lines reported by mpg123, atomic.
+	frames uint64
+}
+
+// Starts mpg123 process if it isn't running.
+func (b *go101AlsaBackend) start() error {
+	if b.cmd != nil {
+		return nil
+	}
+	cmd := exec.Command("mpg123", "-q", "-R", "-o", "alsa", "-a", b.Device)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("couldn't start mpg123: %s", err.Error())
+	}
+	Debug("mpg123 started, pid %d", cmd.Process.Pid)
+	exited, stopped := make(chan struct{}), make(chan struct{}, 1)
+	b.cmd, b.stdin, b.exited, b.stopped, b.playing = cmd, stdin, exited, stopped, false
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			// Frame status is reported for every decoded frame.
+			if strings.HasPrefix(scanner.Text(), "@F ") {
+				atomic.AddUint64(&b.frames, 1)
+				continue
+			}
+			// Playback status: 0 - stopped, 1 - paused, 2 - playing.
+			if scanner.Text() == "@P 0" {
+				select {
+				case stopped <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	go func() {
+		_ = cmd.Wait()
+		Debug("mpg123 (pid %d) exited", cmd.Process.Pid)
+		close(exited)
+		b.mux.Lock()
+		if b.cmd == cmd {
+			b.cmd, b.stdin, b.playing = nil, nil, false
+		}
+		b.mux.Unlock()
+	}()
+	return nil
+}
+
+// Kills hung process and waits for it, so the next stream starts in the fresh one. The lock must be held.
+func (b *go101AlsaBackend) kill() {
+	cmd, exited := b.cmd, b.exited
+	Debug("mpg123 (pid %d) doesn't respond, kill it", cmd.Process.Pid)
+	_ = cmd.Process.Kill()
+	<-exited
+	b.cmd, b.stdin, b.playing = nil, nil, false
+}
+
+// Sends remote control command to mpg123.
+func (b *go101AlsaBackend) send(command string) error {
+	if err := b.start(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(b.stdin, command)
+	return err
+}
+
+func (b *go101AlsaBackend) Play(url string) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.playing && b.cmd != nil {
+		return fmt.Errorf("previous stream of mpg123 (pid %d) isn't stopped", b.cmd.Process.Pid)
+	}
+	// Stale confirmation of the previous stream.
+	select {
+	case <-b.stopped:
+	default:
+	}
+	if err := b.send("LOAD " + url); err != nil {
+		return err
+	}
+	b.playing = true
+	return nil
+}
+
+// Returns number of frames decoded by mpg123.
+func (b *go101AlsaBackend) Progress() (uint64, error) {
+	return atomic.LoadUint64(&b.frames), nil
+}
+
+// Kills mpg123, the next stream starts in the fresh process.
+func (b *go101AlsaBackend) Restart() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.cmd != nil {
+		b.kill()
+	}
+}
+
+func (b *go101AlsaBackend) Mute() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	_ = b.send("VOLUME 0")
+}
+
+func (b *go101AlsaBackend) Unmute() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	_ = b.send("VOLUME 100")
+}
+
+// Stops stream and waits for mpg123 to confirm it, the process is killed otherwise.
+func (b *go101AlsaBackend) Stop() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.cmd == nil || !b.playing {
+		b.playing = false
+		return
+	}
+	if _, err := fmt.Fprintln(b.stdin, "STOP"); err == nil {
+		select {
+		case <-b.stopped:
+			b.playing = false
+			return
+		case <-b.exited:
+			b.playing = false
+			return
+		case <-time.After(ALSA_STOP_TIMEOUT):
+		}
+	}
+	b.kill()
+}
+
+func (b *go101AlsaBackend) Close() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.cmd == nil {
+		return
+	}
+	_, _ = fmt.Fprintln(b.stdin, "QUIT")
+	_ = b.stdin.Close()
+	select {
+	case <-b.exited:
+	case <-time.After(ALSA_STOP_TIMEOUT):
+		b.kill()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Fake mpg123 confirming STOP the way remote control mode does.
+const FAKE_MPG123 = `#!/bin/sh
+while read line; do
+	case "$line" in
+	STOP*) echo "@P 0" ;;
+	QUIT*) exit 0 ;;
+	esac
+done
+`
+
+func TestAlsaBackendRestart(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "mpg123"), []byte(FAKE_MPG123), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	b := &go101AlsaBackend{Device: "default"}
+	defer b.Close()
+
+	if err := b.Play("http://localhost/1"); err != nil {
+		t.Fatalf("couldn't play: %s", err.Error())
+	}
+	b.mux.Lock()
+	cmd, exited := b.cmd, b.exited
+	b.mux.Unlock()
+	// mpg123 dies on its own while playing.
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("mpg123 exit isn't noticed")
+	}
+	// Exit is handled once the process is forgotten.
+	for i := 0; ; i++ {
+		b.mux.Lock()
+		gone := b.cmd == nil
+		b.mux.Unlock()
+		if gone {
+			break
+		}
+		if i == 100 {
+			t.Fatal("dead mpg123 isn't forgotten")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.Stop()
+	if err := b.Play("http://localhost/2"); err != nil {
+		t.Fatalf("couldn't play after mpg123 exit: %s", err.Error())
+	}
+	b.mux.Lock()
+	restarted := b.cmd != nil && b.cmd != cmd
+	b.mux.Unlock()
+	if !restarted {
+		t.Error("mpg123 isn't started again")
+	}
+	b.Stop()
+	b.mux.Lock()
+	playing := b.playing
+	b.mux.Unlock()
+	if playing {
+		t.Error("stream isn't stopped")
+	}
+}
+
+func TestAlsaBackendKilledPlay(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "mpg123"), []byte(FAKE_MPG123), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	b := &go101AlsaBackend{Device: "default"}
+	defer b.Close()
+
+	if err := b.Play("http://localhost/1"); err != nil {
+		t.Fatalf("couldn't play: %s", err.Error())
+	}
+	b.mux.Lock()
+	exited := b.exited
+	_ = b.cmd.Process.Kill()
+	b.mux.Unlock()
+	<-exited
+	// Play right after the exit, without Stop, mustn't touch the dead process.
+	for i := 0; i < 100; i++ {
+		if err := b.Play("http://localhost/2"); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("couldn't play after mpg123 was killed")
+}
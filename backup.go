@@ -0,0 +1,282 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const BACKUP_VERSION = 1
+
+// Database table included into user data bundle.
+type go101BackupTable struct {
+	Name    string
+	Columns []string
+}
+
+// User data tables, channel lists aren't included since they are fetched from the provider.
+var backupTables = []go101BackupTable{
+	{"favorites", []string{"channel_id", "position"}},
+	{"aliases", []string{"alias", "channel_id"}},
+	{"hidden", []string{"kind", "id"}},
+	{"pinned_groups", []string{"group_id", "position"}},
+	{"recordings", []string{"track_uid", "hash", "path", "recorded_at"}},
+	{"ratings", []string{"path", "rating"}},
+	{"followed_artists", []string{"artist"}},
+	{"bookmarks", []string{"channel_id", "track_uid", "artist", "title", "album", "created_at", "note"}},
+	{"history", []string{"channel_id", "track_uid", "artist", "title", "album", "started_at", "played_at"}},
+}
+
+// Bundle description, stored as manifest.json.
+type go101BackupManifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Tables  []string  `json:"tables"`
+}
+
+// Writes user data (database tables and configuration files) to tar.gz bundle.
+func (p *go101) ExportData(w io.Writer, history bool) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := go101BackupManifest{Version: BACKUP_VERSION, Created: time.Now()}
+	for _, t := range backupTables {
+		if t.Name == "history" && !history {
+			continue
+		}
+		rows, err := p.exportTable(t)
+		if err != nil {
+			return fmt.Errorf("couldn't export %s: %s", t.Name, err.Error())
+		}
+		raw, _ := json.Marshal(rows)
+		if err = writeTarFile(tw, "data/"+t.Name+".json", raw); err != nil {
+			return err
+		}
+		manifest.Tables = append(manifest.Tables, t.Name)
+	}
+	files := []string{GetConfigFile(), GetHotkeyConfig()}
+	if profiles, err := filepath.Glob(GetProfilesDir() + string(os.PathSeparator) + "*.json"); err == nil {
+		files = append(files, profiles...)
+	}
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(GetConfigDir(), file)
+		if err = writeTarFile(tw, "config/"+filepath.ToSlash(rel), raw); err != nil {
+			return err
+		}
+	}
+	raw, _ := json.MarshalIndent(manifest, "", "\t")
+	if err := writeTarFile(tw, "manifest.json", raw); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Reads all rows of the table.
+func (p *go101) exportTable(t go101BackupTable) ([][]interface{}, error) {
+	rows, err := p.DB.Query(`SELECT ` + strings.Join(t.Columns, ", ") + ` FROM ` + t.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	result := make([][]interface{}, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(t.Columns))
+		ptrs := make([]interface{}, len(t.Columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result = append(result, values)
+	}
+	return result, rows.Err()
+}
+
+// Adds file to the tar archive.
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Reads user data bundle made by ExportData. Database rows are merged into existing data, configuration files
+// are replaced (previous ones are kept with .bak suffix) unless withConfig is false.
+func (p *go101) ImportData(r io.Reader, withConfig bool) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("couldn't read bundle: %s", err.Error())
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read bundle: %s", err.Error())
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		raw, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		files[path.Clean(hdr.Name)] = raw
+	}
+	manifest := go101BackupManifest{}
+	if err = json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		return fmt.Errorf("not a 101ply bundle: %s", err.Error())
+	}
+	if manifest.Version > BACKUP_VERSION {
+		return fmt.Errorf("bundle version %d isn't supported, upgrade 101ply", manifest.Version)
+	}
+	for _, t := range backupTables {
+		raw, ok := files["data/"+t.Name+".json"]
+		if !ok {
+			continue
+		}
+		n, err := p.importTable(t, raw)
+		if err != nil {
+			return fmt.Errorf("couldn't import %s: %s", t.Name, err.Error())
+		}
+		Debug("Imported %d rows of %s", n, t.Name)
+	}
+	if !withConfig {
+		return nil
+	}
+	for name, raw := range files {
+		if !strings.HasPrefix(name, "config/") || !strings.HasSuffix(name, ".json") || strings.Contains(name, "..") {
+			continue
+		}
+		file := GetConfigDir() + string(os.PathSeparator) + filepath.FromSlash(strings.TrimPrefix(name, "config/"))
+		if err = os.MkdirAll(filepath.Dir(file), PRIVATE_DIR_PERM); err != nil {
+			return err
+		}
+		if _, err = os.Stat(file); err == nil {
+			if err = os.Rename(file, file+".bak"); err != nil {
+				return err
+			}
+		}
+		if err = WriteFileAtomic(file, raw, PRIVATE_FILE_PERM); err != nil {
+			return err
+		}
+		Debug("Imported %s", file)
+	}
+	return nil
+}
+
+// Merges exported rows into the table, rows with the same key are replaced.
+func (p *go101) importTable(t go101BackupTable, raw []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	// Keep integers exact.
+	dec.UseNumber()
+	rows := make([][]interface{}, 0)
+	if err := dec.Decode(&rows); err != nil {
+		return 0, err
+	}
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	query := `INSERT OR REPLACE INTO ` + t.Name + ` (` + strings.Join(t.Columns, ", ") + `) VALUES (?` +
+		strings.Repeat(", ?", len(t.Columns)-1) + `)`
+	for _, row := range rows {
+		if len(row) != len(t.Columns) {
+			_ = tx.Rollback()
+			return 0, fmt.Errorf("wrong row %v", row)
+		}
+		for i, v := range row {
+			if n, ok := v.(json.Number); ok {
+				row[i] = n.String()
+			}
+		}
+		if _, err = tx.Exec(query, row...); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+	return len(rows), tx.Commit()
+}
+
+// Export user data to tar.gz bundle.
+func CmdExportData(args []string) {
+	fs := flag.NewFlagSet("export-data", flag.ExitOnError)
+	noHistory := fs.Bool("no-history", false, "Don't include listening history.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: export-data [-no-history] <file.tar.gz|->")
+	}
+	w := os.Stdout
+	if fs.Arg(0) != "-" {
+		// Bundle has history and config, private like the originals.
+		f, err := os.OpenFile(fs.Arg(0), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, PRIVATE_FILE_PERM)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+	if err := go101o.ExportData(w, !*noHistory); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Import user data from tar.gz bundle.
+func CmdImportData(args []string) {
+	fs := flag.NewFlagSet("import-data", flag.ExitOnError)
+	noConfig := fs.Bool("no-config", false, "Import database only, keep configuration files.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: import-data [-no-config] <file.tar.gz|->")
+	}
+	r := os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		r = f
+	}
+	if err := go101o.ImportData(r, !*noConfig); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	BIGFONT_HEIGHT = 5
+	BIGFONT_WIDTH  = 5
+)
+
+// Block font 5x5, '#' marks lit pixel. Used by car-mode display and pixel displays.
+var bigFont = map[rune][BIGFONT_HEIGHT]string{
+	'A':  {" ### ", "#   #", "#####", "#   #", "#   #"},
+	'B':  {"#### ", "#   #", "#### ", "#   #", "#### "},
+	'C':  {" ####", "#    ", "#    ", "#    ", " ####"},
+	'D':  {"#### ", "#   #", "#   #", "#   #", "#### "},
+	'E':  {"#####", "#    ", "#### ", "#    ", "#####"},
+	'F':  {"#####", "#    ", "#### ", "#    ", "#    "},
+	'G':  {" ####", "#    ", "#  ##", "#   #", " ####"},
+	'H':  {"#   #", "#   #", "#####", "#   #", "#   #"},
+	'I':  {"#####", "  #  ", "  #  ", "  #  ", "#####"},
+	'J':  {"#####", "   # ", "   # ", "#  # ", " ##  "},
+	'K':  {"#   #", "#  # ", "###  ", "#  # ", "#   #"},
+	'L':  {"#    ", "#    ", "#    ", "#    ", "#####"},
+	'M':  {"#   #", "## ##", "# # #", "#   #", "#   #"},
+	'N':  {"#   #", "##  #", "# # #", "#  ##", "#   #"},
+	'O':  {" ### ", "#   #", "#   #", "#   #", " ### "},
+	'P':  {"#### ", "#   #", "#### ", "#    ", "#    "},
+	'Q':  {" ### ", "#   #", "# # #", "#  # ", " ## #"},
+	'R':  {"#### ", "#   #", "#### ", "#  # ", "#   #"},
+	'S':  {" ####", "#    ", " ### ", "    #", "#### "},
+	'T':  {"#####", "  #  ", "  #  ", "  #  ", "  #  "},
+	'U':  {"#   #", "#   #", "#   #", "#   #", " ### "},
+	'V':  {"#   #", "#   #", "#   #", " # # ", "  #  "},
+	'W':  {"#   #", "#   #", "# # #", "## ##", "#   #"},
+	'X':  {"#   #", " # # ", "  #  ", " # # ", "#   #"},
+	'Y':  {"#   #", " # # ", "  #  ", "  #  ", "  #  "},
+	'Z':  {"#####", "   # ", "  #  ", " #   ", "#####"},
+	'0':  {" ### ", "#  ##", "# # #", "##  #", " ### "},
+	'1':  {"  #  ", " ##  ", "  #  ", "  #  ", " ### "},
+	'2':  {" ### ", "#   #", "  ## ", " #   ", "#####"},
+	'3':  {"#### ", "    #", " ### ", "    #", "#### "},
+	'4':  {"#   #", "#   #", "#####", "    #", "    #"},
+	'5':  {"#####", "#    ", "#### ", "    #", "#### "},
+	'6':  {" ### ", "#    ", "#### ", "#   #", " ### "},
+	'7':  {"#####", "    #", "   # ", "  #  ", "  #  "},
+	'8':  {" ### ", "#   #", " ### ", "#   #", " ### "},
+	'9':  {" ### ", "#   #", " ####", "    #", " ### "},
+	' ':  {"     ", "     ", "     ", "     ", "     "},
+	'-':  {"     ", "     ", " ### ", "     ", "     "},
+	'.':  {"     ", "     ", "     ", "     ", "  #  "},
+	',':  {"     ", "     ", "     ", "  #  ", " #   "},
+	'\'': {"  #  ", "  #  ", "     ", "     ", "     "},
+	'!':  {"  #  ", "  #  ", "  #  ", "     ", "  #  "},
+	'?':  {" ### ", "#   #", "  ## ", "     ", "  #  "},
+	'&':  {" ##  ", "#  # ", " ## #", "#  # ", " ## #"},
+	':':  {"     ", "  #  ", "     ", "  #  ", "     "},
+	'(':  {"   # ", "  #  ", "  #  ", "  #  ", "   # "},
+	')':  {" #   ", "  #  ", "  #  ", "  #  ", " #   "},
+	'/':  {"    #", "   # ", "  #  ", " #   ", "#    "},
+}
+
+// Rough Cyrillic to Latin mapping, the block font has Latin glyphs only.
+var bigFontCyrillic = map[rune]string{
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Е': "E", 'Ё': "E", 'Ж': "ZH", 'З': "Z", 'И': "I",
+	'Й': "Y", 'К': "K", 'Л': "L", 'М': "M", 'Н': "N", 'О': "O", 'П': "P", 'Р': "R", 'С': "S", 'Т': "T",
+	'У': "U", 'Ф': "F", 'Х': "H", 'Ц': "TS", 'Ч': "CH", 'Ш': "SH", 'Щ': "SCH", 'Ъ': "", 'Ы': "Y", 'Ь': "",
+	'Э': "E", 'Ю': "YU", 'Я': "YA",
+}
+
+// Converts text to characters available in the block font.
+func BigFontText(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if _, ok := bigFont[r]; ok {
+			b.WriteRune(r)
+		} else if l, ok := bigFontCyrillic[r]; ok {
+			b.WriteString(l)
+		} else if unicode.IsSpace(r) {
+			b.WriteRune(' ')
+		} else {
+			b.WriteRune('?')
+		}
+	}
+	return b.String()
+}
+
+// Returns glyph of the character, text should be converted using BigFontText().
+func BigGlyph(r rune) [BIGFONT_HEIGHT]string {
+	if g, ok := bigFont[r]; ok {
+		return g
+	}
+	return bigFont['?']
+}
+
+// Renders text using block font, pixel drawn with given string.
+// Text is wrapped by words to fit given width in terminal columns.
+func RenderBig(s string, width int, pixel string) []string {
+	perLine := width / (BIGFONT_WIDTH + 1)
+	if perLine < 1 {
+		perLine = 1
+	}
+	lines := make([]string, 0)
+	for _, chunk := range wrapWords(BigFontText(s), perLine) {
+		rows := make([]string, BIGFONT_HEIGHT)
+		for _, r := range chunk {
+			g := BigGlyph(r)
+			for i := 0; i < BIGFONT_HEIGHT; i++ {
+				rows[i] += strings.Replace(g[i], "#", pixel, -1) + " "
+			}
+		}
+		lines = append(lines, rows...)
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// Splits text to lines of at most n characters, breaking by words when possible.
+func wrapWords(s string, n int) []string {
+	lines := make([]string, 0)
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for len([]rune(word)) > n {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, string([]rune(word)[:n]))
+			word = string([]rune(word)[n:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= n:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
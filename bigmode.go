@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Actions allowed in car mode.
+var bigModeActions = map[string]bool{
+	ACTION_PAUSE: true,
+	ACTION_STOP:  true,
+	ACTION_NEXT:  true,
+	ACTION_PREV:  true,
+	"":           true,
+}
+
+// Returns terminal width, 80 if unknown.
+func TerminalWidth() int {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 {
+		return 80
+	}
+	return int(ws.Col)
+}
+
+// Clears the screen and draws channel, artist and title in block letters.
+func (p *go101) RenderBigScreen() {
+	width := TerminalWidth()
+	channel, track := p.Channel(), p.Track()
+	lines := make([]string, 0)
+	lines = append(lines, RenderBig(p.ConsoleText(track.Artist), width, "█")...)
+	lines = append(lines, RenderBig(p.ConsoleText(track.Title), width, "█")...)
+	lines = append(lines, RenderBig(p.ConsoleText(channel.Title), width, "▒")...)
+	lines = append(lines, "", p.BigFooter(width))
+	fmt.Print("\033[H\033[2J")
+	fmt.Print(strings.Join(lines, "\n"))
+}
+
+// Returns footer line of the big screen: clock, remaining time and session stats.
+func (p *go101) BigFooter(width int) string {
+	d := p.TemplateData()
+	return Truncate(d.Clock+" · "+d.Remaining+" left · "+stats.Snapshot().String(), width)
+}
+
+// Keeps footer of the big screen up to date, rewriting the last line in place. Runs forever.
+func (p *go101) BigFooterLoop() {
+	for true {
+		time.Sleep(STATUS_LINE_INTERVAL)
+		if p.Status() != STATUS_STOP && !p.Previewing() && !p.Replaying() {
+			fmt.Print("\r" + p.BigFooter(TerminalWidth()) + "\033[K")
+		}
+	}
+}
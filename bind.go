@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+)
+
+// Time to wait for the key press in bind command.
+const BIND_TIMEOUT = 15 * time.Second
+
+// Grabs keyboard until non-modifier key is pressed, returns it in hotkey format (ex: control-shift-p, mod4-F5).
+func CaptureKey(X *xgbutil.XUtil) (string, error) {
+	if err := keybind.GrabKeyboard(X, X.RootWin()); err != nil {
+		return "", err
+	}
+	defer keybind.UngrabKeyboard(X)
+	for {
+		ev, err := X.Conn().WaitForEvent()
+		if ev == nil && err == nil {
+			return "", fmt.Errorf("X connection closed")
+		}
+		if err != nil {
+			Debug("X error: %s", err)
+			continue
+		}
+		press, ok := ev.(xproto.KeyPressEvent)
+		if !ok || keybind.ModGet(X, press.Detail) != 0 {
+			// Modifier alone, wait for the key pressed with it.
+			continue
+		}
+		// Lock and num lock are ignored by hotkeys anyway.
+		mods, kc := keybind.DeduceKeyInfo(press.State, press.Detail)
+		name := keybind.KeysymToStr(keybind.KeysymGet(X, kc, 0))
+		if name == "" || !hasKeycode(keybind.StrToKeycodes(X, name), kc) {
+			return "", fmt.Errorf("key with code %d has no keysym name usable for hotkey", kc)
+		}
+		if m := keybind.ModifierString(mods); m != "" {
+			name = m + "-" + name
+		}
+		return name, nil
+	}
+}
+
+func hasKeycode(kcs []xproto.Keycode, kc xproto.Keycode) bool {
+	for _, k := range kcs {
+		if k == kc {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns description of the action, empty for unknown one.
+func ActionDesc(action string) string {
+	for _, a := range actions {
+		if a.Name == action {
+			return a.Desc
+		}
+	}
+	return ""
+}
+
+// Binds the key pressed next to the action in hotkey config.
+func CmdBind(args []string) {
+	fs := flag.NewFlagSet("bind", flag.ExitOnError)
+	desc := fs.String("desc", "", "Hotkey description, action description by default.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: bind [-desc text] <action>")
+	}
+	action := fs.Arg(0)
+	if !KnownAction(action) {
+		log.Fatalf("Unknown action %s, see \"101ply help actions\"", action)
+	}
+	if *desc == "" {
+		*desc = ActionDesc(action)
+	}
+	X, err := xgbutil.NewConn()
+	if err != nil {
+		log.Fatal("Couldn't connect to X: ", err.Error())
+	}
+	defer X.Conn().Close()
+	keybind.Initialize(X)
+
+	fmt.Printf("Press key for %s (with modifiers if needed)...\n", Paint(theme.Info, action))
+	captured := make(chan error, 1)
+	var key string
+	go func() {
+		var err error
+		key, err = CaptureKey(X)
+		captured <- err
+	}()
+	select {
+	case err = <-captured:
+		if err != nil {
+			log.Fatal(err)
+		}
+	case <-time.After(BIND_TIMEOUT):
+		keybind.UngrabKeyboard(X)
+		log.Fatal("No key pressed.")
+	}
+	fmt.Printf("Key: %s\n", Paint(theme.Info, key))
+
+	file := GetHotkeyConfig()
+	hotkeys := []Hotkey{}
+	raw, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+	if err == nil {
+		if err = json.Unmarshal(raw, &hotkeys); err != nil {
+			log.Fatalf("Couldn't parse %s: %s", file, err.Error())
+		}
+	}
+	hotkey := Hotkey{Key: key, Action: action, Desc: *desc}
+	replaced := false
+	for i, h := range hotkeys {
+		if strings.EqualFold(h.Key, key) {
+			was := h.Action
+			if len(h.Chord) > 0 {
+				was = "chord"
+			}
+			fmt.Printf("Replaced binding of %s: %s\n", key, was)
+			hotkeys[i], replaced = hotkey, true
+		}
+	}
+	if !replaced {
+		hotkeys = append(hotkeys, hotkey)
+	}
+	raw, _ = json.MarshalIndent(hotkeys, "", "\t")
+	if err = WriteFileAtomic(file, append(raw, '\n'), PRIVATE_FILE_PERM); err != nil {
+		log.Fatal("Error when saving file: ", err.Error())
+	}
+	// Running player reloads the file itself.
+	fmt.Printf("Saved to %s\n", file)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bookmarked moment of live radio.
+type go101Bookmark struct {
+	Id        int64
+	ChannelId uint64
+	Track     go101TrackInfo
+	CreatedAt time.Time
+	Note      string
+}
+
+// Bookmarks current channel, track and time, returns bookmark ID.
+func (p *go101) Bookmark(note string) (int64, error) {
+	track, cid := p.Track(), p.ChannelId()
+	now := time.Now().Unix()
+	// Repeated bookmark of the same second is the same moment, it just gets the note.
+	if _, err := p.DB.Exec(`INSERT INTO bookmarks (channel_id, track_uid, artist, title, album, created_at, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (channel_id, created_at) DO UPDATE SET note = excluded.note
+		WHERE excluded.note != ''`,
+		cid, track.TrackUid, track.Artist, track.Title, track.Album, now, note); err != nil {
+		return 0, err
+	}
+	var id int64
+	if err := p.DB.QueryRow(`SELECT id FROM bookmarks WHERE channel_id = ? AND created_at = ?`,
+		cid, now).Scan(&id); err != nil {
+		return 0, err
+	}
+	message := fmt.Sprintf("#%d %s - %s", id, track.Artist, track.Title)
+	if note != "" {
+		message += ": " + note
+	}
+	fmt.Printf("\n%s: %s\n", Paint(theme.Info, "Bookmark"), p.ConsoleText(message))
+	return id, nil
+}
+
+// Returns last bookmarks, newest first.
+func (p *go101) Bookmarks(limit int) ([]go101Bookmark, error) {
+	rows, err := p.DB.Query(`SELECT id, channel_id, track_uid, artist, title, album, created_at, note FROM bookmarks
+		ORDER BY created_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	bookmarks := make([]go101Bookmark, 0)
+	for rows.Next() {
+		var (
+			b       go101Bookmark
+			created int64
+		)
+		if err = rows.Scan(&b.Id, &b.ChannelId, &b.Track.TrackUid, &b.Track.Artist, &b.Track.Title, &b.Track.Album,
+			&created, &b.Note); err != nil {
+			return nil, err
+		}
+		b.CreatedAt = time.Unix(created, 0)
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+// Sets note of the bookmark.
+func (p *go101) SetBookmarkNote(id int64, note string) error {
+	res, err := p.DB.Exec(`UPDATE bookmarks SET note = ? WHERE id = ?`, note, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("bookmark %d not found", id)
+	}
+	return nil
+}
+
+func (p *go101) RemoveBookmark(id int64) error {
+	_, err := p.DB.Exec(`DELETE FROM bookmarks WHERE id = ?`, id)
+	return err
+}
+
+// Bookmark the current moment of the running player.
+func CmdBookmark(args []string) {
+	CmdCtl(append([]string{ACTION_BOOKMARK}, args...))
+}
+
+// List bookmarks, edit their notes or remove them.
+func CmdBookmarks(args []string) {
+	fs := flag.NewFlagSet("bookmarks", flag.ExitOnError)
+	limit := fs.Int("n", 50, "Max number of bookmarks.")
+	rm := fs.Bool("rm", false, "Remove bookmark by ID.")
+	note := fs.Bool("note", false, "Set note of bookmark: -note <id> <text>.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if *rm || *note {
+		if fs.NArg() == 0 {
+			log.Fatal("Usage: bookmarks -rm <id> | -note <id> <text>")
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(fs.Arg(0), "#"), 10, 64)
+		if err != nil {
+			log.Fatal("Wrong bookmark ID ", fs.Arg(0))
+		}
+		if *rm {
+			err = go101o.RemoveBookmark(id)
+		} else {
+			err = go101o.SetBookmarkNote(id, strings.Join(fs.Args()[1:], " "))
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	bookmarks, err := go101o.Bookmarks(*limit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(bookmarks) == 0 {
+		fmt.Println("No bookmarks yet, bind \"bookmark\" action to a hotkey or run \"101ply bookmark [note]\".")
+		return
+	}
+	go101o.LoadChannelGroups()
+	for _, b := range bookmarks {
+		channel := fmt.Sprintf("channel %d", b.ChannelId)
+		if c, ok := go101o.ChannelGroups[go101o.ChannelGroup(b.ChannelId)].Channels[b.ChannelId]; ok {
+			channel = c.Title
+		}
+		line := fmt.Sprintf("%s - %s [%s]", b.Track.Artist, b.Track.Title, channel)
+		fmt.Printf("#%d %s %s\n", b.Id, FormatDateTime(b.CreatedAt), go101o.ConsoleText(line))
+		if b.Note != "" {
+			fmt.Printf("        %s\n", b.Note)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DEFAULT_CACHE_LIMIT_MB = 500
+
+// Returns directories with cached files which may be evicted any time.
+func EvictableCacheDirs() []string {
+	return []string{GetTrackCacheDir(), GetHttpCacheDir()}
+}
+
+// Cached file.
+type go101CacheFile struct {
+	Path string
+	Size int64
+	// Last use, files are touched on read.
+	Used time.Time
+}
+
+// Returns files of the evictable cache directories.
+func CacheFiles() []go101CacheFile {
+	files := make([]go101CacheFile, 0)
+	for _, dir := range EvictableCacheDirs() {
+		_ = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				files = append(files, go101CacheFile{path, fi.Size(), fi.ModTime()})
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// Marks cached file as recently used, so LRU eviction keeps it.
+func TouchCacheFile(filename string) {
+	now := time.Now()
+	_ = os.Chtimes(filename, now, now)
+}
+
+// Removes least recently used files of the evictable cache directories exceeding the cache size limit.
+func (p *go101) TrimCache() {
+	limit := int64(p.Config.CacheLimitMb)
+	if limit <= 0 {
+		limit = DEFAULT_CACHE_LIMIT_MB
+	}
+	n, freed := EvictCache(limit * 1024 * 1024)
+	if n > 0 {
+		Debug("Cache trimmed, %d files (%d KB) removed", n, freed/1024)
+	}
+}
+
+// Removes least recently used cached files until total size fits the limit. Returns number of removed files
+// and freed bytes.
+func EvictCache(limit int64) (int, int64) {
+	files := CacheFiles()
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Used.After(files[j].Used)
+	})
+	var (
+		total, freed int64
+		n            int
+	)
+	for _, f := range files {
+		total += f.Size
+		if total > limit {
+			if err := os.Remove(f.Path); err == nil {
+				n++
+				freed += f.Size
+			}
+		}
+	}
+	return n, freed
+}
+
+// Writes gzipped data to filename.gz atomically.
+func WriteCacheFile(filename string, data []byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return WriteFileAtomic(filename+".gz", buf.Bytes(), PRIVATE_FILE_PERM)
+}
+
+// Reads file written by WriteCacheFile, falls back to uncompressed file.
+func ReadCacheFile(filename string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(filename + ".gz")
+	if err != nil {
+		return ioutil.ReadFile(filename)
+	}
+	TouchCacheFile(filename + ".gz")
+	gz, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = gz.Close()
+	}()
+	return ioutil.ReadAll(gz)
+}
+
+// Compresses file to filename.gz and removes the original.
+func CompressFile(filename string) error {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err = WriteCacheFile(filename, raw); err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// Show cache usage or clean the cache.
+func CmdCache(args []string) {
+	if len(args) == 0 || args[0] == "stats" {
+		cacheStats()
+		return
+	}
+	if args[0] != "clean" {
+		log.Fatal("Usage: cache stats|clean [-all]")
+	}
+	fs := flag.NewFlagSet("cache clean", flag.ExitOnError)
+	all := fs.Bool("all", false, "Remove all evictable files, not only ones exceeding the limit.")
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	limit := int64(go101o.Config.CacheLimitMb)
+	if limit <= 0 {
+		limit = DEFAULT_CACHE_LIMIT_MB
+	}
+	limit *= 1024 * 1024
+	if *all {
+		limit = 0
+	}
+	n, freed := EvictCache(limit)
+	fmt.Printf("%d files removed, %s freed\n", n, FormatSize(freed))
+}
+
+// Prints size of the cache directory entries.
+func cacheStats() {
+	entries, err := ioutil.ReadDir(GetCacheDir())
+	if err != nil {
+		log.Fatal(err)
+	}
+	evictable := make(map[string]bool)
+	for _, dir := range EvictableCacheDirs() {
+		evictable[dir] = true
+	}
+	var total int64
+	for _, e := range entries {
+		path := GetCacheDir() + string(os.PathSeparator) + e.Name()
+		var size, count int64
+		_ = filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				size += fi.Size()
+				count++
+			}
+			return nil
+		})
+		total += size
+		name := e.Name()
+		if e.IsDir() {
+			name += string(os.PathSeparator)
+		}
+		note := ""
+		if evictable[path] {
+			note = " (evictable)"
+		}
+		fmt.Printf("%-24s %6d files %10s%s\n", name, count, FormatSize(size), note)
+	}
+	limit := go101o.Config.CacheLimitMb
+	if limit <= 0 {
+		limit = DEFAULT_CACHE_LIMIT_MB
+	}
+	fmt.Printf("%s\ntotal %s, evictable files limit %d MB\n", strings.Repeat("-", 50), FormatSize(total), limit)
+}
+
+// Formats size in bytes for humans.
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/1024/1024)
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// Switches playback to the channel. Main loop picks the change up immediately.
+func (p *go101) SwitchChannel(cid uint64) {
+	if p.Profile.ChannelRestricted(cid) {
+		Debug("Channel %d is restricted", cid)
+		return
+	}
+	p.Exec(func() {
+		p.switchChannel(cid)
+	})
+	p.Scheduler.Wake()
+}
+
+// Switches the channel, called by the fetch loop.
+func (p *go101) switchChannel(cid uint64) {
+	p.setChannel(cid)
+	p.ApplyGainProfile()
+	if !p.BigMode {
+		fmt.Printf("\nPlayng: %s\n", Paint(theme.Channel, p.ChannelGroups[p.CurrentGroup].Channels[cid].Title))
+	}
+	p.Emit(EVENT_CHANNEL)
+}
+
+// Switches to the favorite channel at position (starting from 1).
+func (p *go101) PlayFavorite(pos int) {
+	favorites, err := p.Favorites()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if pos < 1 || pos > len(favorites) {
+		Debug("No favorite channel at position %d", pos)
+		return
+	}
+	p.setFavoriteCursor(pos)
+	p.SwitchChannel(favorites[pos-1])
+}
+
+// Switches to the favorite channel after the last one switched to, cycling over the list.
+func (p *go101) NextFavorite() {
+	favorites, err := p.Favorites()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(favorites) == 0 {
+		Debug("No favorite channels")
+		return
+	}
+	p.PlayFavorite(p.FavoriteCursor()%len(favorites) + 1)
+}
+
+// Switches to the next (step > 0) or previous (step < 0) channel of the current group.
+func (p *go101) StepChannel(step int) {
+	p.Exec(func() {
+		// Target is found by the loop, so steps requested in a row add up.
+		if cid, ok := p.StepTarget(p.CurrentChannel, step); ok {
+			p.switchChannel(cid)
+		}
+	})
+	p.Scheduler.Wake()
+}
+
+// Returns channel of the group that is step channels away from the given one, skipping restricted ones.
+// Returns false if all channels of the group are restricted.
+func (p *go101) StepTarget(cid uint64, step int) (uint64, bool) {
+	channels := make([]go101Channel, 0)
+	for _, c := range p.ChannelGroups[p.ChannelGroup(cid)].SortedChannels() {
+		if !p.Profile.ChannelRestricted(c.Id) {
+			channels = append(channels, c)
+		}
+	}
+	if len(channels) == 0 {
+		return 0, false
+	}
+	pos := 0
+	for i, c := range channels {
+		if c.Id == cid {
+			pos = i
+		}
+	}
+	pos = (pos + step + len(channels)) % len(channels)
+	return channels[pos].Id, true
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CLI subcommand, given as first positional argument (ex: 101ply list --long).
+type go101Command struct {
+	Name string
+	Desc string
+	Run  func(args []string)
+}
+
+var commands []go101Command
+
+func init() {
+	commands = []go101Command{
+		{"list", "List channel groups and channels.", CmdList},
+		{"refresh", "Refresh all groups or the single group given by ID.", CmdRefresh},
+		{"alias", "Set alias of the channel (alias <name> <channel>) or remove it (alias -rm <name>).", CmdAlias},
+		{"fav", "Manage favorite channels (fav list|add <channel>|rm <channel>).", CmdFav},
+		{"hide", "Hide channel or group from the picker (hide [-rm] [-group] <id>).", CmdHide},
+		{"pin", "Pin group to the top of the picker or move it (pin [-rm] <group> [position]), list pinned groups without arguments.", CmdPin},
+		{"ctl", "Send action to the running player (ctl pause|next|prev|replay|...|status|version|profile [name]|hotkeys [on|off]|channel [id]|volume [N]|rotation [on|off]).", CmdCtl},
+		{"bind", "Bind the key pressed next to the action in hotkey config (bind [-desc text] <action>).", CmdBind},
+		{"replay", "Replay previous track in the running player.", CmdReplay},
+		{"now", "Print track playing by the running player (now [-tmux] [-max N]).", CmdNow},
+		{"status", "Print status of the running player, with session stats (status [-long]).", CmdStatus},
+		{"bookmark", "Bookmark current moment of the running player with optional note (bookmark [note]).", CmdBookmark},
+		{"bookmarks", "List bookmarks (bookmarks [-n N]), set note (bookmarks -note <id> <text>) or remove (bookmarks -rm <id>).", CmdBookmarks},
+		{"calibrate", "Measure delay of the audio relative to track info, for \"sync_offset_ms\" config (calibrate [-n N]).", CmdCalibrate},
+		{"follow", "Follow artist on any channel (follow [-rm] <artist>), list followed artists without arguments.", CmdFollow},
+		{"watch", "Monitor channels for followed artists without playing, see \"follow\" in \"101ply help config\".", CmdWatch},
+		{"monitor", "Show live table of tracks on several channels (favorites by default).", CmdMonitor},
+		{"history", "List recent plays (history [-n N] [-c channel]) or import plays of other players (history import [-format auto|csv|lastfm|json] [-dry-run] --from <file>).", CmdHistory},
+		{"heard", "Check if the track was heard before, despite spelling differences (heard [<artist> - <title>]).", CmdHeard},
+		{"schedule", "List, add or remove control commands run by cron spec (schedule list|add [-tz zone] <spec> <command>|rm <id>), ex: schedule add \"0 7 * * mon-fri\" channel jazz.", CmdSchedule},
+		{"digest", "Print listening diary of the last week or day, or send it by email (digest [-period daily|weekly] [-send]).", CmdDigest},
+		{"suggest", "Recommend channels based on listening history.", CmdSuggest},
+		{"find", "Find channels playing the artist or title now or recently (find [-now|-history] <query>).", CmdFind},
+		{"export-data", "Export favorites, aliases, hidden and pinned items, history and config to tar.gz (export-data [-no-history] <file>).", CmdExportData},
+		{"import-data", "Import data exported by export-data, merging it into current data (import-data [-no-config] <file>).", CmdImportData},
+		{"archive", "Browse, play (15s skip and speed up to 2x need mpv audio_backend), rate, delete and export recordings (archive [query]), find duplicates among them (archive dedupe [-fingerprint] [-link|-rm]).", CmdArchive},
+		{"cache", "Show cache usage or remove cached files (cache stats|clean [-all]).", CmdCache},
+		{"version", "Print version, build features and credits (version [-json] [-credits]).", CmdVersion},
+		{"secret", "Store secret referenced from config as \"secret:<name>\" (secret set <name>|rm <name>|migrate), see \"secret_storage\" in \"101ply help config\".", CmdSecret},
+		{"doctor", "Check environment: X11, audio, D-Bus, notifications and network, report disabled features.", CmdDoctor},
+		{"report", "Make bug report zip with environment, redacted config, logs and last API responses (report [-o file]).", CmdReport},
+		{"help", "Show help on command or topic (help [commands|flags|hotkeys|actions|config|providers|files]).", CmdHelp},
+		{"man", "Print man page (101ply man > 101ply.1).", CmdMan},
+	}
+}
+
+// Runs subcommand by name.
+func RunCommand(name string, args []string) {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			cmd.Run(args)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %s. Available commands:\n", name)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\t%s\n", cmd.Name, cmd.Desc)
+	}
+	os.Exit(2)
+}
+
+// List channel groups and channels.
+func CmdList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	long := fs.Bool("long", false, "Show channel genres, description and logo.")
+	search := fs.String("search", "", "Show only channels matching the query.")
+	all := fs.Bool("all", false, "Show hidden channels and groups too, ordered by ID.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	go101o.LoadChannelGroups()
+	if *search != "" {
+		found, err := go101o.SearchChannels(*search)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for gid := range go101o.ChannelGroups {
+			g := go101o.ChannelGroups[gid]
+			g.Channels = make(map[uint64]go101Channel)
+			for _, c := range found[gid] {
+				g.Channels[c.Id] = c
+			}
+			if len(g.Channels) == 0 {
+				delete(go101o.ChannelGroups, gid)
+				continue
+			}
+			go101o.ChannelGroups[gid] = g
+		}
+	}
+	groups := go101o.PickerGroups()
+	if *all {
+		groups = go101o.SortedGroups()
+	}
+	for _, g := range groups {
+		fmt.Printf("%d - %s\n", g.Id, g.Title)
+		channels := go101o.PickerChannels(g)
+		if *all {
+			channels = g.SortedChannels()
+		}
+		for _, c := range channels {
+			if !*long {
+				fmt.Printf("    %d - %s\n", c.Id, c.Title)
+				continue
+			}
+			fmt.Printf("    %d - %s\n", c.Id, c.Summary())
+			if c.Description != "" {
+				fmt.Printf("        %s\n", c.Description)
+			}
+			if c.Logo != "" {
+				fmt.Printf("        Logo: %s\n", c.Logo)
+			}
+		}
+	}
+}
+
+// Refresh groups and channels.
+func CmdRefresh(args []string) {
+	if len(args) == 0 {
+		go101o.RefreshGroups(true)
+		return
+	}
+	gid, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		log.Fatal("Wrong group ID: ", args[0])
+	}
+	if err = go101o.RefreshGroup(gid); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Set or remove channel alias.
+func CmdAlias(args []string) {
+	fs := flag.NewFlagSet("alias", flag.ExitOnError)
+	rm := fs.Bool("rm", false, "Remove alias.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case *rm && fs.NArg() == 1:
+		if err := go101o.RemoveAlias(fs.Arg(0)); err != nil {
+			log.Fatal(err)
+		}
+	case !*rm && fs.NArg() == 2:
+		cid, err := go101o.ResolveChannel(fs.Arg(1))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = go101o.SetAlias(fs.Arg(0), cid); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatal("Usage: alias <name> <channel> | alias -rm <name>")
+	}
+}
+
+// Manage favorite channels.
+func CmdFav(args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		go101o.LoadChannelGroups()
+		ids, err := go101o.Favorites()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i, cid := range ids {
+			c := go101o.ChannelGroups[go101o.ChannelGroup(cid)].Channels[cid]
+			fmt.Printf("%d. %d - %s\n", i+1, cid, c.Title)
+		}
+		return
+	}
+	if len(args) != 2 {
+		log.Fatal("Usage: fav list|add <channel>|rm <channel>")
+	}
+	cid, err := go101o.ResolveChannel(args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch args[0] {
+	case "add":
+		err = go101o.AddFavorite(cid)
+	case "rm":
+		err = go101o.RemoveFavorite(cid)
+	default:
+		log.Fatal("Usage: fav list|add <channel>|rm <channel>")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Returns groups ordered by ID.
+func (p *go101) SortedGroups() []go101ChannelGroup {
+	groups := make([]go101ChannelGroup, 0, len(p.ChannelGroups))
+	for _, g := range p.ChannelGroups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id < groups[j].Id
+	})
+	return groups
+}
+
+// Returns channels of the group ordered by ID.
+func (g go101ChannelGroup) SortedChannels() []go101Channel {
+	channels := make([]go101Channel, 0, len(g.Channels))
+	for _, c := range g.Channels {
+		channels = append(channels, c)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Id < channels[j].Id
+	})
+	return channels
+}
+
+// Returns channel title with genres.
+func (c go101Channel) Summary() string {
+	if len(c.Genres) == 0 {
+		return c.Title
+	}
+	return fmt.Sprintf("%s [%s]", c.Title, strings.Join(c.Genres, ", "))
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Player configuration, stored in config.json.
+type go101Config struct {
+	Profiles map[string]go101Profile `json:"profiles"`
+	// Time zone of quiet hours, rotation, digest and scheduled commands, ex: Europe/Berlin. System one by default.
+	TimeZone   string           `json:"time_zone"`
+	QuietHours *go101QuietHours `json:"quiet_hours"`
+	// Channels switched by the part of the day, ex: news in the morning, jazz in the evening.
+	Rotation []go101RotationSlot `json:"rotation"`
+	// Volume per channel category (music, talk), applied on channel start.
+	GainProfiles map[string]go101GainProfile `json:"gain_profiles"`
+	// Substrings of group/channel titles and genres marking talk channels.
+	TalkPatterns []string `json:"talk_patterns"`
+	// Audio backend: mp3lib (default), alsa (mpg123 writing directly to ALSA device), mpv (controlled over IPC)
+	// or gstreamer (needs build with -tags gstreamer).
+	AudioBackend string `json:"audio_backend"`
+	AlsaDevice   string `json:"alsa_device"`
+	// Disable X hotkeys, for headless installs. Also disabled if DISPLAY isn't set.
+	NoX bool `json:"no_x"`
+	// Disable MPRIS service (media keys, Bluetooth headphones buttons, desktop widgets).
+	NoMpris bool `json:"no_mpris"`
+	// Don't use D-Bus at all: MPRIS, libnotify, screen lock and suspend watch, sleep inhibitor, keyring.
+	NoDBus  bool                `json:"no_dbus"`
+	GPIO    *go101GPIOConfig    `json:"gpio"`
+	Display *go101DisplayConfig `json:"display"`
+	// Size limit of the recently played tracks cache.
+	TrackCacheMb int `json:"track_cache_mb"`
+	// Size limit of all evictable cached files, least recently used ones are removed first.
+	CacheLimitMb int `json:"cache_limit_mb"`
+	// Seconds, same track with start timestamp shifted less than that isn't considered a new play.
+	DedupWindow uint64 `json:"dedup_window"`
+	// Disable writing of "now playing" RSS feeds to cache/feeds/<channel>.xml.
+	NoFeed bool `json:"no_feed"`
+	// Don't listen to track changes pushed by the provider, rely on polling only.
+	NoPush bool `json:"no_push"`
+	// Delay of the audio relative to track info, applied to notifications and remaining time.
+	SyncOffsetMs int `json:"sync_offset_ms"`
+	// How long leader key waits for the second key of a chord.
+	ChordTimeoutMs int `json:"chord_timeout_ms"`
+	// Prevent idle/suspend while playing (logind or PowerManagement inhibitor).
+	InhibitSleep bool `json:"inhibit_sleep"`
+	// Don't watch logind for system suspend (stream is stopped before suspend and restarted after resume).
+	NoSuspendWatch bool `json:"no_suspend_watch"`
+	// Pause if output is muted or unplugged for that many minutes, 0 disables.
+	SinkIdleMinutes int `json:"sink_idle_minutes"`
+	// Restart audio pipeline if no audio is consumed for that many seconds while playing, 0 disables.
+	WatchdogSeconds int `json:"watchdog_seconds"`
+	// Pause when the session locks and resume on unlock.
+	PauseOnLock bool `json:"pause_on_lock"`
+	// Console colors: default, solarized, ocean or mono. NO_COLOR environment variable disables colors.
+	Theme string `json:"theme"`
+	// Don't update terminal window title with playing track.
+	NoTitle bool `json:"no_title"`
+	// Webhooks called on player events.
+	Webhooks []go101Webhook `json:"webhooks"`
+	// Notification backends for track changes and stream errors.
+	Notifiers []go101NotifierConfig `json:"notifiers"`
+	Alerts    *go101AlertConfig     `json:"alerts"`
+	// Programs followed on any channel.
+	Schedule *go101ScheduleConfig `json:"schedule"`
+	// Channels monitored for followed artists.
+	Follow *go101FollowConfig `json:"follow"`
+	// Take a break reminders and daily listening cap.
+	Goals   *go101GoalsConfig   `json:"goals"`
+	PlayLog *go101PlayLogConfig `json:"play_log"`
+	// Daily or weekly listening diary by email.
+	Digest *go101DigestConfig `json:"digest"`
+	// Copy every played track to a tagged file in the recordings directory.
+	Record  *go101RecordConfig  `json:"record"`
+	Tracing *go101TracingConfig `json:"tracing"`
+	// Concurrency and retries of track downloads.
+	Download *go101DownloadConfig `json:"download"`
+	// Stream buffering in-process, helps against stutter on unstable networks.
+	Buffer *go101BufferConfig `json:"buffer"`
+	// Channel played instead of the geo-blocked one, by channel ID or "*" for any channel.
+	GeoFallback map[string]string `json:"geo_fallback"`
+	// Live stream of the channel played when track info has no audio file, %d is channel ID.
+	StreamURL string `json:"stream_url"`
+	// Reconnect or switch CDN mirror on silent or corrupted stream.
+	Integrity *go101IntegrityConfig `json:"integrity"`
+	// Custom resolver and host overrides for provider and CDN hosts.
+	DNS *go101DNSConfig `json:"dns"`
+	// Trusted CA certificates and verification of provider and stream connections.
+	TLS *go101TLSConfig `json:"tls"`
+	// Track info polling intervals and provider requests rate limit.
+	Polling *go101PollingConfig `json:"polling"`
+	// Cyrillic to Latin transliteration of console output, recording file names and webhooks.
+	Translit *go101TranslitConfig `json:"translit"`
+	// Cover art providers for tracks without station cover.
+	CoverArt *go101CoverArtConfig `json:"cover_art"`
+	// Search services linked in notifications and "now" output: youtube, youtubemusic, spotify, yandex.
+	TrackLinks []string `json:"track_links"`
+	// Date and time formats of history, bookmarks and schedule, locale ones by default.
+	TimeFormat *go101TimeFormatConfig `json:"time_format"`
+	// Template of the track line, see "101ply help templates".
+	TrackFormat string `json:"track_format"`
+	// Print track line once instead of updating remaining time in place.
+	NoStatusLine bool `json:"no_status_line"`
+	// Where "secret:<name>" values are stored: keyring (Secret Service or KWallet), file (secrets.json)
+	// or encrypted (credentials below).
+	SecretStorage string `json:"secret_storage"`
+	// Secrets encrypted by the key file, managed by "101ply secret" with "encrypted" storage.
+	Credentials string `json:"credentials"`
+	// Path to the key of the credentials, credentials.key in config directory by default.
+	CredentialsKey string `json:"credentials_key"`
+
+	location *time.Location
+}
+
+// Named profile, activated by -profile option or "profile" control command. Profiles are taken from
+// config.json and from profiles/<name>.json files in the config directory.
+type go101Profile struct {
+	// Channels hidden from the picker and refused to play.
+	RestrictedChannels []uint64 `json:"restricted_channels"`
+	// Regular expressions matched against "artist - title", matching tracks are muted.
+	RestrictedPatterns []string `json:"restricted_patterns"`
+	// Default channel ID or alias, played without the picker.
+	Channel string `json:"channel"`
+	// Volume in percents set on profile activation, 0 keeps current.
+	Volume int `json:"volume"`
+	// Hotkeys used instead of hotkey.json.
+	Hotkeys []Hotkey `json:"hotkeys"`
+	// Notifiers used in addition to the common ones.
+	Notifiers []go101NotifierConfig `json:"notifiers"`
+	// Default -output, applied on start only.
+	Output string `json:"output"`
+
+	Name         string `json:"-"`
+	restrictedRe []*regexp.Regexp
+}
+
+// Returns full path to the main configuration file.
+func GetConfigFile() string {
+	ps := string(os.PathSeparator)
+	return GetConfigDir() + ps + "config.json"
+}
+
+// Reads and parses configuration file.
+func LoadConfig() (*go101Config, error) {
+	raw, err := ioutil.ReadFile(GetConfigFile())
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %s", err.Error())
+	}
+	config := &go101Config{}
+	if err = json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("could not parse config file: %s", err.Error())
+	}
+	if config.location, err = LoadZone(config.TimeZone); err != nil {
+		return nil, err
+	}
+	if q := config.QuietHours; q != nil {
+		if _, err = parseClock(q.Start); err != nil {
+			return nil, err
+		}
+		if _, err = parseClock(q.End); err != nil {
+			return nil, err
+		}
+	}
+	if err = CheckTrackLinks(config.TrackLinks); err != nil {
+		return nil, err
+	}
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]go101Profile)
+	}
+	if err = LoadProfiles(config.Profiles); err != nil {
+		return nil, err
+	}
+	for name, profile := range config.Profiles {
+		profile.Name = name
+		for _, pattern := range profile.RestrictedPatterns {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, fmt.Errorf("wrong pattern %s in profile %s: %s", pattern, name, err.Error())
+			}
+			profile.restrictedRe = append(profile.restrictedRe, re)
+		}
+		config.Profiles[name] = profile
+	}
+	return config, nil
+}
+
+// Returns full path to the directory of profile files.
+func GetProfilesDir() string {
+	ps := string(os.PathSeparator)
+	return GetConfigDir() + ps + "profiles"
+}
+
+// Reads profiles/<name>.json files. Profile file overrides profile of the same name in config.json.
+func LoadProfiles(profiles map[string]go101Profile) error {
+	files, err := ioutil.ReadDir(GetProfilesDir())
+	if err != nil {
+		// No profiles directory.
+		return nil
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		raw, err := ioutil.ReadFile(GetProfilesDir() + string(os.PathSeparator) + fi.Name())
+		if err != nil {
+			return fmt.Errorf("could not read profile: %s", err.Error())
+		}
+		profile := go101Profile{}
+		if err = json.Unmarshal(raw, &profile); err != nil {
+			return fmt.Errorf("could not parse profile %s: %s", fi.Name(), err.Error())
+		}
+		profiles[strings.TrimSuffix(fi.Name(), ".json")] = profile
+	}
+	return nil
+}
+
+// Returns time zone of the config.
+func (c *go101Config) Location() *time.Location {
+	if c == nil || c.location == nil {
+		return time.Local
+	}
+	return c.location
+}
+
+// Returns current time in the config time zone.
+func (c *go101Config) Now() time.Time {
+	return time.Now().In(c.Location())
+}
+
+// Returns profile by name.
+func (c *go101Config) Profile(name string) (*go101Profile, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s", name)
+	}
+	return &profile, nil
+}
+
+// Checks if channel is restricted in the profile.
+func (p *go101Profile) ChannelRestricted(cid uint64) bool {
+	if p == nil {
+		return false
+	}
+	for _, id := range p.RestrictedChannels {
+		if id == cid {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if track matches any restricted pattern of the profile.
+func (p *go101Profile) TrackRestricted(track go101TrackInfo) bool {
+	if p == nil {
+		return false
+	}
+	s := track.Artist + " - " + track.Title
+	for _, re := range p.restrictedRe {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
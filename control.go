@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const CONTROL_TIMEOUT = 2 * time.Second
+
+// Returns full path to the control socket of the running player instance.
+func GetControlSocket() string {
+	ps := string(os.PathSeparator)
+	return GetRuntimeDir() + ps + "101ply.sock"
+}
+
+// Accepts commands from the control socket. Runs forever.
+// Protocol is line based: client sends command, server replies with "ok" or "error: <message>".
+func (p *go101) ControlLoop() {
+	socket := GetControlSocket()
+	// Remove socket left by the crashed process.
+	_ = os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		panic(fmt.Errorf("couldn't listen control socket: %s", err.Error()))
+	}
+	// Socket is created by umask, runtime directory is private meanwhile.
+	if err = os.Chmod(socket, PRIVATE_FILE_PERM); err != nil {
+		log.Println("Couldn't restrict control socket: ", err.Error())
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	for true {
+		conn, err := listener.Accept()
+		if err != nil {
+			panic(err)
+		}
+		go Safe("control connection", func() {
+			p.serveControl(conn)
+		})
+	}
+}
+
+// Handles single control connection.
+func (p *go101) serveControl(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetDeadline(time.Now().Add(CONTROL_TIMEOUT))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	reply, err := p.Command(strings.TrimSpace(line))
+	if err != nil {
+		_, _ = fmt.Fprintf(conn, "error: %s\n", err.Error())
+		return
+	}
+	_, _ = fmt.Fprintf(conn, "ok\n%s", reply)
+}
+
+// Player status returned by "status" control command.
+type go101Status struct {
+	Status    string `json:"status"`
+	Channel   string `json:"channel"`
+	ChannelId uint64 `json:"channel_id"`
+	Artist    string `json:"artist"`
+	Title     string `json:"title"`
+	Album     string `json:"album"`
+	Cover     string `json:"cover,omitempty"`
+	Profile   string `json:"profile,omitempty"`
+	// Rotation slot, "off" or "idle" between slots.
+	Rotation string `json:"rotation,omitempty"`
+	// Seconds till the end of the track.
+	Remaining int64 `json:"remaining"`
+	// Stream buffer stats, if buffering is enabled.
+	BufferedBytes int    `json:"buffered_bytes,omitempty"`
+	Underruns     uint64 `json:"underruns,omitempty"`
+	// Current interval of track info fetches, seconds.
+	PollInterval uint64 `json:"poll_interval"`
+	// Provider requests made and delayed by the rate limiter.
+	Requests  uint64 `json:"requests"`
+	Throttled uint64 `json:"throttled"`
+	// Session stats.
+	Stats go101StatsSnapshot `json:"stats"`
+	// Channel page and search links of the track.
+	Links []go101Link `json:"links"`
+	// Next program of the channel, if it has schedule.
+	Next *go101Program `json:"next,omitempty"`
+	// Unix time of the track end in milliseconds, as heard (sync offset applied).
+	Ends         int64 `json:"ends"`
+	SyncOffsetMs int   `json:"sync_offset_ms"`
+	// Hotkeys are passed to other programs.
+	HotkeysSuspended bool `json:"hotkeys_suspended,omitempty"`
+}
+
+// Returns current player status.
+func (p *go101) PlayerStatus() go101Status {
+	channel, track := p.Channel(), p.Track()
+	s := go101Status{
+		Status:       StatusName(p.Status()),
+		Channel:      channel.Title,
+		ChannelId:    channel.Id,
+		Artist:       track.Artist,
+		Title:        track.Title,
+		Album:        track.Album,
+		Cover:        track.Cover,
+		Profile:      p.ProfileName(),
+		Rotation:     p.RotationState(),
+		PollInterval: p.Scheduler.Interval(),
+		Stats:        stats.Snapshot(),
+		Links:        p.TrackLinks(track, channel),
+		Next:         p.NextProgram(channel.Id),
+	}
+	s.Requests, s.Throttled = rateLimiter.Stats()
+	s.Ends = track.Ends.UnixNano() / int64(time.Millisecond)
+	s.SyncOffsetMs = p.Config.SyncOffsetMs
+	s.HotkeysSuspended = HotkeysSuspended()
+	if remaining := time.Until(track.Ends); remaining > 0 {
+		s.Remaining = int64(remaining / time.Second)
+	}
+	if p.Proxy != nil {
+		s.BufferedBytes, s.Underruns = p.Proxy.Stats()
+	}
+	return s
+}
+
+// Returns status name.
+func StatusName(status uint64) string {
+	switch status {
+	case STATUS_PLAY:
+		return "play"
+	case STATUS_PAUSE:
+		return "pause"
+	default:
+		return "stop"
+	}
+}
+
+// Executes control command and returns its output.
+func (p *go101) Command(line string) (string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+	switch fields[0] {
+	case "status":
+		raw, err := json.Marshal(p.PlayerStatus())
+		if err != nil {
+			return "", err
+		}
+		return string(raw) + "\n", nil
+	case "version":
+		raw, err := json.Marshal(VersionInfo())
+		if err != nil {
+			return "", err
+		}
+		return string(raw) + "\n", nil
+	case "profile":
+		if len(fields) < 2 {
+			return p.ProfileName() + "\n", nil
+		}
+		return "", p.SwitchProfile(fields[1])
+	case "hotkeys":
+		if len(fields) > 1 {
+			switch fields[1] {
+			case "on":
+				SuspendHotkeys(false)
+			case "off":
+				SuspendHotkeys(true)
+			default:
+				return "", fmt.Errorf("usage: hotkeys [on|off]")
+			}
+		}
+		if HotkeysSuspended() {
+			return "off\n", nil
+		}
+		return "on\n", nil
+	case "channel":
+		if len(fields) < 2 {
+			return fmt.Sprintf("%d\n", p.ChannelId()), nil
+		}
+		cid, err := p.ResolveChannel(fields[1])
+		if err != nil {
+			return "", err
+		}
+		if _, ok := p.ChannelGroups[p.ChannelGroup(cid)].Channels[cid]; !ok {
+			return "", fmt.Errorf("unknown channel %d", cid)
+		}
+		if p.Profile.ChannelRestricted(cid) {
+			return "", fmt.Errorf("channel %d is restricted by profile", cid)
+		}
+		p.SwitchChannel(cid)
+		return "", nil
+	case "rotation":
+		if len(fields) > 1 {
+			switch fields[1] {
+			case "on":
+				p.SetRotation(true)
+			case "off":
+				p.SetRotation(false)
+			default:
+				return "", fmt.Errorf("usage: rotation [on|off]")
+			}
+		}
+		return p.RotationState() + "\n", nil
+	case "volume":
+		get, set := p.VolumeControl()
+		if len(fields) > 1 {
+			percent, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return "", fmt.Errorf("usage: volume [0-100]")
+			}
+			if err = set(percent); err != nil {
+				return "", err
+			}
+			p.ApplyQuietHours()
+		}
+		volume, err := get()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d\n", volume), nil
+	case ACTION_BOOKMARK:
+		// Note is the rest of the line.
+		id, err := p.Bookmark(strings.Join(fields[1:], " "))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d\n", id), nil
+	}
+	if !KnownAction(fields[0]) {
+		return "", fmt.Errorf("unknown command %s", fields[0])
+	}
+	p.Action(fields[0])
+	return "", nil
+}
+
+// Sends command to the running player and returns its reply.
+func SendControl(command string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("unix", GetControlSocket(), timeout)
+	if err != nil {
+		return "", fmt.Errorf("player isn't running: %s", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = fmt.Fprintln(conn, command); err != nil {
+		return "", err
+	}
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if status = strings.TrimSpace(status); status != "ok" {
+		return "", fmt.Errorf("%s", strings.TrimPrefix(status, "error: "))
+	}
+	var out strings.Builder
+	_, _ = reader.WriteTo(&out)
+	return out.String(), nil
+}
+
+// Send command to the running player.
+func CmdCtl(args []string) {
+	out, err := SendControl(strings.Join(args, " "), CONTROL_TIMEOUT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(out)
+}
+
+// Replay previous track from cache.
+func CmdReplay(args []string) {
+	CmdCtl([]string{ACTION_REPLAY})
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cover art providers.
+const (
+	COVER_STATION         = "station"
+	COVER_COVERARTARCHIVE = "coverartarchive"
+	COVER_ITUNES          = "itunes"
+	COVER_DEEZER          = "deezer"
+)
+
+const (
+	// Whole chain lookup limit, track change is emitted after it.
+	COVER_LOOKUP_TIMEOUT = 8 * time.Second
+	// Tracks without cover are looked up again after that time.
+	COVER_MISS_TTL = 24 * time.Hour
+	// Lookups kept in covers.json and images kept in covers directory.
+	COVER_CACHE_SIZE  = 2000
+	COVER_IMAGES_SIZE = 200
+)
+
+// Cover art lookup for tracks the station supplies no cover for.
+type go101CoverArtConfig struct {
+	// Providers tried in order: station, coverartarchive, itunes, deezer. All of them in that order by default.
+	Providers []string `json:"providers"`
+	// Requests per minute to each provider, 20 by default. Cover Art Archive is limited to 1 per second anyway.
+	RatePerMinute int `json:"rate_per_minute"`
+}
+
+// Cover art provider description, used by help.
+type go101CoverProviderInfo struct {
+	Name string
+	Desc string
+	// Returns cover image URL of the track, empty if provider has none.
+	Find func(ctx context.Context, track go101TrackInfo) (string, error)
+	// Requests per minute allowed by the service, 0 if config one is used.
+	Rate int
+}
+
+var coverProviders = []go101CoverProviderInfo{
+	{COVER_STATION, "Cover supplied by the station with track info.", findStationCover, 0},
+	{COVER_COVERARTARCHIVE, "Cover Art Archive, release groups found by MusicBrainz search.", findCoverArtArchive, 60},
+	{COVER_ITUNES, "iTunes Search API, album artwork.", findItunesCover, 0},
+	{COVER_DEEZER, "Deezer API, album covers.", findDeezerCover, 0},
+}
+
+// Result of the provider lookup, cached by provider, artist and album (title for singles).
+type go101CoverEntry struct {
+	URL     string `json:"url"`
+	Checked int64  `json:"checked"`
+}
+
+var (
+	coverCache    map[string]go101CoverEntry
+	coverCacheMux sync.Mutex
+	coverLimiters = map[string]*go101RateLimiter{}
+	coverFetchMux sync.Mutex
+	coverClient   = &http.Client{Timeout: COVER_LOOKUP_TIMEOUT}
+)
+
+// Returns full path to the cover lookups cache.
+func GetCoverCacheFile() string {
+	ps := string(os.PathSeparator)
+	return GetCacheDir() + ps + "covers.json"
+}
+
+// Returns full path to the downloaded cover images directory.
+func GetCoverDir() string {
+	ps := string(os.PathSeparator)
+	return GetCacheDir() + ps + "covers"
+}
+
+// Returns provider names in lookup order.
+func (c *go101CoverArtConfig) Chain() []string {
+	if c == nil || len(c.Providers) == 0 {
+		names := make([]string, 0, len(coverProviders))
+		for _, cp := range coverProviders {
+			names = append(names, cp.Name)
+		}
+		return names
+	}
+	return c.Providers
+}
+
+// Checks provider names of the config.
+func (c *go101CoverArtConfig) Validate() error {
+	for _, name := range c.Chain() {
+		if _, ok := coverProvider(name); !ok {
+			return fmt.Errorf("unknown cover art provider %s", name)
+		}
+	}
+	return nil
+}
+
+func coverProvider(name string) (go101CoverProviderInfo, bool) {
+	for _, cp := range coverProviders {
+		if cp.Name == name {
+			return cp, true
+		}
+	}
+	return go101CoverProviderInfo{}, false
+}
+
+// Returns rate limiter of the provider.
+func (c *go101CoverArtConfig) limiter(cp go101CoverProviderInfo) *go101RateLimiter {
+	coverCacheMux.Lock()
+	defer coverCacheMux.Unlock()
+	l, ok := coverLimiters[cp.Name]
+	if !ok {
+		rate := cp.Rate
+		if rate == 0 && c != nil {
+			rate = c.RatePerMinute
+		}
+		if rate == 0 {
+			rate = 20
+		}
+		l = NewRateLimiter(rate, 1)
+		coverLimiters[cp.Name] = l
+	}
+	return l
+}
+
+// Returns cache key of the provider lookup: covers belong to albums, tracks without album are looked up by title.
+func coverKey(provider string, track go101TrackInfo) string {
+	name := track.Album
+	if name == "" {
+		name = track.Title
+	}
+	return provider + "\x00" + strings.ToLower(strings.TrimSpace(track.Artist)+"\x00"+strings.TrimSpace(name))
+}
+
+func loadCoverCache() {
+	if coverCache != nil {
+		return
+	}
+	coverCache = make(map[string]go101CoverEntry)
+	raw, err := ioutil.ReadFile(GetCoverCacheFile())
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(raw, &coverCache); err != nil {
+		Debug("Couldn't parse cover cache: %s", err)
+		coverCache = make(map[string]go101CoverEntry)
+	}
+}
+
+// Saves cover lookups, oldest ones above the cache size are dropped.
+func saveCoverCache() {
+	if len(coverCache) > COVER_CACHE_SIZE {
+		keys := make([]string, 0, len(coverCache))
+		for key := range coverCache {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return coverCache[keys[i]].Checked > coverCache[keys[j]].Checked
+		})
+		for _, key := range keys[COVER_CACHE_SIZE:] {
+			delete(coverCache, key)
+		}
+	}
+	raw, _ := json.Marshal(coverCache)
+	if err := WriteFileAtomic(GetCoverCacheFile(), raw, PRIVATE_FILE_PERM); err != nil {
+		Debug("Couldn't save cover cache: %s", err)
+	}
+}
+
+// Returns cover URL of the track found by the first provider of the chain having it, empty if nobody has it.
+// Lookups are cached, misses are retried after a day.
+func (c *go101CoverArtConfig) Find(track go101TrackInfo) string {
+	ctx, cancel := context.WithTimeout(context.Background(), COVER_LOOKUP_TIMEOUT)
+	defer cancel()
+	for _, name := range c.Chain() {
+		if name == COVER_STATION || track.Artist == "" {
+			if track.Cover != "" {
+				return track.Cover
+			}
+			continue
+		}
+		cp, ok := coverProvider(name)
+		if !ok {
+			continue
+		}
+		key := coverKey(name, track)
+		coverCacheMux.Lock()
+		loadCoverCache()
+		entry, cached := coverCache[key]
+		coverCacheMux.Unlock()
+		if cached && (entry.URL != "" || time.Since(time.Unix(entry.Checked, 0)) < COVER_MISS_TTL) {
+			if entry.URL != "" {
+				return entry.URL
+			}
+			continue
+		}
+		c.limiter(cp).Wait()
+		if ctx.Err() != nil {
+			Debug("Cover lookup of %s - %s timed out", track.Artist, track.Title)
+			return ""
+		}
+		cover, err := cp.Find(ctx, track)
+		if err != nil {
+			// Not cached, the next play tries again.
+			Debug("Cover lookup via %s failed: %s", name, err)
+			continue
+		}
+		coverCacheMux.Lock()
+		coverCache[key] = go101CoverEntry{URL: cover, Checked: time.Now().Unix()}
+		saveCoverCache()
+		coverCacheMux.Unlock()
+		if cover != "" {
+			Debug("Cover of %s - %s found via %s: %s", track.Artist, track.Title, name, cover)
+			return cover
+		}
+	}
+	return ""
+}
+
+func findStationCover(ctx context.Context, track go101TrackInfo) (string, error) {
+	return track.Cover, nil
+}
+
+// Sends GET request and decodes JSON response.
+func coverGetJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	// MusicBrainz refuses requests without meaningful agent.
+	req.Header.Set("User-Agent", "101ply/"+version+" ( https://github.com/koykov/101ply )")
+	resp, err := coverClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if err = CheckStatus(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Escapes Lucene query value of MusicBrainz search.
+func luceneQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func findCoverArtArchive(ctx context.Context, track go101TrackInfo) (string, error) {
+	if track.Album == "" {
+		return "", nil
+	}
+	var r struct {
+		ReleaseGroups []struct {
+			Id    string `json:"id"`
+			Score int    `json:"score"`
+		} `json:"release-groups"`
+	}
+	query := "artist:" + luceneQuote(track.Artist) + " AND releasegroup:" + luceneQuote(track.Album)
+	err := coverGetJSON(ctx, "https://musicbrainz.org/ws/2/release-group/?fmt=json&limit=1&query="+url.QueryEscape(query), &r)
+	if err != nil || len(r.ReleaseGroups) == 0 || r.ReleaseGroups[0].Score < 90 {
+		return "", err
+	}
+	// Archive redirects to the image, or replies 404 if release group has no front cover.
+	cover := "https://coverartarchive.org/release-group/" + r.ReleaseGroups[0].Id + "/front-500"
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, cover, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := coverClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err = CheckStatus(resp); err != nil {
+		return "", err
+	}
+	return cover, nil
+}
+
+func findItunesCover(ctx context.Context, track go101TrackInfo) (string, error) {
+	var r struct {
+		Results []struct {
+			ArtistName     string `json:"artistName"`
+			ArtworkUrl100  string `json:"artworkUrl100"`
+			CollectionName string `json:"collectionName"`
+		} `json:"results"`
+	}
+	q := url.Values{"term": {track.Artist + " " + track.Album}, "entity": {"album"}, "limit": {"5"}}
+	if track.Album == "" {
+		q = url.Values{"term": {track.Artist + " " + track.Title}, "entity": {"song"}, "limit": {"5"}}
+	}
+	if err := coverGetJSON(ctx, "https://itunes.apple.com/search?"+q.Encode(), &r); err != nil {
+		return "", err
+	}
+	for _, res := range r.Results {
+		if strings.EqualFold(res.ArtistName, track.Artist) && res.ArtworkUrl100 != "" {
+			// Artwork of any size is served by the same path.
+			return strings.Replace(res.ArtworkUrl100, "100x100bb", "600x600bb", 1), nil
+		}
+	}
+	return "", nil
+}
+
+func findDeezerCover(ctx context.Context, track go101TrackInfo) (string, error) {
+	var r struct {
+		Data []struct {
+			Artist struct {
+				Name string `json:"name"`
+			} `json:"artist"`
+			CoverXL string `json:"cover_xl"`
+			Album   struct {
+				CoverXL string `json:"cover_xl"`
+			} `json:"album"`
+		} `json:"data"`
+	}
+	u := "https://api.deezer.com/search/album?q=" + url.QueryEscape(fmt.Sprintf("artist:%q album:%q", track.Artist, track.Album))
+	if track.Album == "" {
+		u = "https://api.deezer.com/search?q=" + url.QueryEscape(fmt.Sprintf("artist:%q track:%q", track.Artist, track.Title))
+	}
+	if err := coverGetJSON(ctx, u, &r); err != nil {
+		return "", err
+	}
+	for _, res := range r.Data {
+		if !strings.EqualFold(res.Artist.Name, track.Artist) {
+			continue
+		}
+		if res.CoverXL != "" {
+			return res.CoverXL, nil
+		}
+		if res.Album.CoverXL != "" {
+			return res.Album.CoverXL, nil
+		}
+	}
+	return "", nil
+}
+
+// Returns local file of the cover image, downloads it if needed. Local files are used by MPRIS, desktop
+// notifications and recordings, so every cover is downloaded once.
+func CoverFile(cover string) (string, error) {
+	if cover == "" {
+		return "", fmt.Errorf("no cover")
+	}
+	sum := sha1.Sum([]byte(cover))
+	filename := filepath.Join(GetCoverDir(), hex.EncodeToString(sum[:]))
+	coverFetchMux.Lock()
+	defer coverFetchMux.Unlock()
+	if _, err := os.Stat(filename); err == nil {
+		return filename, nil
+	}
+	data, _, err := FetchCover(cover)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(GetCoverDir(), PRIVATE_DIR_PERM); err != nil {
+		return "", err
+	}
+	if err = WriteFileAtomic(filename, data, PRIVATE_FILE_PERM); err != nil {
+		return "", err
+	}
+	trimCoverDir()
+	return filename, nil
+}
+
+// Returns cover image data and MIME type, from the local file if it was downloaded.
+func LoadCover(cover string) ([]byte, string, error) {
+	filename, err := CoverFile(cover)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, http.DetectContentType(data), nil
+}
+
+// Removes oldest cover images above the limit.
+func trimCoverDir() {
+	files, err := ioutil.ReadDir(GetCoverDir())
+	if err != nil || len(files) <= COVER_IMAGES_SIZE {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	for _, fi := range files[COVER_IMAGES_SIZE:] {
+		_ = os.Remove(filepath.Join(GetCoverDir(), fi.Name()))
+	}
+}
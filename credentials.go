@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	SECRET_STORAGE_ENCRYPTED = "encrypted"
+	// Prefix of the encrypted credentials: AES-256-GCM, base64 of nonce and sealed JSON object of secrets.
+	CREDENTIALS_FORMAT   = "aes256gcm:"
+	CREDENTIALS_KEY_SIZE = 32
+)
+
+var reCredentials = regexp.MustCompile(`"credentials"\s*:\s*("(?:[^"\\]|\\.)*"|null)`)
+
+// Returns full path to the key of the encrypted credentials, "credentials_key" config overrides it.
+func GetCredentialsKeyFile() string {
+	if go101o.Config != nil && go101o.Config.CredentialsKey != "" {
+		return go101o.Config.CredentialsKey
+	}
+	ps := string(os.PathSeparator)
+	return GetConfigDir() + ps + "credentials.key"
+}
+
+// Secrets encrypted by the key file and kept in "credentials" of config, for headless installs without keyring.
+// Config file may be readable by others, the key file is readable by the owner only.
+type go101EncryptedKeyring struct {
+	file    string
+	keyFile string
+}
+
+// Reads the key, creates it if create is set and there's no key yet.
+func (k *go101EncryptedKeyring) key(create bool) ([]byte, error) {
+	fi, err := os.Stat(k.keyFile)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, CREDENTIALS_KEY_SIZE)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err = WriteFileAtomic(k.keyFile, key, PRIVATE_FILE_PERM); err != nil {
+			return nil, err
+		}
+		Debug("create credentials key - %s", k.keyFile)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read credentials key: %s", err.Error())
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("credentials key %s is accessible by others, run \"chmod 600 %s\"", k.keyFile, k.keyFile)
+	}
+	key, err := ioutil.ReadFile(k.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != CREDENTIALS_KEY_SIZE {
+		return nil, fmt.Errorf("credentials key %s must be %d bytes long", k.keyFile, CREDENTIALS_KEY_SIZE)
+	}
+	return key, nil
+}
+
+func credentialsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Decrypts credentials of the config file.
+func (k *go101EncryptedKeyring) load() (map[string]string, error) {
+	raw, err := ioutil.ReadFile(k.file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Credentials string `json:"credentials"`
+	}
+	if err = json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", k.file, err.Error())
+	}
+	secrets := make(map[string]string)
+	if config.Credentials == "" {
+		return secrets, nil
+	}
+	if !strings.HasPrefix(config.Credentials, CREDENTIALS_FORMAT) {
+		return nil, fmt.Errorf("unknown format of credentials")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(config.Credentials, CREDENTIALS_FORMAT))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode credentials: %s", err.Error())
+	}
+	key, err := k.key(false)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := credentialsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("credentials are truncated")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt credentials, wrong key %s?", k.keyFile)
+	}
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("couldn't parse credentials: %s", err.Error())
+	}
+	return secrets, nil
+}
+
+// Encrypts secrets into credentials of the config file, the rest of the file is kept as is.
+func (k *go101EncryptedKeyring) save(secrets map[string]string) error {
+	key, err := k.key(true)
+	if err != nil {
+		return err
+	}
+	aead, err := credentialsCipher(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	plain, _ := json.Marshal(secrets)
+	value := jsonString(CREDENTIALS_FORMAT + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)))
+
+	raw, err := ioutil.ReadFile(k.file)
+	if err != nil {
+		return err
+	}
+	if loc := reCredentials.FindSubmatchIndex(raw); loc != nil {
+		raw = append(append(append([]byte{}, raw[:loc[2]]...), value...), raw[loc[3]:]...)
+	} else if i := bytes.IndexByte(raw, '{'); i >= 0 && json.Valid(insertCredentials(raw, i, value)) {
+		// Config made before the option, credentials go first.
+		raw = insertCredentials(raw, i, value)
+	} else {
+		var doc map[string]interface{}
+		if err = json.Unmarshal(raw, &doc); err != nil {
+			return fmt.Errorf("could not parse %s: %s", k.file, err.Error())
+		}
+		doc["credentials"] = json.RawMessage(value)
+		raw, _ = json.MarshalIndent(doc, "", "\t")
+	}
+	return WriteFileAtomic(k.file, raw, PRIVATE_FILE_PERM)
+}
+
+func insertCredentials(raw []byte, pos int, value []byte) []byte {
+	field := append([]byte("\n\t\"credentials\": "), value...)
+	return append(append(append(append([]byte{}, raw[:pos+1]...), field...), ','), raw[pos+1:]...)
+}
+
+func (k *go101EncryptedKeyring) Get(name string) (string, error) {
+	secrets, err := k.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (k *go101EncryptedKeyring) Set(name, value string) error {
+	secrets, err := k.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return k.save(secrets)
+}
+
+func (k *go101EncryptedKeyring) Delete(name string) error {
+	secrets, err := k.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return ErrSecretNotFound
+	}
+	delete(secrets, name)
+	return k.save(secrets)
+}
+
+func (k *go101EncryptedKeyring) Close() {}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Next run is looked for within that many days, enough for "29 February on Monday" specs.
+const CRON_MAX_DAYS = 28 * 366
+
+// Shortcuts of the cron specs.
+var cronShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+var (
+	cronMonths   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// Cron spec in the time zone: "minute hour day-of-month month day-of-week", ex: "30 7 * * mon-fri". Fields
+// are "*", numbers, ranges and lists with optional step: "*/15", "1-5", "0,30", "9-17/2". Runs are computed by
+// the wall clock of the zone, so they stay at the same local time over DST changes.
+type go101Cron struct {
+	Spec     string
+	Location *time.Location
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// Day of month or weekday is "*", then the other one decides alone. Otherwise any of them matches.
+	anyDay     bool
+	anyWeekday bool
+}
+
+// Returns time zone by IANA name, empty name or "Local" is the system zone.
+func LoadZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+	return loc, nil
+}
+
+// Parses cron spec of the zone, empty zone is the system one.
+func ParseCron(spec, zone string) (*go101Cron, error) {
+	loc, err := LoadZone(zone)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCronIn(spec, loc)
+}
+
+// Parses cron spec of the location.
+func ParseCronIn(spec string, loc *time.Location) (*go101Cron, error) {
+	var err error
+	c := &go101Cron{Spec: spec, Location: loc}
+	if s, ok := cronShortcuts[strings.ToLower(spec)]; ok {
+		spec = s
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("wrong schedule %q, expected \"minute hour day month weekday\"", c.Spec)
+	}
+	for i, f := range []struct {
+		set      *uint64
+		min, max int
+		names    []string
+	}{
+		{&c.minutes, 0, 59, nil},
+		{&c.hours, 0, 23, nil},
+		{&c.days, 1, 31, nil},
+		{&c.months, 1, 12, cronMonths},
+		{&c.weekdays, 0, 7, cronWeekdays},
+	} {
+		if *f.set, err = parseCronField(fields[i], f.min, f.max, f.names); err != nil {
+			return nil, fmt.Errorf("wrong schedule %q: %s", c.Spec, err.Error())
+		}
+	}
+	// Sunday is both 0 and 7.
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	c.anyDay, c.anyWeekday = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// Parses field to the set of values, bit per value.
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				// Months are counted from 1, weekdays from 0.
+				return i + min, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%s isn't within %d-%d", s, min, max)
+		}
+		return n, nil
+	}
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("wrong step %s", part[i+1:])
+			}
+			part, step = part[:i], n
+		}
+		from, to := min, max
+		switch i := strings.IndexByte(part, '-'); {
+		case part == "*":
+		case i > 0:
+			var err error
+			if from, err = value(part[:i]); err != nil {
+				return 0, err
+			}
+			if to, err = value(part[i+1:]); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("wrong range %s", part)
+			}
+		default:
+			n, err := value(part)
+			if err != nil {
+				return 0, err
+			}
+			from, to = n, n
+			if step > 1 {
+				// "5/15" means from 5 to the end.
+				to = max
+			}
+		}
+		for n := from; n <= to; n += step {
+			set |= 1 << uint(n)
+		}
+	}
+	return set, nil
+}
+
+func (c *go101Cron) dayMatches(date time.Time) bool {
+	if c.months&(1<<uint(date.Month())) == 0 {
+		return false
+	}
+	day := c.days&(1<<uint(date.Day())) != 0
+	weekday := c.weekdays&(1<<uint(date.Weekday())) != 0
+	switch {
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// Returns the first run after the moment, zero time if spec never runs (ex: 31 February).
+// Local time skipped by DST shift is moved forward by the shift, repeated local time runs once.
+func (c *go101Cron) Next(after time.Time) time.Time {
+	t := after.In(c.Location)
+	y, m, d := t.Date()
+	from := t.Hour()*60 + t.Minute() + 1
+	for i := 0; i < CRON_MAX_DAYS; i++ {
+		// Noon exists on any day, midnight is skipped by DST shift in some zones.
+		date := time.Date(y, m, d+i, 12, 0, 0, 0, c.Location)
+		if !c.dayMatches(date) {
+			continue
+		}
+		for h := 0; h < 24; h++ {
+			if c.hours&(1<<uint(h)) == 0 {
+				continue
+			}
+			for min := 0; min < 60; min++ {
+				if c.minutes&(1<<uint64(min)) == 0 || (i == 0 && h*60+min < from) {
+					continue
+				}
+				next := time.Date(date.Year(), date.Month(), date.Day(), h, min, 0, 0, c.Location)
+				if next.After(after) {
+					return next
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// Returns the last run not after the moment, zero time if there's none within the limit.
+func (c *go101Cron) Prev(now time.Time) time.Time {
+	// Runs are searched forward from a day before, going back further for rare specs.
+	for back := 1; back <= CRON_MAX_DAYS; back *= 2 {
+		var prev time.Time
+		for next := c.Next(now.AddDate(0, 0, -back)); !next.IsZero() && !next.After(now); next = c.Next(next) {
+			prev = next
+		}
+		if !prev.IsZero() {
+			return prev
+		}
+	}
+	return time.Time{}
+}
+
+// Returns the moment of "hh:mm" clock of the day in the day's zone. Clock skipped by DST shift is moved
+// forward by the shift.
+func clockOn(day time.Time, minutes int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+}
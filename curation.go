@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+const (
+	HIDDEN_GROUP   = "group"
+	HIDDEN_CHANNEL = "channel"
+)
+
+// Hides group or channel (kind) from the picker.
+func (p *go101) Hide(kind string, id uint64) error {
+	_, err := p.DB.Exec(`INSERT OR IGNORE INTO hidden (kind, id) VALUES (?, ?)`, kind, id)
+	return err
+}
+
+// Shows hidden group or channel (kind) in the picker again.
+func (p *go101) Unhide(kind string, id uint64) error {
+	_, err := p.DB.Exec(`DELETE FROM hidden WHERE kind = ? AND id = ?`, kind, id)
+	return err
+}
+
+// Returns hidden IDs of the kind.
+func (p *go101) Hidden(kind string) (map[uint64]bool, error) {
+	rows, err := p.DB.Query(`SELECT id FROM hidden WHERE kind = ?`, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	ids := make(map[uint64]bool)
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// Returns pinned group IDs in order.
+func (p *go101) PinnedGroups() ([]uint64, error) {
+	rows, err := p.DB.Query(`SELECT group_id FROM pinned_groups ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	ids := make([]uint64, 0)
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Pins group to the position (starting from 1) of the picker, 0 appends it to pinned groups.
+func (p *go101) PinGroup(gid uint64, pos int) error {
+	pinned, err := p.PinnedGroups()
+	if err != nil {
+		return err
+	}
+	ids := make([]uint64, 0, len(pinned)+1)
+	for _, id := range pinned {
+		if id != gid {
+			ids = append(ids, id)
+		}
+	}
+	if pos < 1 || pos > len(ids) {
+		pos = len(ids) + 1
+	}
+	ids = append(ids[:pos-1], append([]uint64{gid}, ids[pos-1:]...)...)
+	return p.savePinnedGroups(ids)
+}
+
+// Removes group from pinned groups.
+func (p *go101) UnpinGroup(gid uint64) error {
+	_, err := p.DB.Exec(`DELETE FROM pinned_groups WHERE group_id = ?`, gid)
+	return err
+}
+
+// Rewrites pinned groups order.
+func (p *go101) savePinnedGroups(ids []uint64) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM pinned_groups`); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for i, id := range ids {
+		if _, err = tx.Exec(`INSERT INTO pinned_groups (group_id, position) VALUES (?, ?)`, id, i+1); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Returns groups shown in the picker: pinned groups first, then others ordered by ID, hidden ones are skipped.
+func (p *go101) PickerGroups() []go101ChannelGroup {
+	hidden, err := p.Hidden(HIDDEN_GROUP)
+	if err != nil {
+		log.Println(err)
+	}
+	pinned, err := p.PinnedGroups()
+	if err != nil {
+		log.Println(err)
+	}
+	groups := make([]go101ChannelGroup, 0, len(p.ChannelGroups))
+	seen := make(map[uint64]bool)
+	for _, gid := range pinned {
+		if g, ok := p.ChannelGroups[gid]; ok && !hidden[gid] {
+			groups = append(groups, g)
+			seen[gid] = true
+		}
+	}
+	for _, g := range p.SortedGroups() {
+		if !seen[g.Id] && !hidden[g.Id] {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// Returns channels of the group shown in the picker, without hidden and restricted ones.
+func (p *go101) PickerChannels(g go101ChannelGroup) []go101Channel {
+	hidden, err := p.Hidden(HIDDEN_CHANNEL)
+	if err != nil {
+		log.Println(err)
+	}
+	channels := make([]go101Channel, 0, len(g.Channels))
+	for _, c := range g.SortedChannels() {
+		if !hidden[c.Id] && !p.Profile.ChannelRestricted(c.Id) {
+			channels = append(channels, c)
+		}
+	}
+	return channels
+}
+
+// Hide channel or group from the picker.
+func CmdHide(args []string) {
+	fs := flag.NewFlagSet("hide", flag.ExitOnError)
+	rm := fs.Bool("rm", false, "Show hidden channel or group again.")
+	group := fs.Bool("group", false, "Hide group instead of channel.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: hide [-rm] <channel> | hide [-rm] -group <group>")
+	}
+	kind := HIDDEN_CHANNEL
+	var (
+		id  uint64
+		err error
+	)
+	if *group {
+		kind = HIDDEN_GROUP
+		if id, err = strconv.ParseUint(fs.Arg(0), 10, 64); err != nil {
+			log.Fatal("Wrong group ID: ", fs.Arg(0))
+		}
+	} else if id, err = go101o.ResolveChannel(fs.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+	if *rm {
+		err = go101o.Unhide(kind, id)
+	} else {
+		err = go101o.Hide(kind, id)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Pin group to the top of the picker or move pinned group.
+func CmdPin(args []string) {
+	fs := flag.NewFlagSet("pin", flag.ExitOnError)
+	rm := fs.Bool("rm", false, "Unpin group.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if fs.NArg() == 0 {
+		go101o.LoadChannelGroups()
+		ids, err := go101o.PinnedGroups()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i, gid := range ids {
+			fmt.Printf("%d. %d - %s\n", i+1, gid, go101o.ChannelGroups[gid].Title)
+		}
+		return
+	}
+	gid, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		log.Fatal("Wrong group ID: ", fs.Arg(0))
+	}
+	switch {
+	case *rm && fs.NArg() == 1:
+		err = go101o.UnpinGroup(gid)
+	case !*rm && fs.NArg() <= 2:
+		pos := 0
+		if fs.NArg() == 2 {
+			if pos, err = strconv.Atoi(fs.Arg(1)); err != nil || pos < 1 {
+				log.Fatal("Wrong position: ", fs.Arg(1))
+			}
+		}
+		err = go101o.PinGroup(gid, pos)
+	default:
+		log.Fatal("Usage: pin [<group> [position]] | pin -rm <group>")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Group considered deprecated and should be refreshed after that period.
+const GROUP_TTL = 7 * 24 * time.Hour
+
+const dbSchema = `
+CREATE TABLE IF NOT EXISTS groups (
+	id         INTEGER PRIMARY KEY,
+	title      TEXT    NOT NULL,
+	checked_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS channels (
+	id          INTEGER NOT NULL,
+	group_id    INTEGER NOT NULL,
+	title       TEXT    NOT NULL,
+	genres      TEXT    NOT NULL DEFAULT '[]',
+	description TEXT    NOT NULL DEFAULT '',
+	logo        TEXT    NOT NULL DEFAULT '',
+	dead        INTEGER NOT NULL DEFAULT 0,
+	checked_at  INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (group_id, id)
+);
+CREATE INDEX IF NOT EXISTS channels_id ON channels (id);
+CREATE TABLE IF NOT EXISTS aliases (
+	alias      TEXT    PRIMARY KEY,
+	channel_id INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS favorites (
+	channel_id INTEGER PRIMARY KEY,
+	position   INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS history (
+	channel_id INTEGER NOT NULL,
+	track_uid  INTEGER NOT NULL,
+	artist     TEXT    NOT NULL,
+	title      TEXT    NOT NULL,
+	album      TEXT    NOT NULL DEFAULT '',
+	started_at INTEGER NOT NULL,
+	played_at  INTEGER NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS history_play ON history (channel_id, track_uid, started_at);
+CREATE INDEX IF NOT EXISTS history_played_at ON history (played_at);
+CREATE TABLE IF NOT EXISTS hidden (
+	kind TEXT    NOT NULL,
+	id   INTEGER NOT NULL,
+	PRIMARY KEY (kind, id)
+);
+CREATE TABLE IF NOT EXISTS pinned_groups (
+	group_id INTEGER PRIMARY KEY,
+	position INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS recordings (
+	track_uid   INTEGER NOT NULL,
+	hash        TEXT    NOT NULL,
+	path        TEXT    PRIMARY KEY,
+	recorded_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS recordings_track_uid ON recordings (track_uid);
+CREATE INDEX IF NOT EXISTS recordings_hash ON recordings (hash);
+CREATE TABLE IF NOT EXISTS archive_files (
+	path        TEXT    PRIMARY KEY,
+	size        INTEGER NOT NULL,
+	mod_time    INTEGER NOT NULL,
+	hash        TEXT    NOT NULL,
+	duration    REAL    NOT NULL DEFAULT 0,
+	fingerprint BLOB
+);
+CREATE INDEX IF NOT EXISTS archive_files_hash ON archive_files (hash);
+CREATE TABLE IF NOT EXISTS ratings (
+	path   TEXT    PRIMARY KEY,
+	rating INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS programs (
+	channel_id INTEGER NOT NULL,
+	starts_at  INTEGER NOT NULL,
+	title      TEXT    NOT NULL,
+	PRIMARY KEY (channel_id, starts_at)
+);
+CREATE INDEX IF NOT EXISTS programs_starts_at ON programs (starts_at);
+CREATE TABLE IF NOT EXISTS followed_artists (
+	artist TEXT PRIMARY KEY COLLATE NOCASE
+);
+CREATE TABLE IF NOT EXISTS track_keys (
+	artist     TEXT NOT NULL,
+	title      TEXT NOT NULL,
+	artist_key TEXT NOT NULL,
+	title_key  TEXT NOT NULL,
+	PRIMARY KEY (artist, title)
+);
+CREATE INDEX IF NOT EXISTS track_keys_key ON track_keys (artist_key, title_key);
+CREATE TABLE IF NOT EXISTS bookmarks (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	channel_id INTEGER NOT NULL,
+	track_uid  INTEGER NOT NULL,
+	artist     TEXT    NOT NULL,
+	title      TEXT    NOT NULL,
+	album      TEXT    NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	note       TEXT    NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX IF NOT EXISTS bookmarks_moment ON bookmarks (channel_id, created_at);
+CREATE TABLE IF NOT EXISTS schedules (
+	channel_id INTEGER PRIMARY KEY,
+	checked_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS jobs (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	instance  TEXT    NOT NULL DEFAULT '',
+	spec      TEXT    NOT NULL,
+	time_zone TEXT    NOT NULL DEFAULT '',
+	command   TEXT    NOT NULL,
+	last_run  INTEGER NOT NULL DEFAULT 0
+);
+`
+
+// Returns full path to the database file of the provider.
+func GetDatabaseFile(provider string) string {
+	ps := string(os.PathSeparator)
+	if provider == PROVIDER_101RU {
+		return GetCacheDir() + ps + "101ply.db"
+	}
+	return GetCacheDir() + ps + "101ply." + provider + ".db"
+}
+
+// Opens database and creates schema if needed.
+func OpenDB(filename string) *sql.DB {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		log.Fatal("Couldn't open database: ", err.Error())
+	}
+	if _, err = db.Exec(dbSchema); err != nil {
+		log.Fatal("Couldn't create database schema: ", err.Error())
+	}
+	return db
+}
+
+// Imports legacy data.json cache (if exists) into the database and removes it.
+func (p *go101) ImportLegacyCache(cacheFile string) {
+	fi, err := os.Stat(cacheFile)
+	if err != nil {
+		return
+	}
+	raw, err := ioutil.ReadFile(cacheFile)
+	if err != nil {
+		return
+	}
+	// Keep original cache time, so imported groups will be refreshed in time.
+	checked := fi.ModTime().Unix()
+	groups := make(map[uint64]go101ChannelGroup)
+	if err = json.Unmarshal(raw, &groups); err != nil {
+		log.Println("Couldn't parse legacy cache file: ", err.Error())
+		return
+	}
+	for _, g := range groups {
+		if err = p.SaveGroup(g, checked); err != nil {
+			log.Println("Couldn't import legacy cache file: ", err.Error())
+			return
+		}
+		if err = p.SaveChannels(g.Id, g.Channels, checked); err != nil {
+			log.Println("Couldn't import legacy cache file: ", err.Error())
+			return
+		}
+	}
+	_ = os.Remove(cacheFile)
+	Debug("Legacy cache file %s imported to database", cacheFile)
+}
+
+// Reads channel groups from the database and refreshes deprecated groups from the provider.
+func (p *go101) LoadChannelGroups() {
+	var count int
+	if err := p.DB.QueryRow(`SELECT COUNT(*) FROM groups WHERE id != ?`, DISCOVERED_GROUP).Scan(&count); err != nil {
+		log.Fatal("Error reading database: ", err.Error())
+	}
+	if count == 0 {
+		Debug("Database is empty, need generate.")
+		p.RefreshGroups(false)
+	} else if stale := p.StaleGroups(); len(stale) > 0 {
+		// Group list is checked with the groups, failure isn't fatal: groups from the database still work.
+		if groups, err := p.Provider.FetchChannelGroups(); err != nil {
+			log.Println("Couldn't fetch channel groups: ", err.Error())
+		} else if err = p.PruneGroups(groups); err != nil {
+			log.Println("Couldn't prune groups: ", err.Error())
+		}
+		for _, gid := range stale {
+			Debug("Group %d is deprecated, need regenerate.", gid)
+			if err := p.RefreshGroup(gid); err != nil {
+				log.Println("Couldn't refresh group: ", err.Error())
+			}
+		}
+	}
+	groups, err := p.ReadGroups()
+	if err != nil {
+		log.Fatal("Error reading database: ", err.Error())
+	}
+	p.ChannelGroups = groups
+}
+
+// Returns IDs of groups checked more than GROUP_TTL ago.
+func (p *go101) StaleGroups() []uint64 {
+	rows, err := p.DB.Query(`SELECT id FROM groups WHERE checked_at < ? AND id != ?`, time.Now().Add(-GROUP_TTL).Unix(), DISCOVERED_GROUP)
+	if err != nil {
+		log.Fatal("Error reading database: ", err.Error())
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	ids := make([]uint64, 0)
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Reads all groups with alive channels.
+func (p *go101) ReadGroups() (map[uint64]go101ChannelGroup, error) {
+	groups := make(map[uint64]go101ChannelGroup)
+	rows, err := p.DB.Query(`SELECT id, title FROM groups`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var g go101ChannelGroup
+		if err = rows.Scan(&g.Id, &g.Title); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		g.Channels = make(map[uint64]go101Channel)
+		groups[g.Id] = g
+	}
+	_ = rows.Close()
+
+	channels, err := p.queryChannels(`SELECT group_id, id, title, genres, description, logo FROM channels WHERE dead = 0`)
+	if err != nil {
+		return nil, err
+	}
+	for gid, list := range channels {
+		if g, ok := groups[gid]; ok {
+			for _, c := range list {
+				g.Channels[c.Id] = c
+			}
+		}
+	}
+	return groups, nil
+}
+
+// Searches alive channels by title, genre or description.
+func (p *go101) SearchChannels(query string) (map[uint64][]go101Channel, error) {
+	like := "%" + query + "%"
+	return p.queryChannels(`SELECT group_id, id, title, genres, description, logo FROM channels
+		WHERE dead = 0 AND (title LIKE ? OR genres LIKE ? OR description LIKE ?)`, like, like, like)
+}
+
+// Runs channels query and returns result indexed by group ID.
+func (p *go101) queryChannels(query string, args ...interface{}) (map[uint64][]go101Channel, error) {
+	rows, err := p.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	channels := make(map[uint64][]go101Channel)
+	for rows.Next() {
+		var (
+			gid    uint64
+			c      go101Channel
+			genres string
+		)
+		if err = rows.Scan(&gid, &c.Id, &c.Title, &genres, &c.Description, &c.Logo); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(genres), &c.Genres)
+		channels[gid] = append(channels[gid], c)
+	}
+	return channels, rows.Err()
+}
+
+// Fetches all groups from the provider and refreshes deprecated ones (or all of them if force is set).
+func (p *go101) RefreshGroups(force bool) {
+	p.FetchChannelGroups()
+	if err := p.PruneGroups(p.ChannelGroups); err != nil {
+		log.Println("Couldn't prune groups: ", err.Error())
+	}
+	for _, g := range p.ChannelGroups {
+		var checked int64
+		err := p.DB.QueryRow(`SELECT checked_at FROM groups WHERE id = ?`, g.Id).Scan(&checked)
+		if err == nil && !force && time.Since(time.Unix(checked, 0)) < GROUP_TTL {
+			// Update title only.
+			_, _ = p.DB.Exec(`UPDATE groups SET title = ? WHERE id = ?`, g.Title, g.Id)
+			continue
+		}
+		if err = p.SaveGroup(g, checked); err != nil {
+			log.Fatal("Couldn't save group: ", err.Error())
+		}
+		if err = p.RefreshGroup(g.Id); err != nil {
+			log.Println("Couldn't refresh group: ", err.Error())
+		}
+	}
+}
+
+// Removes groups disappeared from the site and marks their channels as dead. Channel rows are kept, as dead
+// channels of refreshed groups, so favorites, aliases and history still resolve them.
+func (p *go101) PruneGroups(groups map[uint64]go101ChannelGroup) error {
+	rows, err := p.DB.Query(`SELECT id FROM groups WHERE id != ?`, DISCOVERED_GROUP)
+	if err != nil {
+		return err
+	}
+	gone := make([]uint64, 0)
+	for rows.Next() {
+		var gid uint64
+		if err = rows.Scan(&gid); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if _, ok := groups[gid]; !ok {
+			gone = append(gone, gid)
+		}
+	}
+	_ = rows.Close()
+	for _, gid := range gone {
+		if _, err = p.DB.Exec(`UPDATE channels SET dead = 1 WHERE group_id = ?`, gid); err != nil {
+			return err
+		}
+		if _, err = p.DB.Exec(`DELETE FROM pinned_groups WHERE group_id = ?`, gid); err != nil {
+			return err
+		}
+		if _, err = p.DB.Exec(`DELETE FROM groups WHERE id = ?`, gid); err != nil {
+			return err
+		}
+		Debug("Group %d disappeared from the site, removed", gid)
+	}
+	return nil
+}
+
+// Fetches channels of the single group from the provider and marks disappeared channels as dead.
+func (p *go101) RefreshGroup(gid uint64) error {
+	var g go101ChannelGroup
+	err := p.DB.QueryRow(`SELECT id, title FROM groups WHERE id = ?`, gid).Scan(&g.Id, &g.Title)
+	if err != nil {
+		return fmt.Errorf("unknown group %d: %s", gid, err.Error())
+	}
+	if gid == DISCOVERED_GROUP {
+		return fmt.Errorf("group %d holds manually entered channels and can't be refreshed", gid)
+	}
+	channels, err := p.Provider.FetchChannels(g)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if err = p.SaveChannels(gid, channels, now); err != nil {
+		return err
+	}
+	if _, err = p.DB.Exec(`UPDATE channels SET dead = 1 WHERE group_id = ? AND checked_at < ?`, gid, now); err != nil {
+		return err
+	}
+	// Discovered channels appeared in the list at last.
+	if _, err = p.DB.Exec(`DELETE FROM channels WHERE group_id = ? AND id IN (SELECT id FROM channels WHERE group_id = ?)`,
+		DISCOVERED_GROUP, gid); err != nil {
+		return err
+	}
+	_, err = p.DB.Exec(`UPDATE groups SET checked_at = ? WHERE id = ?`, now, gid)
+	Debug("Group %d refreshed, %d channels", gid, len(channels))
+	return err
+}
+
+// Inserts or updates group.
+func (p *go101) SaveGroup(g go101ChannelGroup, checked int64) error {
+	_, err := p.DB.Exec(`INSERT INTO groups (id, title, checked_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title, checked_at = excluded.checked_at`, g.Id, g.Title, checked)
+	return err
+}
+
+// Inserts or updates channels of the group.
+func (p *go101) SaveChannels(gid uint64, channels map[uint64]go101Channel, checked int64) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, c := range channels {
+		genres, _ := json.Marshal(c.Genres)
+		_, err = tx.Exec(`INSERT INTO channels (id, group_id, title, genres, description, logo, dead, checked_at)
+			VALUES (?, ?, ?, ?, ?, ?, 0, ?)
+			ON CONFLICT (group_id, id) DO UPDATE SET title = excluded.title, genres = excluded.genres,
+				description = excluded.description, logo = excluded.logo, dead = 0, checked_at = excluded.checked_at`,
+			c.Id, gid, c.Title, string(genres), c.Description, c.Logo, checked)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Resolves channel given by ID or alias.
+func (p *go101) ResolveChannel(s string) (uint64, error) {
+	if id, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return id, nil
+	}
+	var id uint64
+	if err := p.DB.QueryRow(`SELECT channel_id FROM aliases WHERE alias = ?`, s).Scan(&id); err != nil {
+		return 0, fmt.Errorf("unknown channel or alias %s", s)
+	}
+	return id, nil
+}
+
+// Returns group containing the channel.
+func (p *go101) ChannelGroup(cid uint64) uint64 {
+	for gid := range p.ChannelGroups {
+		if _, ok := p.ChannelGroups[gid].Channels[cid]; ok {
+			return gid
+		}
+	}
+	return 0
+}
+
+// Saves alias of the channel.
+func (p *go101) SetAlias(alias string, cid uint64) error {
+	_, err := p.DB.Exec(`INSERT INTO aliases (alias, channel_id) VALUES (?, ?)
+		ON CONFLICT (alias) DO UPDATE SET channel_id = excluded.channel_id`, alias, cid)
+	return err
+}
+
+// Removes alias.
+func (p *go101) RemoveAlias(alias string) error {
+	_, err := p.DB.Exec(`DELETE FROM aliases WHERE alias = ?`, alias)
+	return err
+}
+
+// Returns favorite channel IDs in order.
+func (p *go101) Favorites() ([]uint64, error) {
+	rows, err := p.DB.Query(`SELECT channel_id FROM favorites ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	ids := make([]uint64, 0)
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Appends channel to favorites.
+func (p *go101) AddFavorite(cid uint64) error {
+	_, err := p.DB.Exec(`INSERT OR IGNORE INTO favorites (channel_id, position)
+		SELECT ?, COALESCE(MAX(position), 0) + 1 FROM favorites`, cid)
+	return err
+}
+
+// Removes channel from favorites.
+func (p *go101) RemoveFavorite(cid uint64) error {
+	_, err := p.DB.Exec(`DELETE FROM favorites WHERE channel_id = ?`, cid)
+	return err
+}
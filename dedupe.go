@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Either database or transaction.
+type go101Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Normalizes artist or title for dedupe: lower case, ё as е, punctuation as spaces, apostrophes dropped,
+// so "AC/DC", "Ac-Dc" and "ac dc" share the key.
+func DedupeKey(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r == '\'' || r == '’' || r == '`':
+			continue
+		case r == 'ё':
+			r = 'е'
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Adds artist and title to the dedupe index.
+func (p *go101) IndexTrack(db go101Execer, artist, title string) error {
+	_, err := db.Exec(`INSERT OR IGNORE INTO track_keys (artist, title, artist_key, title_key) VALUES (?, ?, ?, ?)`,
+		artist, title, DedupeKey(artist), DedupeKey(title))
+	return err
+}
+
+// Indexes history tracks missing in the dedupe index, e.g. played by older versions or imported.
+func (p *go101) IndexHistory() error {
+	rows, err := p.DB.Query(`SELECT DISTINCT h.artist, h.title FROM history h
+		LEFT JOIN track_keys k ON k.artist = h.artist AND k.title = h.title WHERE k.artist IS NULL`)
+	if err != nil {
+		return err
+	}
+	tracks := make([][2]string, 0)
+	for rows.Next() {
+		var t [2]string
+		if err = rows.Scan(&t[0], &t[1]); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		tracks = append(tracks, t)
+	}
+	_ = rows.Close()
+	if len(tracks) == 0 {
+		return rows.Err()
+	}
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, t := range tracks {
+		if err = p.IndexTrack(tx, t[0], t[1]); err != nil {
+			return err
+		}
+	}
+	Debug("Indexed %d history tracks", len(tracks))
+	return tx.Commit()
+}
+
+// Plays of the track in the history, whatever spelling the station used.
+type go101Heard struct {
+	Plays     int
+	Channels  int
+	FirstPlay time.Time
+	LastPlay  time.Time
+	// Channel of the last play.
+	ChannelId uint64
+}
+
+// Returns plays of the track, zero Plays if it's never heard. Empty title counts plays of the artist.
+func (p *go101) Heard(artist, title string) (go101Heard, error) {
+	var (
+		h           go101Heard
+		first, last sql.NullInt64
+		cid         sql.NullInt64
+	)
+	artistKey, titleKey := DedupeKey(artist), DedupeKey(title)
+	err := p.DB.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT h.channel_id), MIN(h.played_at), MAX(h.played_at),
+		(SELECT h2.channel_id FROM history h2 JOIN track_keys k2 ON k2.artist = h2.artist AND k2.title = h2.title
+			WHERE k2.artist_key = ?1 AND (?2 = '' OR k2.title_key = ?2) ORDER BY h2.played_at DESC LIMIT 1)
+		FROM history h JOIN track_keys k ON k.artist = h.artist AND k.title = h.title
+		WHERE k.artist_key = ?1 AND (?2 = '' OR k.title_key = ?2)`, artistKey, titleKey).
+		Scan(&h.Plays, &h.Channels, &first, &last, &cid)
+	if err != nil {
+		return h, err
+	}
+	if h.Plays > 0 {
+		h.FirstPlay, h.LastPlay = time.Unix(first.Int64, 0), time.Unix(last.Int64, 0)
+		h.ChannelId = uint64(cid.Int64)
+	}
+	return h, nil
+}
+
+// Check if the track (the playing one by default) was heard before.
+func CmdHeard(args []string) {
+	fs := flag.NewFlagSet("heard", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	var artist, title string
+	if fs.NArg() > 0 {
+		query := strings.Join(fs.Args(), " ")
+		if i := strings.Index(query, " - "); i >= 0 {
+			artist, title = query[:i], query[i+3:]
+		} else {
+			artist = query
+		}
+	} else {
+		status, err := QueryStatus(NOW_TIMEOUT)
+		if err != nil {
+			log.Fatal("Usage: heard [<artist> - <title>] (the playing track without arguments)")
+		}
+		artist, title = status.Artist, status.Title
+	}
+	if DedupeKey(artist) == "" {
+		log.Fatal("Usage: heard [<artist> - <title>] (the playing track without arguments)")
+	}
+	h, err := go101o.Heard(artist, title)
+	if err != nil {
+		log.Fatal(err)
+	}
+	what := strings.TrimSpace(artist)
+	if title != "" {
+		what += " - " + strings.TrimSpace(title)
+	}
+	if h.Plays == 0 {
+		fmt.Printf("%s: never heard\n", what)
+		return
+	}
+	go101o.LoadChannelGroups()
+	channel := fmt.Sprintf("channel %d", h.ChannelId)
+	if h.ChannelId == 0 {
+		channel = HISTORY_IMPORTED
+	} else if c, ok := go101o.ChannelGroups[go101o.ChannelGroup(h.ChannelId)].Channels[h.ChannelId]; ok {
+		channel = c.Title
+	}
+	fmt.Printf("%s: heard %d times on %d channels since %s, last %s on %s\n", what, h.Plays, h.Channels,
+		FormatDate(h.FirstPlay), FormatDateTime(h.LastPlay), channel)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"embed"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Default configuration files and themes, built into the binary.
+//
+//go:embed defaults
+var defaultsFS embed.FS
+
+// Name of the data directory next to the binary in portable mode.
+const PORTABLE_DIR = "101ply-data"
+
+// Data directory of portable mode, empty if player uses home directory.
+var portableDir string
+
+// Config and cache directories set by -config-dir and -cache-dir options, they override any other location.
+var configDirOverride, cacheDirOverride string
+
+// Returns embedded default file.
+func DefaultFile(name string) []byte {
+	raw, err := defaultsFS.ReadFile("defaults/" + name)
+	if err != nil {
+		log.Fatal("Missing default file: ", err.Error())
+	}
+	return raw
+}
+
+// Enables portable mode: config and cache are kept in 101ply-data directory next to the binary instead of
+// home directory, ex: for USB-stick install. Mode is enabled automatically if the directory exists.
+func SetPortable(enable bool) {
+	exe, err := os.Executable()
+	if err != nil {
+		if enable {
+			log.Fatal("Couldn't locate binary: ", err.Error())
+		}
+		return
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	dir := filepath.Join(filepath.Dir(exe), PORTABLE_DIR)
+	if _, err = os.Stat(dir); enable || err == nil {
+		portableDir = dir
+		Debug("Portable mode, data directory %s", dir)
+	}
+}
+
+// Sets config and cache directories, ex: for sandboxes and packages with their own data layout.
+// Empty value keeps default location.
+func SetDataDirs(config, cache string) {
+	if config != "" {
+		configDirOverride = filepath.Clean(config)
+	}
+	if cache != "" {
+		cacheDirOverride = filepath.Clean(cache)
+	}
+}
+
+// Returns per-application directory of sandbox (ex: ~/.var/app/<id>/config of Flatpak), empty if not sandboxed.
+// Real home directory isn't accessible from sandbox, so XDG variable or HOME remapped by sandbox is used instead.
+func sandboxDir(env, home string) string {
+	if Sandbox() == "" {
+		return ""
+	}
+	if dir := os.Getenv(env); dir != "" {
+		return filepath.Join(dir, "101ply")
+	}
+	if dir := os.Getenv("HOME"); dir != "" {
+		return filepath.Join(dir, home, "101ply")
+	}
+	return ""
+}
+
+// Creates config and cache directories and default config files if needed.
+func InitDirs() {
+	// Check (and create if needed) configuration directory.
+	if err := os.MkdirAll(GetConfigDir(), PRIVATE_DIR_PERM); err != nil {
+		log.Fatal("Cannot create configuration diectory.")
+	}
+	// Check (and create) hotkeys and main configuration files.
+	// For possible keys see https://github.com/BurntSushi/xgbutil/blob/master/keybind/keysymdef.go
+	// Media keys might be grabbed by desktop environment, then they reach the player via MPRIS.
+	files := map[string]string{
+		GetHotkeyConfig(): "hotkey.json",
+		GetConfigFile():   "config.json",
+	}
+	for file, name := range files {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			continue
+		}
+		if err := WriteFileAtomic(file, DefaultFile(name), PRIVATE_FILE_PERM); err != nil {
+			log.Fatal("Error when saving file: ", err.Error())
+		}
+		Debug("create default config file - %s", file)
+	}
+	// Check (and create if needed) cache directory.
+	if err := os.MkdirAll(GetCacheDir(), PRIVATE_DIR_PERM); err != nil {
+		log.Fatal("Cannot create cache diectory.")
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DIGEST_DAILY  = "daily"
+	DIGEST_WEEKLY = "weekly"
+
+	DIGEST_CHECK_INTERVAL = time.Minute
+	DIGEST_SMTP_TIMEOUT   = 30 * time.Second
+	// Longer gaps between tracks are pauses, they don't count as listening time.
+	DIGEST_MAX_GAP = 10 * time.Minute
+	DIGEST_TOP     = 10
+)
+
+// Listening diary sent by email.
+type go101DigestConfig struct {
+	// daily or weekly (default).
+	Period string `json:"period"`
+	// Local time of sending, "hh:mm", 09:00 by default. Digest covers the day or week before it.
+	At string `json:"at"`
+	// Day of weekly digest, monday by default.
+	Weekday string          `json:"weekday"`
+	From    string          `json:"from"`
+	To      []string        `json:"to"`
+	SMTP    go101SMTPConfig `json:"smtp"`
+}
+
+// Outgoing mail server.
+type go101SMTPConfig struct {
+	Host string `json:"host"`
+	// 587 by default. Port 465 is connected with TLS, others are upgraded by STARTTLS if server supports it.
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// Track of the digest with play count.
+type go101DigestTrack struct {
+	Artist  string
+	Title   string
+	Channel uint64
+	Plays   int
+	// Artist is followed.
+	Followed bool
+}
+
+// Channel with play count.
+type go101DigestChannel struct {
+	Id    uint64
+	Plays int
+}
+
+// Listening summary of the period.
+type go101Digest struct {
+	From      time.Time
+	To        time.Time
+	Tracks    int
+	Listening time.Duration
+	Artists   []go101ArtistPlays
+	Channels  []go101DigestChannel
+	// Tracks never heard before the period, followed artists and repeated ones first.
+	New       []go101DigestTrack
+	Bookmarks []go101Bookmark
+}
+
+// Sent digests, so restarts don't send them again.
+type go101DigestState struct {
+	// End of the period of the last sent digest.
+	Sent int64 `json:"sent"`
+}
+
+// Returns full path to the digest state file.
+func GetDigestFile() string {
+	ps := string(os.PathSeparator)
+	return GetCacheDir() + ps + "digest.json"
+}
+
+// Checks digest config.
+func (c *go101DigestConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Period != "" && c.Period != DIGEST_DAILY && c.Period != DIGEST_WEEKLY {
+		return fmt.Errorf("digest period must be %s or %s", DIGEST_DAILY, DIGEST_WEEKLY)
+	}
+	if c.At != "" {
+		if _, err := parseClock(c.At); err != nil {
+			return fmt.Errorf("digest: %s", err.Error())
+		}
+	}
+	if _, err := parseWeekday(c.Weekday); err != nil {
+		return err
+	}
+	if c.SMTP.Host == "" || c.From == "" || len(c.To) == 0 {
+		return fmt.Errorf("digest needs smtp host, from and to")
+	}
+	return nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	if s == "" {
+		return time.Monday, nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), s) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %s", s)
+}
+
+// Returns length of the digest period.
+func (c *go101DigestConfig) Length() time.Duration {
+	if c.Period == DIGEST_DAILY {
+		return 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// Returns schedule of sending in the zone.
+func (c *go101DigestConfig) Schedule(loc *time.Location) *go101Cron {
+	at := c.At
+	if at == "" {
+		at = "09:00"
+	}
+	minutes, _ := parseClock(at)
+	weekday := "*"
+	if c.Period != DIGEST_DAILY {
+		d, _ := parseWeekday(c.Weekday)
+		weekday = strconv.Itoa(int(d))
+	}
+	// Spec is made of checked values.
+	cron, _ := ParseCronIn(fmt.Sprintf("%d %d * * %s", minutes%60, minutes/60, weekday), loc)
+	return cron
+}
+
+// Returns the latest sending moment not after now, in the zone of now.
+func (c *go101DigestConfig) Due(now time.Time) time.Time {
+	return c.Schedule(now.Location()).Prev(now)
+}
+
+// Builds listening summary of the period from history.
+func (p *go101) Digest(from, to time.Time) (*go101Digest, error) {
+	d := &go101Digest{From: from, To: to}
+	rows, err := p.DB.Query(`SELECT played_at FROM history WHERE played_at >= ? AND played_at < ? ORDER BY played_at`,
+		from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	var last int64
+	for rows.Next() {
+		var played int64
+		if err = rows.Scan(&played); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if gap := time.Duration(played-last) * time.Second; d.Tracks > 0 && gap < DIGEST_MAX_GAP {
+			d.Listening += gap
+		}
+		last = played
+		d.Tracks++
+	}
+	_ = rows.Close()
+	if d.Artists, err = p.topArtistsBetween(from, to, DIGEST_TOP); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.DB.Query(`SELECT channel_id, COUNT(*) AS n FROM history WHERE played_at >= ? AND played_at < ?
+		AND channel_id != 0 GROUP BY channel_id ORDER BY n DESC LIMIT ?`, from.Unix(), to.Unix(), DIGEST_TOP)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c go101DigestChannel
+		if err = rows.Scan(&c.Id, &c.Plays); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		d.Channels = append(d.Channels, c)
+	}
+	_ = rows.Close()
+
+	// Spellings of the same track are counted together, as in "heard".
+	rows, err = p.DB.Query(`SELECT MAX(h.artist), MAX(h.title), MAX(h.channel_id), COUNT(*) AS n,
+		MAX(EXISTS (SELECT 1 FROM followed_artists f WHERE f.artist = h.artist)) AS followed
+		FROM history h JOIN track_keys k ON k.artist = h.artist AND k.title = h.title
+		WHERE h.played_at >= ? AND h.played_at < ? AND k.artist_key != ''
+		AND NOT EXISTS (SELECT 1 FROM history h2 JOIN track_keys k2 ON k2.artist = h2.artist AND k2.title = h2.title
+			WHERE k2.artist_key = k.artist_key AND k2.title_key = k.title_key AND h2.played_at < ?)
+		GROUP BY k.artist_key, k.title_key ORDER BY followed DESC, n DESC, MIN(h.played_at) LIMIT ?`,
+		from.Unix(), to.Unix(), from.Unix(), DIGEST_TOP)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var t go101DigestTrack
+		if err = rows.Scan(&t.Artist, &t.Title, &t.Channel, &t.Plays, &t.Followed); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		d.New = append(d.New, t)
+	}
+	_ = rows.Close()
+
+	rows, err = p.DB.Query(`SELECT id, channel_id, artist, title, created_at, note FROM bookmarks
+		WHERE created_at >= ? AND created_at < ? ORDER BY created_at`, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var (
+			b       go101Bookmark
+			created int64
+		)
+		if err = rows.Scan(&b.Id, &b.ChannelId, &b.Track.Artist, &b.Track.Title, &created, &b.Note); err != nil {
+			return nil, err
+		}
+		b.CreatedAt = time.Unix(created, 0)
+		d.Bookmarks = append(d.Bookmarks, b)
+	}
+	return d, rows.Err()
+}
+
+// Returns channel title from database, channels aren't loaded by commands.
+func (p *go101) channelTitle(cid uint64) string {
+	if cid == 0 {
+		return HISTORY_IMPORTED
+	}
+	var title string
+	if err := p.DB.QueryRow(`SELECT title FROM channels WHERE id = ?`, cid).Scan(&title); err != nil {
+		return fmt.Sprintf("channel %d", cid)
+	}
+	return title
+}
+
+// Returns dates of the digest period.
+func (d *go101Digest) Dates() string {
+	last := d.To.Add(-time.Second)
+	if d.To.Sub(d.From) <= 24*time.Hour {
+		return FormatDate(last)
+	}
+	return FormatDate(d.From) + " - " + FormatDate(last)
+}
+
+// Returns digest subject.
+func (d *go101Digest) Subject() string {
+	return "101ply: listening diary of " + d.Dates()
+}
+
+// Renders digest as plain text.
+func (p *go101) DigestText(d *go101Digest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Listening diary of %s\n\n", d.Dates())
+	if d.Tracks == 0 {
+		b.WriteString("Nothing was heard.\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Listening time: %s, %d tracks.\n", FormatDuration(d.Listening), d.Tracks)
+	if len(d.Artists) > 0 {
+		b.WriteString("\nTop artists:\n")
+		for i, a := range d.Artists {
+			fmt.Fprintf(&b, "%2d. %s (%d)\n", i+1, a.Name, a.Plays)
+		}
+	}
+	if len(d.Channels) > 0 {
+		b.WriteString("\nTop channels:\n")
+		for i, c := range d.Channels {
+			fmt.Fprintf(&b, "%2d. %s (%d)\n", i+1, p.channelTitle(c.Id), c.Plays)
+		}
+	}
+	if len(d.New) > 0 {
+		b.WriteString("\nNew tracks:\n")
+		for _, t := range d.New {
+			mark := ""
+			if t.Followed {
+				mark = " (followed artist)"
+			}
+			fmt.Fprintf(&b, "  %s - %s%s, %s", t.Artist, t.Title, mark, p.channelTitle(t.Channel))
+			if t.Plays > 1 {
+				fmt.Fprintf(&b, ", %d times", t.Plays)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if len(d.Bookmarks) > 0 {
+		b.WriteString("\nBookmarks:\n")
+		for _, bm := range d.Bookmarks {
+			fmt.Fprintf(&b, "  %s %s - %s", FormatDateTime(bm.CreatedAt), bm.Track.Artist, bm.Track.Title)
+			if bm.Note != "" {
+				fmt.Fprintf(&b, " (%s)", bm.Note)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// Sends plain text email to the digest recipients.
+func (c *go101DigestConfig) Send(subject, body string) error {
+	user, err := ResolveSecret(c.SMTP.User)
+	if err != nil {
+		return err
+	}
+	password, err := ResolveSecret(c.SMTP.Password)
+	if err != nil {
+		return err
+	}
+	port := c.SMTP.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(c.SMTP.Host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: DIGEST_SMTP_TIMEOUT}
+	var conn net.Conn
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: c.SMTP.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(DIGEST_SMTP_TIMEOUT))
+	client, err := smtp.NewClient(conn, c.SMTP.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	if ok, _ := client.Extension("STARTTLS"); ok && port != 465 {
+		if err = client.StartTLS(&tls.Config{ServerName: c.SMTP.Host}); err != nil {
+			return err
+		}
+	}
+	if user != "" {
+		// Plain auth refuses to send password over unencrypted connection to remote host.
+		if err = client.Auth(smtp.PlainAuth("", user, password, c.SMTP.Host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(c.From); err != nil {
+		return err
+	}
+	for _, to := range c.To {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", c.From, strings.Join(c.To, ", "),
+		mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	if _, err = w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func loadDigestState() go101DigestState {
+	var state go101DigestState
+	if raw, err := ioutil.ReadFile(GetDigestFile()); err == nil {
+		_ = json.Unmarshal(raw, &state)
+	}
+	return state
+}
+
+// Sends digest of the period ended at the last due moment, if it isn't sent yet. Digest missed while player
+// wasn't running is sent on start, older ones are skipped.
+func (p *go101) SendDueDigest() {
+	c := p.Config.Digest
+	due := c.Due(p.Config.Now())
+	state := loadDigestState()
+	if state.Sent >= due.Unix() {
+		return
+	}
+	d, err := p.Digest(due.Add(-c.Length()), due)
+	if err != nil {
+		log.Println("Couldn't make listening digest: ", err.Error())
+		return
+	}
+	if d.Tracks > 0 {
+		if err = c.Send(d.Subject(), p.DigestText(d)); err != nil {
+			log.Println("Couldn't send listening digest: ", err.Error())
+			return
+		}
+		Debug("Listening digest sent to %s", strings.Join(c.To, ", "))
+	}
+	state.Sent = due.Unix()
+	raw, _ := json.Marshal(state)
+	if err = WriteFileAtomic(GetDigestFile(), raw, PRIVATE_FILE_PERM); err != nil {
+		log.Println("Couldn't save digest state: ", err.Error())
+	}
+}
+
+// Sends listening digests by schedule. Runs forever.
+func (p *go101) DigestLoop() {
+	for true {
+		p.SendDueDigest()
+		time.Sleep(DIGEST_CHECK_INTERVAL)
+	}
+}
+
+// Print or send listening digest of the last day or week.
+func CmdDigest(args []string) {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	period := fs.String("period", "", "Period: daily or weekly, as in \"digest\" config by default (weekly without config).")
+	send := fs.Bool("send", false, "Send by email instead of printing, needs \"digest\" config.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	c := go101o.Config.Digest
+	if c == nil {
+		if *send {
+			log.Fatal("No \"digest\" config, see \"101ply help config\".")
+		}
+		c = &go101DigestConfig{}
+	}
+	length := c.Length()
+	switch *period {
+	case "":
+	case DIGEST_DAILY:
+		length = 24 * time.Hour
+	case DIGEST_WEEKLY:
+		length = 7 * 24 * time.Hour
+	default:
+		log.Fatalf("Unknown period %s", *period)
+	}
+	now := go101o.Config.Now()
+	d, err := go101o.Digest(now.Add(-length), now)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !*send {
+		fmt.Print(go101o.DigestText(d))
+		return
+	}
+	if err = c.Send(d.Subject(), go101o.DigestText(d)); err != nil {
+		log.Fatal("Couldn't send digest: ", err.Error())
+	}
+	fmt.Printf("Sent to %s.\n", strings.Join(c.To, ", "))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Group of channels entered manually and missing from the provider's list. Isn't refreshed from the provider.
+const (
+	DISCOVERED_GROUP uint64 = 0
+	DISCOVERED_TITLE        = "Discovered"
+)
+
+// Checks if channel is present in the loaded list.
+func (p *go101) KnownChannel(cid uint64) bool {
+	_, ok := p.ChannelGroups[p.ChannelGroup(cid)].Channels[cid]
+	return ok
+}
+
+// Makes sure the channel may be played: known channels pass as is, unknown ones are discovered.
+func (p *go101) EnsureChannel(cid uint64) error {
+	if p.KnownChannel(cid) {
+		return nil
+	}
+	return p.DiscoverChannel(cid)
+}
+
+// Checks that channel missing from the cached list (list lags behind new channels) is on air
+// and adds it to the "discovered" group.
+func (p *go101) DiscoverChannel(cid uint64) error {
+	info, err := p.Provider.FetchTrackOnAir(cid)
+	if IsGeoBlocked(err) {
+		return fmt.Errorf("channel %d isn't available in your region", cid)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't check channel %d: %s", cid, err.Error())
+	}
+	if err = info.Check(); err != nil {
+		return fmt.Errorf("channel %d doesn't exist or isn't on air: %s", cid, err.Error())
+	}
+	// Channel without track files is playable by its live stream only.
+	if _, ok := info.AudioFile(); !ok && p.Config.StreamURL == "" {
+		return fmt.Errorf("channel %d doesn't exist or isn't on air", cid)
+	}
+	c := go101Channel{
+		Id:          cid,
+		Title:       fmt.Sprintf("Channel %d", cid),
+		Genres:      []string{},
+		Description: "Entered manually.",
+	}
+	now := time.Now().Unix()
+	g := go101ChannelGroup{DISCOVERED_GROUP, DISCOVERED_TITLE, map[uint64]go101Channel{cid: c}}
+	if err = p.SaveGroup(g, now); err != nil {
+		return err
+	}
+	if err = p.SaveChannels(g.Id, g.Channels, now); err != nil {
+		return err
+	}
+	if dg, ok := p.ChannelGroups[g.Id]; ok {
+		dg.Channels[cid] = c
+	} else {
+		p.ChannelGroups[g.Id] = g
+	}
+	Debug("Channel %d discovered", cid)
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stianeikeland/go-rpio/v4"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	DISPLAY_HD44780 = "hd44780"
+	DISPLAY_SSD1306 = "ssd1306"
+
+	// ioctl request to set I2C slave address.
+	I2C_SLAVE = 0x0703
+	// ioctl request to set SPI clock, _IOW('k', 4, __u32).
+	SPI_IOC_WR_MAX_SPEED_HZ = 0x40046b04
+	SPI_SPEED_HZ            = 8000000
+	SPI_BUS_PREFIX          = "/dev/spidev"
+)
+
+// Embedded display settings. HD44780 is connected via I2C PCF8574 backpack, SSD1306 OLED via I2C or
+// 4-wire SPI.
+type go101DisplayConfig struct {
+	Driver string `json:"driver"`
+	// I2C bus device, ex: /dev/i2c-1, or SPI device, ex: /dev/spidev0.0.
+	Bus     string `json:"bus"`
+	Address int    `json:"address"`
+	// SPI only: data/command and optional reset pins, BCM numbering.
+	DCPin    uint8 `json:"dc_pin"`
+	ResetPin uint8 `json:"reset_pin"`
+	// Character grid, SSD1306 128x64 always has 21x8 characters.
+	Cols     int `json:"cols"`
+	Rows     int `json:"rows"`
+	ScrollMs int `json:"scroll_ms"`
+}
+
+// Checks if display is connected via SPI.
+func (c *go101DisplayConfig) SPI() bool {
+	return strings.HasPrefix(c.Bus, SPI_BUS_PREFIX)
+}
+
+// Character display.
+type go101Display interface {
+	Init() error
+	// Writes lines, each line is padded or cut to display width by caller.
+	WriteLines(lines []string) error
+	Size() (cols, rows int)
+	Close()
+}
+
+// Opens I2C device with given slave address.
+func OpenI2C(bus string, address int) (*os.File, error) {
+	f, err := os.OpenFile(bus, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = unix.IoctlSetInt(int(f.Fd()), I2C_SLAVE, address); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("couldn't set I2C address %#x: %s", address, err.Error())
+	}
+	return f, nil
+}
+
+// 4-wire SPI link: data/command pin selects what the written bytes are.
+type go101SPI struct {
+	dev *os.File
+	dc  rpio.Pin
+}
+
+// Opens SPI device, resets the controller by reset pin if given. GPIO must be opened on start, see OpenGPIO.
+func OpenSPI(bus string, dcPin, resetPin uint8) (*go101SPI, error) {
+	if !GPIOOpened() {
+		return nil, fmt.Errorf("GPIO isn't opened, SPI display needs it for dc_pin")
+	}
+	f, err := os.OpenFile(bus, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = unix.IoctlSetPointerInt(int(f.Fd()), SPI_IOC_WR_MAX_SPEED_HZ, SPI_SPEED_HZ); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("couldn't set SPI speed: %s", err.Error())
+	}
+	s := &go101SPI{dev: f, dc: rpio.Pin(dcPin)}
+	s.dc.Output()
+	if resetPin != 0 {
+		reset := rpio.Pin(resetPin)
+		reset.Output()
+		reset.Low()
+		time.Sleep(10 * time.Millisecond)
+		reset.High()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s, nil
+}
+
+// Writes command bytes.
+func (s *go101SPI) Commands(cmds ...byte) error {
+	s.dc.Low()
+	_, err := s.dev.Write(cmds)
+	return err
+}
+
+// Writes data bytes.
+func (s *go101SPI) Data(data []byte) error {
+	s.dc.High()
+	_, err := s.dev.Write(data)
+	return err
+}
+
+// Closes SPI device. GPIO stays mapped, GPIO controls may use it.
+func (s *go101SPI) Close() error {
+	return s.dev.Close()
+}
+
+// Returns display driver by config.
+func NewDisplay(config *go101DisplayConfig) (go101Display, error) {
+	if config.Bus == "" {
+		config.Bus = "/dev/i2c-1"
+	}
+	switch config.Driver {
+	case DISPLAY_HD44780:
+		if config.SPI() {
+			return nil, fmt.Errorf("%s display is supported via I2C only", config.Driver)
+		}
+		if config.Address == 0 {
+			config.Address = 0x27
+		}
+		if config.Cols == 0 || config.Rows == 0 {
+			config.Cols, config.Rows = 16, 2
+		}
+		return &go101HD44780{Bus: config.Bus, Address: config.Address, Cols: config.Cols, Rows: config.Rows}, nil
+	case DISPLAY_SSD1306:
+		if config.Address == 0 {
+			config.Address = 0x3c
+		}
+		return &go101SSD1306{Bus: config.Bus, Address: config.Address, DCPin: config.DCPin, ResetPin: config.ResetPin}, nil
+	default:
+		return nil, fmt.Errorf("unknown display driver %s", config.Driver)
+	}
+}
+
+// Latest player event shown on the display.
+var (
+	displayEvent     go101Event
+	displayEventMux  sync.Mutex
+	displayEventOnce sync.Once
+)
+
+// Scrolling text for the display row.
+type go101DisplayLine struct {
+	Text   string
+	offset int
+}
+
+// Returns visible part of the line and advances scroll position.
+func (l *go101DisplayLine) Window(cols int) string {
+	text := []rune(l.Text)
+	if len(text) <= cols {
+		return string(text) + strings.Repeat(" ", cols-len(text))
+	}
+	loop := append(text, []rune("   ")...)
+	window := make([]rune, cols)
+	for i := range window {
+		window[i] = loop[(l.offset+i)%len(loop)]
+	}
+	l.offset = (l.offset + 1) % len(loop)
+	return string(window)
+}
+
+// Shows channel and current track on the embedded display. Runs forever.
+func (p *go101) DisplayLoop() {
+	config := p.Config.Display
+	display, err := NewDisplay(config)
+	if err != nil {
+		panic(err)
+	}
+	if err = display.Init(); err != nil {
+		panic(err)
+	}
+	defer display.Close()
+	cols, rows := display.Size()
+
+	displayEventOnce.Do(func() {
+		displayEvent = go101Event{Track: p.Track(), Channel: p.Channel(), Status: p.Status()}
+		p.Subscribe(func(e go101Event) {
+			displayEventMux.Lock()
+			displayEvent = e
+			displayEventMux.Unlock()
+		})
+	})
+	lines := make([]*go101DisplayLine, rows)
+	for i := range lines {
+		lines[i] = &go101DisplayLine{}
+	}
+
+	interval := time.Duration(config.ScrollMs) * time.Millisecond
+	if interval <= 0 {
+		interval = 400 * time.Millisecond
+	}
+	for true {
+		displayEventMux.Lock()
+		e := displayEvent
+		displayEventMux.Unlock()
+		texts := []string{e.Channel.Title, e.Track.Artist + " - " + e.Track.Title}
+		if rows >= 3 {
+			texts = []string{e.Channel.Title, e.Track.Artist, e.Track.Title}
+		}
+		if rows >= 4 && e.Status == STATUS_PAUSE {
+			texts = append(texts, "Paused")
+		}
+		out := make([]string, rows)
+		for i, l := range lines {
+			text := ""
+			if i < len(texts) {
+				// Displays don't have Cyrillic glyphs.
+				text = BigFontText(texts[i])
+			}
+			if l.Text != text {
+				l.Text, l.offset = text, 0
+			}
+			out[i] = l.Window(cols)
+		}
+		if err = display.WriteLines(out); err != nil {
+			panic(err)
+		}
+		time.Sleep(interval)
+	}
+}
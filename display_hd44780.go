@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// PCF8574 backpack pins.
+const (
+	hd44780RS        = 0x01
+	hd44780EN        = 0x04
+	hd44780Backlight = 0x08
+)
+
+// Row start addresses of the display memory.
+var hd44780RowOffsets = []byte{0x00, 0x40, 0x14, 0x54}
+
+// HD44780 character LCD (16x2, 20x4) connected via PCF8574 I2C backpack, works in 4-bit mode.
+type go101HD44780 struct {
+	Bus     string
+	Address int
+	Cols    int
+	Rows    int
+
+	dev *os.File
+}
+
+func (d *go101HD44780) Init() (err error) {
+	if d.dev, err = OpenI2C(d.Bus, d.Address); err != nil {
+		return
+	}
+	time.Sleep(50 * time.Millisecond)
+	// Reset to 4-bit mode.
+	for _, nibble := range []byte{0x03, 0x03, 0x03, 0x02} {
+		if err = d.writeNibble(nibble, 0); err != nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Function set (4-bit, 2 lines), display on, entry mode (increment), clear.
+	for _, cmd := range []byte{0x28, 0x0C, 0x06, 0x01} {
+		if err = d.command(cmd); err != nil {
+			return
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+	return
+}
+
+func (d *go101HD44780) Size() (int, int) {
+	return d.Cols, d.Rows
+}
+
+func (d *go101HD44780) WriteLines(lines []string) error {
+	for row, line := range lines {
+		if row >= d.Rows || row >= len(hd44780RowOffsets) {
+			break
+		}
+		if err := d.command(0x80 | hd44780RowOffsets[row]); err != nil {
+			return err
+		}
+		for i, r := range []rune(line) {
+			if i >= d.Cols {
+				break
+			}
+			c := byte('?')
+			if r < 0x80 {
+				c = byte(r)
+			}
+			if err := d.write(c, hd44780RS); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *go101HD44780) Close() {
+	if d.dev != nil {
+		_ = d.command(0x01)
+		_ = d.dev.Close()
+	}
+}
+
+func (d *go101HD44780) command(cmd byte) error {
+	return d.write(cmd, 0)
+}
+
+// Writes byte as two nibbles.
+func (d *go101HD44780) write(b byte, mode byte) error {
+	if err := d.writeNibble(b>>4, mode); err != nil {
+		return err
+	}
+	return d.writeNibble(b&0x0F, mode)
+}
+
+// Writes nibble to data pins D4-D7 and pulses enable pin.
+func (d *go101HD44780) writeNibble(nibble byte, mode byte) error {
+	b := nibble<<4 | mode | hd44780Backlight
+	if _, err := d.dev.Write([]byte{b | hd44780EN}); err != nil {
+		return err
+	}
+	time.Sleep(time.Microsecond)
+	if _, err := d.dev.Write([]byte{b}); err != nil {
+		return err
+	}
+	time.Sleep(50 * time.Microsecond)
+	return nil
+}
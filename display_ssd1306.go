@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	SSD1306_WIDTH  = 128
+	SSD1306_HEIGHT = 64
+	SSD1306_PAGES  = SSD1306_HEIGHT / 8
+)
+
+// SSD1306 128x64 OLED connected via I2C or SPI (bus is SPI device). Text is drawn using the block font,
+// one character row per page.
+type go101SSD1306 struct {
+	Bus     string
+	Address int
+	// SPI only.
+	DCPin    uint8
+	ResetPin uint8
+
+	link go101SSD1306Link
+	buf  [SSD1306_WIDTH * SSD1306_PAGES]byte
+}
+
+// Link to the controller, I2C or SPI.
+type go101SSD1306Link interface {
+	Commands(cmds ...byte) error
+	Data(data []byte) error
+	Close() error
+}
+
+// I2C link: control byte tells commands from data.
+type go101SSD1306I2C struct {
+	dev *os.File
+}
+
+func (l *go101SSD1306I2C) Commands(cmds ...byte) error {
+	for _, c := range cmds {
+		if _, err := l.dev.Write([]byte{0x00, c}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *go101SSD1306I2C) Data(data []byte) error {
+	// Send in chunks, many I2C adapters limit message size.
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := l.dev.Write(append([]byte{0x40}, data[i:end]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *go101SSD1306I2C) Close() error {
+	return l.dev.Close()
+}
+
+func (d *go101SSD1306) Init() error {
+	if strings.HasPrefix(d.Bus, SPI_BUS_PREFIX) {
+		if d.DCPin == 0 {
+			return fmt.Errorf("dc_pin is required for SPI display")
+		}
+		spi, err := OpenSPI(d.Bus, d.DCPin, d.ResetPin)
+		if err != nil {
+			return err
+		}
+		d.link = spi
+	} else {
+		dev, err := OpenI2C(d.Bus, d.Address)
+		if err != nil {
+			return err
+		}
+		d.link = &go101SSD1306I2C{dev}
+	}
+	return d.link.Commands(
+		0xAE,       // display off
+		0xD5, 0x80, // clock divide
+		0xA8, 0x3F, // multiplex 64
+		0xD3, 0x00, // display offset
+		0x40,       // start line 0
+		0x8D, 0x14, // charge pump on
+		0x20, 0x00, // horizontal addressing
+		0xA1,       // segment remap
+		0xC8,       // COM scan direction
+		0xDA, 0x12, // COM pins
+		0x81, 0xCF, // contrast
+		0xD9, 0xF1, // precharge
+		0xDB, 0x40, // VCOM detect
+		0xA4, // display follows RAM
+		0xA6, // normal (not inverted)
+		0xAF, // display on
+	)
+}
+
+func (d *go101SSD1306) Size() (int, int) {
+	return SSD1306_WIDTH / (BIGFONT_WIDTH + 1), SSD1306_PAGES
+}
+
+func (d *go101SSD1306) WriteLines(lines []string) error {
+	for i := range d.buf {
+		d.buf[i] = 0
+	}
+	cols, _ := d.Size()
+	for page, line := range lines {
+		if page >= SSD1306_PAGES {
+			break
+		}
+		for i, r := range []rune(line) {
+			if i >= cols {
+				break
+			}
+			g := BigGlyph(r)
+			for x := 0; x < BIGFONT_WIDTH; x++ {
+				var column byte
+				for y := 0; y < BIGFONT_HEIGHT; y++ {
+					if g[y][x] == '#' {
+						// Leave top pixel row empty as line spacing.
+						column |= 1 << uint(y+1)
+					}
+				}
+				d.buf[page*SSD1306_WIDTH+i*(BIGFONT_WIDTH+1)+x] = column
+			}
+		}
+	}
+	if err := d.link.Commands(0x21, 0, SSD1306_WIDTH-1, 0x22, 0, SSD1306_PAGES-1); err != nil {
+		return err
+	}
+	return d.link.Data(d.buf[:])
+}
+
+func (d *go101SSD1306) Close() {
+	if d.link != nil {
+		_ = d.link.Commands(0xAE)
+		_ = d.link.Close()
+	}
+}
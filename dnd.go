@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Do-not-disturb state is cached that long, so burst of notifications doesn't query it every time.
+const DND_CACHE_TTL = 10 * time.Second
+
+var (
+	dndActive  bool
+	dndChecked time.Time
+	dndMux     sync.Mutex
+)
+
+// Checks if desktop do-not-disturb mode is active.
+func DoNotDisturb() bool {
+	dndMux.Lock()
+	defer dndMux.Unlock()
+	if time.Since(dndChecked) < DND_CACHE_TTL {
+		return dndActive
+	}
+	dndActive = queryDoNotDisturb()
+	dndChecked = time.Now()
+	return dndActive
+}
+
+// Asks notification server (KDE, dunst) and GNOME settings.
+func queryDoNotDisturb() bool {
+	if !SessionBusAvailable() {
+		return false
+	}
+	if conn, err := dbus.SessionBus(); err == nil {
+		obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+		// KDE Plasma notification server.
+		if v, err := obj.GetProperty("org.freedesktop.Notifications.Inhibited"); err == nil {
+			if inhibited, ok := v.Value().(bool); ok && inhibited {
+				return true
+			}
+		}
+		// dunst paused with "dunstctl set-paused true".
+		if v, err := obj.GetProperty("org.dunstproject.cmd0.paused"); err == nil {
+			if paused, ok := v.Value().(bool); ok && paused {
+				return true
+			}
+		}
+	}
+	// GNOME hides banners in do-not-disturb mode.
+	out, err := exec.Command("gsettings", "get", "org.gnome.desktop.notifications", "show-banners").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "false"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Name resolution of provider and CDN hosts, workaround for ISP resolvers returning dead CDN nodes.
+type go101DNSConfig struct {
+	// DNS server used instead of the system resolver, ex: "1.1.1.1" or "8.8.8.8:53".
+	Resolver string `json:"resolver"`
+	// Static host to IP overrides, ex: {"cdn1.101.ru": "1.2.3.4"}. "*.101.ru" matches any subdomain.
+	Hosts map[string]string `json:"hosts"`
+}
+
+// Returns IP override of the host.
+func (c *go101DNSConfig) lookup(host string) (string, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip, ok := c.Hosts[host]; ok {
+		return ip, true
+	}
+	for pattern, ip := range c.Hosts {
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return ip, true
+		}
+	}
+	return "", false
+}
+
+// Makes all HTTP requests of the player (provider, stream, track cache) use overrides and custom resolver.
+func InitDNS(c *go101DNSConfig) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if c.Resolver != "" {
+		server := c.Resolver
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: 5 * time.Second}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport)
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err == nil {
+			if ip, ok := c.lookup(host); ok {
+				Debug("Host %s resolved to %s by config", host, ip)
+				address = net.JoinHostPort(ip, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/godbus/dbus/v5"
+)
+
+// Time given to the slow probes: X connection, notification server and network.
+const PROBE_TIMEOUT = 5 * time.Second
+
+// Result of the capability probe.
+type go101Capability struct {
+	Name string
+	OK   bool
+	// Found version or path, or why capability isn't available.
+	Detail string
+	// Features depending on the capability.
+	Features string
+	// Player can't work without the capability.
+	Required bool
+	// Turned off by config, so it isn't reported on start.
+	Off bool
+}
+
+// Probes environment capabilities concurrently, results are in fixed order.
+func (p *go101) ProbeCapabilities() []go101Capability {
+	probes := []func() go101Capability{
+		p.probeX11,
+		p.probeAudio,
+		probeMixer,
+		probeSessionBus,
+		probeNotifications,
+		probeSystemBus,
+		p.probeNetwork,
+	}
+	results := make([]go101Capability, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(i int, probe func() go101Capability) {
+			defer wg.Done()
+			results[i] = probe()
+		}(i, probe)
+	}
+	wg.Wait()
+	return results
+}
+
+func (p *go101) probeX11() go101Capability {
+	c := go101Capability{Name: "X11", Features: "global hotkeys"}
+	wayland := os.Getenv("WAYLAND_DISPLAY") != ""
+	switch {
+	case p.Config.NoX:
+		c.Detail, c.Off = "turned off by \"no_x\" config", true
+	case os.Getenv("DISPLAY") == "" && Sandbox() != "":
+		c.Detail = Sandbox() + " sandbox without X11 socket, bind desktop shortcuts to \"101ply ctl <action>\""
+	case os.Getenv("DISPLAY") == "" && wayland:
+		c.Detail = "Wayland session without XWayland, bind desktop shortcuts to \"101ply ctl <action>\""
+	case os.Getenv("DISPLAY") == "":
+		c.Detail = "DISPLAY isn't set"
+	default:
+		X, err := xgbutil.NewConn()
+		if err != nil {
+			c.Detail = err.Error()
+			break
+		}
+		X.Conn().Close()
+		c.OK, c.Detail = true, os.Getenv("DISPLAY")
+		if wayland {
+			// XWayland delivers keys to X clients only while one of them is focused.
+			c.Detail += " (XWayland, hotkeys work only while X11 window is focused)"
+		}
+	}
+	return c
+}
+
+// Checks if audio backend can run here.
+func CheckBackend(name string) error {
+	tool := ""
+	switch name {
+	case BACKEND_MP3LIB, "":
+		return nil
+	case BACKEND_ALSA:
+		tool = "mpg123"
+	case BACKEND_MPV:
+		tool = "mpv"
+	default:
+		if _, ok := taggedBackends[name]; ok {
+			return nil
+		}
+		// Unknown or not built in.
+		_, err := NewBackend(name, nil)
+		return err
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return fmt.Errorf("%s backend needs %s installed", name, tool)
+	}
+	return nil
+}
+
+func (p *go101) probeAudio() go101Capability {
+	name := p.Config.AudioBackend
+	if name == "" {
+		name = BACKEND_MP3LIB
+	}
+	c := go101Capability{Name: "Audio backend", Features: "playback", Required: true, OK: true, Detail: name}
+	if err := CheckBackend(name); err != nil {
+		c.OK, c.Detail = false, err.Error()
+	}
+	return c
+}
+
+func probeMixer() go101Capability {
+	c := go101Capability{Name: "Mixer", Features: "volume actions, gain profiles, silent output watch"}
+	for _, tool := range []string{"pactl", "amixer"} {
+		if path, err := exec.LookPath(tool); err == nil {
+			c.OK, c.Detail = true, path
+			return c
+		}
+	}
+	c.Detail = "neither pactl nor amixer found"
+	return c
+}
+
+func probeSessionBus() go101Capability {
+	c := go101Capability{Name: "Session bus", Features: "MPRIS, pause on screen lock"}
+	if go101o.Config.NoDBus {
+		c.Detail, c.Off = "turned off by \"no_dbus\" config", true
+		return c
+	}
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		c.Detail = "DBUS_SESSION_BUS_ADDRESS isn't set"
+		return c
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.OK, c.Detail = true, conn.Names()[0]
+	return c
+}
+
+func probeNotifications() go101Capability {
+	c := go101Capability{Name: "Notification server", Features: "libnotify notifier"}
+	if !SessionBusAvailable() {
+		c.Detail, c.Off = "no session bus", go101o.Config.NoDBus
+		return c
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if UsePortals() {
+		// Notifications go through the portal, so only it is checked.
+		v, err := conn.Object(PORTAL_NAME, PORTAL_PATH).GetProperty(PORTAL_IFACE + "Notification.version")
+		if err != nil {
+			c.Detail = "notification portal isn't available: " + err.Error()
+			return c
+		}
+		c.OK, c.Detail = true, fmt.Sprintf("desktop portal, version %v", v.Value())
+		return c
+	}
+	// Servers are often started by D-Bus activation, so the call is made instead of looking up the name.
+	ctx, cancel := context.WithTimeout(context.Background(), PROBE_TIMEOUT)
+	defer cancel()
+	var name, vendor, version, spec string
+	call := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications").
+		CallWithContext(ctx, "org.freedesktop.Notifications.GetServerInformation", 0)
+	if err = call.Store(&name, &vendor, &version, &spec); err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.OK, c.Detail = true, name+" "+version
+	return c
+}
+
+func probeSystemBus() go101Capability {
+	c := go101Capability{Name: "System bus", Features: "restart after suspend"}
+	if go101o.Config.NoDBus {
+		c.Detail, c.Off = "turned off by \"no_dbus\" config", true
+		return c
+	}
+	if c.OK = SystemBusAvailable(); !c.OK {
+		c.Detail = "no system bus socket"
+	}
+	return c
+}
+
+func (p *go101) probeNetwork() go101Capability {
+	base := p.BaseUrl()
+	c := go101Capability{Name: "Network", Features: "channel list, track info, playback", Required: true}
+	client := &http.Client{Timeout: PROBE_TIMEOUT}
+	resp, err := client.Head(base)
+	if err != nil {
+		c.Detail = fmt.Sprintf("%s isn't reachable: %s", base, err.Error())
+		return c
+	}
+	_ = resp.Body.Close()
+	c.OK, c.Detail = true, fmt.Sprintf("%s replies %s", base, resp.Status)
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnavailableForLegalReasons {
+		c.Detail += ", region might be geo-blocked"
+	}
+	return c
+}
+
+// Prints missing capabilities and features they disable, all of them in verbose mode.
+func ReportCapabilities(caps []go101Capability) {
+	for _, c := range caps {
+		if c.OK || c.Off {
+			Debug("%s: %s", c.Name, c.Detail)
+			continue
+		}
+		fmt.Printf("%s: %s (disabled: %s)\n", Paint(theme.Error, c.Name), c.Detail, c.Features)
+	}
+}
+
+// Check environment and report enabled and disabled features.
+func CmdDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if Sandbox() != "" {
+		fmt.Printf("Running in %s sandbox, see \"101ply help sandbox\" for permissions.\n", Sandbox())
+	}
+	failed := false
+	for _, c := range go101o.ProbeCapabilities() {
+		mark, state := Paint(theme.Info, "ok"), "enabled"
+		if !c.OK {
+			mark, state = Paint(theme.Error, "--"), "disabled"
+			failed = failed || c.Required
+		}
+		fmt.Printf("%s %-20s %s\n", mark, c.Name, c.Detail)
+		fmt.Printf("   %-20s %s: %s\n", "", state, c.Features)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
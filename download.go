@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_DOWNLOAD_CONCURRENCY = 2
+	DEFAULT_DOWNLOAD_RETRIES     = 3
+	// First retry delay, doubled on every next one.
+	DOWNLOAD_RETRY_DELAY = 2 * time.Second
+	// Attempt is aborted if no data comes that long (stalled CDN connection), the next one resumes it.
+	DOWNLOAD_IDLE_TIMEOUT = 30 * time.Second
+)
+
+// Track downloads of the cache and the recorder.
+type go101DownloadConfig struct {
+	// Downloads running at once, others wait.
+	Concurrency int `json:"concurrency"`
+	// Attempts to resume interrupted download before giving up.
+	Retries int `json:"retries"`
+}
+
+// Downloader resuming interrupted downloads with ranged requests.
+type go101Downloader struct {
+	slots   chan struct{}
+	retries int
+}
+
+// Downloader of tracks, reconfigured from config on start.
+var downloader = NewDownloader(DEFAULT_DOWNLOAD_CONCURRENCY, DEFAULT_DOWNLOAD_RETRIES)
+
+// Returns downloader running up to concurrency downloads at once.
+func NewDownloader(concurrency, retries int) *go101Downloader {
+	if concurrency <= 0 {
+		concurrency = DEFAULT_DOWNLOAD_CONCURRENCY
+	}
+	if retries <= 0 {
+		retries = DEFAULT_DOWNLOAD_RETRIES
+	}
+	return &go101Downloader{slots: make(chan struct{}, concurrency), retries: retries}
+}
+
+// Downloads url to filename. Data goes to filename.part first, which is resumed on the next attempt,
+// and renamed only when the length matches the one announced by the server.
+func (d *go101Downloader) Download(url, filename string) error {
+	d.slots <- struct{}{}
+	defer func() {
+		<-d.slots
+	}()
+	tmp := filename + ".part"
+	delay := DOWNLOAD_RETRY_DELAY
+	var err error
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			Debug("Download of %s failed: %s, retry in %s", url, err, delay)
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = d.fetch(url, tmp); err == nil {
+			return os.Rename(tmp, filename)
+		}
+		// Client errors won't change on retry.
+		var httpErr *go101HttpError
+		if errors.As(err, &httpErr) && httpErr.Code < http.StatusInternalServerError {
+			break
+		}
+	}
+	return err
+}
+
+// Makes a single attempt, continuing the partial file if the server supports ranges.
+func (d *go101Downloader) fetch(url, tmp string) error {
+	var offset int64
+	if fi, err := os.Stat(tmp); err == nil {
+		offset = fi.Size()
+	}
+	// Whole download may take long on slow link, so only idle connection is timed out.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	idle := time.AfterFunc(DOWNLOAD_IDLE_TIMEOUT, cancel)
+	defer idle.Stop()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return idleError(ctx, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var total int64 = -1
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return fmt.Errorf("unexpected content range %q", resp.Header.Get("Content-Range"))
+		}
+		total = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Partial file is complete already, or longer than the remote one.
+		_, size, _ := parseContentRange(resp.Header.Get("Content-Range"))
+		if size == offset {
+			return nil
+		}
+		_ = os.Remove(tmp)
+		return fmt.Errorf("partial download is longer than the file")
+	default:
+		if err = CheckStatus(resp); err != nil {
+			return err
+		}
+		// Server ignored the range, start over.
+		offset = 0
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		total = resp.ContentLength
+	}
+
+	file, err := os.OpenFile(tmp, flags, PRIVATE_FILE_PERM)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(io.MultiWriter(file, stats), &go101IdleReader{resp.Body, idle, DOWNLOAD_IDLE_TIMEOUT})
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return idleError(ctx, err)
+	}
+	if total >= 0 && offset+n != total {
+		return fmt.Errorf("got %d of %d bytes: %w", offset+n, total, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// Reader pushing the idle timer back on every read.
+type go101IdleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *go101IdleReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// Explains error of the request canceled by the idle timer.
+func idleError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("no data for %s: %w", DOWNLOAD_IDLE_TIMEOUT, err)
+	}
+	return err
+}
+
+// Parses "bytes start-end/size" header value. Unknown size is returned as -1.
+func parseContentRange(s string) (start, size int64, ok bool) {
+	s = strings.TrimPrefix(s, "bytes ")
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return 0, 0, false
+	}
+	size = -1
+	if s[i+1:] != "*" {
+		var err error
+		if size, err = strconv.ParseInt(s[i+1:], 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if r := s[:i]; r != "*" {
+		j := strings.IndexByte(r, '-')
+		if j < 0 {
+			return 0, 0, false
+		}
+		var err error
+		if start, err = strconv.ParseInt(r[:j], 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, size, true
+}
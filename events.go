@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Player event types.
+const (
+	EVENT_TRACK   = "track"
+	EVENT_STATUS  = "status"
+	EVENT_CHANNEL = "channel"
+	EVENT_ERROR   = "error"
+	// Not emitted to listeners, used for notifiers filtering only.
+	EVENT_ALERT    = "alert"
+	EVENT_REMINDER = "reminder"
+	EVENT_PROGRAM  = "program"
+	EVENT_FOLLOW   = "follow"
+	EVENT_ROTATION = "rotation"
+)
+
+// Player event, passed to all listeners.
+type go101Event struct {
+	Type    string
+	Track   go101TrackInfo
+	Channel go101Channel
+	Status  uint64
+	Time    time.Time
+	// Error message of error event.
+	Error string
+}
+
+type go101Listener func(e go101Event)
+
+var (
+	listeners    []go101Listener
+	listenersMux sync.Mutex
+)
+
+// Registers listener of player events.
+func (p *go101) Subscribe(l go101Listener) {
+	listenersMux.Lock()
+	listeners = append(listeners, l)
+	listenersMux.Unlock()
+}
+
+// Sends event with current player state to all listeners. Each listener works in own goroutine.
+func (p *go101) Emit(typ string) {
+	p.emit(go101Event{Type: typ})
+}
+
+// Sends error event to all listeners.
+func (p *go101) EmitError(err error) {
+	p.emit(go101Event{Type: EVENT_ERROR, Error: err.Error()})
+}
+
+func (p *go101) emit(e go101Event) {
+	e.Track = p.Track()
+	e.Channel = p.Channel()
+	e.Status = p.Status()
+	e.Time = time.Now()
+	listenersMux.Lock()
+	defer listenersMux.Unlock()
+	for _, l := range listeners {
+		l := l
+		go Safe("event listener", func() {
+			l(e)
+		})
+	}
+}
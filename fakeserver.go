@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fake 101.ru server with canned group/channel pages, getTrackOnAir responses and silent audio files.
+// Tracks of each channel rotate every TrackDuration, so fetch/play loop sees track changes.
+type go101FakeServer struct {
+	Groups map[uint64]go101ChannelGroup
+	Tracks []go101TrackInfo
+	// Channels replying "403 Forbidden", like geo-blocked ones.
+	Blocked map[uint64]bool
+	// Channels replying without audio files, like live shows. Their live stream is served at /stream/{id}.
+	NoAudio map[uint64]bool
+	// Programs of channels with schedule, each one lasts two hours, in turn.
+	Programs      map[uint64][]string
+	TrackDuration time.Duration
+	Now           func() time.Time
+}
+
+// Returns fake server filled with canned data.
+func NewFakeServer() *go101FakeServer {
+	return &go101FakeServer{
+		Groups: map[uint64]go101ChannelGroup{
+			1: {1, "Rock", map[uint64]go101Channel{
+				100: {100, "Classic Rock", []string{"Rock", "Classic"}, "Rock hits of the 60s and 70s.", "/logo/100.png"},
+				101: {101, "Hard Rock", []string{"Rock", "Hard rock"}, "Heavy guitars only.", "/logo/101.png"},
+				102: {102, "Rock Live", []string{"Rock"}, "Live shows, no track files.", "/logo/102.png"},
+			}},
+			2: {2, "Jazz", map[uint64]go101Channel{
+				200: {200, "Smooth Jazz", []string{"Jazz"}, "Relaxing jazz around the clock.", "/logo/200.png"},
+				201: {201, "Foreign Jazz", []string{"Jazz"}, "Not available in your region.", "/logo/201.png"},
+			}},
+		},
+		Blocked: map[uint64]bool{
+			201: true,
+		},
+		NoAudio: map[uint64]bool{
+			102: true,
+		},
+		Programs: map[uint64][]string{
+			100: {"Guitar Heroes", "Rock Chronicles", "Vinyl Hour"},
+		},
+		Tracks: []go101TrackInfo{
+			{TrackUid: 1001, Artist: "Deep Purple", Title: "Highway Star", Album: "Machine Head", AlbumDate: "1972"},
+			{TrackUid: 1002, Artist: "Led Zeppelin", Title: "Kashmir", Album: "Physical Graffiti", AlbumDate: "1975"},
+			{TrackUid: 1003, Artist: "Miles Davis", Title: "So What", Album: "Kind of Blue", AlbumDate: "1959"},
+			{TrackUid: 1004, Artist: "Кино", Title: "Группа крови", Album: "Группа крови", AlbumDate: "1988"},
+		},
+		TrackDuration: 30 * time.Second,
+		Now:           time.Now,
+	}
+}
+
+func (s *go101FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/radio-top":
+		var buf bytes.Buffer
+		s.serveGroups(&buf)
+		serveWithETag(w, r, buf.Bytes())
+	case strings.HasPrefix(r.URL.Path, "/radio-group/group/"):
+		var buf bytes.Buffer
+		if !s.serveChannels(&buf, r) {
+			http.NotFound(w, r)
+			return
+		}
+		serveWithETag(w, r, buf.Bytes())
+	case strings.HasPrefix(r.URL.Path, "/radio/channel/") && strings.HasSuffix(r.URL.Path, "/schedule"):
+		var buf bytes.Buffer
+		if !s.serveSchedule(&buf, r) {
+			http.NotFound(w, r)
+			return
+		}
+		serveWithETag(w, r, buf.Bytes())
+	case strings.HasPrefix(r.URL.Path, "/api/channel/getTrackOnAir/"):
+		s.serveTrackOnAir(w, r)
+	case strings.HasPrefix(r.URL.Path, "/api/channel/trackEvents/"):
+		s.serveTrackEvents(w, r)
+	case strings.HasPrefix(r.URL.Path, "/vardata/modules/musicdb/files/"), strings.HasPrefix(r.URL.Path, "/stream/"):
+		s.serveAudio(w, r)
+	case strings.HasPrefix(r.URL.Path, "/vardata/modules/musicdb/covers/"):
+		s.serveCover(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Returns track playing on the channel at the moment and its start time. Tracks shorter than a second (ex: in
+// tests) are fine too.
+func (s *go101FakeServer) TrackAt(channel uint64, now time.Time) (go101TrackInfo, time.Time) {
+	d := int64(s.TrackDuration)
+	if d <= 0 {
+		d = int64(time.Second)
+	}
+	ts := now.UnixNano()
+	n := uint64(ts/d) + channel
+	return s.Tracks[n%uint64(len(s.Tracks))], time.Unix(0, ts-ts%d)
+}
+
+// Serves page with ETag, so conditional requests get "304 Not Modified".
+func serveWithETag(w http.ResponseWriter, r *http.Request, body []byte) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha1.Sum(body)))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+func (s *go101FakeServer) serveGroups(w io.Writer) {
+	ids := make([]int, 0, len(s.Groups))
+	for id := range s.Groups {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	_, _ = fmt.Fprint(w, `<html><body><ul class="full list menu">`)
+	for _, id := range ids {
+		_, _ = fmt.Fprintf(w, `<li><a href="/radio-group/group/%d">%s</a></li>`, id, s.Groups[uint64(id)].Title)
+	}
+	_, _ = fmt.Fprint(w, `</ul></body></html>`)
+}
+
+func (s *go101FakeServer) serveChannels(w io.Writer, r *http.Request) bool {
+	gid, _ := strconv.ParseUint(path.Base(r.URL.Path), 10, 64)
+	group, ok := s.Groups[gid]
+	if !ok {
+		return false
+	}
+	_, _ = fmt.Fprint(w, `<html><body><ul class="list list-channels">`)
+	for _, c := range group.SortedChannels() {
+		_, _ = fmt.Fprintf(w, `<li><a href="/radio/channel/%d"><img src="%s"/><div class="h3">%s</div><div class="text">%s</div></a>`,
+			c.Id, c.Logo, c.Title, c.Description)
+		_, _ = fmt.Fprint(w, `<div class="genre">`)
+		for _, g := range c.Genres {
+			_, _ = fmt.Fprintf(w, `<a href="/radio-genre/%s">%s</a>`, g, g)
+		}
+		_, _ = fmt.Fprint(w, `</div></li>`)
+	}
+	_, _ = fmt.Fprint(w, `</ul></body></html>`)
+	return true
+}
+
+func (s *go101FakeServer) serveSchedule(w io.Writer, r *http.Request) bool {
+	// Path looks like /radio/channel/{id}/schedule
+	cid, _ := strconv.ParseUint(path.Base(path.Dir(r.URL.Path)), 10, 64)
+	programs, ok := s.Programs[cid]
+	if !ok {
+		return false
+	}
+	_, _ = fmt.Fprint(w, `<html><body><ul class="schedule">`)
+	for hour := 0; hour < 24; hour += 2 {
+		_, _ = fmt.Fprintf(w, `<li><span class="time">%02d:00</span><span class="title">%s</span></li>`,
+			hour, programs[hour/2%len(programs)])
+	}
+	_, _ = fmt.Fprint(w, `</ul></body></html>`)
+	return true
+}
+
+func (s *go101FakeServer) serveTrackOnAir(w http.ResponseWriter, r *http.Request) {
+	// Path looks like /api/channel/getTrackOnAir/{id}/channel/
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	cid, err := strconv.ParseUint(parts[len(parts)-2], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if s.Blocked[cid] {
+		http.Error(w, "Channel is not available in your region", http.StatusForbidden)
+		return
+	}
+	now := s.Now()
+	track, start := s.TrackAt(cid, now)
+
+	var info TrackInfo
+	info.Status = 1
+	info.Result.About.Title = track.Title
+	info.Result.About.Artist = track.Artist
+	info.Result.About.Album.Title = track.Album
+	info.Result.About.Album.ReleaseDate = track.AlbumDate
+	info.Result.About.Album.Cover = fmt.Sprintf("/vardata/modules/musicdb/covers/%d.png", track.TrackUid)
+	info.Result.About.Audio = []TrackInfo__Result__About__Audio{
+		{track.TrackUid, fmt.Sprintf("/vardata/modules/musicdb/files/%d.mp3", track.TrackUid)},
+	}
+	if s.NoAudio[cid] {
+		info.Result.About.Audio = nil
+	}
+	info.Result.Stat.StartSong = uint64(start.Unix())
+	info.Result.Stat.FinishSong = uint64(start.Add(s.TrackDuration).Unix())
+	info.Result.Stat.ServerTime = uint64(now.Unix())
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(info)
+}
+
+// Streams track changes of the channel as server-sent events, like the web player gets them.
+func (s *go101FakeServer) serveTrackEvents(w http.ResponseWriter, r *http.Request) {
+	// Path looks like /api/channel/trackEvents/{id}/
+	cid, err := strconv.ParseUint(path.Base(r.URL.Path), 10, 64)
+	flusher, ok := w.(http.Flusher)
+	if err != nil || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if s.Blocked[cid] {
+		http.Error(w, "Channel is not available in your region", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		_, start := s.TrackAt(cid, s.Now())
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(time.Until(start.Add(s.TrackDuration))):
+		}
+		track, _ := s.TrackAt(cid, s.Now())
+		if _, err = fmt.Fprintf(w, "event: track\ndata: {\"uid\": %d}\n\n", track.TrackUid); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Serves a track of silent MPEG-1 Layer III frames (128 kbps, 44.1 kHz, mono). Ranged requests are
+// supported, so downloads may be resumed.
+func (s *go101FakeServer) serveAudio(w http.ResponseWriter, r *http.Request) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0xC0})
+	// Each frame holds 1152 samples.
+	frames := int(s.TrackDuration.Seconds() * 44100 / 1152)
+	w.Header().Set("Content-Type", "audio/mpeg")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(bytes.Repeat(frame, frames)))
+}
+
+// Serves a single-color cover image, color depends on the track.
+func (s *go101FakeServer) serveCover(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(strings.TrimSuffix(path.Base(r.URL.Path), ".png"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: uint8(uid * 40), G: uint8(uid * 80), B: 160, A: 255}}, image.Point{}, draw.Src)
+	w.Header().Set("Content-Type", "image/png")
+	_ = png.Encode(w, img)
+}
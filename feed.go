@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+)
+
+const FEED_SIZE = 20
+
+// RSS 2.0 document.
+type go101Rss struct {
+	XMLName xml.Name        `xml:"rss"`
+	Version string          `xml:"version,attr"`
+	Channel go101RssChannel `xml:"channel"`
+}
+
+type go101RssChannel struct {
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	PubDate     string         `xml:"pubDate,omitempty"`
+	Items       []go101RssItem `xml:"item"`
+}
+
+type go101RssItem struct {
+	Title   string       `xml:"title"`
+	Guid    go101RssGuid `xml:"guid"`
+	PubDate string       `xml:"pubDate"`
+	Desc    string       `xml:"description,omitempty"`
+}
+
+type go101RssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// Returns full path to the feeds directory.
+func GetFeedDir() string {
+	ps := string(os.PathSeparator)
+	return GetCacheDir() + ps + "feeds"
+}
+
+// Returns full path to the "now playing" feed of the channel.
+func GetFeedFile(cid uint64) string {
+	ps := string(os.PathSeparator)
+	return fmt.Sprintf("%s%s%d.xml", GetFeedDir(), ps, cid)
+}
+
+// Writes RSS feed of recently played tracks of the channel. Called after each history write.
+func (p *go101) WriteFeed(channel go101Channel) error {
+	if err := os.MkdirAll(GetFeedDir(), PRIVATE_DIR_PERM); err != nil {
+		return err
+	}
+	entries, err := p.History(channel.Id, FEED_SIZE)
+	if err != nil {
+		return err
+	}
+	feed := go101Rss{
+		Version: "2.0",
+		Channel: go101RssChannel{
+			Title:       "101ply: " + channel.Title,
+			Link:        fmt.Sprintf("%s/radio/channel/%d", p.BaseUrl(), channel.Id),
+			Description: channel.Description,
+			Items:       make([]go101RssItem, 0, len(entries)),
+		},
+	}
+	if feed.Channel.Description == "" {
+		feed.Channel.Description = "Recently played on " + channel.Title
+	}
+	for _, e := range entries {
+		item := go101RssItem{
+			Title:   e.Track.Artist + " - " + e.Track.Title,
+			Guid:    go101RssGuid{Value: fmt.Sprintf("101ply:%d:%d:%d", e.ChannelId, e.Track.TrackUid, e.Track.Start)},
+			PubDate: e.PlayedAt.Format(time.RFC1123Z),
+			Desc:    e.Track.Album,
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	if len(entries) > 0 {
+		feed.Channel.PubDate = entries[0].PlayedAt.Format(time.RFC1123Z)
+	}
+	raw, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(GetFeedFile(channel.Id), []byte(xml.Header+string(raw)), PRIVATE_FILE_PERM)
+}
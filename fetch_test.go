@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "101ply-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	SetDataDirs(filepath.Join(dir, "config"), filepath.Join(dir, "cache"))
+	InitDirs()
+	// Fake server needs no protection.
+	rateLimiter = NewRateLimiter(60000, 1000)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// Backend remembering streams instead of playing them.
+type go101TestBackend struct {
+	mux    sync.Mutex
+	played []string
+	stops  int
+	// Error returned by Play.
+	fail error
+	// Receives URL of every Play call.
+	plays chan string
+}
+
+func newTestBackend() *go101TestBackend {
+	return &go101TestBackend{plays: make(chan string, 16)}
+}
+
+func (b *go101TestBackend) Play(url string) error {
+	b.mux.Lock()
+	b.played = append(b.played, url)
+	err := b.fail
+	b.mux.Unlock()
+	b.plays <- url
+	return err
+}
+
+func (b *go101TestBackend) Stop() {
+	b.mux.Lock()
+	b.stops++
+	b.mux.Unlock()
+}
+
+func (b *go101TestBackend) Mute()   {}
+func (b *go101TestBackend) Unmute() {}
+func (b *go101TestBackend) Close()  {}
+
+// Waits for the next Play call, fails the test after a while.
+func (b *go101TestBackend) waitPlay(t *testing.T) string {
+	t.Helper()
+	select {
+	case url := <-b.plays:
+		return url
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream isn't started")
+		return ""
+	}
+}
+
+// Checks there's no Play call for a moment.
+func (b *go101TestBackend) noPlay(t *testing.T) {
+	t.Helper()
+	select {
+	case url := <-b.plays:
+		t.Fatalf("unexpected stream start %s", url)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Clock of the fake server, moved by tests.
+type go101TestClock struct {
+	mux sync.Mutex
+	now time.Time
+}
+
+func (c *go101TestClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *go101TestClock) Add(d time.Duration) {
+	c.mux.Lock()
+	c.now = c.now.Add(d)
+	c.mux.Unlock()
+}
+
+// Returns player on the channel 100 of the fake server, with stopped clock at the start of a track.
+func newTestPlayer(t *testing.T) (*go101, *go101MockProvider, *go101TestBackend, *go101TestClock) {
+	t.Helper()
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Intervals without jitter.
+	config.Polling = &go101PollingConfig{}
+	provider := NewMockProvider()
+	t.Cleanup(provider.Close)
+	d := provider.Fake.TrackDuration
+	clock := &go101TestClock{now: time.Now().Truncate(d).Add(time.Second)}
+	provider.Fake.Now = clock.Now
+	backend := newTestBackend()
+	p := &go101{
+		Config:   config,
+		Provider: provider,
+		Backend:  backend,
+		DB:       OpenDB(filepath.Join(t.TempDir(), "101ply.db")),
+	}
+	t.Cleanup(func() {
+		_ = p.DB.Close()
+	})
+	if p.TrackFormat, err = ParseTrackFormat(config.TrackFormat); err != nil {
+		t.Fatal(err)
+	}
+	if p.ChannelGroups, err = provider.FetchChannelGroups(); err != nil {
+		t.Fatal(err)
+	}
+	for id, g := range p.ChannelGroups {
+		if g.Channels, err = provider.FetchChannels(g); err != nil {
+			t.Fatal(err)
+		}
+		p.ChannelGroups[id] = g
+	}
+	p.CurrentChannel = 100
+	p.CurrentGroup = p.ChannelGroup(100)
+	return p, provider, backend, clock
+}
+
+func TestFetchChannelInfo(t *testing.T) {
+	p, provider, _, clock := newTestPlayer(t)
+	p.FetchChannelInfo()
+
+	want, start := provider.Fake.TrackAt(100, clock.Now())
+	track := p.CurrentTrack
+	if track.TrackUid != want.TrackUid || track.Artist != want.Artist || track.Title != want.Title ||
+		track.Album != want.Album || track.AlbumDate != want.AlbumDate {
+		t.Fatalf("got track %+v, want %+v", track, want)
+	}
+	if url := fmt.Sprintf("%s/vardata/modules/musicdb/files/%d.mp3", provider.BaseUrl, want.TrackUid); track.PlayURL != url {
+		t.Errorf("got play URL %s, want %s", track.PlayURL, url)
+	}
+	if cover := fmt.Sprintf("%s/vardata/modules/musicdb/covers/%d.png", provider.BaseUrl, want.TrackUid); track.Cover != cover {
+		t.Errorf("got cover %s, want %s", track.Cover, cover)
+	}
+	if track.Start != uint64(start.Unix()) {
+		t.Errorf("got start %d, want %d", track.Start, start.Unix())
+	}
+	left := uint64(start.Add(provider.Fake.TrackDuration).Sub(clock.Now()) / time.Second)
+	if want := p.PollInterval(left - 3); p.NextFetch != want {
+		t.Errorf("got next fetch in %d seconds, want %d", p.NextFetch, want)
+	}
+	if p.FetchFailures != 0 {
+		t.Errorf("got %d fetch failures", p.FetchFailures)
+	}
+}
+
+func TestApplyTrackInfo(t *testing.T) {
+	p, _, _, _ := newTestPlayer(t)
+	info := func(uid uint64, filename string) *TrackInfo {
+		var i TrackInfo
+		i.Result.About.Title = "Title"
+		i.Result.About.Artist = "Artist"
+		i.Result.About.Audio = []TrackInfo__Result__About__Audio{{uid, filename}}
+		i.Result.Stat.StartSong = 1000
+		i.Result.Stat.FinishSong = 1200
+		i.Result.Stat.ServerTime = 1100
+		return &i
+	}
+	for _, c := range []struct {
+		name     string
+		filename string
+		url      string
+	}{
+		{"relative", "/vardata/modules/musicdb/files/1.mp3", p.BaseUrl() + "/vardata/modules/musicdb/files/1.mp3"},
+		{"full", "http://cdn1.101.ru/vardata/modules/musicdb/files/1.mp3", "http://cdn1.101.ru/vardata/modules/musicdb/files/1.mp3"},
+		{"doubled path", "http://cdn1.101.ru/vardata/modules/musicdb/files//vardata/modules/musicdb/files/1.mp3",
+			"http://cdn1.101.ru/vardata/modules/musicdb/files/1.mp3"},
+	} {
+		if err := p.ApplyTrackInfo(100, info(1, c.filename)); err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if p.CurrentTrack.PlayURL != c.url {
+			t.Errorf("%s: got play URL %s, want %s", c.name, p.CurrentTrack.PlayURL, c.url)
+		}
+	}
+	if left := time.Until(p.CurrentTrack.Ends); left < 99*time.Second || left > 100*time.Second {
+		t.Errorf("track ends in %s, want 100s by the server clock", left)
+	}
+	if p.NextFetch != p.PollInterval(97) {
+		t.Errorf("got next fetch in %d seconds, want %d", p.NextFetch, p.PollInterval(97))
+	}
+
+	// Station error keeps the current track.
+	failed := info(2, "/2.mp3")
+	failed.ErrorCode, failed.ErrorMessage = 404, "Channel not found"
+	var ae *go101ApiError
+	if err := p.ApplyTrackInfo(100, failed); !errors.As(err, &ae) || ae.Code != 404 {
+		t.Errorf("got error %v, want station error 404", err)
+	}
+	if p.CurrentTrack.TrackUid != 1 {
+		t.Errorf("current track is replaced by track %d of failed reply", p.CurrentTrack.TrackUid)
+	}
+}
+
+func TestStaleTrackInfo(t *testing.T) {
+	p, provider, _, clock := newTestPlayer(t)
+	p.FetchChannelInfo()
+	fresh := p.CurrentTrack
+
+	// Provider serves a copy cached a minute ago: server clock lags.
+	clock.Add(-time.Minute)
+	p.FetchChannelInfo()
+	if p.CurrentTrack.TrackUid != fresh.TrackUid || p.CurrentTrack.Start != fresh.Start {
+		t.Errorf("stale track %d is applied over %d", p.CurrentTrack.TrackUid, fresh.TrackUid)
+	}
+	if p.NextFetch != p.RetryInterval(1) {
+		t.Errorf("got next fetch in %d seconds, want re-poll in %d", p.NextFetch, p.RetryInterval(1))
+	}
+	// Stale copy served again, re-polls back off.
+	p.FetchChannelInfo()
+	if p.NextFetch != p.RetryInterval(2) || p.StaleReplies != 2 {
+		t.Errorf("got next fetch in %d seconds after %d stale replies, want %d", p.NextFetch, p.StaleReplies, p.RetryInterval(2))
+	}
+
+	// Track finished already by the server clock.
+	var info TrackInfo
+	info.Result.Stat.FinishSong = 1000
+	info.Result.Stat.ServerTime = 1000
+	if !p.StaleTrackInfo(&info) {
+		t.Error("finished track isn't stale")
+	}
+
+	// Fresh reply after the clock catches up.
+	clock.Add(time.Minute + provider.Fake.TrackDuration)
+	p.FetchChannelInfo()
+	if p.CurrentTrack.TrackUid == fresh.TrackUid {
+		t.Error("next track isn't applied")
+	}
+	if p.StaleReplies != 0 {
+		t.Errorf("got %d stale replies after fresh one", p.StaleReplies)
+	}
+}
+
+func TestFetchFailed(t *testing.T) {
+	p, _, _, _ := newTestPlayer(t)
+	p.FetchChannelInfo()
+	playing := p.CurrentTrack
+
+	// Geo-blocked channel without fallback: retries with backoff, current track stays.
+	p.CurrentChannel = 201
+	p.CurrentGroup = p.ChannelGroup(201)
+	for i := 1; i <= 3; i++ {
+		p.FetchChannelInfo()
+		if p.FetchFailures != i {
+			t.Fatalf("got %d fetch failures, want %d", p.FetchFailures, i)
+		}
+		if p.NextFetch != p.RetryInterval(i) {
+			t.Errorf("got next fetch in %d seconds after %d failures, want %d", p.NextFetch, i, p.RetryInterval(i))
+		}
+	}
+	if p.RetryInterval(3) <= p.RetryInterval(1) {
+		t.Errorf("retry interval doesn't grow: %d, %d", p.RetryInterval(1), p.RetryInterval(3))
+	}
+	if p.CurrentTrack.TrackUid != playing.TrackUid {
+		t.Errorf("failed fetch replaced track %d by %d", playing.TrackUid, p.CurrentTrack.TrackUid)
+	}
+
+	// Successful fetch resets failures.
+	p.CurrentChannel = 100
+	p.CurrentGroup = p.ChannelGroup(100)
+	p.FetchChannelInfo()
+	if p.FetchFailures != 0 {
+		t.Errorf("got %d fetch failures after success", p.FetchFailures)
+	}
+}
+
+func TestChannelStreamURL(t *testing.T) {
+	p, provider, _, _ := newTestPlayer(t)
+	for _, c := range []struct {
+		pattern string
+		url     string
+	}{
+		{"https://radio.example/air/%d.mp3", "https://radio.example/air/100.mp3"},
+		{"/stream/%d", provider.BaseUrl + "/stream/100"},
+		{"https://radio.example/air%20hd/%d?ch=%d", "https://radio.example/air%20hd/100?ch=100"},
+	} {
+		p.Config.StreamURL = c.pattern
+		if url, err := p.ChannelStreamURL(100); err != nil || url != c.url {
+			t.Errorf("%s: got %s, %v, want %s", c.pattern, url, err, c.url)
+		}
+	}
+	p.Config.StreamURL = ""
+	if _, err := p.ChannelStreamURL(100); err == nil {
+		t.Error("got stream URL without pattern")
+	}
+}
+
+func TestPruneGroups(t *testing.T) {
+	p, _, _, _ := newTestPlayer(t)
+	for _, g := range p.ChannelGroups {
+		if err := p.SaveGroup(g, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SaveChannels(g.Id, g.Channels, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Jazz group disappeared from the site.
+	gid := p.ChannelGroup(200)
+	groups := make(map[uint64]go101ChannelGroup)
+	for id, g := range p.ChannelGroups {
+		if id != gid {
+			groups[id] = g
+		}
+	}
+	if err := p.PruneGroups(groups); err != nil {
+		t.Fatal(err)
+	}
+	read, err := p.ReadGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := read[gid]; ok {
+		t.Errorf("group %d isn't removed", gid)
+	}
+	if len(read) != len(groups) {
+		t.Errorf("got %d groups, want %d", len(read), len(groups))
+	}
+	var dead bool
+	if err = p.DB.QueryRow(`SELECT dead FROM channels WHERE id = 200`).Scan(&dead); err != nil || !dead {
+		t.Errorf("channel of removed group isn't dead: %v", err)
+	}
+}
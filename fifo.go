@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Returns full path to the command FIFO of the running player instance.
+func GetCommandFifo() string {
+	ps := string(os.PathSeparator)
+	return GetRuntimeDir() + ps + "cmd"
+}
+
+// Reads newline-delimited commands from the FIFO, for shells without socket clients (echo pause > ~/.cache/101ply/cmd).
+// Commands are the same as of the control socket, replies are discarded. Runs forever.
+func (p *go101) FifoLoop() {
+	fifo := GetCommandFifo()
+	if info, err := os.Stat(fifo); err == nil && info.Mode()&os.ModeNamedPipe == 0 {
+		// Regular file in place of the FIFO, ex: created by echo before the first start.
+		_ = os.Remove(fifo)
+	}
+	if err := syscall.Mkfifo(fifo, uint32(PRIVATE_FILE_PERM)); err != nil && !os.IsExist(err) {
+		panic(fmt.Errorf("couldn't create command FIFO: %s", err.Error()))
+	}
+	// Opened for writing too, so reads don't end with EOF each time a writer closes the FIFO.
+	f, err := os.OpenFile(fifo, os.O_RDWR, 0)
+	if err != nil {
+		panic(fmt.Errorf("couldn't open command FIFO: %s", err.Error()))
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		reply, err := p.Command(line)
+		if err != nil {
+			log.Println("Couldn't run FIFO command: ", err.Error())
+			continue
+		}
+		Debug("FIFO command %s: %s", line, strings.TrimSpace(reply))
+	}
+	panic(fmt.Errorf("command FIFO closed: %v", scanner.Err()))
+}
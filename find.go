@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parallel requests to the provider while scanning channels on air.
+const FIND_WORKERS = 8
+
+// Track found on the channel.
+type go101Found struct {
+	Channel go101Channel
+	Track   go101TrackInfo
+	// Zero for tracks on air.
+	PlayedAt time.Time
+}
+
+// Checks if artist or title of the track contains the query.
+func TrackMatches(track go101TrackInfo, query string) bool {
+	query = strings.ToLower(query)
+	return strings.Contains(strings.ToLower(track.Artist), query) ||
+		strings.Contains(strings.ToLower(track.Title), query) ||
+		strings.Contains(strings.ToLower(track.Artist+" - "+track.Title), query)
+}
+
+// Returns channels playing a track matching the query right now.
+func (p *go101) FindOnAir(query string) []go101Found {
+	channels := make(chan go101Channel)
+	var (
+		found []go101Found
+		mux   sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < FIND_WORKERS; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range channels {
+				trackInfo, err := p.Provider.FetchTrackOnAir(c.Id)
+				if err != nil {
+					continue
+				}
+				info := go101{Provider: p.Provider, Config: p.Config}
+				if info.ApplyTrackInfo(c.Id, trackInfo) != nil {
+					continue
+				}
+				if TrackMatches(info.CurrentTrack, query) {
+					mux.Lock()
+					found = append(found, go101Found{Channel: c, Track: info.CurrentTrack})
+					mux.Unlock()
+				}
+			}
+		}()
+	}
+	for _, g := range p.SortedGroups() {
+		for _, c := range g.SortedChannels() {
+			if !p.Profile.ChannelRestricted(c.Id) {
+				channels <- c
+			}
+		}
+	}
+	close(channels)
+	wg.Wait()
+	return found
+}
+
+// Returns channels played a track matching the query before, according to the history.
+func (p *go101) FindInHistory(query string, limit int) ([]go101Found, error) {
+	like := "%" + query + "%"
+	rows, err := p.DB.Query(`SELECT channel_id, track_uid, artist, title, album, MAX(played_at) FROM history
+		WHERE channel_id != 0 AND (artist LIKE ? OR title LIKE ? OR artist || ' - ' || title LIKE ?)
+		GROUP BY channel_id, track_uid ORDER BY MAX(played_at) DESC LIMIT ?`, like, like, like, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	found := make([]go101Found, 0)
+	for rows.Next() {
+		var (
+			f      go101Found
+			cid    uint64
+			played int64
+		)
+		if err = rows.Scan(&cid, &f.Track.TrackUid, &f.Track.Artist, &f.Track.Title, &f.Track.Album, &played); err != nil {
+			return nil, err
+		}
+		if p.Profile.ChannelRestricted(cid) {
+			continue
+		}
+		f.Channel = p.ChannelGroups[p.ChannelGroup(cid)].Channels[cid]
+		if f.Channel.Id == 0 {
+			f.Channel = go101Channel{Id: cid, Title: fmt.Sprintf("channel %d", cid)}
+		}
+		f.PlayedAt = time.Unix(played, 0)
+		found = append(found, f)
+	}
+	return found, rows.Err()
+}
+
+// Find channels playing the artist or title.
+func CmdFind(args []string) {
+	fs := flag.NewFlagSet("find", flag.ExitOnError)
+	onAir := fs.Bool("now", false, "Search only tracks on air now.")
+	history := fs.Bool("history", false, "Search only the listening history.")
+	limit := fs.Int("n", 20, "Max number of history results.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	query := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if query == "" {
+		log.Fatal("Usage: 101ply find [-now|-history] <artist or title>")
+	}
+	go101o.LoadChannelGroups()
+	if !*history {
+		fmt.Println("On air:")
+		found := go101o.FindOnAir(query)
+		for _, f := range found {
+			fmt.Printf("    %d - %s\n", f.Channel.Id, go101o.ConsoleText(fmt.Sprintf("%s: %s - %s", f.Channel.Title, f.Track.Artist, f.Track.Title)))
+		}
+		if len(found) == 0 {
+			fmt.Println("    nothing found")
+		}
+	}
+	if !*onAir {
+		found, err := go101o.FindInHistory(query, *limit)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Played recently:")
+		for _, f := range found {
+			fmt.Printf("    %d - %s (%s)\n", f.Channel.Id, go101o.ConsoleText(fmt.Sprintf("%s: %s - %s", f.Channel.Title, f.Track.Artist, f.Track.Title)), FormatDateTime(f.PlayedAt))
+		}
+		if len(found) == 0 {
+			fmt.Println("    nothing found")
+		}
+	}
+}
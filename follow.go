@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const DEFAULT_FOLLOW_INTERVAL = 60
+
+// Followed artists monitoring.
+type go101FollowConfig struct {
+	// Channel IDs or aliases to monitor, favorites if empty.
+	Channels []string `json:"channels"`
+	// Seconds between checks of the channels.
+	IntervalSeconds int `json:"interval_seconds"`
+	// Switch to the channel playing followed artist, unless followed artist plays already.
+	AutoSwitch bool `json:"auto_switch"`
+}
+
+// Returns followed artists.
+func (p *go101) FollowedArtists() ([]string, error) {
+	rows, err := p.DB.Query(`SELECT artist FROM followed_artists ORDER BY artist`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	artists := make([]string, 0)
+	for rows.Next() {
+		var artist string
+		if err = rows.Scan(&artist); err != nil {
+			return nil, err
+		}
+		artists = append(artists, artist)
+	}
+	return artists, rows.Err()
+}
+
+func (p *go101) FollowArtist(artist string) error {
+	_, err := p.DB.Exec(`INSERT OR IGNORE INTO followed_artists (artist) VALUES (?)`, artist)
+	return err
+}
+
+func (p *go101) UnfollowArtist(artist string) error {
+	_, err := p.DB.Exec(`DELETE FROM followed_artists WHERE artist = ?`, artist)
+	return err
+}
+
+// Returns followed artist of the track, empty if the artist isn't followed.
+func FollowedArtist(track go101TrackInfo, artists []string) string {
+	for _, artist := range artists {
+		if strings.EqualFold(strings.TrimSpace(track.Artist), artist) {
+			return artist
+		}
+	}
+	return ""
+}
+
+// Returns monitored channels: configured ones or favorites.
+func (p *go101) FollowChannels() ([]uint64, error) {
+	c := p.Config.Follow
+	if c == nil || len(c.Channels) == 0 {
+		return p.Favorites()
+	}
+	ids := make([]uint64, 0, len(c.Channels))
+	for _, s := range c.Channels {
+		cid, err := p.ResolveChannel(s)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, cid)
+	}
+	return ids, nil
+}
+
+// Polls monitored channels concurrently and calls found for followed artists on air. Each track is reported once.
+// Runs forever.
+func (p *go101) WatchFollowed(found func(channel go101Channel, track go101TrackInfo)) {
+	interval := DEFAULT_FOLLOW_INTERVAL
+	if p.Config.Follow != nil && p.Config.Follow.IntervalSeconds > 0 {
+		interval = p.Config.Follow.IntervalSeconds
+	}
+	reported := make(map[uint64]uint64)
+	for true {
+		artists, err := p.FollowedArtists()
+		if err != nil {
+			log.Println("Couldn't read followed artists: ", err.Error())
+		}
+		ids, err := p.FollowChannels()
+		if err != nil {
+			log.Println(err)
+		}
+		if len(artists) == 0 {
+			time.Sleep(time.Duration(interval) * time.Second)
+			continue
+		}
+		tracks := p.PollChannels(ids)
+		for _, cid := range ids {
+			track, ok := tracks[cid]
+			if !ok || FollowedArtist(track, artists) == "" || reported[cid] == track.TrackUid {
+				continue
+			}
+			reported[cid] = track.TrackUid
+			found(p.ChannelGroups[p.ChannelGroup(cid)].Channels[cid], track)
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
+
+// Notifies about followed artists on other channels and switches to them if configured. Runs forever.
+func (p *go101) FollowLoop() {
+	p.WatchFollowed(func(channel go101Channel, track go101TrackInfo) {
+		if channel.Id == p.ChannelId() {
+			return
+		}
+		p.FollowedOnAir(channel, track)
+		if !p.Config.Follow.AutoSwitch || p.Status() != STATUS_PLAY {
+			return
+		}
+		// Don't leave followed artist for another one.
+		artists, _ := p.FollowedArtists()
+		if FollowedArtist(p.Track(), artists) == "" {
+			p.SwitchChannel(channel.Id)
+		}
+	})
+}
+
+// Prints and notifies about followed artist on air.
+func (p *go101) FollowedOnAir(channel go101Channel, track go101TrackInfo) {
+	message := fmt.Sprintf("%s - %s on %s", track.Artist, track.Title, channel.Title)
+	fmt.Printf("\n%s: %s\n", Paint(theme.Info, "Followed artist"), p.ConsoleText(message))
+	p.Notify(EVENT_FOLLOW, "101ply: "+track.Artist, message)
+}
+
+// Manage followed artists.
+func CmdFollow(args []string) {
+	fs := flag.NewFlagSet("follow", flag.ExitOnError)
+	rm := fs.Bool("rm", false, "Stop following the artist.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if fs.NArg() == 0 {
+		artists, err := go101o.FollowedArtists()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, artist := range artists {
+			fmt.Println(artist)
+		}
+		return
+	}
+	artist := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	var err error
+	if *rm {
+		err = go101o.UnfollowArtist(artist)
+	} else {
+		err = go101o.FollowArtist(artist)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Monitor channels for followed artists without playing.
+func CmdWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	go101o.LoadChannelGroups()
+	if err := go101o.SetNotifiers(); err != nil {
+		log.Fatal(err)
+	}
+	ids, err := go101o.FollowChannels()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(ids) == 0 {
+		log.Fatal("No channels to watch: add favorites or set follow.channels in config")
+	}
+	fmt.Printf("Watching %d channels for followed artists.\n", len(ids))
+	go101o.WatchFollowed(go101o.FollowedOnAir)
+}
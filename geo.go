@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Unexpected HTTP response status.
+type go101HttpError struct {
+	URL    string
+	Code   int
+	Status string
+}
+
+func (e *go101HttpError) Error() string {
+	return fmt.Sprintf("got status %s from %s", e.Status, e.URL)
+}
+
+// Checks HTTP response status, returns go101HttpError if it isn't 200 OK.
+func CheckStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	return &go101HttpError{resp.Request.URL.String(), resp.StatusCode, resp.Status}
+}
+
+// Checks if error means the channel isn't available in the user's region: 101.ru and its CDN reply
+// "403 Forbidden" (or "451 Unavailable For Legal Reasons") to geo-blocked requests.
+func IsGeoBlocked(err error) bool {
+	var he *go101HttpError
+	if !errors.As(err, &he) {
+		return false
+	}
+	return he.Code == http.StatusForbidden || he.Code == http.StatusUnavailableForLegalReasons
+}
+
+// Channels already reported as geo-blocked.
+var (
+	geoBlocked    = make(map[uint64]bool)
+	geoBlockedMux sync.Mutex
+)
+
+// Reports geo-blocked channel once and switches to the fallback channel if configured, called by the fetch loop.
+// Returns true if switched to the fallback.
+func (p *go101) HandleGeoBlock(cid uint64, err error) bool {
+	geoBlockedMux.Lock()
+	reported := geoBlocked[cid]
+	geoBlocked[cid] = true
+	geoBlockedMux.Unlock()
+	channel := p.ChannelGroups[p.ChannelGroup(cid)].Channels[cid]
+	fallback, ok := p.GeoFallback(cid)
+	if !reported {
+		msg := fmt.Sprintf("%s (%d) isn't available in your region (%s).", channel.Title, cid, err.Error())
+		if !ok {
+			msg += " Set geo_fallback in config to switch to another channel automatically."
+		}
+		p.Alert("Channel isn't available", msg)
+	}
+	if !ok || cid != p.CurrentChannel || p.Profile.ChannelRestricted(fallback) {
+		return false
+	}
+	fmt.Printf("Switching to fallback channel %d.\n", fallback)
+	p.switchChannel(fallback)
+	return true
+}
+
+// Returns fallback channel for geo-blocked channel: configured for the channel itself or "*" one.
+func (p *go101) GeoFallback(cid uint64) (uint64, bool) {
+	s, ok := p.Config.GeoFallback[strconv.FormatUint(cid, 10)]
+	if !ok {
+		s, ok = p.Config.GeoFallback["*"]
+	}
+	if !ok {
+		return 0, false
+	}
+	fallback, err := p.ResolveChannel(s)
+	if err != nil {
+		log.Println("Wrong geo_fallback: ", err.Error())
+		return 0, false
+	}
+	geoBlockedMux.Lock()
+	blocked := geoBlocked[fallback]
+	geoBlockedMux.Unlock()
+	if fallback == cid || blocked {
+		return 0, false
+	}
+	if err = p.EnsureChannel(fallback); err != nil {
+		log.Println("Wrong geo_fallback: ", err.Error())
+		return 0, false
+	}
+	return fallback, true
+}
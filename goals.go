@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	GOALS_CHECK_INTERVAL = time.Minute
+	// Pause or stop that long ends the listening session.
+	DEFAULT_BREAK_GAP_MINUTES = 10
+)
+
+// Listening reminders and daily cap.
+type go101GoalsConfig struct {
+	// Remind to take a break after that many minutes of listening without a pause, 0 disables.
+	BreakMinutes int `json:"break_minutes"`
+	// Pause or stop at least that long counts as a break, 10 by default.
+	BreakGapMinutes int `json:"break_gap_minutes"`
+	// Notify when the day's listening reaches that many minutes, 0 disables.
+	DailyCapMinutes int `json:"daily_cap_minutes"`
+	// Stop playing at the daily cap instead of notifying only.
+	StopAtCap bool `json:"stop_at_cap"`
+}
+
+// Listening time of the day, persisted so restarts don't reset the cap.
+type go101ListeningDay struct {
+	Date    string `json:"date"`
+	Seconds int64  `json:"seconds"`
+	// Cap notification was sent.
+	Capped bool `json:"capped"`
+}
+
+// Returns full path to the listening time file.
+func GetListeningFile() string {
+	ps := string(os.PathSeparator)
+	return GetRuntimeDir() + ps + "listening.json"
+}
+
+// Reads listening time of today, zero if the file is missing or left from another day.
+func LoadListeningDay() go101ListeningDay {
+	today := go101ListeningDay{Date: time.Now().Format("2006-01-02")}
+	raw, err := ioutil.ReadFile(GetListeningFile())
+	if err != nil {
+		return today
+	}
+	var day go101ListeningDay
+	if err = json.Unmarshal(raw, &day); err != nil || day.Date != today.Date {
+		return today
+	}
+	return day
+}
+
+// Counts listening time and sends break reminders and daily cap notifications. Runs forever.
+func (p *go101) GoalsLoop() {
+	c := p.Config.Goals
+	gap := time.Duration(c.BreakGapMinutes) * time.Minute
+	if gap <= 0 {
+		gap = DEFAULT_BREAK_GAP_MINUTES * time.Minute
+	}
+	day := LoadListeningDay()
+	var session, idle time.Duration
+	reminded := 0
+	for true {
+		time.Sleep(GOALS_CHECK_INTERVAL)
+		if date := time.Now().Format("2006-01-02"); date != day.Date {
+			day = go101ListeningDay{Date: date}
+		}
+		if p.Status() != STATUS_PLAY {
+			idle += GOALS_CHECK_INTERVAL
+			if idle >= gap {
+				session, reminded = 0, 0
+			}
+			continue
+		}
+		idle = 0
+		session += GOALS_CHECK_INTERVAL
+		day.Seconds += int64(GOALS_CHECK_INTERVAL / time.Second)
+
+		// Remind again after every next period of listening.
+		if c.BreakMinutes > 0 && int(session/time.Minute) >= c.BreakMinutes*(reminded+1) {
+			reminded++
+			p.Remind("Take a break", fmt.Sprintf("You've been listening for %s.", FormatDuration(session)))
+		}
+		if c.DailyCapMinutes > 0 && !day.Capped && day.Seconds >= int64(c.DailyCapMinutes)*60 {
+			day.Capped = true
+			message := fmt.Sprintf("Daily listening cap of %s is reached.", FormatDuration(time.Duration(c.DailyCapMinutes)*time.Minute))
+			if c.StopAtCap {
+				message += " Playback is stopped."
+				p.Stop()
+			}
+			p.Remind("Enough for today", message)
+		}
+		if b, err := json.Marshal(day); err == nil {
+			if err = WriteFileAtomic(GetListeningFile(), b, PRIVATE_FILE_PERM); err != nil {
+				log.Println("Couldn't save listening time: ", err.Error())
+			}
+		}
+	}
+}
+
+// Formats duration as "3 hours 20 minutes".
+func FormatDuration(d time.Duration) string {
+	h, m := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case h == 0:
+		return plural(m, "minute")
+	case m == 0:
+		return plural(h, "hour")
+	}
+	return plural(h, "hour") + " " + plural(m, "minute")
+}
+
+// Prints reminder and sends it through the notifiers (events filter "reminder").
+func (p *go101) Remind(title, message string) {
+	fmt.Printf("\n%s: %s\n", Paint(theme.Info, title), message)
+	p.Notify(EVENT_REMINDER, "101ply: "+title, message)
+}
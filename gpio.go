@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stianeikeland/go-rpio/v4"
+)
+
+const (
+	// Pins are polled slowly while idle, buttons are debounced anyway.
+	GPIO_IDLE_INTERVAL = 20 * time.Millisecond
+	// Encoder transitions last a few milliseconds, so pins are polled fast for a while after any change.
+	GPIO_ACTIVE_INTERVAL = 2 * time.Millisecond
+	GPIO_ACTIVE_PERIOD   = 500 * time.Millisecond
+	GPIO_DEBOUNCE        = 50 * time.Millisecond
+)
+
+// GPIO controls (Raspberry Pi), pins are given in BCM numbering.
+type go101GPIOConfig struct {
+	Buttons  []go101GPIOButton  `json:"buttons"`
+	Encoders []go101GPIOEncoder `json:"encoders"`
+}
+
+// Push button between pin and ground, performs action on press.
+type go101GPIOButton struct {
+	Pin    uint8  `json:"pin"`
+	Action string `json:"action"`
+}
+
+// Rotary encoder, performs actions on clockwise and counter-clockwise detents.
+type go101GPIOEncoder struct {
+	PinA             uint8  `json:"pin_a"`
+	PinB             uint8  `json:"pin_b"`
+	Clockwise        string `json:"cw"`
+	CounterClockwise string `json:"ccw"`
+}
+
+// go-rpio maps GPIO memory globally, so it's shared by controls and SPI display and unmapped by the last user.
+var (
+	gpioRefs int
+	gpioMux  sync.Mutex
+)
+
+// Maps GPIO memory, or takes another reference to the mapping.
+func OpenGPIO() error {
+	gpioMux.Lock()
+	defer gpioMux.Unlock()
+	if gpioRefs == 0 {
+		if err := rpio.Open(); err != nil {
+			return fmt.Errorf("couldn't open GPIO: %s", err.Error())
+		}
+	}
+	gpioRefs++
+	return nil
+}
+
+// Releases reference to GPIO mapping, unmaps it once unused.
+func CloseGPIO() {
+	gpioMux.Lock()
+	defer gpioMux.Unlock()
+	if gpioRefs == 0 {
+		return
+	}
+	gpioRefs--
+	if gpioRefs == 0 {
+		_ = rpio.Close()
+	}
+}
+
+// Checks if GPIO memory is mapped.
+func GPIOOpened() bool {
+	gpioMux.Lock()
+	defer gpioMux.Unlock()
+	return gpioRefs > 0
+}
+
+// Quadrature transitions: index is (previous state << 2 | current state), value is direction.
+var encoderTransitions = [16]int{0, -1, 1, 0, 1, 0, 0, -1, -1, 0, 0, 1, 0, 1, -1, 0}
+
+// Polls buttons and encoders and performs bound actions. Runs forever. Polling is fast only while controls are
+// used: the first encoder transition after idle may be missed, the rest of the turn isn't.
+func (p *go101) GPIOLoop() {
+	config := p.Config.GPIO
+	if err := OpenGPIO(); err != nil {
+		panic(err)
+	}
+	defer CloseGPIO()
+
+	pins := make([]uint8, 0)
+	for _, b := range config.Buttons {
+		pins = append(pins, b.Pin)
+	}
+	for _, e := range config.Encoders {
+		pins = append(pins, e.PinA, e.PinB)
+	}
+	for _, pin := range pins {
+		rpio.Pin(pin).Input()
+		rpio.Pin(pin).PullUp()
+	}
+
+	pressed := make([]bool, len(config.Buttons))
+	changed := make([]time.Time, len(config.Buttons))
+	states := make([]int, len(config.Encoders))
+	steps := make([]int, len(config.Encoders))
+	var active time.Time
+	for true {
+		now := time.Now()
+		for i, b := range config.Buttons {
+			// Pulled up, so pressed button reads low.
+			down := rpio.Pin(b.Pin).Read() == rpio.Low
+			if down != pressed[i] {
+				active = now
+			}
+			if down != pressed[i] && now.Sub(changed[i]) > GPIO_DEBOUNCE {
+				pressed[i], changed[i] = down, now
+				if down {
+					go Safe("gpio button", func() {
+						p.Action(b.Action)
+					})
+				}
+			}
+		}
+		for i, e := range config.Encoders {
+			state := int(rpio.Pin(e.PinA).Read())<<1 | int(rpio.Pin(e.PinB).Read())
+			if state != states[i] {
+				active = now
+			}
+			steps[i] += encoderTransitions[states[i]<<2|state]
+			states[i] = state
+			// One detent is four transitions.
+			action := ""
+			if steps[i] >= 4 {
+				action, steps[i] = e.Clockwise, 0
+			} else if steps[i] <= -4 {
+				action, steps[i] = e.CounterClockwise, 0
+			}
+			if action != "" {
+				go Safe("gpio encoder", func() {
+					p.Action(action)
+				})
+			}
+		}
+		if now.Sub(active) < GPIO_ACTIVE_PERIOD {
+			time.Sleep(GPIO_ACTIVE_INTERVAL)
+		} else {
+			time.Sleep(GPIO_IDLE_INTERVAL)
+		}
+	}
+}
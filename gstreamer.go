@@ -0,0 +1,238 @@
+//go:build gstreamer
+
+package main
+
+/*
+#cgo pkg-config: gstreamer-1.0
+#include <stdlib.h>
+#include <gst/gst.h>
+
+static void go101_gst_init(void) {
+	gst_init(NULL, NULL);
+}
+
+static GstElement *go101_gst_pipeline(const char *uri, char **message) {
+	GError *err = NULL;
+	// Decoders are picked by rank, so hardware ones (v4l2, omx) win on boards having them.
+	GstElement *pipeline = gst_parse_launch(
+		"uridecodebin name=src ! audioconvert ! audioresample ! volume name=vol ! autoaudiosink", &err);
+	if (pipeline == NULL) {
+		*message = g_strdup(err != NULL ? err->message : "unknown error");
+		if (err != NULL) {
+			g_error_free(err);
+		}
+		return NULL;
+	}
+	if (err != NULL) {
+		// Recoverable error, ex: missing optional element.
+		g_error_free(err);
+	}
+	GstElement *src = gst_bin_get_by_name(GST_BIN(pipeline), "src");
+	g_object_set(src, "uri", uri, NULL);
+	gst_object_unref(src);
+	return pipeline;
+}
+
+static void go101_gst_set_volume(GstElement *pipeline, double volume, int mute) {
+	GstElement *vol = gst_bin_get_by_name(GST_BIN(pipeline), "vol");
+	g_object_set(vol, "volume", volume, "mute", mute, NULL);
+	gst_object_unref(vol);
+}
+
+static int go101_gst_play(GstElement *pipeline) {
+	return gst_element_set_state(pipeline, GST_STATE_PLAYING) != GST_STATE_CHANGE_FAILURE;
+}
+
+static void go101_gst_free(GstElement *pipeline) {
+	gst_element_set_state(pipeline, GST_STATE_NULL);
+	gst_object_unref(pipeline);
+}
+
+// Returns bus of the pipeline, it stays valid after the pipeline is freed until unref.
+static GstBus *go101_gst_bus(GstElement *pipeline) {
+	return gst_element_get_bus(pipeline);
+}
+
+static void go101_gst_unref_bus(GstBus *bus) {
+	gst_object_unref(bus);
+}
+
+// Waits for error or end of stream up to timeout (ns), returns error message, "" on EOS, NULL on timeout.
+static char *go101_gst_wait(GstBus *bus, long long timeout) {
+	GstMessage *msg = gst_bus_timed_pop_filtered(bus, timeout, GST_MESSAGE_ERROR | GST_MESSAGE_EOS);
+	if (msg == NULL) {
+		return NULL;
+	}
+	char *message = NULL;
+	if (GST_MESSAGE_TYPE(msg) == GST_MESSAGE_ERROR) {
+		GError *err = NULL;
+		gst_message_parse_error(msg, &err, NULL);
+		message = g_strdup(err->message);
+		g_error_free(err);
+	} else {
+		message = g_strdup("");
+	}
+	gst_message_unref(msg);
+	return message;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Interval of pipeline bus checks.
+const GST_BUS_POLL = 200 * time.Millisecond
+
+var gstInit sync.Once
+
+func init() {
+	audioBackends = append(audioBackends, BACKEND_GSTREAMER)
+	taggedBackends[BACKEND_GSTREAMER] = func(config *go101Config) (go101Backend, error) {
+		gstInit.Do(func() {
+			C.go101_gst_init()
+		})
+		return &go101GstBackend{volume: 100}, nil
+	}
+}
+
+// Backend playing via GStreamer pipeline: uridecodebin - volume - autoaudiosink. Plays any format
+// GStreamer has decoder for, not only MP3.
+type go101GstBackend struct {
+	mux      sync.Mutex
+	pipeline *C.GstElement
+	// Closed on stop of the pipeline, ends its bus watch.
+	done   chan struct{}
+	volume int
+	muted  bool
+}
+
+// Applies volume and mute to the pipeline. The lock must be held.
+func (b *go101GstBackend) apply() {
+	if b.pipeline == nil {
+		return
+	}
+	mute := C.int(0)
+	if b.muted {
+		mute = 1
+	}
+	C.go101_gst_set_volume(b.pipeline, C.double(float64(b.volume)/100), mute)
+}
+
+// Logs pipeline errors until it's stopped.
+func (b *go101GstBackend) watch(bus *C.GstBus, done chan struct{}) {
+	defer C.go101_gst_unref_bus(bus)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		cmsg := C.go101_gst_wait(bus, C.longlong(GST_BUS_POLL))
+		if cmsg == nil {
+			continue
+		}
+		message := C.GoString(cmsg)
+		C.free(unsafe.Pointer(cmsg))
+		if message == "" {
+			Debug("GStreamer: end of stream")
+		} else {
+			log.Println("GStreamer: ", message)
+		}
+		return
+	}
+}
+
+func (b *go101GstBackend) Play(url string) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.pipeline != nil {
+		return fmt.Errorf("previous GStreamer pipeline isn't stopped")
+	}
+	uri := url
+	if !strings.Contains(url, "://") {
+		// Local file, ex: replay from cache.
+		abs, err := filepath.Abs(url)
+		if err != nil {
+			return err
+		}
+		uri = "file://" + abs
+	}
+	curi := C.CString(uri)
+	defer C.free(unsafe.Pointer(curi))
+	var cmsg *C.char
+	pipeline := C.go101_gst_pipeline(curi, &cmsg)
+	if pipeline == nil {
+		defer C.free(unsafe.Pointer(cmsg))
+		return fmt.Errorf("couldn't create GStreamer pipeline: %s", C.GoString(cmsg))
+	}
+	// New stream starts unmuted, like with other backends.
+	b.pipeline, b.muted = pipeline, false
+	b.apply()
+	if C.go101_gst_play(pipeline) == 0 {
+		C.go101_gst_free(pipeline)
+		b.pipeline = nil
+		return fmt.Errorf("couldn't start GStreamer pipeline of %s", url)
+	}
+	b.done = make(chan struct{})
+	go b.watch(C.go101_gst_bus(pipeline), b.done)
+	return nil
+}
+
+func (b *go101GstBackend) Mute() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.muted = true
+	b.apply()
+}
+
+func (b *go101GstBackend) Unmute() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.muted = false
+	b.apply()
+}
+
+func (b *go101GstBackend) Stop() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.pipeline == nil {
+		return
+	}
+	close(b.done)
+	C.go101_gst_free(b.pipeline)
+	b.pipeline = nil
+}
+
+// Returns volume of the pipeline in percents.
+func (b *go101GstBackend) Volume() (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.volume, nil
+}
+
+// Sets volume of the pipeline in percents.
+func (b *go101GstBackend) SetVolume(percent int) error {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.volume = percent
+	b.apply()
+	return nil
+}
+
+func (b *go101GstBackend) Close() {
+	b.Stop()
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Help topic, printed by "101ply help <topic>" and included to the man page.
+type go101HelpTopic struct {
+	Name  string
+	Title string
+	Write func(w io.Writer)
+}
+
+var helpTopics []go101HelpTopic
+
+func init() {
+	helpTopics = []go101HelpTopic{
+		{"commands", "Commands", writeCommandsHelp},
+		{"flags", "Options", writeFlagsHelp},
+		{"hotkeys", "Hotkeys", writeHotkeysHelp},
+		{"actions", "Actions", writeActionsHelp},
+		{"config", "Configuration", writeConfigHelp},
+		{"providers", "Providers", writeProvidersHelp},
+		{"templates", "Templates", writeTemplatesHelp},
+		{"files", "Files", writeFilesHelp},
+		{"sandbox", "Sandboxes", writeSandboxHelp},
+	}
+}
+
+// Descriptions of the config.json keys. Keys themselves and their types are taken from go101Config.
+var configHelp = map[string]string{
+	"profiles":          "Named profiles, activated by -profile option or switched at runtime by \"101ply ctl profile <name>\". Each has restricted_channels (IDs), restricted_patterns (regular expressions matched against \"artist - title\"), channel (default channel), volume, hotkeys (instead of hotkey.json), notifiers (in addition to common ones) and output (applied on start only). Profiles may be also stored in profiles/<name>.json files.",
+	"time_zone":         "Time zone of quiet hours, rotation, digest and scheduled commands (\"101ply schedule\"), ex: \"Europe/Berlin\". Empty means the system one. Clocks stay the same over DST changes: 07:00 is 07:00 in summer and winter, time skipped by the change is taken right after it, repeated time is taken once.",
+	"quiet_hours":       "Period of the day with capped volume: {\"start\": \"22:00\", \"end\": \"07:00\", \"volume\": 30}. Volume of mpv and gstreamer backends is capped, system mixer volume with other backends.",
+	"rotation":          "Channels switched automatically by the part of the day: [{\"name\": \"mornings\", \"start\": \"07:00\", \"end\": \"10:00\", \"group\": \"news\"}, {\"name\": \"evenings\", \"start\": \"19:00\", \"end\": \"23:00\", \"genre\": \"jazz\"}]. Slot plays a random channel matching its group (ID or part of the title), genre and channel (ID or alias). Switches are announced through notifiers (events filter \"rotation\"). Switching to another channel manually pauses rotation till the end of the slot, \"rotation\" action and \"101ply ctl rotation on|off\" turn it on and off. Player started without -c plays the channel of the current slot.",
+	"gain_profiles":     "Volume and equalizer per channel category (music, talk), applied on channel start: {\"talk\": {\"volume\": 60, \"bass\": -6, \"treble\": 3}}. Volume 0 keeps current one. Volume of mpv and gstreamer backends is set, system mixer volume with other backends. Bass and treble gain (dB) needs mpv backend, category without profile plays flat.",
+	"talk_patterns":     "Substrings of group/channel titles and genres marking talk channels.",
+	"audio_backend":     "Audio backend: mp3lib (default), alsa (mpg123 writing directly to ALSA device), mpv (controlled over IPC, also skips and changes speed of recordings in \"101ply archive\") or gstreamer (needs build with -tags gstreamer).",
+	"alsa_device":       "ALSA device of the alsa backend.",
+	"no_x":              "Disable X hotkeys, for headless installs and sandboxes. Also disabled if DISPLAY isn't set.",
+	"no_mpris":          "Disable MPRIS service (media keys, Bluetooth headphones buttons, desktop widgets).",
+	"no_dbus":           "Don't use D-Bus at all: MPRIS, libnotify and portal notifications, screen lock and suspend watch, sleep inhibitor, do-not-disturb check, keyring. For sandboxes filtering the bus, see \"101ply help sandbox\".",
+	"gpio":              "GPIO buttons and rotary encoders: {\"buttons\": [{\"pin\": 17, \"action\": \"pause\"}], \"encoders\": [{\"pin_a\": 22, \"pin_b\": 23, \"cw\": \"volume-up\", \"ccw\": \"volume-down\"}]}.",
+	"display":           "I2C character or pixel display: {\"driver\": \"hd44780|ssd1306\", \"bus\": \"/dev/i2c-1\", \"address\": 39, \"cols\": 16, \"rows\": 2, \"scroll_ms\": 400}. SSD1306 may be connected via SPI: {\"driver\": \"ssd1306\", \"bus\": \"/dev/spidev0.0\", \"dc_pin\": 24, \"reset_pin\": 25}, pins in BCM numbering.",
+	"track_cache_mb":    "Size limit of the recently played tracks cache, used by replay.",
+	"cache_limit_mb":    "Size limit of all evictable cached files (see \"101ply cache stats\"), least recently used files are removed first.",
+	"dedup_window":      "Seconds, same track with start timestamp shifted less than that isn't considered a new play.",
+	"no_feed":           "Disable writing of \"now playing\" RSS feeds.",
+	"sync_offset_ms":    "Milliseconds the audio lags track info (negative if it's ahead), track change events (notifications, webhooks, history) and remaining time are shifted by it. Measure it with \"101ply calibrate\".",
+	"no_push":           "Don't listen to track change events of the web player (server-sent events), detect track changes by polling only.",
+	"chord_timeout_ms":  "How long leader key waits for the second key of a chord.",
+	"inhibit_sleep":     "Prevent idle/suspend while playing.",
+	"no_suspend_watch":  "Don't stop the stream before system suspend and restart it after resume.",
+	"sink_idle_minutes": "Pause if output is muted or unplugged for that many minutes, ex: 10. 0 (default) disables.",
+	"watchdog_seconds":  "Restart audio pipeline (kill hung mpg123 or mpv and start the stream again) if no audio is consumed for that many seconds while playing, ex: 30. 0 (default) disables. Progress is taken from mpg123 frames (alsa backend), mpv playback time, or the stream proxy when \"buffer\", \"dns\", \"tls\" or \"integrity\" is set, so mp3lib and gstreamer backends are watched through the proxy only. Restarts are reported as error events (notifiers, webhooks, play log).",
+	"pause_on_lock":     "Pause when the session locks and resume on unlock.",
+	"no_title":          "Don't update terminal window title with playing track.",
+	"webhooks":          "Webhooks called on player events: [{\"url\": \"https://...\", \"events\": [\"track\"], \"secret\": \"...\", \"retries\": 3}]. JSON payload is signed by HMAC-SHA256 with the secret, signature is sent in X-101ply-Signature header. Set \"format\": \"ifttt\" for IFTTT Webhooks flat payload (value1 - artist, value2 - title, value3 - channel) and \"artists\": [\"...\"] to call webhook only when these artists come on.",
+	"notifiers":         "Notification backends for track changes and stream errors: [{\"type\": \"libnotify\"}, {\"type\": \"pushover\", \"token\": \"...\", \"user\": \"...\"}, {\"type\": \"ntfy\", \"topic\": \"...\", \"url\": \"https://ntfy.sh\"}, {\"type\": \"gotify\", \"url\": \"...\", \"token\": \"...\"}]. Optional \"events\": [\"track\", \"error\"] filters events. Notifications are silent during quiet hours. Desktop pop-ups (libnotify) are suppressed in do-not-disturb mode (GNOME, KDE, dunst), \"dnd_override\": true shows error and alert pop-ups anyway.",
+	"alerts":            "Alert rules for unattended installs: {\"stream_error_minutes\": 5, \"recording_failed\": true}. Alerts are sent through notifiers (events filter \"alert\").",
+	"schedule":          "Followed programs: {\"follow\": [\"morning show\"], \"notify_minutes\": 5}. Schedules of all channels are fetched in background, programs with titles containing any of the follow strings are announced through notifiers (events filter \"program\") notify_minutes before the start. Next program of the playing channel is shown without this option too.",
+	"follow":            "Monitoring of followed artists (see \"101ply follow\") while playing: {\"channels\": [\"jazz\", \"123\"], \"interval_seconds\": 60, \"auto_switch\": false}. Favorites are monitored if channels are empty. Followed artist on another channel is announced through notifiers (events filter \"follow\"), auto_switch switches to that channel.",
+	"goals":             "Listening reminders: {\"break_minutes\": 180, \"break_gap_minutes\": 10, \"daily_cap_minutes\": 240, \"stop_at_cap\": false}. Reminds to take a break after break_minutes of listening without a pause (pause or stop of break_gap_minutes ends the session) and notifies when the day's listening reaches daily_cap_minutes. Reminders are sent through notifiers (events filter \"reminder\").",
+	"digest":            "Listening diary by email: listening time, top artists and channels, tracks heard for the first time (followed artists first) and bookmarks. {\"period\": \"weekly\", \"at\": \"09:00\", \"weekday\": \"monday\", \"from\": \"101ply@example.com\", \"to\": [\"me@example.com\"], \"smtp\": {\"host\": \"smtp.example.com\", \"port\": 587, \"user\": \"...\", \"password\": \"secret:smtp\"}}. Period is daily or weekly, digest covers the day or week before the sending time and is sent by the running player (default instance only), or on the next start if it was missed. Port 465 uses TLS, others STARTTLS if the server supports it. See also \"101ply digest\".",
+	"record":            "Copy every played track to a file with ID3 tags and cover: {\"dir\": \"\", \"path\": \"{{.Artist}}/{{.Album}}/{{.Title}}.mp3\", \"no_cover\": false, \"keep_latest\": false}. Tracks recorded before (same track ID, artist and title, or audio) are skipped unless keep_latest is set, then the old file is replaced. Duplicates already in the archive are found by \"101ply archive dedupe\". Empty dir means ~/Music/101ply. Path template may use .Artist, .Title, .Album, .Year, .Channel, .TrackUid, .Date (2006-01-02) and .Time (15-04), ex: \"{{.Channel}}/{{.Date}}/{{.Artist}} - {{.Title}}.mp3\". Fields are stripped of characters invalid on any file system, names are cut to 200 bytes, existing file of another track gets \" (2)\" suffix. With \"fingerprint\": {\"api_key\": \"<AcoustID application key>\", \"min_score\": 0.8} files are tagged with canonical artist, title, album and MusicBrainz IDs found by AcoustID, needs fpcalc (chromaprint).",
+	"play_log":          "JSON Lines log of all player events: {\"path\": \"\", \"max_mb\": 10, \"keep\": 5}. Empty path means play.jsonl in cache directory, file is rotated after max_mb.",
+	"tracing":           "OpenTelemetry tracing of track info fetch and stream start, exported via OTLP/HTTP: {\"endpoint\": \"localhost:4318\", \"insecure\": true, \"service\": \"101ply\"}.",
+	"download":          "Track downloads of the cache and recordings: {\"concurrency\": 2, \"retries\": 3}. Interrupted downloads are resumed with ranged requests, files not matching the announced length are never saved.",
+	"buffer":            "In-process stream buffer: {\"size_kb\": 1024, \"prebuffer_ms\": 2000}. Playback starts after prebuffer_ms of audio is buffered, underruns are shown by \"101ply now\".",
+	"geo_fallback":      "Channels (ID or alias) played instead of ones not available in your region, ex: {\"123\": \"456\", \"*\": \"jazz\"}. \"*\" applies to any channel.",
+	"stream_url":        "Live stream URL of the channel, %d is replaced by channel ID (relative URL is taken on the provider host). Played when the station replies without audio file of the track on air and the track isn't playing already. Live stream isn't restarted on track change. Empty value disables it.",
+	"integrity":         "Stream integrity monitoring: {\"silence_seconds\": 20, \"max_bad_frames\": 50, \"mirrors\": [\"cdn2.101.ru\"]}. Silent or corrupted (lost frame sync, CRC mismatch) stream is logged as error and restarted, switching to the next mirror host if given. Enables stream buffering, so the stream is fetched by the player itself.",
+	"dns":               "Name resolution of provider and CDN hosts: resolver (DNS server, ex: \"1.1.1.1\") and hosts (static overrides, ex: {\"cdn1.101.ru\": \"1.2.3.4\", \"*.101.ru\": \"1.2.3.5\"}). Enables stream buffering, so the stream is fetched by the player itself.",
+	"tls":               "TLS options of provider and stream connections: ca_file (PEM bundle of additional trusted CAs, ex: corporate proxy one) and insecure_skip_verify. Enables stream buffering, so the stream is fetched by the player itself.",
+	"polling":           "Track info polling: rate_per_minute and burst limit all provider requests, min_seconds and max_seconds clamp the interval between fetches, jitter_seconds adds random delay. Request counters are shown by \"101ply ctl status\".",
+	"translit":          "Cyrillic to Latin transliteration of artists and titles: {\"console\": true, \"filenames\": true, \"webhooks\": false}. console covers track line, big mode, terminal title and commands output, filenames - recorded tracks. Scheme of Russian passports: \"Ёлка\" - \"Elka\", \"Жуки\" - \"Zhuki\".",
+	"cover_art":         "Cover art lookup for notifications, MPRIS, track format (.Cover) and recording tags: {\"providers\": [\"station\", \"coverartarchive\", \"itunes\", \"deezer\"], \"rate_per_minute\": 20}. Providers are tried in order until one has the cover, station cover goes first by default. Lookups are cached, misses are retried after a day.",
+	"track_links":       "Search links of the playing track shown in notifications, \"101ply now\" and \"101ply ctl status\", in addition to the channel page: youtube, youtubemusic, spotify, yandex.",
+	"time_format":       "Date and time formats of history, bookmarks and schedule: {\"locale\": \"\", \"date\": \"\", \"time\": \"\"}. Formats are taken from the locale (LC_ALL, LC_TIME or LANG unless locale is set), date and time override them with Go layouts, ex: \"02.01.2006\", \"3:04 PM\".",
+	"track_format":      "Template of the track line, empty for default. See \"101ply help templates\".",
+	"no_status_line":    "Print track line once instead of updating remaining time in place.",
+	"secret_storage":    "Storage of secrets referenced from config as \"secret:<name>\" (ex: \"token\": \"secret:pushover-token\"): keyring (default, Secret Service or KWallet), or for headless machines file (secrets.json in config directory, readable by owner only) or encrypted (\"credentials\" of config, encrypted by the key file). Secrets are added by \"101ply secret set <name>\", \"101ply secret migrate\" moves plain tokens, keys and webhook secrets of config and profiles to the storage. Notifier tokens and user keys, webhook URLs and secrets and AcoustID key may be references.",
+	"credentials":       "Secrets encrypted with AES-256-GCM by credentials_key, used by \"encrypted\" secret_storage. Written by \"101ply secret\", don't edit it.",
+	"credentials_key":   "Path to the key of the encrypted credentials, credentials.key in config directory by default. Key of 32 random bytes is created with the first secret, it must be readable by owner only.",
+	"theme":             "Console colors: default, solarized, ocean or mono. Colors are downgraded to 256 or 8 colors if terminal doesn't support truecolor and disabled if NO_COLOR is set.",
+}
+
+func writeCommandsHelp(w io.Writer) {
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\n\t%s\n", cmd.Name, cmd.Desc)
+	}
+}
+
+func writeFlagsHelp(w io.Writer) {
+	flag.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		fmt.Fprintf(w, "  %s\n\t%s", strings.TrimSpace("-"+f.Name+" "+name), usage)
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0s" {
+			fmt.Fprintf(w, " (default %s)", f.DefValue)
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+func writeHotkeysHelp(w io.Writer) {
+	fmt.Fprintf(w, "Hotkeys are configured in %s, file is reloaded on change:\n\n", GetHotkeyConfig())
+	fmt.Fprint(w, `  [
+	{"key": "Pause", "action": "pause", "desc": "Play/pause."},
+	{"key": "Scroll_Lock", "desc": "Favorites.", "chord": [
+		{"key": "1", "action": "fav-1"},
+		{"key": "2", "action": "fav-2"}
+	]}
+  ]
+
+Key is an X keysym name (ex: Pause, XF86AudioPlay, F9), optionally with modifiers (ex: control-shift-p,
+mod4-F5). Run "101ply bind <action>" and press the key to add it without looking up the names.
+Key with "chord" is a leader: after pressing it, one of the chord keys should be pressed within
+chord_timeout_ms. Pressing the leader again cancels the chord. See "101ply help actions" for actions.
+`)
+}
+
+func writeActionsHelp(w io.Writer) {
+	for _, a := range actions {
+		fmt.Fprintf(w, "  %s\n\t%s\n", a.Name, a.Desc)
+	}
+}
+
+func writeConfigHelp(w io.Writer) {
+	fmt.Fprintf(w, "Configuration is stored in %s:\n\n", GetConfigFile())
+	t := reflect.TypeOf(go101Config{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := strings.Split(f.Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		fmt.Fprintf(w, "  %s (%s)\n\t%s\n", key, configType(f.Type), configHelp[key])
+	}
+}
+
+// Returns JSON type name of the config field.
+func configType(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return configType(t.Elem()) + ", null to disable"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int64, reflect.Uint64, reflect.Float64:
+		if t == reflect.TypeOf(time.Duration(0)) {
+			return "duration"
+		}
+		return "number"
+	case reflect.Slice:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func writeTemplatesHelp(w io.Writer) {
+	fmt.Fprintf(w, "Track line is a Go template (https://pkg.go.dev/text/template), default:\n\n  %s\n\nFields:\n", DEFAULT_TRACK_FORMAT)
+	t := reflect.TypeOf(go101TemplateData{})
+	for i := 0; i < t.NumField(); i++ {
+		fmt.Fprintf(w, "  .%s\n", t.Field(i).Name)
+	}
+	fmt.Fprint(w, `
+Functions:
+  artist, title, album, time, channel, info
+	Paint text with the theme color, ex: {{artist .Artist}}.
+  progress
+	Progress bar of given width, ex: {{progress .Done 20}}.
+`)
+}
+
+func writeProvidersHelp(w io.Writer) {
+	for _, p := range providers {
+		fmt.Fprintf(w, "  %s\n\t%s\n", p.Name, p.Desc)
+	}
+	fmt.Fprintln(w, "\nCover art providers (\"cover_art\" config):")
+	for _, cp := range coverProviders {
+		fmt.Fprintf(w, "  %s\n\t%s\n", cp.Name, cp.Desc)
+	}
+}
+
+func writeFilesHelp(w io.Writer) {
+	files := map[string]string{
+		GetConfigFile():                 "Main configuration.",
+		GetHotkeyConfig():               "Hotkeys.",
+		GetProfilesDir():                "Profiles, one <name>.json file per profile.",
+		GetDatabaseFile(PROVIDER_101RU): "Channels, aliases, favorites and history.",
+		GetStateFile():                  "Session state, used to restore the session terminated unexpectedly.",
+		GetListeningFile():              "Today's listening time, used by the daily listening cap.",
+		GetControlSocket():              "Control socket of the running player.",
+		GetCommandFifo():                "Command FIFO of the running player, accepts \"ctl\" commands: echo \"volume 70\" > cmd.",
+		GetLockFile():                   "Lock file of the running player.",
+		GetSecretsFile():                "Secrets, if \"secret_storage\" is \"file\".",
+		GetTrackCacheDir():              "Recently played tracks.",
+		GetHttpCacheDir():               "Provider responses with ETag/Last-Modified, for conditional requests.",
+		GetPlayLogFile():                "Play log (if enabled).",
+		GetFeedDir():                    "\"Now playing\" RSS feeds.",
+		GetCoverCacheFile():             "Cover art lookups.",
+		GetCoverDir():                   "Downloaded cover images, for MPRIS, notifications and recordings.",
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n\t%s\n", name, files[name])
+	}
+	fmt.Fprintf(w, "\nPlayers started with -instance <name> keep socket, lock, state and play log in %s.\n",
+		GetCacheDir()+string(os.PathSeparator)+"instances"+string(os.PathSeparator)+"<name>")
+}
+
+func writeSandboxHelp(w io.Writer) {
+	if sb := Sandbox(); sb != "" {
+		fmt.Fprintf(w, "Running in %s sandbox.\n\n", sb)
+	}
+	fmt.Fprintf(w, `Player runs in Flatpak, Snap and Firejail sandboxes, features without access degrade gracefully.
+Config and cache are kept in $XDG_CONFIG_HOME/101ply and $XDG_CACHE_HOME/101ply of the sandbox (ex:
+~/.var/app/<id>/config/101ply of Flatpak), -config-dir and -cache-dir options override them.
+
+Flatpak permissions (finish-args of the manifest) per feature:
+  --share=network
+	Streams and provider API.
+  --socket=pulseaudio
+	Audio output.
+  --socket=x11
+	Global hotkeys. Without it (or with "no_x" config) use MPRIS media keys or "101ply ctl".
+  --own-name=%s --own-name=%s.*
+	MPRIS service, ".*" is needed for players started with -instance.
+  --talk-name=org.freedesktop.ScreenSaver --talk-name=org.gnome.ScreenSaver
+	Pause on screen lock ("pause_on_lock" config).
+  --system-talk-name=org.freedesktop.login1
+	Stop the stream before suspend and restart it after resume (unless "no_suspend_watch" is set).
+  --talk-name=%s --talk-name=org.kde.kwalletd6 --talk-name=org.kde.kwalletd5
+	Keyring ("secret_storage" config), use "encrypted" storage otherwise.
+  --talk-name=org.freedesktop.Notifications
+	Do-not-disturb check of notifiers.
+  --filesystem=xdg-music
+	Recordings, if "record" dir isn't set inside the sandbox.
+
+Desktop notifications and the sleep inhibitor go through desktop portals (%s), no permission is needed.
+If sandbox filters the session bus without portals, set "no_dbus" to stop the player from using D-Bus.
+`, MPRIS_NAME, MPRIS_NAME, secretsDest, PORTAL_NAME)
+}
+
+// Show help on topic or command.
+func CmdHelp(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: 101ply [options] [command [args]]\n\nCommands:")
+		writeCommandsHelp(os.Stdout)
+		fmt.Println("\nHelp topics (101ply help <topic>):")
+		for _, t := range helpTopics {
+			fmt.Printf("  %s\n", t.Name)
+		}
+		return
+	}
+	for _, t := range helpTopics {
+		if t.Name == args[0] {
+			t.Write(os.Stdout)
+			return
+		}
+	}
+	for _, cmd := range commands {
+		if cmd.Name == args[0] {
+			fmt.Printf("%s\n\t%s\n", cmd.Name, cmd.Desc)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown help topic %s.\n", args[0])
+	os.Exit(2)
+}
+
+// Print man page in roff format.
+func CmdMan(args []string) {
+	w := os.Stdout
+	fmt.Fprintf(w, ".TH 101PLY 1 %q 101ply\n", time.Now().Format("2006-01-02"))
+	fmt.Fprintln(w, ".SH NAME\n101ply \\- console player of 101.ru radio")
+	fmt.Fprintln(w, ".SH SYNOPSIS\n.B 101ply\n[\\fIoptions\\fR] [\\fIcommand\\fR [\\fIargs\\fR]]")
+	fmt.Fprintln(w, ".SH DESCRIPTION\nWithout command plays the channel chosen interactively or given by \\fB\\-c\\fR option.")
+	for _, t := range helpTopics {
+		var b strings.Builder
+		t.Write(&b)
+		fmt.Fprintf(w, ".SH %s\n", strings.ToUpper(t.Title))
+		fmt.Fprintln(w, ".nf")
+		fmt.Fprint(w, roffEscape(b.String()))
+		fmt.Fprintln(w, ".fi")
+	}
+}
+
+// Escapes text for roff.
+func roffEscape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = "\\&" + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Track considered the same play if it comes again with start timestamp shifted less than that.
+const DEFAULT_DEDUP_WINDOW = 30
+
+// Played track, stored in history table.
+type go101HistoryEntry struct {
+	Track     go101TrackInfo
+	ChannelId uint64
+	PlayedAt  time.Time
+}
+
+// Checks if track on air differs from the playing one. Same TrackUid with start timestamp beyond
+// the dedup window means the channel replays the track after a break, so it's a new play.
+func (p *go101) TrackChanged() bool {
+	if p.TrackUid != p.CurrentTrack.TrackUid {
+		return true
+	}
+	window := p.Config.DedupWindow
+	if window <= 0 {
+		window = DEFAULT_DEDUP_WINDOW
+	}
+	start := p.CurrentTrack.Start
+	diff := start - p.TrackStart
+	if start < p.TrackStart {
+		diff = p.TrackStart - start
+	}
+	return diff > window
+}
+
+// Writes every played track to the history.
+func (p *go101) InitHistory() {
+	p.Subscribe(func(e go101Event) {
+		if e.Type != EVENT_TRACK {
+			return
+		}
+		if err := p.AddHistory(e.Channel.Id, e.Track, e.Time); err != nil {
+			log.Println("Couldn't write history: ", err.Error())
+			return
+		}
+		if !p.Config.NoFeed {
+			if err := p.WriteFeed(e.Channel); err != nil {
+				log.Println("Couldn't write feed: ", err.Error())
+			}
+		}
+	})
+}
+
+// Adds track to the history. Repeated writes of the same play are ignored.
+func (p *go101) AddHistory(cid uint64, track go101TrackInfo, at time.Time) error {
+	_, err := p.DB.Exec(`INSERT OR IGNORE INTO history (channel_id, track_uid, artist, title, album, started_at, played_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		cid, track.TrackUid, track.Artist, track.Title, track.Album, track.Start, at.Unix())
+	if err != nil {
+		return err
+	}
+	return p.IndexTrack(p.DB, track.Artist, track.Title)
+}
+
+// Returns last played tracks, newest first. Zero cid means all channels.
+func (p *go101) History(cid uint64, limit int) ([]go101HistoryEntry, error) {
+	rows, err := p.DB.Query(`SELECT channel_id, track_uid, artist, title, album, started_at, played_at FROM history
+		WHERE ? = 0 OR channel_id = ? ORDER BY played_at DESC LIMIT ?`, cid, cid, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	entries := make([]go101HistoryEntry, 0)
+	for rows.Next() {
+		var (
+			e      go101HistoryEntry
+			played int64
+		)
+		if err = rows.Scan(&e.ChannelId, &e.Track.TrackUid, &e.Track.Artist, &e.Track.Title, &e.Track.Album, &e.Track.Start, &played); err != nil {
+			return nil, err
+		}
+		e.PlayedAt = time.Unix(played, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of imported history.
+const (
+	HISTORY_FORMAT_AUTO = "auto"
+	// CSV with header: artist, title (or track), album and time columns, in any order.
+	HISTORY_FORMAT_CSV = "csv"
+	// Last.fm scrobbles CSV without header: artist, album, title, date ("31 Jan 2021 12:34" UTC).
+	HISTORY_FORMAT_LASTFM = "lastfm"
+	// Last.fm API pages, ListenBrainz and Spotify exports or array of {artist, title, album, played_at}.
+	HISTORY_FORMAT_JSON = "json"
+)
+
+// Channel title of imported plays.
+const HISTORY_IMPORTED = "imported history"
+
+// Play imported from another player. Imported plays have no channel and track ID.
+type go101ImportedPlay struct {
+	Artist   string
+	Title    string
+	Album    string
+	PlayedAt time.Time
+}
+
+// Time formats of exports, zone-less ones are UTC.
+var historyTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"02 Jan 2006 15:04",
+	"02 Jan 2006, 15:04",
+	"2 Jan 2006 15:04",
+	"2 Jan 2006, 15:04",
+}
+
+// Column names of CSV header and keys of JSON objects, compared lower case without spaces and underscores.
+var (
+	historyArtistKeys = []string{"artist", "artistname", "masterMetadataAlbumArtistName"}
+	historyTitleKeys  = []string{"title", "track", "trackname", "name", "song", "masterMetadataTrackName"}
+	historyAlbumKeys  = []string{"album", "albumname", "release", "releasename", "masterMetadataAlbumAlbumName"}
+	historyTimeKeys   = []string{"playedat", "uts", "timestamp", "listenedat", "date", "time", "utctime", "endtime", "ts"}
+)
+
+func historyKey(s string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.TrimSpace(s)))
+}
+
+// Finds first of the keys in the normalized names, -1 if there's none.
+func historyColumn(names []string, keys []string) int {
+	for _, key := range keys {
+		for i, name := range names {
+			if name == historyKey(key) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Parses play time: unix time in seconds or milliseconds, or one of the export formats.
+func parseHistoryTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e11 {
+			return time.Unix(n/1000, 0), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown time format %q", s)
+}
+
+// Parses exported history. Plays without artist, title or time are skipped and counted.
+func ParseHistory(raw []byte, format string) ([]go101ImportedPlay, int, error) {
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	if format == "" || format == HISTORY_FORMAT_AUTO {
+		format = detectHistoryFormat(raw)
+	}
+	switch format {
+	case HISTORY_FORMAT_CSV, HISTORY_FORMAT_LASTFM:
+		return parseHistoryCSV(raw, format == HISTORY_FORMAT_LASTFM)
+	case HISTORY_FORMAT_JSON:
+		var doc interface{}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, 0, fmt.Errorf("couldn't parse JSON: %s", err.Error())
+		}
+		plays, skipped := make([]go101ImportedPlay, 0), 0
+		walkHistoryJSON(doc, &plays, &skipped)
+		return plays, skipped, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown format %s", format)
+	}
+}
+
+// Guesses format by contents: JSON, CSV with known header or Last.fm CSV.
+func detectHistoryFormat(raw []byte) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return HISTORY_FORMAT_JSON
+	}
+	header, err := csv.NewReader(bytes.NewReader(raw)).Read()
+	if err != nil {
+		return HISTORY_FORMAT_CSV
+	}
+	names := make([]string, len(header))
+	for i, h := range header {
+		names[i] = historyKey(h)
+	}
+	if historyColumn(names, historyArtistKeys) >= 0 && historyColumn(names, historyTitleKeys) >= 0 {
+		return HISTORY_FORMAT_CSV
+	}
+	return HISTORY_FORMAT_LASTFM
+}
+
+func parseHistoryCSV(raw []byte, lastfm bool) ([]go101ImportedPlay, int, error) {
+	r := csv.NewReader(bytes.NewReader(raw))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	artist, album, title, at := 0, 1, 2, 3
+	if !lastfm {
+		header, err := r.Read()
+		if err != nil {
+			return nil, 0, fmt.Errorf("couldn't read CSV header: %s", err.Error())
+		}
+		names := make([]string, len(header))
+		for i, h := range header {
+			names[i] = historyKey(h)
+		}
+		artist, title = historyColumn(names, historyArtistKeys), historyColumn(names, historyTitleKeys)
+		album, at = historyColumn(names, historyAlbumKeys), historyColumn(names, historyTimeKeys)
+		if artist < 0 || title < 0 || at < 0 {
+			return nil, 0, fmt.Errorf("CSV header needs artist, title and time columns, got %s", strings.Join(header, ","))
+		}
+	}
+	field := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	plays, skipped := make([]go101ImportedPlay, 0), 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		play := go101ImportedPlay{Artist: field(record, artist), Title: field(record, title), Album: field(record, album)}
+		t, err := parseHistoryTime(field(record, at))
+		if err != nil || play.Artist == "" || play.Title == "" {
+			skipped++
+			continue
+		}
+		play.PlayedAt = t
+		plays = append(plays, play)
+	}
+	return plays, skipped, nil
+}
+
+// Returns string value of the object by the first present key. Last.fm objects ({"#text": "..."}) and numbers
+// are taken too.
+func historyValue(obj map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		for k, v := range obj {
+			if historyKey(k) != historyKey(key) {
+				continue
+			}
+			switch t := v.(type) {
+			case string:
+				return strings.TrimSpace(t)
+			case float64:
+				return strconv.FormatInt(int64(t), 10)
+			case map[string]interface{}:
+				if s := historyValue(t, []string{"uts", "#text", "name"}); s != "" {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Collects plays of any JSON structure: objects with artist and title are plays, others are searched inside.
+func walkHistoryJSON(v interface{}, plays *[]go101ImportedPlay, skipped *int) {
+	switch t := v.(type) {
+	case []interface{}:
+		for _, item := range t {
+			walkHistoryJSON(item, plays, skipped)
+		}
+	case map[string]interface{}:
+		obj := t
+		// ListenBrainz keeps track inside of the listen.
+		if meta, ok := t["track_metadata"].(map[string]interface{}); ok {
+			obj = make(map[string]interface{}, len(t)+len(meta))
+			for k, v := range t {
+				obj[k] = v
+			}
+			for k, v := range meta {
+				obj[k] = v
+			}
+		}
+		artist, title := historyValue(obj, historyArtistKeys), historyValue(obj, historyTitleKeys)
+		if artist == "" || title == "" {
+			for _, item := range t {
+				walkHistoryJSON(item, plays, skipped)
+			}
+			return
+		}
+		at, err := parseHistoryTime(historyValue(obj, historyTimeKeys))
+		if err != nil {
+			// Ex: Last.fm track playing now, without date.
+			*skipped++
+			return
+		}
+		*plays = append(*plays, go101ImportedPlay{artist, title, historyValue(obj, historyAlbumKeys), at})
+	}
+}
+
+// Adds imported plays to the history, returns number of new ones. Plays imported before are ignored.
+func (p *go101) ImportHistory(plays []go101ImportedPlay) (int, error) {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, play := range plays {
+		// Without channel and track ID, play time keeps imported plays unique.
+		res, err := tx.Exec(`INSERT OR IGNORE INTO history (channel_id, track_uid, artist, title, album, started_at, played_at)
+			VALUES (0, 0, ?, ?, ?, ?, ?)`, play.Artist, play.Title, play.Album, play.PlayedAt.Unix(), play.PlayedAt.Unix())
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+		if err = p.IndexTrack(tx, play.Artist, play.Title); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+	return added, tx.Commit()
+}
+
+// Show listening history or import it from other players.
+func CmdHistory(args []string) {
+	if len(args) > 0 && args[0] == "import" {
+		cmdHistoryImport(args[1:])
+		return
+	}
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	limit := fs.Int("n", 20, "Max number of tracks.")
+	channel := fs.String("c", "", "Channel ID or alias, all channels by default.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	var cid uint64
+	if *channel != "" {
+		var err error
+		if cid, err = go101o.ResolveChannel(*channel); err != nil {
+			log.Fatal(err)
+		}
+	}
+	entries, err := go101o.History(cid, *limit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("History is empty, play a bit or run \"101ply history import <file>\".")
+		return
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		line := fmt.Sprintf("%s - %s [%s]", e.Track.Artist, e.Track.Title, go101o.channelTitle(e.ChannelId))
+		fmt.Printf("%s %s\n", FormatDateTime(e.PlayedAt), go101o.ConsoleText(line))
+	}
+}
+
+func cmdHistoryImport(args []string) {
+	fs := flag.NewFlagSet("history import", flag.ExitOnError)
+	from := fs.String("from", "", "Exported history file, - for stdin.")
+	format := fs.String("format", HISTORY_FORMAT_AUTO, "Format: auto, csv (with header), lastfm (Last.fm scrobbles CSV) or json (Last.fm, ListenBrainz, Spotify).")
+	dryRun := fs.Bool("dry-run", false, "Parse the file and print what would be imported.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if *from == "" && fs.NArg() > 0 {
+		*from = fs.Arg(0)
+	}
+	if *from == "" {
+		log.Fatal("Usage: history import [-format auto|csv|lastfm|json] [-dry-run] --from <file>")
+	}
+	var (
+		raw []byte
+		err error
+	)
+	if *from == "-" {
+		raw, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		raw, err = ioutil.ReadFile(*from)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	plays, skipped, err := ParseHistory(raw, *format)
+	if err != nil {
+		log.Fatalf("Couldn't parse %s: %s", *from, err.Error())
+	}
+	if len(plays) == 0 {
+		log.Fatalf("No plays found in %s (%d skipped)", *from, skipped)
+	}
+	first, last := plays[0].PlayedAt, plays[0].PlayedAt
+	for _, play := range plays {
+		if play.PlayedAt.Before(first) {
+			first = play.PlayedAt
+		}
+		if play.PlayedAt.After(last) {
+			last = play.PlayedAt
+		}
+	}
+	fmt.Printf("Found %d plays of %s - %s", len(plays), FormatDate(first), FormatDate(last))
+	if skipped > 0 {
+		fmt.Printf(", %d skipped (no artist, title or time)", skipped)
+	}
+	fmt.Println(".")
+	if *dryRun {
+		return
+	}
+	added, err := go101o.ImportHistory(plays)
+	if err != nil {
+		log.Fatal("Couldn't import history: ", err.Error())
+	}
+	fmt.Printf("Imported %d plays, %d were imported before.\n", added, len(plays)-added)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/BurntSushi/xgbutil/xevent"
+)
+
+const (
+	DEFAULT_CHORD_TIMEOUT = 1500 * time.Millisecond
+	// Interval of reconnection attempts after X connection is lost, ex: on session restart.
+	HOTKEY_RETRY_INTERVAL = 30 * time.Second
+)
+
+var (
+	// X connection used for hotkeys, nil if hotkeys aren't available.
+	hotkeyX   *xgbutil.XUtil
+	hotkeyMux sync.Mutex
+	// Grabs are released, only "suspend-hotkeys" keys are bound.
+	hotkeysSuspended bool
+)
+
+// Rebinds hotkeys, ex: after profile switch.
+func ReloadHotkeys() {
+	hotkeyMux.Lock()
+	defer hotkeyMux.Unlock()
+	if hotkeyX == nil {
+		return
+	}
+	if err := bindall(GetHotkeyConfig(), hotkeyX); err != nil {
+		log.Println(err)
+	}
+}
+
+// Releases all grabs but the ones of "suspend-hotkeys" action, so other programs get the keys, or grabs them back.
+func SuspendHotkeys(suspended bool) {
+	hotkeyMux.Lock()
+	defer hotkeyMux.Unlock()
+	if hotkeysSuspended == suspended {
+		return
+	}
+	hotkeysSuspended = suspended
+	if hotkeyX != nil {
+		if err := bindall(GetHotkeyConfig(), hotkeyX); err != nil {
+			log.Println(err)
+		}
+	}
+	message := "enabled."
+	if suspended {
+		message = "suspended, keys are passed to other programs."
+	}
+	fmt.Printf("\n%s: %s\n", Paint(theme.Info, "Hotkeys"), message)
+}
+
+// Checks if hotkeys are suspended.
+func HotkeysSuspended() bool {
+	hotkeyMux.Lock()
+	defer hotkeyMux.Unlock()
+	return hotkeysSuspended
+}
+
+// Connects to X and binds hotkeys.
+func connectHotkeys() (*xgbutil.XUtil, error) {
+	X, err := xgbutil.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	keybind.Initialize(X)
+	hotkeyMux.Lock()
+	defer hotkeyMux.Unlock()
+	hotkeyX = X
+	if err = bindall(GetHotkeyConfig(), X); err != nil {
+		log.Println(err)
+	}
+	return X, nil
+}
+
+// Runs hotkey callbacks of key press events until X connection is closed. Unlike xevent.Main, it doesn't
+// exit the process on disconnect.
+func hotkeyEvents(X *xgbutil.XUtil) {
+	for {
+		ev, err := X.Conn().WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		if err != nil {
+			Debug("X error: %s", err)
+			continue
+		}
+		press, ok := ev.(xproto.KeyPressEvent)
+		if !ok {
+			continue
+		}
+		e := xevent.KeyPressEvent{KeyPressEvent: &press}
+		X.TimeSet(e.Time)
+		X.CallbacksLck.RLock()
+		callbacks := X.Callbacks[xevent.KeyPress][e.Event]
+		X.CallbacksLck.RUnlock()
+		for _, cb := range callbacks {
+			cb.Run(X, e)
+		}
+	}
+}
+
+// Handles hotkeys, reconnects to X if connection is lost. Playback goes on without hotkeys meanwhile.
+// Runs forever.
+func HotkeyLoop(X *xgbutil.XUtil) {
+	for true {
+		if X != nil {
+			hotkeyEvents(X)
+			hotkeyMux.Lock()
+			hotkeyX = nil
+			hotkeyMux.Unlock()
+			log.Println("X connection lost, hotkeys are disabled until it's back")
+		}
+		time.Sleep(HOTKEY_RETRY_INTERVAL)
+		var err error
+		if X, err = connectHotkeys(); err != nil {
+			Debug("Couldn't reconnect to X: %s", err)
+			continue
+		}
+		fmt.Println("X connection restored, hotkeys are enabled.")
+	}
+}
+
+// Connects to X, binds hotkeys and starts goroutines watching hotkey config and handling X events.
+// Goroutines are started even if X isn't available, so hotkeys get enabled once it is.
+func InitHotkeys(wg *sync.WaitGroup) error {
+	hotkeyConfig := GetHotkeyConfig()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err = watcher.Add(hotkeyConfig); err != nil {
+		log.Println(err)
+	}
+
+	// Keybinding goroutine.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Supervise("hotkey watcher", func() {
+			for {
+				select {
+				case ev := <-watcher.Events:
+					log.Println(ev)
+					ReloadHotkeys()
+
+				case err := <-watcher.Errors:
+					log.Println("error:", err)
+				}
+			}
+		})
+	}()
+
+	X, err := connectHotkeys()
+
+	// Event handling goroutine.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Supervise("hotkey events", func() {
+			HotkeyLoop(X)
+		})
+	}()
+	return err
+}
+
+// Parses config file and binds keys to events. Hotkeys of the active profile are used instead of config file.
+// The hotkey lock must be held.
+func bindall(hotkeyConfig string, X *xgbutil.XUtil) (err error) {
+	hotkeys := []Hotkey{}
+	if go101o.Profile != nil && len(go101o.Profile.Hotkeys) > 0 {
+		hotkeys = go101o.Profile.Hotkeys
+	} else {
+		config, err := ioutil.ReadFile(hotkeyConfig)
+		if err != nil {
+			return fmt.Errorf("could not find config file: %s", err.Error())
+		}
+		if err = json.Unmarshal(config, &hotkeys); err != nil {
+			return fmt.Errorf("could not parse config file: %s", err.Error())
+		}
+	}
+	keybind.Detach(X, X.RootWin())
+	for _, hotkey := range hotkeys {
+		if hotkeysSuspended && hotkey.Action != ACTION_SUSPEND_HOTKEYS {
+			continue
+		}
+		if err := hotkey.attach(X); err != nil {
+			log.Println(err)
+		}
+	}
+	return
+}
+
+// Attach callback to the hotkey.
+func (hotkey Hotkey) attach(X *xgbutil.XUtil) error {
+	err := keybind.KeyPressFun(
+		func(X *xgbutil.XUtil, e xevent.KeyPressEvent) {
+			if len(hotkey.Chord) > 0 {
+				go Safe("chord "+hotkey.Key, func() {
+					hotkey.chord(X)
+				})
+				return
+			}
+			go Safe("hotkey "+hotkey.Key, func() {
+				go101o.Action(hotkey.Action)
+			})
+		}).Connect(X, X.RootWin(), hotkey.Key, true)
+	if err != nil {
+		// Usually key is grabbed by another program (media keys by desktop environment), skip it.
+		return fmt.Errorf("could not bind %s, probably it's used by another program: %s", hotkey.Key, err.Error())
+	}
+	return nil
+}
+
+// Waits for the second key of the chord. Only chord keys are grabbed meanwhile, leader key cancels the chord.
+// All hotkeys are bound back after that.
+func (hotkey Hotkey) chord(X *xgbutil.XUtil) {
+	timeout := time.Duration(go101o.Config.ChordTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = DEFAULT_CHORD_TIMEOUT
+	}
+	pressed := make(chan string, 1)
+	// Grabs are shared with the hotkey event and watcher goroutines.
+	hotkeyMux.Lock()
+	if hotkeyX != X {
+		// X connection is lost meanwhile.
+		hotkeyMux.Unlock()
+		return
+	}
+	keybind.Detach(X, X.RootWin())
+	for _, k := range append(hotkey.Chord, Hotkey{Key: hotkey.Key}) {
+		k := k
+		err := keybind.KeyPressFun(
+			func(X *xgbutil.XUtil, e xevent.KeyPressEvent) {
+				select {
+				case pressed <- k.Action:
+				default:
+				}
+			}).Connect(X, X.RootWin(), k.Key, true)
+		if err != nil {
+			log.Printf("could not bind %s: %s", k.Key, err.Error())
+		}
+	}
+	hotkeyMux.Unlock()
+	Debug("Chord %s started", hotkey.Key)
+
+	select {
+	case action := <-pressed:
+		if action != "" {
+			go101o.Action(action)
+		}
+	case <-time.After(timeout):
+		Debug("Chord %s timed out", hotkey.Key)
+	}
+	ReloadHotkeys()
+}
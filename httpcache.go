@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+const HTTP_TIMEOUT = 30 * time.Second
+
+// Client for provider requests.
+var httpClient = &http.Client{Timeout: HTTP_TIMEOUT}
+
+// Cached HTTP response with its validators.
+type go101HttpCacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	Body         []byte `json:"body"`
+}
+
+// Returns full path to the HTTP responses cache directory.
+func GetHttpCacheDir() string {
+	ps := string(os.PathSeparator)
+	return GetCacheDir() + ps + "http"
+}
+
+// Returns full path to the cached response of the URL (without .gz suffix).
+func GetHttpCacheFile(url string) string {
+	ps := string(os.PathSeparator)
+	return fmt.Sprintf("%s%s%x.json", GetHttpCacheDir(), ps, sha1.Sum([]byte(url)))
+}
+
+// Fetches URL with conditional request if the response is cached: server replies "304 Not Modified" without body
+// if ETag or Last-Modified didn't change, then cached body is returned. Responses without validators aren't cached.
+func CachedGet(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	filename := GetHttpCacheFile(url)
+	var cached *go101HttpCacheEntry
+	if raw, err := ReadCacheFile(filename); err == nil {
+		entry := &go101HttpCacheEntry{}
+		if json.Unmarshal(raw, entry) == nil && entry.URL == url {
+			cached = entry
+			if entry.ETag != "" {
+				req.Header.Set("If-None-Match", entry.ETag)
+			}
+			if entry.LastModified != "" {
+				req.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+		}
+	}
+	rateLimiter.Wait()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		Debug("Not modified, cached response used: %s", url)
+		return cached.Body, nil
+	}
+	if err = CheckStatus(resp); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	entry := go101HttpCacheEntry{url, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), body}
+	if entry.ETag != "" || entry.LastModified != "" {
+		if err = os.MkdirAll(GetHttpCacheDir(), PRIVATE_DIR_PERM); err == nil {
+			raw, _ := json.Marshal(entry)
+			err = WriteCacheFile(filename, raw)
+		}
+		if err != nil {
+			Debug("Couldn't cache response: %s", err)
+		}
+	}
+	return body, nil
+}
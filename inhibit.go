@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	LOGIND_NAME = "org.freedesktop.login1"
+	LOGIND_PATH = "/org/freedesktop/login1"
+	PM_NAME     = "org.freedesktop.PowerManagement"
+	PM_PATH     = "/org/freedesktop/PowerManagement/Inhibit"
+)
+
+// Idle/suspend inhibitor held while playing.
+type go101Inhibitor struct {
+	mux sync.Mutex
+	// Lock file descriptor given by logind.
+	fd int
+	// Cookie given by PowerManagement service, used if logind isn't available.
+	cookie uint32
+	// Inhibit request of the desktop portal, used in Flatpak.
+	request dbus.ObjectPath
+	held    bool
+}
+
+var inhibitor = &go101Inhibitor{fd: -1}
+
+// Takes idle/suspend inhibitor when playback starts and releases it on pause/stop.
+func (p *go101) InitInhibitor() {
+	p.Subscribe(func(e go101Event) {
+		if e.Type != EVENT_STATUS {
+			return
+		}
+		// Listeners run concurrently, so check actual status instead of the event one.
+		if p.Status() == STATUS_PLAY {
+			inhibitor.Take()
+		} else {
+			inhibitor.Release()
+		}
+	})
+}
+
+// Takes inhibitor via logind, falls back to session PowerManagement service.
+func (i *go101Inhibitor) Take() {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.held {
+		return
+	}
+	if !SystemBusAvailable() {
+		// Skip to the session services.
+	} else if conn, err := dbus.SystemBus(); err == nil {
+		var fd dbus.UnixFD
+		err = conn.Object(LOGIND_NAME, LOGIND_PATH).
+			Call(LOGIND_NAME+".Manager.Inhibit", 0, "sleep:idle", "101ply", "Playing radio", "block").
+			Store(&fd)
+		if err == nil {
+			i.fd, i.held = int(fd), true
+			Debug("Sleep inhibited via logind")
+			return
+		}
+		Debug("Couldn't inhibit sleep via logind: %s", err)
+	}
+	if UsePortals() {
+		request, err := PortalInhibit("Playing radio")
+		if err == nil {
+			i.request, i.held = request, true
+			Debug("Sleep inhibited via portal")
+			return
+		}
+		Debug("Couldn't inhibit sleep via portal: %s", err)
+	}
+	if !SessionBusAvailable() {
+		log.Println("Couldn't inhibit sleep: no D-Bus")
+		return
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		log.Println("Couldn't inhibit sleep: ", err.Error())
+		return
+	}
+	err = conn.Object(PM_NAME, PM_PATH).Call(PM_NAME+".Inhibit.Inhibit", 0, "101ply", "Playing radio").Store(&i.cookie)
+	if err != nil {
+		log.Println("Couldn't inhibit sleep: ", err.Error())
+		return
+	}
+	i.held = true
+	Debug("Sleep inhibited via PowerManagement")
+}
+
+// Releases inhibitor, if any.
+func (i *go101Inhibitor) Release() {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if !i.held {
+		return
+	}
+	i.held = false
+	if i.fd >= 0 {
+		_ = syscall.Close(i.fd)
+		i.fd = -1
+		Debug("Sleep inhibitor released")
+		return
+	}
+	if i.request != "" {
+		if err := PortalRelease(i.request); err != nil {
+			Debug("Couldn't release inhibitor: %s", err)
+		}
+		i.request = ""
+		Debug("Sleep inhibitor released")
+		return
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return
+	}
+	if err = conn.Object(PM_NAME, PM_PATH).Call(PM_NAME+".Inhibit.UnInhibit", 0, i.cookie).Err; err != nil {
+		Debug("Couldn't release inhibitor: %s", err)
+	}
+	Debug("Sleep inhibitor released")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+var reInstance = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Instance name given by -instance option, empty for the default instance.
+var instance string
+
+// Lock file of the running instance, kept open until exit.
+var instanceLock *os.File
+
+// Checks and sets instance name.
+func SetInstance(name string) error {
+	if name != "" && !reInstance.MatchString(name) {
+		return fmt.Errorf("wrong instance name %s, only letters, digits, '-' and '_' are allowed", name)
+	}
+	instance = name
+	return nil
+}
+
+// Returns full path to the directory of runtime files (socket, lock, state, play log) of the instance.
+// Default instance keeps them right in the cache directory.
+func GetRuntimeDir() string {
+	if instance == "" {
+		return GetCacheDir()
+	}
+	ps := string(os.PathSeparator)
+	return GetCacheDir() + ps + "instances" + ps + instance
+}
+
+// Returns full path to the lock file of the instance.
+func GetLockFile() string {
+	ps := string(os.PathSeparator)
+	return GetRuntimeDir() + ps + "101ply.lock"
+}
+
+// Takes exclusive lock of the instance, fails if player with the same instance name is running.
+// Lock is released by the kernel on exit, even if process crashed.
+func LockInstance() error {
+	if err := os.MkdirAll(GetRuntimeDir(), PRIVATE_DIR_PERM); err != nil {
+		return fmt.Errorf("couldn't create runtime directory: %s", err.Error())
+	}
+	f, err := os.OpenFile(GetLockFile(), os.O_CREATE|os.O_RDWR, PRIVATE_FILE_PERM)
+	if err != nil {
+		return fmt.Errorf("couldn't open lock file: %s", err.Error())
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if instance == "" {
+			return fmt.Errorf("player is already running, use -instance option to run another one")
+		}
+		return fmt.Errorf("player instance %s is already running", instance)
+	}
+	_ = f.Truncate(0)
+	_, _ = fmt.Fprintf(f, "%d\n", os.Getpid())
+	instanceLock = f
+	return nil
+}
+
+// Returns D-Bus name of the MPRIS service, unique per instance.
+func MprisName() string {
+	if instance == "" {
+		return MPRIS_NAME
+	}
+	// Bus name elements can't contain '-'.
+	return MPRIS_NAME + ".instance_" + strings.Replace(instance, "-", "_", -1)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_SILENCE_SECONDS = 20
+	DEFAULT_MAX_BAD_FRAMES  = 50
+	// Bad frames are counted within that much audio.
+	BAD_FRAMES_WINDOW = 10 * time.Second
+)
+
+// Stream integrity monitoring, works in the stream proxy.
+type go101IntegrityConfig struct {
+	// Reconnect after that many seconds of digital silence.
+	SilenceSeconds int `json:"silence_seconds"`
+	// Reconnect after that many broken frames (lost sync or CRC mismatch) within 10 seconds of audio.
+	MaxBadFrames int `json:"max_bad_frames"`
+	// Stream hosts tried in turn on reconnect, ex: ["cdn2.101.ru", "cdn3.101.ru"]. Original host comes first.
+	Mirrors []string `json:"mirrors"`
+}
+
+// Index of the stream host in use, 0 is the original one. Reconnects of the same track are counted,
+// so a track broken on every host doesn't restart forever.
+var (
+	streamMirror     int
+	streamMirrorMux  sync.Mutex
+	reconnectTrack   uint64
+	reconnectAttempt int
+)
+
+// Returns stream URL with host replaced by the current mirror.
+func (c *go101IntegrityConfig) MirrorURL(raw string) string {
+	streamMirrorMux.Lock()
+	i := streamMirror
+	streamMirrorMux.Unlock()
+	if c == nil || i == 0 || i > len(c.Mirrors) {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Host = c.Mirrors[i-1]
+	return u.String()
+}
+
+// Switches to the next mirror, returns its host or empty string for the original one.
+func (c *go101IntegrityConfig) NextMirror() string {
+	streamMirrorMux.Lock()
+	defer streamMirrorMux.Unlock()
+	streamMirror = (streamMirror + 1) % (len(c.Mirrors) + 1)
+	if streamMirror == 0 {
+		return ""
+	}
+	return c.Mirrors[streamMirror-1]
+}
+
+// Handles broken stream: logs the problem and restarts current track from the next mirror.
+func (p *go101) StreamBroken(reason string) {
+	err := fmt.Errorf("stream integrity: %s", reason)
+	log.Println(err)
+	p.EmitError(err)
+	p.Reconnect()
+}
+
+// Restarts current track from the next mirror, unless it was restarted on every host already.
+func (p *go101) Reconnect() {
+	if p.Status() == STATUS_STOP || p.Replaying() || p.Previewing() {
+		return
+	}
+	streamMirrorMux.Lock()
+	if uid := p.Track().TrackUid; reconnectTrack != uid {
+		reconnectTrack, reconnectAttempt = uid, 0
+	}
+	reconnectAttempt++
+	attempt := reconnectAttempt
+	streamMirrorMux.Unlock()
+	if attempt > len(p.Config.Integrity.Mirrors)+1 {
+		Debug("Stream is broken on all hosts, keep playing")
+		return
+	}
+	if len(p.Config.Integrity.Mirrors) > 0 {
+		host := p.Config.Integrity.NextMirror()
+		if host == "" {
+			host = "original host"
+		}
+		Debug("Switch stream to %s", host)
+	}
+	stats.AddReconnect()
+	// Main loop fetches and plays the current track again.
+	p.RestartTrack()
+}
+
+// MPEG audio frame checker, fed with the raw stream. Calls broken once, when silence or broken frames
+// exceed the limits.
+type go101FrameChecker struct {
+	silenceLimit time.Duration
+	maxBad       int
+	broken       func(reason string)
+
+	buf     []byte
+	silence time.Duration
+	// Audio duration and bad frames of the current window.
+	window   time.Duration
+	bad      int
+	reported bool
+}
+
+// Returns frame checker reporting problems to broken.
+func NewFrameChecker(c *go101IntegrityConfig, broken func(reason string)) *go101FrameChecker {
+	k := &go101FrameChecker{
+		silenceLimit: time.Duration(c.SilenceSeconds) * time.Second,
+		maxBad:       c.MaxBadFrames,
+		broken:       broken,
+	}
+	if k.silenceLimit <= 0 {
+		k.silenceLimit = DEFAULT_SILENCE_SECONDS * time.Second
+	}
+	if k.maxBad <= 0 {
+		k.maxBad = DEFAULT_MAX_BAD_FRAMES
+	}
+	return k
+}
+
+// Checks all complete frames of the data, incomplete tail waits for the next write. Never fails,
+// so the stream itself isn't affected.
+func (k *go101FrameChecker) Write(data []byte) (int, error) {
+	if k.reported {
+		return len(data), nil
+	}
+	k.buf = append(k.buf, data...)
+	i := 0
+	for len(k.buf)-i >= 10 {
+		if n := id3Size(k.buf[i:]); n > 0 {
+			if len(k.buf)-i < n {
+				break
+			}
+			i += n
+			continue
+		}
+		h, ok := parseFrameHeader(k.buf[i:])
+		if !ok {
+			// Lost sync, skip to the next sync word.
+			j := i + 1
+			for j < len(k.buf)-1 && !(k.buf[j] == 0xFF && k.buf[j+1]&0xE0 == 0xE0) {
+				j++
+			}
+			k.bad++
+			i = j
+			continue
+		}
+		if len(k.buf)-i < h.length {
+			break
+		}
+		k.frame(h, k.buf[i:i+h.length])
+		i += h.length
+		if k.reported {
+			k.buf = nil
+			return len(data), nil
+		}
+	}
+	k.buf = append(k.buf[:0], k.buf[i:]...)
+	return len(data), nil
+}
+
+// Accounts a single frame.
+func (k *go101FrameChecker) frame(h go101FrameHeader, frame []byte) {
+	if h.crc && !h.checkCRC(frame) {
+		k.bad++
+	}
+	if h.silent(frame) {
+		k.silence += h.duration
+	} else {
+		k.silence = 0
+	}
+	k.window += h.duration
+	switch {
+	case k.silence >= k.silenceLimit:
+		k.report(fmt.Sprintf("silence for %s", k.silence.Round(time.Second)))
+	case k.bad >= k.maxBad:
+		k.report(fmt.Sprintf("%d broken frames", k.bad))
+	case k.window >= BAD_FRAMES_WINDOW:
+		k.window, k.bad = 0, 0
+	}
+}
+
+func (k *go101FrameChecker) report(reason string) {
+	k.reported = true
+	go Safe("stream integrity", func() {
+		k.broken(reason)
+	})
+}
+
+// Returns size of ID3v2 tag the data starts with, 0 if there is no tag.
+func id3Size(data []byte) int {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return 0
+	}
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9]) + 10
+	if data[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+// Parsed MPEG audio frame header.
+type go101FrameHeader struct {
+	mpeg1    bool
+	layer    int
+	mono     bool
+	crc      bool
+	length   int
+	duration time.Duration
+}
+
+var (
+	// Kbps by MPEG version (1 and 2/2.5) and layer.
+	frameBitrates = [2][3][16]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		},
+	}
+	// Hz by MPEG version bits.
+	frameSampleRates = map[byte][3]int{
+		3: {44100, 48000, 32000},
+		2: {22050, 24000, 16000},
+		0: {11025, 12000, 8000},
+	}
+)
+
+// Parses 4 bytes frame header.
+func parseFrameHeader(b []byte) (go101FrameHeader, bool) {
+	var h go101FrameHeader
+	if b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return h, false
+	}
+	version := b[1] >> 3 & 3
+	layerBits := b[1] >> 1 & 3
+	rates, ok := frameSampleRates[version]
+	if !ok || layerBits == 0 {
+		return h, false
+	}
+	h.mpeg1 = version == 3
+	h.layer = int(4 - layerBits)
+	h.crc = b[1]&1 == 0
+	v := 1
+	if h.mpeg1 {
+		v = 0
+	}
+	bitrate := frameBitrates[v][h.layer-1][b[2]>>4]
+	rateIdx := b[2] >> 2 & 3
+	if bitrate == 0 || rateIdx == 3 {
+		return h, false
+	}
+	rate := rates[rateIdx]
+	padding := int(b[2] >> 1 & 1)
+	h.mono = b[3]>>6 == 3
+	samples := 1152
+	switch {
+	case h.layer == 1:
+		samples = 384
+		h.length = (12*bitrate*1000/rate + padding) * 4
+	case h.layer == 3 && !h.mpeg1:
+		samples = 576
+		h.length = 72*bitrate*1000/rate + padding
+	default:
+		h.length = 144*bitrate*1000/rate + padding
+	}
+	h.duration = time.Duration(samples) * time.Second / time.Duration(rate)
+	return h, h.length > 4
+}
+
+// Returns Layer III side information size.
+func (h go101FrameHeader) sideInfoSize() int {
+	switch {
+	case h.mpeg1 && h.mono:
+		return 17
+	case h.mpeg1:
+		return 32
+	case h.mono:
+		return 9
+	}
+	return 17
+}
+
+// Verifies CRC-16 of the frame. Only Layer III is checked, its protected part is the side information.
+func (h go101FrameHeader) checkCRC(frame []byte) bool {
+	if h.layer != 3 || len(frame) < 6+h.sideInfoSize() {
+		return true
+	}
+	crc := uint16(0xFFFF)
+	for _, b := range append([]byte{frame[2], frame[3]}, frame[6:6+h.sideInfoSize()]...) {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc == uint16(frame[4])<<8|uint16(frame[5])
+}
+
+// Checks if Layer III frame holds no audio data: part2_3_length of every granule and channel is zero.
+// Other layers are never considered silent.
+func (h go101FrameHeader) silent(frame []byte) bool {
+	offset := 4
+	if h.crc {
+		offset += 2
+	}
+	if h.layer != 3 || len(frame) < offset+h.sideInfoSize() {
+		return false
+	}
+	side := frame[offset : offset+h.sideInfoSize()]
+	// Bits before the first granule and size of granule info.
+	start, size, granules, channels := 17, 63, 1, 2
+	switch {
+	case h.mpeg1 && h.mono:
+		start, size, granules, channels = 18, 59, 2, 1
+	case h.mpeg1:
+		start, size, granules, channels = 20, 59, 2, 2
+	case h.mono:
+		start, channels = 9, 1
+	default:
+		start = 10
+	}
+	for i := 0; i < granules*channels; i++ {
+		if readBits(side, start+i*size, 12) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads n bits starting at bit offset, most significant first.
+func readBits(data []byte, offset, n int) int {
+	v := 0
+	for i := offset; i < offset+n; i++ {
+		v = v<<1 | int(data[i/8]>>(7-uint(i%8))&1)
+	}
+	return v
+}
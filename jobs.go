@@ -0,0 +1,272 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	JOB_CHECK_INTERVAL = 20 * time.Second
+	// Run missed by that much (ex: after suspend) is still done, later ones are skipped.
+	JOB_GRACE = 5 * time.Minute
+)
+
+// Control commands allowed in schedule besides actions.
+var jobCommands = []string{"channel", "volume", "profile", "rotation", "hotkeys", ACTION_BOOKMARK}
+
+// Control command run by cron spec, ex: "channel jazz" at "0 7 * * mon-fri" makes an alarm.
+type go101Job struct {
+	Id int64
+	// Player instance the command is sent to, empty is the default one.
+	Instance string
+	Spec     string
+	// Time zone of the spec, "time_zone" of the config if empty.
+	TimeZone string
+	Command  string
+	LastRun  time.Time
+}
+
+// Checks that the line is a control command suitable for schedule.
+func CheckJobCommand(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	if KnownAction(fields[0]) {
+		return nil
+	}
+	for _, name := range jobCommands {
+		if fields[0] == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown command %s, expected action or one of %s", fields[0], strings.Join(jobCommands, ", "))
+}
+
+// Returns parsed spec of the job in its zone, or in the config zone.
+func (p *go101) JobCron(j go101Job) (*go101Cron, error) {
+	if j.TimeZone == "" {
+		return ParseCronIn(j.Spec, p.Config.Location())
+	}
+	return ParseCron(j.Spec, j.TimeZone)
+}
+
+// Returns scheduled commands of the instance.
+func (p *go101) Jobs(instance string) ([]go101Job, error) {
+	rows, err := p.DB.Query(`SELECT id, instance, spec, time_zone, command, last_run FROM jobs WHERE instance = ?
+		ORDER BY id`, instance)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	jobs := make([]go101Job, 0)
+	for rows.Next() {
+		var (
+			j    go101Job
+			last int64
+		)
+		if err = rows.Scan(&j.Id, &j.Instance, &j.Spec, &j.TimeZone, &j.Command, &last); err != nil {
+			return nil, err
+		}
+		j.LastRun = time.Unix(last, 0)
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Adds scheduled command, returns its ID.
+func (p *go101) AddJob(j go101Job) (int64, error) {
+	if _, err := p.JobCron(j); err != nil {
+		return 0, err
+	}
+	if err := CheckJobCommand(j.Command); err != nil {
+		return 0, err
+	}
+	res, err := p.DB.Exec(`INSERT INTO jobs (instance, spec, time_zone, command) VALUES (?, ?, ?, ?)`,
+		j.Instance, j.Spec, j.TimeZone, j.Command)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Removes scheduled command.
+func (p *go101) RemoveJob(id int64) error {
+	res, err := p.DB.Exec(`DELETE FROM jobs WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no scheduled command #%d", id)
+	}
+	return nil
+}
+
+// Runs commands due since the last check. Runs missed while player wasn't running aren't done.
+func (p *go101) RunDueJobs(started time.Time) {
+	jobs, err := p.Jobs(instance)
+	if err != nil {
+		log.Println("Couldn't load scheduled commands: ", err.Error())
+		return
+	}
+	now := time.Now()
+	for _, j := range jobs {
+		cron, err := p.JobCron(j)
+		if err != nil {
+			Debug("Scheduled command #%d skipped: %s", j.Id, err)
+			continue
+		}
+		since := j.LastRun
+		if since.Before(started) {
+			since = started
+		}
+		next := cron.Next(since)
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		if now.Sub(next) > JOB_GRACE {
+			Debug("Scheduled command #%d of %s is missed", j.Id, FormatDateTime(next))
+		} else {
+			fmt.Printf("\n%s: %s\n", Paint(theme.Info, "Schedule"), j.Command)
+			if _, err = p.Command(j.Command); err != nil {
+				log.Printf("Couldn't run scheduled command #%d: %s", j.Id, err.Error())
+			}
+		}
+		if _, err = p.DB.Exec(`UPDATE jobs SET last_run = ? WHERE id = ?`, now.Unix(), j.Id); err != nil {
+			log.Println("Couldn't save scheduled command: ", err.Error())
+		}
+	}
+}
+
+// Runs scheduled commands. Commands added by "101ply schedule add" are picked up on the next check. Runs forever.
+func (p *go101) JobLoop() {
+	started := time.Now()
+	for true {
+		time.Sleep(JOB_CHECK_INTERVAL)
+		p.RunDueJobs(started)
+	}
+}
+
+// Returns the run moment with zone clock, if the zone differs from the system one.
+func formatRun(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	s := FormatDateTime(t)
+	_, offset := t.Zone()
+	if _, local := t.Local().Zone(); offset != local {
+		s += fmt.Sprintf(" (%s %s)", t.Location(), t.Format("15:04"))
+	}
+	return s
+}
+
+// Prints scheduled commands and schedules of the config with their next runs.
+func (p *go101) PrintSchedule() {
+	now := time.Now()
+	jobs, err := p.Jobs(instance)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No scheduled commands, add one by \"101ply schedule add <spec> <command>\".")
+	}
+	for _, j := range jobs {
+		next := "wrong spec"
+		if cron, err := p.JobCron(j); err == nil {
+			next = formatRun(cron.Next(now))
+		}
+		zone := ""
+		if j.TimeZone != "" {
+			zone = " " + j.TimeZone
+		}
+		fmt.Printf("#%d %-16s %s%s, next %s\n", j.Id, j.Spec, j.Command, zone, next)
+	}
+
+	// Clocks of the config, shown for the whole picture.
+	loc := p.Config.Location()
+	daily := func(clock string) string {
+		minutes, err := parseClock(clock)
+		if err != nil {
+			return clock
+		}
+		cron, _ := ParseCronIn(fmt.Sprintf("%d %d * * *", minutes%60, minutes/60), loc)
+		return formatRun(cron.Next(now))
+	}
+	lines := make([]string, 0)
+	if q := p.Config.QuietHours; q != nil {
+		lines = append(lines, fmt.Sprintf("quiet hours %s-%s, next %s", q.Start, q.End, daily(q.Start)))
+	}
+	for _, s := range p.Config.Rotation {
+		lines = append(lines, fmt.Sprintf("rotation %s %s-%s, next %s", s.Title(), s.Start, s.End, daily(s.Start)))
+	}
+	if c := p.Config.Digest; c != nil {
+		period := c.Period
+		if period == "" {
+			period = DIGEST_WEEKLY
+		}
+		lines = append(lines, fmt.Sprintf("%s digest, next %s", period, formatRun(c.Schedule(loc).Next(now))))
+	}
+	if len(lines) > 0 {
+		fmt.Printf("\nConfig (time zone %s):\n", loc)
+		for _, line := range lines {
+			fmt.Println("  " + line)
+		}
+	}
+}
+
+// List, add or remove scheduled commands.
+func CmdSchedule(args []string) {
+	usage := "Usage: schedule list | add [-tz zone] <spec> <command> | rm <id>"
+	if len(args) == 0 || args[0] == "list" {
+		go101o.PrintSchedule()
+		return
+	}
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("schedule add", flag.ExitOnError)
+		tz := fs.String("tz", "", "Time zone of the spec, ex: Europe/Berlin. \"time_zone\" of the config by default.")
+		if err := fs.Parse(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		rest := fs.Args()
+		// Spec is a shortcut, quoted or given as five arguments.
+		n := 5
+		if len(rest) > 0 && (strings.HasPrefix(rest[0], "@") || len(strings.Fields(rest[0])) == 5) {
+			n = 1
+		}
+		if len(rest) <= n {
+			log.Fatal(usage)
+		}
+		j := go101Job{
+			Instance: instance,
+			Spec:     strings.Join(rest[:n], " "),
+			TimeZone: *tz,
+			Command:  strings.Join(rest[n:], " "),
+		}
+		id, err := go101o.AddJob(j)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cron, _ := go101o.JobCron(j)
+		fmt.Printf("#%d added, next run %s\n", id, formatRun(cron.Next(time.Now())))
+	case "rm":
+		if len(args) < 2 {
+			log.Fatal(usage)
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			log.Fatal("Wrong scheduled command ID ", args[1])
+		}
+		if err = go101o.RemoveJob(id); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatal(usage)
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	SECRET_STORAGE_KEYRING = "keyring"
+	SECRET_STORAGE_FILE    = "file"
+	// Time given to the user to unlock the keyring.
+	KEYRING_PROMPT_TIMEOUT = 2 * time.Minute
+	KEYRING_APP            = "101ply"
+
+	secretsDest  = "org.freedesktop.secrets"
+	secretsPath  = "/org/freedesktop/secrets"
+	secretsIface = "org.freedesktop.Secret."
+	kwalletIface = "org.kde.KWallet."
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// Storage of secrets: tokens and keys referenced from config as "secret:<name>".
+type go101Keyring interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+	Close()
+}
+
+// Opens secret storage: Secret Service (GNOME Keyring, KeePassXC, KWallet 5.97+) or KWallet for "keyring",
+// secrets.json in config directory for "file", "credentials" of config encrypted by key file for "encrypted".
+func OpenKeyring(storage string) (go101Keyring, error) {
+	switch storage {
+	case SECRET_STORAGE_KEYRING, "":
+		if !SessionBusAvailable() {
+			return nil, fmt.Errorf("no session bus for keyring, set \"secret_storage\" to \"file\" or \"encrypted\" on headless machines")
+		}
+		ss, err := openSecretService()
+		if err == nil {
+			return ss, nil
+		}
+		Debug("Secret Service isn't available: %s", err)
+		kw, err := openKWallet()
+		if err == nil {
+			return kw, nil
+		}
+		Debug("KWallet isn't available: %s", err)
+		return nil, fmt.Errorf("neither Secret Service nor KWallet is available, set \"secret_storage\" to \"file\" or \"encrypted\" on headless machines")
+	case SECRET_STORAGE_FILE:
+		return &go101FileKeyring{file: GetSecretsFile()}, nil
+	case SECRET_STORAGE_ENCRYPTED:
+		return &go101EncryptedKeyring{file: GetConfigFile(), keyFile: GetCredentialsKeyFile()}, nil
+	default:
+		return nil, fmt.Errorf("unknown secret storage %s", storage)
+	}
+}
+
+// Returns full path to the file of secrets, used if "secret_storage" is "file".
+func GetSecretsFile() string {
+	ps := string(os.PathSeparator)
+	return GetConfigDir() + ps + "secrets.json"
+}
+
+// Secrets in JSON file readable by the owner only.
+type go101FileKeyring struct {
+	file string
+}
+
+func (k *go101FileKeyring) load() (map[string]string, error) {
+	secrets := make(map[string]string)
+	raw, err := ioutil.ReadFile(k.file)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(raw, &secrets); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", k.file, err.Error())
+	}
+	return secrets, nil
+}
+
+func (k *go101FileKeyring) save(secrets map[string]string) error {
+	raw, _ := json.MarshalIndent(secrets, "", "\t")
+	return WriteFileAtomic(k.file, raw, PRIVATE_FILE_PERM)
+}
+
+func (k *go101FileKeyring) Get(name string) (string, error) {
+	secrets, err := k.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (k *go101FileKeyring) Set(name, value string) error {
+	secrets, err := k.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return k.save(secrets)
+}
+
+func (k *go101FileKeyring) Delete(name string) error {
+	secrets, err := k.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return ErrSecretNotFound
+	}
+	delete(secrets, name)
+	return k.save(secrets)
+}
+
+func (k *go101FileKeyring) Close() {}
+
+// Secret Service client, see https://specifications.freedesktop.org/secret-service/.
+type go101SecretService struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+	// Default collection, usually "login" keyring.
+	collection dbus.ObjectPath
+}
+
+// Secret struct of Secret Service API.
+type go101Secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+func openSecretService() (*go101SecretService, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+	s := &go101SecretService{conn: conn}
+	svc := conn.Object(secretsDest, secretsPath)
+	// Plain session: secrets aren't encrypted on the session bus, which is private to the user anyway.
+	var output dbus.Variant
+	err = svc.Call(secretsIface+"Service.OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &s.session)
+	if err == nil {
+		err = svc.Call(secretsIface+"Service.ReadAlias", 0, "default").Store(&s.collection)
+	}
+	if err == nil && s.collection == "/" {
+		err = fmt.Errorf("no default keyring")
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func secretAttributes(name string) map[string]string {
+	return map[string]string{"application": KEYRING_APP, "name": name}
+}
+
+// Unlocks items or collections. Keyring might be locked on start or by screen lock, then the user is prompted.
+func (s *go101SecretService) unlock(objects []dbus.ObjectPath) error {
+	var (
+		unlocked []dbus.ObjectPath
+		prompt   dbus.ObjectPath
+	)
+	err := s.conn.Object(secretsDest, secretsPath).Call(secretsIface+"Service.Unlock", 0, objects).Store(&unlocked, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(prompt)
+}
+
+// Shows prompt of the Secret Service and waits for its completion.
+func (s *go101SecretService) prompt(prompt dbus.ObjectPath) error {
+	if prompt == "/" {
+		return nil
+	}
+	err := s.conn.AddMatchSignal(dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(secretsIface+"Prompt"),
+		dbus.WithMatchMember("Completed"))
+	if err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+	if err = s.conn.Object(secretsDest, prompt).Call(secretsIface+"Prompt.Prompt", 0, "").Err; err != nil {
+		return err
+	}
+	timeout := time.After(KEYRING_PROMPT_TIMEOUT)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != prompt || len(sig.Body) == 0 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return fmt.Errorf("keyring prompt dismissed")
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("keyring prompt isn't answered")
+		}
+	}
+}
+
+// Returns items of the secret, unlocking them if needed.
+func (s *go101SecretService) items(name string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.conn.Object(secretsDest, secretsPath).Call(secretsIface+"Service.SearchItems", 0, secretAttributes(name)).
+		Store(&unlocked, &locked)
+	if err != nil {
+		return nil, err
+	}
+	if len(locked) > 0 {
+		if err = s.unlock(locked); err != nil {
+			return nil, err
+		}
+	}
+	items := append(unlocked, locked...)
+	if len(items) == 0 {
+		return nil, ErrSecretNotFound
+	}
+	return items, nil
+}
+
+func (s *go101SecretService) Get(name string) (string, error) {
+	items, err := s.items(name)
+	if err != nil {
+		return "", err
+	}
+	var secret go101Secret
+	if err = s.conn.Object(secretsDest, items[0]).Call(secretsIface+"Item.GetSecret", 0, s.session).Store(&secret); err != nil {
+		return "", err
+	}
+	return string(secret.Value), nil
+}
+
+func (s *go101SecretService) Set(name, value string) error {
+	if err := s.unlock([]dbus.ObjectPath{s.collection}); err != nil {
+		return err
+	}
+	props := map[string]dbus.Variant{
+		secretsIface + "Item.Label":      dbus.MakeVariant(KEYRING_APP + " " + name),
+		secretsIface + "Item.Attributes": dbus.MakeVariant(secretAttributes(name)),
+	}
+	secret := go101Secret{Session: s.session, Parameters: []byte{}, Value: []byte(value), ContentType: "text/plain"}
+	var item, prompt dbus.ObjectPath
+	err := s.conn.Object(secretsDest, s.collection).Call(secretsIface+"Collection.CreateItem", 0, props, secret, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(prompt)
+}
+
+func (s *go101SecretService) Delete(name string) error {
+	items, err := s.items(name)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err = s.conn.Object(secretsDest, item).Call(secretsIface+"Item.Delete", 0).Store(&prompt); err != nil {
+			return err
+		}
+		if err = s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *go101SecretService) Close() {
+	_ = s.conn.Object(secretsDest, s.session).Call(secretsIface+"Session.Close", 0).Err
+	_ = s.conn.Close()
+}
+
+// KWallet client for KDE without Secret Service support. Secrets are kept in "101ply" folder of the network wallet.
+type go101KWallet struct {
+	conn   *dbus.Conn
+	obj    dbus.BusObject
+	handle int32
+}
+
+func openKWallet() (*go101KWallet, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+	for _, daemon := range []string{"kwalletd6", "kwalletd5"} {
+		obj := conn.Object("org.kde."+daemon, dbus.ObjectPath("/modules/"+daemon))
+		var wallet string
+		if err = obj.Call(kwalletIface+"networkWallet", 0).Store(&wallet); err != nil {
+			continue
+		}
+		// Closed wallet asks for its password.
+		ctx, cancel := context.WithTimeout(context.Background(), KEYRING_PROMPT_TIMEOUT)
+		var handle int32
+		err = obj.CallWithContext(ctx, kwalletIface+"open", 0, wallet, int64(0), KEYRING_APP).Store(&handle)
+		cancel()
+		if err == nil && handle < 0 {
+			err = fmt.Errorf("wallet %s isn't opened", wallet)
+		}
+		if err != nil {
+			continue
+		}
+		return &go101KWallet{conn: conn, obj: obj, handle: handle}, nil
+	}
+	_ = conn.Close()
+	return nil, err
+}
+
+func (k *go101KWallet) has(name string) error {
+	var has bool
+	if err := k.obj.Call(kwalletIface+"hasEntry", 0, k.handle, KEYRING_APP, name, KEYRING_APP).Store(&has); err != nil {
+		return err
+	}
+	if !has {
+		return ErrSecretNotFound
+	}
+	return nil
+}
+
+func (k *go101KWallet) Get(name string) (string, error) {
+	if err := k.has(name); err != nil {
+		return "", err
+	}
+	var value string
+	err := k.obj.Call(kwalletIface+"readPassword", 0, k.handle, KEYRING_APP, name, KEYRING_APP).Store(&value)
+	return value, err
+}
+
+func (k *go101KWallet) Set(name, value string) error {
+	var has bool
+	if err := k.obj.Call(kwalletIface+"hasFolder", 0, k.handle, KEYRING_APP, KEYRING_APP).Store(&has); err != nil {
+		return err
+	}
+	if !has {
+		if err := k.obj.Call(kwalletIface+"createFolder", 0, k.handle, KEYRING_APP, KEYRING_APP).Store(&has); err != nil {
+			return err
+		}
+	}
+	var rc int32
+	if err := k.obj.Call(kwalletIface+"writePassword", 0, k.handle, KEYRING_APP, name, value, KEYRING_APP).Store(&rc); err != nil {
+		return err
+	}
+	if rc != 0 {
+		return fmt.Errorf("couldn't write secret %s to wallet", name)
+	}
+	return nil
+}
+
+func (k *go101KWallet) Delete(name string) error {
+	if err := k.has(name); err != nil {
+		return err
+	}
+	var rc int32
+	if err := k.obj.Call(kwalletIface+"removeEntry", 0, k.handle, KEYRING_APP, name, KEYRING_APP).Store(&rc); err != nil {
+		return err
+	}
+	if rc != 0 {
+		return fmt.Errorf("couldn't remove secret %s from wallet", name)
+	}
+	return nil
+}
+
+func (k *go101KWallet) Close() {
+	var rc int32
+	_ = k.obj.Call(kwalletIface+"close", 0, k.handle, false, KEYRING_APP).Store(&rc)
+	_ = k.conn.Close()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// Search services of track links.
+var searchLinks = map[string]string{
+	"youtube":      "https://www.youtube.com/results?search_query=%s",
+	"youtubemusic": "https://music.youtube.com/search?q=%s",
+	"spotify":      "https://open.spotify.com/search/%s",
+	"yandex":       "https://music.yandex.ru/search?text=%s",
+}
+
+// Link to open the track in browser.
+type go101Link struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Returns page of the channel on the provider site.
+func (p *go101) ChannelURL(cid uint64) string {
+	return fmt.Sprintf("%s/radio/channel/%d", p.BaseUrl(), cid)
+}
+
+// Returns channel page and configured search links of the track.
+func (p *go101) TrackLinks(track go101TrackInfo, channel go101Channel) []go101Link {
+	links := []go101Link{{"101.ru", p.ChannelURL(channel.Id)}}
+	query := strings.TrimSpace(track.Artist + " " + track.Title)
+	if query == "" {
+		return links
+	}
+	for _, name := range p.Config.TrackLinks {
+		format, ok := searchLinks[name]
+		if !ok {
+			continue
+		}
+		var q string
+		if strings.Contains(format, "?") {
+			q = url.QueryEscape(query)
+		} else {
+			q = url.PathEscape(query)
+		}
+		links = append(links, go101Link{name, fmt.Sprintf(format, q)})
+	}
+	return links
+}
+
+// Checks configured search services.
+func CheckTrackLinks(names []string) error {
+	for _, name := range names {
+		if _, ok := searchLinks[name]; !ok {
+			return fmt.Errorf("unknown track link %s", name)
+		}
+	}
+	return nil
+}
+
+// Opens URL in the default browser.
+func OpenBrowser(link string) error {
+	cmd := exec.Command("xdg-open", link)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("couldn't open browser: %s", err.Error())
+	}
+	// Don't leave zombie behind.
+	go func() {
+		_ = cmd.Wait()
+	}()
+	Debug("Opened %s", link)
+	return nil
+}
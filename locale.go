@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_DATE_FORMAT = "2006-01-02"
+	DEFAULT_TIME_FORMAT = "15:04"
+)
+
+// User-facing date and time formats, Go layouts (see https://pkg.go.dev/time#pkg-constants).
+type go101TimeFormatConfig struct {
+	// Locale to take formats from, ex: "en_US", LC_ALL/LC_TIME/LANG by default.
+	Locale string `json:"locale"`
+	// Explicit formats, ex: "02.01.2006" and "3:04 PM", override the locale ones.
+	Date string `json:"date"`
+	Time string `json:"time"`
+}
+
+// Formats of timestamps in history, bookmarks and schedule.
+var timeFormats = struct {
+	Date string
+	Time string
+}{DEFAULT_DATE_FORMAT, DEFAULT_TIME_FORMAT}
+
+// Territories with 12-hour clock.
+var clock12Territories = map[string]bool{
+	"US": true, "CA": true, "AU": true, "NZ": true, "IN": true, "PH": true, "PK": true, "EG": true, "SA": true,
+}
+
+// Date formats by territory, then by language. ISO 8601 is used for the rest.
+var localeDateFormats = map[string]string{
+	"US": "01/02/2006", "PH": "01/02/2006",
+	"GB": "02/01/2006", "IE": "02/01/2006", "FR": "02/01/2006", "BE": "02/01/2006", "ES": "02/01/2006",
+	"IT": "02/01/2006", "PT": "02/01/2006", "BR": "02/01/2006", "AU": "02/01/2006", "NZ": "02/01/2006",
+	"IN": "02/01/2006", "GR": "02/01/2006",
+	"ru": "02.01.2006", "uk": "02.01.2006", "be": "02.01.2006", "kk": "02.01.2006", "de": "02.01.2006",
+	"pl": "02.01.2006", "cs": "02.01.2006", "sk": "02.01.2006", "fi": "02.01.2006", "nb": "02.01.2006",
+	"tr": "02.01.2006", "ro": "02.01.2006", "bg": "02.01.2006", "sr": "02.01.2006", "hr": "02.01.2006",
+}
+
+// Returns locale of the time formats: LC_ALL, LC_TIME or LANG, like libc does.
+func TimeLocale() string {
+	for _, env := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Returns date and time formats of the locale, ex: "ru_RU.UTF-8" - "02.01.2006", "15:04".
+func LocaleTimeFormats(locale string) (string, string) {
+	// Strip encoding and modifier: "en_US.UTF-8@euro".
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	lang, territory := locale, ""
+	if i := strings.IndexAny(locale, "_-"); i >= 0 {
+		lang, territory = locale[:i], strings.ToUpper(locale[i+1:])
+	}
+	lang = strings.ToLower(lang)
+	date, clock := DEFAULT_DATE_FORMAT, DEFAULT_TIME_FORMAT
+	if f, ok := localeDateFormats[territory]; ok {
+		date = f
+	} else if f, ok := localeDateFormats[lang]; ok {
+		date = f
+	}
+	// Clock depends on the country, not the language: en_GB uses 24-hour one.
+	if clock12Territories[territory] {
+		clock = "3:04 PM"
+	}
+	return date, clock
+}
+
+// Sets timestamp formats from the locale and config.
+func InitTimeFormats(c *go101TimeFormatConfig) {
+	locale := TimeLocale()
+	if c != nil && c.Locale != "" {
+		locale = c.Locale
+	}
+	timeFormats.Date, timeFormats.Time = LocaleTimeFormats(locale)
+	if c == nil {
+		return
+	}
+	if c.Date != "" {
+		timeFormats.Date = c.Date
+	}
+	if c.Time != "" {
+		timeFormats.Time = c.Time
+	}
+}
+
+// Formats date of the timestamp in local time zone.
+func FormatDate(t time.Time) string {
+	return t.Local().Format(timeFormats.Date)
+}
+
+// Formats time of day of the timestamp in local time zone.
+func FormatClock(t time.Time) string {
+	return t.Local().Format(timeFormats.Time)
+}
+
+// Formats date and time of the timestamp in local time zone.
+func FormatDateTime(t time.Time) string {
+	return t.Local().Format(timeFormats.Date + " " + timeFormats.Time)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStepTrackChange(t *testing.T) {
+	p, provider, backend, clock := newTestPlayer(t)
+
+	p.Step()
+	first := backend.waitPlay(t)
+	if first != p.CurrentTrack.PlayURL {
+		t.Fatalf("got stream %s, want %s", first, p.CurrentTrack.PlayURL)
+	}
+	if p.Status() != STATUS_PLAY {
+		t.Errorf("got status %s, want play", StatusName(p.Status()))
+	}
+	if p.TrackUid != p.CurrentTrack.TrackUid {
+		t.Errorf("played track %d isn't remembered, got %d", p.CurrentTrack.TrackUid, p.TrackUid)
+	}
+
+	// The same track on re-poll keeps the stream.
+	p.Step()
+	backend.noPlay(t)
+
+	// Next track restarts the stream.
+	clock.Add(provider.Fake.TrackDuration)
+	p.Step()
+	second := backend.waitPlay(t)
+	if second == first {
+		t.Fatalf("stream %s isn't switched", first)
+	}
+	backend.mux.Lock()
+	stops := backend.stops
+	backend.mux.Unlock()
+	if stops != 2 {
+		t.Errorf("got %d stops, want one before every stream", stops)
+	}
+
+	// Replay of cached track isn't interrupted by track change.
+	p.setReplaying(true)
+	clock.Add(provider.Fake.TrackDuration)
+	p.Step()
+	backend.noPlay(t)
+}
+
+func TestStepChannelSwitch(t *testing.T) {
+	p, _, backend, _ := newTestPlayer(t)
+	p.Step()
+	backend.waitPlay(t)
+
+	// Track ID is reset on channel switch, so even the same track is played again.
+	p.SwitchChannel(101)
+	p.Step()
+	url := backend.waitPlay(t)
+	if url != p.CurrentTrack.PlayURL || p.CurrentChannel != 101 {
+		t.Errorf("got stream %s on channel %d, want %s on channel 101", url, p.CurrentChannel, p.CurrentTrack.PlayURL)
+	}
+}
+
+func TestSwitchProfile(t *testing.T) {
+	p, _, backend, _ := newTestPlayer(t)
+	p.Config.Profiles = map[string]go101Profile{"kids": {Name: "kids", Channel: "101"}}
+	p.Step()
+	backend.waitPlay(t)
+
+	// Profile is switched by the loop, its channel is played by the same step.
+	if err := p.SwitchProfile("kids"); err != nil {
+		t.Fatal(err)
+	}
+	if p.ChannelId() != 100 {
+		t.Errorf("channel switched to %d outside the loop", p.ChannelId())
+	}
+	p.Step()
+	backend.waitPlay(t)
+	if p.ProfileName() != "kids" || p.CurrentChannel != 101 {
+		t.Errorf("got profile %q on channel %d, want kids on channel 101", p.ProfileName(), p.CurrentChannel)
+	}
+	if err := p.SwitchProfile("unknown"); err == nil {
+		t.Error("unknown profile is switched")
+	}
+}
+
+func TestStepLiveStream(t *testing.T) {
+	p, provider, backend, clock := newTestPlayer(t)
+	p.Config.StreamURL = "/stream/%d"
+	p.SwitchChannel(102)
+	p.Step()
+	url := backend.waitPlay(t)
+	if want := provider.BaseUrl + "/stream/102"; url != want {
+		t.Fatalf("got stream %s, want live stream %s", url, want)
+	}
+	p.state.stream.Lock()
+	p.state.stream.Unlock()
+
+	// Live stream goes on over track change.
+	uid := p.CurrentTrack.TrackUid
+	clock.Add(provider.Fake.TrackDuration)
+	p.Step()
+	if p.CurrentTrack.TrackUid == uid {
+		t.Fatal("track isn't changed")
+	}
+	backend.noPlay(t)
+	backend.mux.Lock()
+	stops := backend.stops
+	backend.mux.Unlock()
+	if stops != 1 {
+		t.Errorf("got %d stops, want live stream kept", stops)
+	}
+	if p.TrackUid != p.CurrentTrack.TrackUid {
+		t.Errorf("track %d isn't remembered as played, got %d", p.CurrentTrack.TrackUid, p.TrackUid)
+	}
+}
+
+func TestStepPlayFailed(t *testing.T) {
+	p, _, backend, _ := newTestPlayer(t)
+	backend.fail = errors.New("connection refused")
+	p.Step()
+	backend.waitPlay(t)
+	// Play is done once the stream lock is released.
+	p.state.stream.Lock()
+	p.state.stream.Unlock()
+	if p.Status() != STATUS_STOP {
+		t.Errorf("got status %s of failed stream, want stop", StatusName(p.Status()))
+	}
+
+	// The same track is played again by the next step.
+	backend.mux.Lock()
+	backend.fail = nil
+	backend.mux.Unlock()
+	p.Step()
+	backend.waitPlay(t)
+	p.state.stream.Lock()
+	p.state.stream.Unlock()
+	if p.Status() != STATUS_PLAY {
+		t.Errorf("got status %s after retry, want play", StatusName(p.Status()))
+	}
+}
+
+func TestStepGeoFallback(t *testing.T) {
+	p, _, backend, _ := newTestPlayer(t)
+	p.Config.GeoFallback = map[string]string{"100": "101"}
+	backend.fail = &go101HttpError{URL: "http://localhost/", Code: http.StatusForbidden, Status: "403 Forbidden"}
+	p.Step()
+	backend.waitPlay(t)
+	p.state.stream.Lock()
+	p.state.stream.Unlock()
+	// Fallback is chosen by the next step, not by the audio pipeline.
+	if p.ChannelId() != 100 {
+		t.Errorf("channel switched to %d outside the loop", p.ChannelId())
+	}
+
+	backend.mux.Lock()
+	backend.fail = nil
+	backend.mux.Unlock()
+	p.Step()
+	backend.waitPlay(t)
+	if p.CurrentChannel != 101 {
+		t.Errorf("got channel %d after geo-block, want fallback 101", p.CurrentChannel)
+	}
+}
+
+func TestStepConcurrentControl(t *testing.T) {
+	p, provider, backend, clock := newTestPlayer(t)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	// Hotkeys, control socket, watchdog, status line, state saver.
+	for _, control := range []func(){
+		func() { p.SwitchChannel(101) },
+		func() { p.StepChannel(1) },
+		p.RestartTrack,
+		func() { _ = p.PlayerStatus() },
+		func() { _ = p.TemplateData() },
+		func() { _ = p.State() },
+		func() {
+			select {
+			case <-backend.plays:
+			default:
+			}
+		},
+	} {
+		wg.Add(1)
+		go func(control func()) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					control()
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}(control)
+	}
+	for i := 0; i < 20; i++ {
+		clock.Add(provider.Fake.TrackDuration)
+		p.Step()
+	}
+	close(done)
+	wg.Wait()
+	if gid := p.GroupId(); gid != p.ChannelGroup(100) {
+		t.Errorf("got group %d, want channels of group %d only", gid, p.ChannelGroup(100))
+	}
+}
+
+func TestPreview(t *testing.T) {
+	p, provider, backend, clock := newTestPlayer(t)
+	if err := p.Preview(101, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := provider.Fake.TrackAt(101, clock.Now())
+	if url := backend.waitPlay(t); url != fmt.Sprintf("%s/vardata/modules/musicdb/files/%d.mp3", provider.BaseUrl, want.TrackUid) {
+		t.Errorf("got preview stream %s, want track %d", url, want.TrackUid)
+	}
+	if p.Status() != STATUS_STOP || p.Previewing() {
+		t.Errorf("got status %s after preview, want stop", StatusName(p.Status()))
+	}
+
+	// The channel is played by the loop afterwards.
+	p.Step()
+	if url := backend.waitPlay(t); url != p.CurrentTrack.PlayURL {
+		t.Errorf("got stream %s after preview, want %s", url, p.CurrentTrack.PlayURL)
+	}
+}
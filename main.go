@@ -4,32 +4,26 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"os/user"
-	"path"
+	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
-	"github.com/fsnotify/fsnotify"
-
-	"github.com/BurntSushi/xgbutil"
-	"github.com/BurntSushi/xgbutil/keybind"
-	"github.com/BurntSushi/xgbutil/xevent"
-
-	mp3 "github.com/koykov/mp3lib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -49,14 +43,19 @@ type Exception interface{}
 
 // JSON types
 type Hotkey struct {
-	Key  string `json:"key"`
-	Desc string `json:"desc"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	Desc   string `json:"desc"`
+	// Second step keys, makes the key a leader (ex: Pause then 1-9 for favorites).
+	Chord []Hotkey `json:"chord,omitempty"`
 }
 
 type TrackInfo struct {
 	Status    uint64            `json:"status"`
 	Result    TrackInfo__Result `json:"result"`
 	ErrorCode uint64            `json:"errorCode"`
+	// Station's message of the error code, if any.
+	ErrorMessage string `json:"errorMessage"`
 }
 
 type TrackInfo__Result struct {
@@ -79,6 +78,7 @@ type TrackInfo__Result__About__Audio struct {
 type TrackInfo__Result__About__Album struct {
 	Title       string `json:"title"`
 	ReleaseDate string `json:"releaseDate"`
+	Cover       string `json:"cover"`
 }
 
 type TrackInfo__Result__Stat struct {
@@ -95,8 +95,27 @@ type go101 struct {
 	CurrentChannel   uint64
 	CurrentTrack     go101TrackInfo
 	TrackUid         uint64
-	Status           uint64
+	TrackStart       uint64
+	PlayingURL       string
 	NextFetch        uint64
+	FetchFailures    int
+	StaleReplies     int
+	ServerClock      go101ServerClock
+	Provider         Provider
+	DB               *sql.DB
+	Config           *go101Config
+	Profile          *go101Profile
+	Quiet            go101Quiet
+	Rotation         go101Rotation
+	Category         string
+	BigMode          bool
+	Scheduler        go101Scheduler
+	state            go101PlayerState
+	Backend          go101Backend
+	Proxy            *go101StreamProxy
+	TrackFormat      *template.Template
+	StatusLine       bool
+	SleepAt          time.Time
 }
 
 type go101TrackInfo struct {
@@ -105,12 +124,23 @@ type go101TrackInfo struct {
 	Title     string
 	Album     string
 	AlbumDate string
-	PlayURL   string
+	// Album cover image URL.
+	Cover   string
+	PlayURL string
+	// Played from the channel live stream, track has no audio file.
+	Live   bool
+	Start  uint64
+	Finish uint64
+	// Local time of the track end.
+	Ends time.Time
 }
 
 type go101Channel struct {
-	Id    uint64 `json:"Id"`
-	Title string `json:"Title"`
+	Id          uint64   `json:"Id"`
+	Title       string   `json:"Title"`
+	Genres      []string `json:"Genres"`
+	Description string   `json:"Description"`
+	Logo        string   `json:"Logo"`
 }
 
 type go101ChannelGroup struct {
@@ -122,209 +152,483 @@ type go101ChannelGroup struct {
 var go101o go101
 var verbose bool
 
-func init() {
-	// Check (and create if needed) configuration directory.
-	configDir := GetConfigDir()
-	_, err := os.Stat(configDir)
-	if os.IsNotExist(err) {
-		if err := os.MkdirAll(configDir, 0755); err != nil {
-			log.Fatal("Cannot create configuration diectory.")
-		}
-	}
-	// Check (and create) hotkeys configuration file.
-	hotkeyConfig := GetHotkeyConfig()
-	_, err = os.Stat(hotkeyConfig)
-	if os.IsNotExist(err) {
-		// For possible keys see https://github.com/BurntSushi/xgbutil/blob/master/keybind/keysymdef.go
-		// Unfortunately, there isn't possibility to specify a key combination, only one key may be used.
-		PutToFile(hotkeyConfig, `[
-	{
-		"key": "Pause",
-		"desc": "Play/pause."
-	}
-]`)
-		Debug("create default config file - %s", hotkeyConfig)
-	}
-	// Check (and create if needed) cache directory.
-	cacheDir := GetCacheDir()
-	_, err = os.Stat(cacheDir)
-	if os.IsNotExist(err) {
-		if err := os.MkdirAll(cacheDir, 0755); err != nil {
-			log.Fatal("Cannot create cache diectory.")
-		}
-	}
-}
-
 func main() {
 	var wg sync.WaitGroup
 
 	// Parse CLI options.
-	channelPtr := flag.Int("c", 0, "Channel ID.")
+	channelPtr := flag.String("c", "", "Channel ID or alias.")
 	verbosePtr := flag.Bool("verbose", false, "Display debug messages.")
+	providerPtr := flag.String("provider", PROVIDER_101RU, "Data provider, see \"101ply help providers\".")
+	sleepPtr := flag.Duration("sleep", 0, "Stop playing after given duration (ex: 30m).")
+	profilePtr := flag.String("profile", "", "Profile name from config.json or profiles/<name>.json (ex: kids).")
+	bigPtr := flag.Bool("big", false, "Car mode: huge artist/title display, only pause/next/prev hotkeys.")
+	outputPtr := flag.String("output", "", "Write stream to file (file:/path/out.mp3) or stdout (-) instead of playing it.")
+	encodePtr := flag.String("encode", "", "Re-encode output stream: opus (Ogg Opus). Output files *.opus and *.ogg are always re-encoded.")
+	bitratePtr := flag.Int("bitrate", DEFAULT_OPUS_BITRATE, "Bitrate of re-encoded output, kbps.")
+	portablePtr := flag.Bool("portable", false, "Keep config and cache in "+PORTABLE_DIR+" directory next to the binary. Enabled automatically if the directory exists.")
+	configDirPtr := flag.String("config-dir", "", "Config directory instead of ~/.config/101ply, ex: for packages and sandboxes.")
+	cacheDirPtr := flag.String("cache-dir", "", "Cache directory instead of ~/.cache/101ply, also keeps runtime files (socket, lock, state).")
+	instancePtr := flag.String("instance", "", "Instance name, allows to run several players (ex: kitchen). Also selects player for ctl and now commands.")
 	flag.Parse()
 
 	verbose = *verbosePtr
+	go101o.BigMode = *bigPtr
+	SetPortable(*portablePtr)
+	SetDataDirs(*configDirPtr, *cacheDirPtr)
+	InitDirs()
+	if err := SetInstance(*instancePtr); err != nil {
+		log.Fatal(err)
+	}
 
-	// Make goroutine for final cleanup callback.
-	wg.Add(1)
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		defer wg.Done()
-		<-c
-		Cleanup()
-		os.Exit(1)
-	}()
-
-	// Initialize keybinding.
-	X, err := xgbutil.NewConn()
+	config, err := LoadConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
-	keybind.Initialize(X)
+	if err = SetTheme(config.Theme); err != nil {
+		log.Fatal(err)
+	}
+	if err = config.CoverArt.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err = config.ValidateRotation(); err != nil {
+		log.Fatal(err)
+	}
+	if err = config.Digest.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if go101o.TrackFormat, err = ParseTrackFormat(config.TrackFormat); err != nil {
+		log.Fatal(err)
+	}
+	log.SetOutput(go101ErrorWriter{os.Stderr})
+	go101o.Config = config
+	InitTimeFormats(config.TimeFormat)
+	if config.Polling != nil {
+		rateLimiter = NewRateLimiter(config.Polling.RatePerMinute, config.Polling.Burst)
+	}
+	if config.Download != nil {
+		downloader = NewDownloader(config.Download.Concurrency, config.Download.Retries)
+	}
+	if config.DNS != nil {
+		InitDNS(config.DNS)
+	}
+	if config.TLS != nil {
+		if err = InitTLS(config.TLS); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *profilePtr != "" {
+		if go101o.Profile, err = config.Profile(*profilePtr); err != nil {
+			log.Fatal(err)
+		}
+		if *channelPtr == "" {
+			*channelPtr = go101o.Profile.Channel
+		}
+		if *outputPtr == "" {
+			*outputPtr = go101o.Profile.Output
+		}
+	}
 
-	hotkeyConfig := GetHotkeyConfig()
-	watcher, err := fsnotify.NewWatcher()
+	provider, err := NewProvider(*providerPtr)
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = watcher.Add(hotkeyConfig)
-	if err != nil {
-		log.Println(err)
+	go101o.Provider = provider
+	go101o.DB = OpenDB(GetDatabaseFile(*providerPtr))
+	go101o.ImportLegacyCache(GetCacheFile(*providerPtr))
+	if err := go101o.IndexHistory(); err != nil {
+		log.Println("Couldn't index history: ", err.Error())
 	}
 
-	// Keybinding goroutine.
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for {
-			select {
-			case ev := <-watcher.Events:
-				log.Println(ev)
-				err := bindall(hotkeyConfig, X)
-				if err != nil {
-					log.Println(err)
-					continue
-				}
+	// Run subcommand if given instead of the player, before audio device and stream proxy are opened: status bars
+	// poll some of them every few seconds.
+	if flag.NArg() > 0 {
+		RunCommand(flag.Arg(0), flag.Args()[1:])
+		return
+	}
+	if err = LockInstance(); err != nil {
+		log.Fatal(err)
+	}
+	HardenPermissions()
 
-			case err := <-watcher.Errors:
-				log.Println("error:", err)
-			}
+	if *outputPtr != "" {
+		if go101o.Backend, err = NewOutputBackend(*outputPtr, *encodePtr, *bitratePtr); err != nil {
+			log.Fatal(err)
+		}
+	} else if go101o.Backend, err = NewBackend(config.AudioBackend, config); err != nil {
+		log.Printf("Couldn't start audio backend: %s, falling back to %s", err.Error(), BACKEND_MP3LIB)
+		go101o.Backend, _ = NewBackend(BACKEND_MP3LIB, config)
+	}
+	// Audio backends resolve hosts and verify certificates themselves, so stream goes through the proxy
+	// if DNS or TLS options are set. Integrity checks need the raw stream as well.
+	if config.Buffer != nil || config.DNS != nil || config.TLS != nil || config.Integrity != nil {
+		buffer := config.Buffer
+		if buffer == nil {
+			buffer = &go101BufferConfig{}
+		}
+		if go101o.Proxy, err = NewStreamProxy(buffer); err != nil {
+			log.Fatal(err)
+		}
+		go101o.Backend = &go101BufferedBackend{go101o.Backend, go101o.Proxy}
+		if config.Integrity != nil {
+			go101o.Proxy.Monitor(config.Integrity, go101o.StreamBroken)
 		}
-	}()
-	err = bindall(hotkeyConfig, X)
-	if err != nil {
-		log.Panicln(err)
 	}
 
-	// Event handling goroutine.
+	// Make goroutine for final cleanup callback.
 	wg.Add(1)
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		defer wg.Done()
-		xevent.Main(X)
+		<-c
+		Cleanup()
+		os.Exit(1)
 	}()
 
-	// Cache check.
-	cacheFile := GetCacheDir() + string(os.PathSeparator) + "data.json"
-	needRegenerate := false
-	fi, err := os.Stat(cacheFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			needRegenerate = true
-			Debug("Cache file %s doesn't exists, need generate.", cacheFile)
-		} else {
-			log.Fatal("Error when reading cache file: %s", err.Error())
-		}
-	}
-	if !needRegenerate {
-		now := time.Now()
-		mtime := fi.ModTime()
-		diff := now.Sub(mtime)
-		needRegenerate = diff.Seconds() > 7*24*3600
-		if needRegenerate {
-			Debug("Cache file %s is deprecated, need regenerate.", cacheFile)
-		}
-	}
-	if !needRegenerate {
-		// Read channels and groups from the cache.
-		raw, err := ioutil.ReadFile(cacheFile)
-		if err != nil {
-			log.Fatal("Error reading cache file: %s", err.Error())
+	// Report missing capabilities instead of failing on them one by one.
+	ReportCapabilities(go101o.ProbeCapabilities())
+
+	// Initialize keybinding.
+	if !config.NoX && os.Getenv("DISPLAY") != "" {
+		if err = InitHotkeys(&wg); err != nil {
+			log.Println("Hotkeys aren't available yet: ", err.Error())
 		}
-		go101o.ChannelGroups = make(map[uint64]go101ChannelGroup)
-		_ = json.Unmarshal(raw, &go101o.ChannelGroups)
-		Debug("Cache hit, reading file %s", cacheFile)
 	} else {
-		// Fetch channels and groups from 101.ru
-		go101o.FetchChannelGroups()
-		go101o.FetchChannels()
+		Debug("X is disabled, hotkeys aren't available.")
+	}
 
-		b, err := json.Marshal(go101o.ChannelGroups)
-		if err != nil {
-			log.Fatal(err.Error())
+	// GPIO memory is mapped once for the process: restart of controls or display mustn't unmap it under the other.
+	if config.GPIO != nil || config.Display != nil && config.Display.SPI() {
+		if err := OpenGPIO(); err != nil {
+			log.Println("Couldn't open GPIO: ", err.Error())
 		}
+	}
 
-		PutToFile(cacheFile, string(b))
-		Debug("Write groups and channels data to cache file %s", cacheFile)
+	// GPIO controls goroutine.
+	if config.GPIO != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("gpio", go101o.GPIOLoop)
+		}()
 	}
-	//fmt.Printf("%#v\n", go101o)
 
-	// Choose group and channel.
-	if *channelPtr == 0 {
-		reader := bufio.NewReader(os.Stdin)
+	// Load channels from database or from provider.
+	go101o.LoadChannelGroups()
+	//fmt.Printf("%#v\n", go101o)
 
-		gls := make([]string, len(go101o.ChannelGroups))
-		for _, g := range go101o.ChannelGroups {
-			gls = append(gls, fmt.Sprintf("%d - %s\n", g.Id, g.Title))
+	// Offer to restore the session terminated unexpectedly.
+	reader := bufio.NewReader(os.Stdin)
+	piped := StdinPiped()
+	var state *go101State
+	restored := false
+	if *channelPtr == "" && !piped {
+		if state = LoadState(); state != nil && go101o.OfferRestore(state, reader) {
+			go101o.Restore(state)
+			restored = true
 		}
-		sort.Strings(gls)
+	}
+
+	// Choose group and channel.
+	if restored {
+		// Channel already known.
+	} else if *channelPtr == "" && piped {
+		// Driven by another program, channel comes with the command.
+		go101o.setChannel(go101o.ReadChannelCommand(reader))
+	} else if rotated := go101o.StartRotation(*channelPtr); rotated != 0 {
+		// Part of the day has its channels.
+		go101o.setChannel(rotated)
+	} else if *channelPtr == "" {
 		fmt.Println("Choose group:")
-		for _, g := range gls {
-			fmt.Print(g)
+		for _, g := range go101o.PickerGroups() {
+			fmt.Printf("%d - %s\n", g.Id, g.Title)
 		}
-		fmt.Print("\nGroup: ")
+		fmt.Print("\nGroup (s to play suggested channel): ")
 		groupIndex, _ := reader.ReadString('\n')
-		go101o.CurrentGroup, _ = strconv.ParseUint(strings.Trim(groupIndex, "\n"), 10, 64)
+		groupIndex = strings.TrimSpace(groupIndex)
+		if groupIndex == "s" {
+			suggestions, err := go101o.Suggest(1, time.Now())
+			if err != nil || len(suggestions) == 0 {
+				log.Fatal("No suggestions yet, choose channel manually.")
+			}
+			go101o.setChannel(suggestions[0].Channel.Id)
+			fmt.Printf("Suggested: %s (%s)\n", suggestions[0].Channel.Title, strings.Join(suggestions[0].Reasons, "; "))
+		} else {
+			gid, _ := strconv.ParseUint(groupIndex, 10, 64)
 
-		cls := make([]string, len(go101o.ChannelGroups[go101o.CurrentGroup].Channels))
-		for _, c := range go101o.ChannelGroups[go101o.CurrentGroup].Channels {
-			cls = append(cls, fmt.Sprintf("%d - %s\n", c.Id, c.Title))
-		}
-		sort.Strings(cls)
-		fmt.Println("\nChoose channel:")
-		for _, c := range cls {
-			fmt.Print(c)
-		}
-		fmt.Print("\nChannel: ")
-		channelIndex, _ := reader.ReadString('\n')
-		go101o.CurrentChannel, _ = strconv.ParseUint(strings.Trim(channelIndex, "\n"), 10, 64)
-	} else {
-		for gid := range go101o.ChannelGroups {
-			for cid := range go101o.ChannelGroups[gid].Channels {
-				if cid == uint64(*channelPtr) {
-					go101o.CurrentGroup = gid
+			fmt.Println("\nChoose channel:")
+			for _, c := range go101o.PickerChannels(go101o.ChannelGroups[gid]) {
+				fmt.Printf("%d - %s\n", c.Id, c.Summary())
+			}
+			for {
+				fmt.Print("\nChannel (p <id> to preview): ")
+				channelIndex, _ := reader.ReadString('\n')
+				channelIndex = strings.TrimSpace(channelIndex)
+				if strings.HasPrefix(channelIndex, "p") {
+					cid, _ := strconv.ParseUint(strings.TrimSpace(channelIndex[1:]), 10, 64)
+					if err := go101o.Preview(cid, PREVIEW_DURATION); err != nil {
+						fmt.Println("Preview failed: ", err.Error())
+					}
+					continue
 				}
+				cid, err := strconv.ParseUint(channelIndex, 10, 64)
+				if err != nil {
+					fmt.Println("Wrong channel ID: ", channelIndex)
+					continue
+				}
+				// Channel may be missing from the list or belong to another group.
+				if err = go101o.EnsureChannel(cid); err != nil {
+					fmt.Println(err.Error())
+					continue
+				}
+				go101o.setChannel(cid)
+				break
 			}
 		}
-		go101o.CurrentChannel = uint64(*channelPtr)
+	} else {
+		cid, err := go101o.ResolveChannel(*channelPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = go101o.EnsureChannel(cid); err != nil {
+			log.Fatal(err)
+		}
+		go101o.setChannel(cid)
+	}
+	if go101o.Profile.ChannelRestricted(go101o.CurrentChannel) {
+		log.Fatalf("Channel %d is restricted in profile %s", go101o.CurrentChannel, *profilePtr)
 	}
 	group := go101o.ChannelGroups[go101o.CurrentGroup]
 	channel := group.Channels[go101o.CurrentChannel]
+	if *sleepPtr > 0 {
+		go101o.ArmSleepTimer(*sleepPtr)
+	}
 
-	// Playing loop.
-	fmt.Printf("\nPlayng: %s\n", channel.Title)
-	for true {
-		go101o.FetchChannelInfo()
-		if go101o.TrackUid != go101o.CurrentTrack.TrackUid {
-			fmt.Printf("%s - %s [%s] - %s\n", go101o.CurrentTrack.Artist, go101o.CurrentTrack.Title, go101o.CurrentTrack.Album, FormatTime(go101o.NextFetch))
-			Debug("Fetch remote data %#v", go101o.CurrentTrack)
-			go101o.Stop()
-			go go101o.Play()
+	go101o.ApplyGainProfile()
+	if go101o.Profile != nil && go101o.Profile.Volume > 0 {
+		_, setVolume := go101o.VolumeControl()
+		if err := setVolume(go101o.Profile.Volume); err != nil {
+			log.Println(err)
+		}
+	}
+	if restored {
+		go101o.RestoreVolume(state)
+	}
+
+	go101o.InitHistory()
+	go101o.InitStats()
+	go101o.InitSchedule()
+	if config.Tracing != nil {
+		if err := InitTracing(config.Tracing); err != nil {
+			log.Fatal(err)
 		}
-		Debug("Next fetch after %d seconds", go101o.NextFetch)
-		go101o.Sleep(go101o.NextFetch)
+	}
+	if config.PlayLog != nil {
+		go101o.InitPlayLog()
+	}
+	if len(config.Notifiers) > 0 || go101o.Profile != nil {
+		go101o.InitNotifiers()
+	}
+	if len(config.Webhooks) > 0 {
+		go101o.InitWebhooks()
+	}
+	if !config.NoTitle {
+		go101o.InitTerminalTitle()
+	}
+	if config.InhibitSleep {
+		go101o.InitInhibitor()
+	}
+	go101o.InitTrackCache()
+
+	// System suspend watcher goroutine.
+	if !config.NoSuspendWatch && SystemBusAvailable() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("suspend watcher", go101o.SuspendLoop)
+		}()
+	}
+
+	// Silent output watcher goroutine.
+	if config.SinkIdleMinutes > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("sink watcher", go101o.SinkWatchLoop)
+		}()
+	}
+
+	// Stuck audio pipeline watchdog goroutine, backends without progress report aren't watched.
+	if _, ok := go101o.Backend.(go101ProgressBackend); ok && config.WatchdogSeconds > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("audio watchdog", go101o.WatchdogLoop)
+		}()
 	}
 
+	// Screen lock watcher goroutine.
+	if config.PauseOnLock && SessionBusAvailable() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("screen lock watcher", go101o.ScreenLockLoop)
+		}()
+	}
+
+	// Alerts goroutine.
+	if config.Alerts != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("alerts", go101o.AlertLoop)
+		}()
+	}
+
+	// Followed programs goroutine.
+	if config.Schedule != nil && len(config.Schedule.Follow) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("schedule", go101o.ScheduleLoop)
+		}()
+	}
+
+	// Followed artists goroutine.
+	if config.Follow != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("follow", go101o.FollowLoop)
+		}()
+	}
+
+	// Listening goals goroutine.
+	if config.Goals != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("goals", go101o.GoalsLoop)
+		}()
+	}
+
+	// Pushed track changes goroutine.
+	if !config.NoPush {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("push", go101o.PushLoop)
+		}()
+	}
+
+	// Big screen clock goroutine.
+	if go101o.BigMode {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("big screen footer", go101o.BigFooterLoop)
+		}()
+	}
+
+	// Remaining time line goroutine.
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 && !config.NoStatusLine && !go101o.BigMode {
+		go101o.StatusLine = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("status line", go101o.StatusLineLoop)
+		}()
+	}
+
+	// Control socket goroutine.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Supervise("control server", go101o.ControlLoop)
+	}()
+
+	// Command FIFO goroutine.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Supervise("command fifo", go101o.FifoLoop)
+	}()
+
+	// Stdin commands goroutine.
+	if piped {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("stdin commands", func() {
+				go101o.StdinLoop(reader)
+			})
+		}()
+	}
+
+	// MPRIS service goroutine.
+	if !go101o.Config.NoMpris && SessionBusAvailable() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("mpris", go101o.MprisLoop)
+		}()
+	}
+
+	// Embedded display goroutine.
+	if go101o.Config.Display != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("display", go101o.DisplayLoop)
+		}()
+	}
+
+	// Listening digest goroutine. Instances share history, so only the default one sends it.
+	if go101o.Config.Digest != nil && instance == "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("digest", go101o.DigestLoop)
+		}()
+	}
+
+	// Scheduled commands goroutine, commands may be added while player runs.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Supervise("schedule", go101o.JobLoop)
+	}()
+
+	// Channel rotation goroutine.
+	if len(go101o.Config.Rotation) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("rotation", go101o.RotationLoop)
+		}()
+	}
+
+	// Quiet hours goroutine.
+	if go101o.Config.QuietHours != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Supervise("quiet hours", go101o.QuietHoursLoop)
+		}()
+	}
+
+	// State saving goroutine.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Supervise("state saver", go101o.SaveStateLoop)
+	}()
+
+	// Playing loop.
+	fmt.Printf("\nPlayng: %s\n", Paint(theme.Channel, channel.Title))
+	go101o.ShowNextProgram(channel.Id)
+	Supervise("fetch loop", go101o.Loop)
+
 	// Waiting for finishing all goroutines.
 	wg.Wait()
 }
@@ -332,11 +636,30 @@ func main() {
 // Process finish callback.
 func Cleanup() {
 	go101o.Stop()
+	inhibitor.Release()
+	RestoreTerminalTitle()
+	ShutdownTracing()
+	_ = os.Remove(GetControlSocket())
+	_ = os.Remove(GetCommandFifo())
+	go101o.Backend.Close()
+	ClearState()
+	if mock, ok := go101o.Provider.(*go101MockProvider); ok {
+		mock.Close()
+	}
 	Debug("Cleanup sig.")
 }
 
 // Returns full path to the config directory.
 func GetConfigDir() string {
+	if configDirOverride != "" {
+		return configDirOverride
+	}
+	if portableDir != "" {
+		return filepath.Join(portableDir, "config")
+	}
+	if dir := sandboxDir("XDG_CONFIG_HOME", ".config"); dir != "" {
+		return dir
+	}
 	usr, err := user.Current()
 	if err != nil {
 		log.Fatal(err)
@@ -353,6 +676,15 @@ func GetHotkeyConfig() string {
 
 // Returns full path to the cache directory.
 func GetCacheDir() string {
+	if cacheDirOverride != "" {
+		return cacheDirOverride
+	}
+	if portableDir != "" {
+		return filepath.Join(portableDir, "cache")
+	}
+	if dir := sandboxDir("XDG_CACHE_HOME", ".cache"); dir != "" {
+		return dir
+	}
 	usr, err := user.Current()
 	if err != nil {
 		log.Fatal(err)
@@ -361,176 +693,163 @@ func GetCacheDir() string {
 	return usr.HomeDir + ps + ".cache" + ps + "101ply"
 }
 
-// Create file (if needed) and write contents to him.
-func PutToFile(filename string, contents string) {
-	if _, err := os.Create(filename); err != nil {
-		log.Fatal("Error when file is created: ", err.Error())
+// Returns full path to the channels cache file of the provider.
+func GetCacheFile(provider string) string {
+	ps := string(os.PathSeparator)
+	if provider == PROVIDER_101RU {
+		return GetCacheDir() + ps + "data.json"
 	}
+	return GetCacheDir() + ps + "data." + provider + ".json"
+}
 
-	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+// Writes contents to the file atomically: data goes to temporary file in the same directory, which is synced
+// and renamed over the target. Crash mid-write leaves either old or new contents, never partial file.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filename)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".*.tmp")
 	if err != nil {
-		log.Fatal("Error when file is created: ", err.Error())
+		return err
 	}
-	defer func () {
-		_ = file.Close()
-	}()
-	_, _ = file.WriteString(contents)
-	if err = file.Sync(); err != nil {
-		log.Fatal("Error when saving file: ", err.Error())
+	cleanup := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
 	}
-}
-
-// Parses config file and binds keys to events.
-func bindall(hotkeyConfig string, X *xgbutil.XUtil) (err error) {
-	config, err := ioutil.ReadFile(hotkeyConfig)
-	if err != nil {
-		log.Fatal("Could not find config file: ", err.Error())
-		return
+	if _, err = tmp.Write(data); err != nil {
+		return cleanup(err)
 	}
-	hotkeys := []Hotkey{}
-	err = json.Unmarshal(config, &hotkeys)
-	if err != nil {
-		log.Fatal("Could not parse config file: ", err.Error())
-		return
+	if err = tmp.Chmod(perm); err != nil {
+		return cleanup(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return cleanup(err)
 	}
-	keybind.Detach(X, X.RootWin())
-	for _, hotkey := range hotkeys {
-		hotkey.attach(X)
+	if err = tmp.Close(); err != nil {
+		return cleanup(err)
 	}
-	return
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	// Persist rename itself.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
 }
 
-// Attach callback to the hotkey.
-func (hotkey Hotkey) attach(X *xgbutil.XUtil) {
-	err := keybind.KeyPressFun(
-		func(X *xgbutil.XUtil, e xevent.KeyPressEvent) {
-			if go101o.Status == STATUS_STOP || go101o.Status == STATUS_PAUSE {
-				go go101o.Resume()
+// Fetches track info and switches playback on track change. Runs forever.
+func (p *go101) Loop() {
+	for true {
+		p.Step()
+		if !p.StatusLine {
+			// Status line shows the countdown.
+			Debug("Next fetch after %d seconds", p.NextFetch)
+		}
+		p.Sleep(p.NextFetch)
+	}
+}
+
+// Fetches track info once and restarts the stream if the track changed.
+func (p *go101) Step() {
+	p.Scheduler.run()
+	p.FetchChannelInfo()
+	if p.TrackChanged() && !p.Previewing() && !p.Replaying() {
+		if p.BigMode {
+			p.RenderBigScreen()
+		} else {
+			if p.StatusLine {
+				// Finish the line of the previous track, the new one is updated by StatusLineLoop.
+				fmt.Print("\n" + p.TrackLine())
 			} else {
-				go go101o.Pause()
+				fmt.Println(p.TrackLine())
 			}
-		}).Connect(X, X.RootWin(), hotkey.Key, true)
-	if err != nil {
-		log.Fatalf("Could not bind %s: %s", hotkey.Key, err.Error())
+		}
+		Debug("Fetch remote data %#v", p.CurrentTrack)
+		// Live stream of the channel keeps playing, only its metadata changed.
+		restart := !p.CurrentTrack.Live || p.CurrentTrack.PlayURL != p.PlayingURL || p.Status() == STATUS_STOP
+		if restart {
+			// Pause (mute) is kept between tracks.
+			p.Stop()
+		}
+		p.Restrict(p.Profile.TrackRestricted(p.CurrentTrack))
+		p.state.data.Lock()
+		p.TrackUid = p.CurrentTrack.TrackUid
+		p.TrackStart = p.CurrentTrack.Start
+		p.PlayingURL = p.CurrentTrack.PlayURL
+		p.state.data.Unlock()
+		p.EmitTrack()
+		if restart {
+			go Safe("audio pipeline", p.Play)
+		}
 	}
 }
 
-// Convert seconds to "mm:ss" time format.
+// Convert seconds to "m:ss" time format, "h:mm:ss" for an hour and longer.
 func FormatTime(s uint64) string {
-	min := s / 60
-	sec := s % 60
-	return fmt.Sprintf("%d:%d", min, sec)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s%3600/60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
 }
 
 // Print formatted debug message.
 func Debug(message string, a ...interface{}) {
 	if verbose {
-		fmt.Println(fmt.Sprintf("Debug: "+message, a))
+		fmt.Println(fmt.Sprintf("Debug: "+message, a...))
 	}
 }
 
-// Fetches channel groups from 101.ru
+// Fetches channel groups from the provider.
 func (p *go101) FetchChannelGroups() {
-	p.ChannelGroups = make(map[uint64]go101ChannelGroup)
-
-	doc, err := goquery.NewDocument("http://101.ru/radio-top")
+	groups, err := p.Provider.FetchChannelGroups()
 	if err != nil {
 		log.Fatal("Couldn't fetch channel groups: ", err.Error())
 	}
-	doc.Find("ul.full.list.menu li").Each(func(i int, selection *goquery.Selection) {
-		title := selection.Find("a").Text()
-		href, exists := selection.Find("a").Attr("href")
-		if exists {
-			id, _ := strconv.ParseUint(path.Base(href), 0, 64)
-			channels := make(map[uint64]go101Channel, 0)
-			p.ChannelGroups[id] = go101ChannelGroup{
-				id, title, channels,
-			}
-		}
-	})
-}
-
-// Fetches channels from 101.ru
-func (p *go101) FetchChannels() {
-	for gid, cg := range p.ChannelGroups {
-
-		doc, err := goquery.NewDocument(fmt.Sprintf("http://101.ru/radio-group/group/%d", cg.Id))
-		if err != nil {
-			log.Fatal("Couldn't fetch channels: ", err.Error())
-		}
-
-		doc.Find("ul.list.list-channels li").Each(func(i int, selection *goquery.Selection) {
-			title := selection.Find("a").Find(".h3").Text()
-			href, exists := selection.Find("a").Attr("href")
-			if exists {
-				cid, _ := strconv.ParseUint(path.Base(href), 0, 64)
-				p.ChannelGroups[gid].Channels[cid] = go101Channel{
-					cid, title,
-				}
-			}
-		})
-	}
+	p.ChannelGroups = groups
 }
 
 // Fetch channel info.
 func (p *go101) FetchChannelInfo() {
+	_, span := p.StartSpan("fetch track info")
 	Block{
 		Try: func() {
-			playlistUrl := fmt.Sprintf("http://101.ru/api/channel/getTrackOnAir/%d/channel/?dataFormat=json", p.CurrentChannel)
-			response, err := http.Get(playlistUrl)
+			trackInfo, err := p.Provider.FetchTrackOnAir(p.CurrentChannel)
 			if err != nil {
 				panic(err)
-				//return
 			}
-			defer func() {
-				_ = response.Body.Close()
-			}()
-
-			b, err := ioutil.ReadAll(response.Body)
-			if err != nil {
-				panic(err)
+			// Station error or reply without the track, keep the current one.
+			if err = trackInfo.Check(); err != nil {
+				p.FetchFailed(span, err)
+				return
 			}
-
-			var trackInfo TrackInfo
-			err = json.Unmarshal(b, &trackInfo)
-			if err != nil {
-				panic(err)
-			}
-			p.CurrentTrack.TrackUid = trackInfo.Result.About.Audio[0].TrackUid
-			p.CurrentTrack.Title = trackInfo.Result.About.Title
-			p.CurrentTrack.Artist = trackInfo.Result.About.Artist
-			p.CurrentTrack.Album = trackInfo.Result.About.Album.Title
-			p.CurrentTrack.AlbumDate = trackInfo.Result.About.Album.ReleaseDate
-
-			// Provide case when got full URL.
-			re := regexp.MustCompile(`http\:(.)`)
-			res := re.FindStringSubmatch(string(trackInfo.Result.About.Audio[0].Filename))
-			prefix := ""
-			if res == nil {
-				prefix = "http://101.ru"
-			}
-			p.CurrentTrack.PlayURL = prefix + trackInfo.Result.About.Audio[0].Filename
-
-			// Provide case with wrong URL (ex: http://cdn*.101.ru/vardata/modules/musicdb/files//vardata/modules/musicdb/files/*).
-			//                                                    ^                             ^^
-			re = regexp.MustCompile(`(\/vardata\/modules\/musicdb\/files\/)`)
-			dres := re.FindAllStringSubmatch(string(p.CurrentTrack.PlayURL), -1)
-			if len(dres) == 2 {
-				p.CurrentTrack.PlayURL = strings.Replace(p.CurrentTrack.PlayURL, "/vardata/modules/musicdb/files/", "", 1)
+			if p.StaleTrackInfo(trackInfo) {
+				// Keep the current track instead of the outdated one and its bogus fetch interval. Provider
+				// may serve the stale copy for a while, so re-polls back off like retries.
+				p.StaleReplies++
+				p.NextFetch = p.RetryInterval(p.StaleReplies)
+				Debug("Stale track info of channel %d, re-poll in %d seconds", p.CurrentChannel, p.NextFetch)
+				if p.CurrentTrack.TrackUid == 0 {
+					_ = p.ApplyTrackInfo(p.CurrentChannel, trackInfo)
+				}
+				EndSpan(span, nil)
+				return
 			}
-
-			// Calculate next fetch period. Based on the difference between current timestamp and song start timestamp.
-			diff := uint64(trackInfo.Result.Stat.FinishSong - trackInfo.Result.Stat.ServerTime)
-			if diff < 5 || diff > 1800 {
-				diff = 5
-			} else {
-				diff -= 3
+			if err = p.ApplyTrackInfo(p.CurrentChannel, trackInfo); err != nil {
+				p.FetchFailed(span, err)
+				return
 			}
-			p.NextFetch = diff
+			p.FetchFailures, p.StaleReplies = 0, 0
+			span.SetAttributes(attribute.Int64("track.uid", int64(p.CurrentTrack.TrackUid)))
+			EndSpan(span, nil)
 		},
 		Catch: func(e Exception) {
-			Debug("Got error during fetch channel info: %s", e)
-			p.NextFetch = 5
+			err, ok := e.(error)
+			if !ok {
+				err = fmt.Errorf("%v", e)
+			}
+			p.FetchFailed(span, err)
 		},
 		Finally: func() {
 			// Normal behavior...
@@ -538,57 +857,179 @@ func (p *go101) FetchChannelInfo() {
 	}.Do()
 }
 
-// Play channel.
-func (p *go101) Play() {
-	playUrl := p.CurrentTrack.PlayURL
-	mp3.PlayProcess(playUrl)
-	p.TrackUid = p.CurrentTrack.TrackUid
-	if p.Status == STATUS_PAUSE {
-		p.Pause()
-	} else {
-		p.Status = STATUS_PLAY
-		Debug("Play sig.")
+// Handles failed fetch of channel info: switches geo-blocked channel or schedules retry. Current track keeps
+// playing meanwhile.
+func (p *go101) FetchFailed(span trace.Span, err error) {
+	Debug("Got error during fetch channel info: %s", err)
+	if IsGeoBlocked(err) && p.HandleGeoBlock(p.CurrentChannel, err) {
+		p.NextFetch = 0
+		return
+	}
+	var ae *go101ApiError
+	if errors.As(err, &ae) {
+		// Station's own error is worth showing, unlike network hiccups.
+		log.Printf("Channel %d: %s", p.CurrentChannel, ae.Error())
+	}
+	p.FetchFailures++
+	p.NextFetch = p.RetryInterval(p.FetchFailures)
+	err = fmt.Errorf("couldn't fetch channel info: %v", err)
+	EndSpan(span, err)
+	p.EmitError(err)
+}
+
+// Fill current track and next fetch period using API response of the channel. Current track is kept if the
+// response has station error or neither audio file nor fallback stream.
+func (p *go101) ApplyTrackInfo(cid uint64, trackInfo *TrackInfo) error {
+	if err := trackInfo.Check(); err != nil {
+		return err
+	}
+	re := regexp.MustCompile(`^https?://`)
+	playUrl, live := "", false
+	audio, ok := trackInfo.AudioFile()
+	switch {
+	case ok:
+		// Provide case when got full URL.
+		playUrl = audio.Filename
+		if !re.MatchString(playUrl) {
+			playUrl = p.BaseUrl() + playUrl
+		}
+	case p.CurrentTrack.PlayURL != "" && p.CurrentTrack.TrackUid != 0 && p.CurrentTrack.TrackUid == trackInfo.TrackUid():
+		// Partial reply of the track playing already.
+		audio.TrackUid = p.CurrentTrack.TrackUid
+		playUrl, live = p.CurrentTrack.PlayURL, p.CurrentTrack.Live
+	default:
+		audio.TrackUid = trackInfo.TrackUid()
+		var err error
+		if playUrl, err = p.ChannelStreamURL(cid); err != nil {
+			return err
+		}
+		live = true
+		Debug("No audio file of track %d on channel %d, play live stream %s", audio.TrackUid, cid, playUrl)
+	}
+
+	previous := p.CurrentTrack
+	track := go101TrackInfo{
+		TrackUid:  audio.TrackUid,
+		Live:      live,
+		Title:     trackInfo.Result.About.Title,
+		Artist:    trackInfo.Result.About.Artist,
+		Album:     trackInfo.Result.About.Album.Title,
+		AlbumDate: trackInfo.Result.About.Album.ReleaseDate,
+		Start:     trackInfo.Result.Stat.StartSong,
+		Finish:    trackInfo.Result.Stat.FinishSong,
+		PlayURL:   playUrl,
+	}
+	// Server clock may differ from local one, so use server time to calculate the end. Partial reply may lack it.
+	if trackInfo.Result.Stat.FinishSong > 0 && trackInfo.Result.Stat.ServerTime > 0 {
+		track.Ends = time.Now().Add(time.Duration(int64(trackInfo.Result.Stat.FinishSong)-int64(trackInfo.Result.Stat.ServerTime)) * time.Second)
+		track.Ends = track.Ends.Add(p.SyncOffset())
+	}
+
+	if cover := trackInfo.Result.About.Album.Cover; cover != "" {
+		if re.MatchString(cover) {
+			track.Cover = cover
+		} else {
+			track.Cover = p.BaseUrl() + cover
+		}
 	}
+	if track.TrackUid == previous.TrackUid && previous.Cover != "" {
+		// Re-polled track keeps the cover found by cover art providers.
+		track.Cover = previous.Cover
+	}
+
+	// Provide case with wrong URL (ex: http://cdn*.101.ru/vardata/modules/musicdb/files//vardata/modules/musicdb/files/*).
+	//                                                    ^                             ^^
+	re = regexp.MustCompile(`(\/vardata\/modules\/musicdb\/files\/)`)
+	dres := re.FindAllStringSubmatch(string(track.PlayURL), -1)
+	if len(dres) == 2 {
+		track.PlayURL = strings.Replace(track.PlayURL, "/vardata/modules/musicdb/files/", "", 1)
+	}
+	p.state.data.Lock()
+	p.CurrentTrack = track
+	p.state.data.Unlock()
+
+	// Calculate next fetch period. Based on the difference between current timestamp and song start timestamp.
+	var diff uint64
+	if trackInfo.Result.Stat.FinishSong > trackInfo.Result.Stat.ServerTime+3 {
+		diff = trackInfo.Result.Stat.FinishSong - trackInfo.Result.Stat.ServerTime - 3
+	}
+	p.NextFetch = p.PollInterval(diff)
+	return nil
 }
 
-// Pause playing.
-func (p *go101) Pause() {
-	// Since we plays music from online radio station, it make sense to just mute sound.
-	// At the resume signal we will continue from actual moment of station playing.
-	mp3.MuteProcess()
-	p.Status = STATUS_PAUSE
-	Debug("Pause sig.")
+// Returns base URL for relative audio file names.
+func (p *go101) BaseUrl() string {
+	switch provider := p.Provider.(type) {
+	case *go101ruProvider:
+		return provider.BaseUrl
+	case *go101MockProvider:
+		return provider.BaseUrl
+	}
+	return "https://101.ru"
 }
 
-// Resume playing.
-func (p *go101) Resume() {
-	// See go101ply.Pause()
-	mp3.UnmuteProcess()
-	p.Status = STATUS_PLAY
-	Debug("Resume sig.")
+// Play channel. Played track is remembered by the fetch loop.
+func (p *go101) Play() {
+	// Track is taken once, the loop may change it meanwhile.
+	track := p.Track()
+	if err := p.PlayTrack(track); err != nil {
+		p.PlayFailed(track, err)
+	}
 }
 
-// Stop playing.
-func (p *go101) Stop() {
-	// Call stop proc twice, just in case.
-	mp3.StopProcess()
-	mp3.StopProcess()
-	p.Status = STATUS_STOP
-	Debug("Stop sig.")
+// Starts stream of the track and moves player to play. Does nothing if the stream is started already: track
+// change runs Stop and Play, so only one of the concurrent Plays after Stop starts the stream.
+func (p *go101) PlayTrack(track go101TrackInfo) error {
+	p.state.stream.Lock()
+	defer p.state.stream.Unlock()
+	if p.state.streaming {
+		Debug("Stream is started already.")
+		return nil
+	}
+	playUrl := p.Config.Integrity.MirrorURL(track.PlayURL)
+	_, span := p.StartSpan("stream start")
+	err := p.Backend.Play(playUrl)
+	p.state.streaming = err == nil
+	if err != nil {
+		log.Println(err)
+		p.EmitError(err)
+		EndSpan(span, err)
+		return err
+	}
+	if track.Finish > track.Start {
+		// Latency between track start on server and local playback start.
+		started := track.Ends.Add(-time.Duration(track.Finish-track.Start)*time.Second - p.SyncOffset())
+		span.SetAttributes(attribute.Int64("track.start_lag_ms", time.Since(started).Milliseconds()))
+	}
+	EndSpan(span, nil)
+	p.Started()
+	return nil
 }
 
-// Sleep function, freezes duration on pause/stop status.
-func (p *go101) Sleep(s uint64) {
-	var counter uint64
-	for true {
-		time.Sleep(time.Second)
-		if p.Status == STATUS_PLAY {
-			counter += 1
+// Handles stream which didn't start: switches geo-blocked channel, or forgets the track, so the fetch loop
+// plays it again after a while, from the next mirror if any. Player keeps the status meanwhile.
+func (p *go101) PlayFailed(track go101TrackInfo, err error) {
+	p.Exec(func() {
+		// Fallback channel is chosen by the loop, it owns the channel list.
+		if IsGeoBlocked(err) && p.HandleGeoBlock(p.CurrentChannel, err) {
+			p.Scheduler.Wake()
+			return
 		}
-		if counter >= s {
-			break
+		if c := p.Config.Integrity; c != nil && len(c.Mirrors) > 0 {
+			host := c.NextMirror()
+			if host == "" {
+				host = "original host"
+			}
+			Debug("Switch stream to %s", host)
 		}
-	}
+		// Another track may be started meanwhile.
+		if p.TrackUid == track.TrackUid {
+			p.state.data.Lock()
+			p.TrackUid, p.PlayingURL = 0, ""
+			p.state.data.Unlock()
+		}
+	})
+	time.AfterFunc(time.Duration(p.RetryInterval(1))*time.Second, p.Scheduler.Wake)
 }
 
 func (p Block) Do() {
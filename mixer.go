@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var reVolumePercent = regexp.MustCompile(`(\d+)%`)
+
+// Returns volume (in percents) of the default output using pactl or amixer.
+func GetVolume() (int, error) {
+	out, err := exec.Command("pactl", "get-sink-volume", "@DEFAULT_SINK@").Output()
+	if err != nil {
+		out, err = exec.Command("amixer", "get", "Master").Output()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get volume: %s", err.Error())
+	}
+	m := reVolumePercent.FindSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("couldn't parse volume: %s", out)
+	}
+	return strconv.Atoi(string(m[1]))
+}
+
+// Sets volume (in percents) of the default output using pactl or amixer.
+func SetVolume(percent int) error {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	err := exec.Command("pactl", "set-sink-volume", "@DEFAULT_SINK@", fmt.Sprintf("%d%%", percent)).Run()
+	if err != nil {
+		err = exec.Command("amixer", "-q", "set", "Master", fmt.Sprintf("%d%%", percent)).Run()
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't set volume: %s", err.Error())
+	}
+	Debug("Volume set to %d%%", percent)
+	return nil
+}
+
+// Checks if nobody can hear the default output: it's muted or its active port (headphones, speakers) is unplugged.
+// Works with PulseAudio and PipeWire (via pipewire-pulse).
+func SinkSilent() (bool, error) {
+	out, err := exec.Command("pactl", "get-sink-mute", "@DEFAULT_SINK@").Output()
+	if err != nil {
+		return false, fmt.Errorf("couldn't get sink state: %s", err.Error())
+	}
+	if strings.Contains(string(out), "yes") {
+		return true, nil
+	}
+	out, err = exec.Command("pactl", "get-default-sink").Output()
+	if err != nil {
+		// No sink at all, all outputs removed.
+		return true, nil
+	}
+	sink := strings.TrimSpace(string(out))
+	if sink == "" || sink == "auto_null" {
+		return true, nil
+	}
+	out, err = exec.Command("pactl", "list", "sinks").Output()
+	if err != nil {
+		return false, fmt.Errorf("couldn't list sinks: %s", err.Error())
+	}
+	return activePortUnavailable(string(out), sink), nil
+}
+
+// Parses "pactl list sinks" output and checks if active port of the sink is unplugged.
+func activePortUnavailable(list, sink string) bool {
+	var (
+		current, active string
+		ports           = make(map[string]string)
+	)
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Name: "):
+			current = strings.TrimPrefix(line, "Name: ")
+		case current != sink:
+			continue
+		case strings.HasPrefix(line, "Active Port: "):
+			active = strings.TrimPrefix(line, "Active Port: ")
+		case strings.Contains(line, "available"):
+			if i := strings.Index(line, ": "); i > 0 {
+				ports[line[:i]] = line
+			}
+		}
+	}
+	if active == "" {
+		return false
+	}
+	return strings.Contains(ports[active], "not available")
+}
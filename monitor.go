@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Parallel requests to the provider while polling monitored channels, all of them share the rate limiter.
+	MONITOR_WORKERS          = 4
+	DEFAULT_MONITOR_INTERVAL = 15
+)
+
+// Fetches tracks on air of the channels concurrently. Channels failed to fetch are missing in the result.
+func (p *go101) PollChannels(ids []uint64) map[uint64]go101TrackInfo {
+	queue := make(chan uint64)
+	tracks := make(map[uint64]go101TrackInfo, len(ids))
+	var (
+		mux sync.Mutex
+		wg  sync.WaitGroup
+	)
+	for i := 0; i < MONITOR_WORKERS; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cid := range queue {
+				trackInfo, err := p.Provider.FetchTrackOnAir(cid)
+				if err != nil {
+					Debug("Couldn't fetch track on channel %d: %s", cid, err)
+					continue
+				}
+				info := go101{Provider: p.Provider, Config: p.Config}
+				if err = info.ApplyTrackInfo(cid, trackInfo); err != nil {
+					Debug("Couldn't fetch track on channel %d: %s", cid, err)
+					continue
+				}
+				mux.Lock()
+				tracks[cid] = info.CurrentTrack
+				mux.Unlock()
+			}
+		}()
+	}
+	for _, cid := range ids {
+		if !p.Profile.ChannelRestricted(cid) {
+			queue <- cid
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return tracks
+}
+
+// Renders table of tracks on air, followed artists are marked with a star.
+func (p *go101) RenderMonitor(ids []uint64, tracks map[uint64]go101TrackInfo, artists []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %d channels, updated %s\n\n", Paint(theme.Info, "101ply monitor"), len(ids), time.Now().Format("15:04:05"))
+	width := TerminalWidth()
+	for _, cid := range ids {
+		channel := Truncate(p.ConsoleText(p.ChannelGroups[p.ChannelGroup(cid)].Channels[cid].Title), 20)
+		track, ok := tracks[cid]
+		if !ok {
+			fmt.Fprintf(&b, "  %6d  %-20s  %s\n", cid, channel, Paint(theme.Error, "unavailable"))
+			continue
+		}
+		mark := " "
+		if FollowedArtist(track, artists) != "" {
+			mark = "★"
+		}
+		left := ""
+		if remaining := time.Until(track.Ends); remaining > 0 {
+			left = FormatTime(uint64(remaining / time.Second))
+		}
+		line := Truncate(p.ConsoleText(track.Artist+" - "+track.Title), width-42)
+		fmt.Fprintf(&b, "%s %6d  %-20s  %s  %s\n", mark, cid, Paint(theme.Channel, channel), line, Paint(theme.Time, left))
+	}
+	return b.String()
+}
+
+// Show live table of tracks playing on several channels.
+func CmdMonitor(args []string) {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	interval := fs.Int("interval", DEFAULT_MONITOR_INTERVAL, "Seconds between updates.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	go101o.LoadChannelGroups()
+	var ids []uint64
+	for _, s := range fs.Args() {
+		cid, err := go101o.ResolveChannel(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ids = append(ids, cid)
+	}
+	if len(ids) == 0 {
+		var err error
+		if ids, err = go101o.FollowChannels(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(ids) == 0 {
+		log.Fatal("Usage: monitor [-interval N] <channel>... (favorites are monitored without arguments)")
+	}
+	if *interval <= 0 {
+		*interval = DEFAULT_MONITOR_INTERVAL
+	}
+	for true {
+		tracks := go101o.PollChannels(ids)
+		artists, _ := go101o.FollowedArtists()
+		fmt.Print("\033[H\033[2J" + go101o.RenderMonitor(ids, tracks, artists))
+		time.Sleep(time.Duration(*interval) * time.Second)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	MPRIS_NAME   = "org.mpris.MediaPlayer2.101ply"
+	MPRIS_PATH   = "/org/mpris/MediaPlayer2"
+	MPRIS_ROOT   = "org.mpris.MediaPlayer2"
+	MPRIS_PLAYER = "org.mpris.MediaPlayer2.Player"
+)
+
+// Go to D-Bus method names mapping of the player interface.
+var mprisPlayerMethods = map[string]string{"SeekBy": "Seek"}
+
+// Properties of the running MPRIS service, updated by player events.
+var (
+	mprisProps     *prop.Properties
+	mprisPropsMux  sync.Mutex
+	mprisPropsOnce sync.Once
+)
+
+// MPRIS root interface.
+type go101MprisRoot struct {
+	p *go101
+}
+
+func (m go101MprisRoot) Raise() *dbus.Error {
+	return nil
+}
+
+func (m go101MprisRoot) Quit() *dbus.Error {
+	Cleanup()
+	os.Exit(0)
+	return nil
+}
+
+// MPRIS player interface. Bluetooth headphones (AVRCP via BlueZ mpris-proxy), media keys daemons and
+// desktop widgets call it.
+type go101MprisPlayer struct {
+	p *go101
+}
+
+func (m go101MprisPlayer) Next() *dbus.Error {
+	m.p.Action(ACTION_NEXT)
+	return nil
+}
+
+func (m go101MprisPlayer) Previous() *dbus.Error {
+	m.p.Action(ACTION_PREV)
+	return nil
+}
+
+func (m go101MprisPlayer) Pause() *dbus.Error {
+	m.p.Pause()
+	return nil
+}
+
+func (m go101MprisPlayer) PlayPause() *dbus.Error {
+	m.p.Action(ACTION_PAUSE)
+	return nil
+}
+
+// Live radio can't be stopped, so stop works like pause.
+func (m go101MprisPlayer) Stop() *dbus.Error {
+	return m.Pause()
+}
+
+func (m go101MprisPlayer) Play() *dbus.Error {
+	m.p.Resume()
+	return nil
+}
+
+// Checks if playback can seek: live radio can't, only replay from cache on backend supporting it can.
+func (p *go101) CanSeek() bool {
+	_, ok := BaseBackend(p.Backend).(go101SeekBackend)
+	return ok && p.Replaying()
+}
+
+// Exported as Seek, see mprisPlayerMethods.
+func (m go101MprisPlayer) SeekBy(offset int64) *dbus.Error {
+	if m.p.CanSeek() {
+		if err := BaseBackend(m.p.Backend).(go101SeekBackend).Seek(time.Duration(offset) * time.Microsecond); err != nil {
+			Debug("%s", err)
+		}
+	}
+	return nil
+}
+
+func (m go101MprisPlayer) SetPosition(track dbus.ObjectPath, position int64) *dbus.Error {
+	return nil
+}
+
+func (m go101MprisPlayer) OpenUri(uri string) *dbus.Error {
+	return nil
+}
+
+// Returns MPRIS playback status.
+func MprisStatus(status uint64) string {
+	switch status {
+	case STATUS_PLAY:
+		return "Playing"
+	case STATUS_PAUSE:
+		return "Paused"
+	default:
+		return "Stopped"
+	}
+}
+
+// Returns MPRIS metadata of the track.
+func MprisMetadata(track go101TrackInfo, channel go101Channel, url string) map[string]dbus.Variant {
+	metadata := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath(fmt.Sprintf("/org/mpris/MediaPlayer2/101ply/track/%d", track.TrackUid))),
+		"xesam:title":   dbus.MakeVariant(track.Title),
+		"xesam:artist":  dbus.MakeVariant([]string{track.Artist}),
+		"xesam:album":   dbus.MakeVariant(track.Album),
+		"xesam:comment": dbus.MakeVariant([]string{channel.Title}),
+		"xesam:url":     dbus.MakeVariant(url),
+	}
+	if track.Cover != "" {
+		// Not every client loads remote images, local copy is preferred.
+		art := track.Cover
+		if filename, err := CoverFile(track.Cover); err == nil {
+			art = "file://" + filename
+		}
+		metadata["mpris:artUrl"] = dbus.MakeVariant(art)
+	}
+	return metadata
+}
+
+// Registers MPRIS service on the session bus and keeps its properties in sync with player. Runs forever.
+func (p *go101) MprisLoop() {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		panic(fmt.Errorf("couldn't connect to session bus: %s", err.Error()))
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	name := MprisName()
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		panic(fmt.Errorf("couldn't acquire name %s: %v", name, err))
+	}
+
+	root := go101MprisRoot{p}
+	player := go101MprisPlayer{p}
+	if err = conn.Export(root, MPRIS_PATH, MPRIS_ROOT); err != nil {
+		panic(err)
+	}
+	if err = conn.ExportWithMap(player, mprisPlayerMethods, MPRIS_PATH, MPRIS_PLAYER); err != nil {
+		panic(err)
+	}
+	channel := p.Channel()
+	props, err := prop.Export(conn, MPRIS_PATH, prop.Map{
+		MPRIS_ROOT: {
+			"CanQuit":             {Value: true, Emit: prop.EmitTrue},
+			"CanRaise":            {Value: false, Emit: prop.EmitTrue},
+			"HasTrackList":        {Value: false, Emit: prop.EmitTrue},
+			"Identity":            {Value: "101ply", Emit: prop.EmitTrue},
+			"SupportedUriSchemes": {Value: []string{}, Emit: prop.EmitTrue},
+			"SupportedMimeTypes":  {Value: []string{}, Emit: prop.EmitTrue},
+		},
+		MPRIS_PLAYER: {
+			"PlaybackStatus": {Value: MprisStatus(p.Status()), Emit: prop.EmitTrue},
+			"Metadata":       {Value: MprisMetadata(p.Track(), channel, p.ChannelURL(channel.Id)), Emit: prop.EmitTrue},
+			"Rate":           {Value: 1.0, Emit: prop.EmitTrue},
+			"MinimumRate":    {Value: 1.0, Emit: prop.EmitTrue},
+			"MaximumRate":    {Value: 1.0, Emit: prop.EmitTrue},
+			"Volume":         {Value: 1.0, Emit: prop.EmitTrue},
+			"Position":       {Value: int64(0), Emit: prop.EmitFalse},
+			"CanGoNext":      {Value: true, Emit: prop.EmitTrue},
+			"CanGoPrevious":  {Value: true, Emit: prop.EmitTrue},
+			"CanPlay":        {Value: true, Emit: prop.EmitTrue},
+			"CanPause":       {Value: true, Emit: prop.EmitTrue},
+			"CanSeek":        {Value: p.CanSeek(), Emit: prop.EmitTrue},
+			"CanControl":     {Value: true, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	playerMethods := introspect.Methods(player)
+	for i := range playerMethods {
+		if name, ok := mprisPlayerMethods[playerMethods[i].Name]; ok {
+			playerMethods[i].Name = name
+		}
+	}
+	node := &introspect.Node{
+		Name: MPRIS_PATH,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{Name: MPRIS_ROOT, Methods: introspect.Methods(root), Properties: props.Introspection(MPRIS_ROOT)},
+			{Name: MPRIS_PLAYER, Methods: playerMethods, Properties: props.Introspection(MPRIS_PLAYER)},
+		},
+	}
+	if err = conn.Export(introspect.NewIntrospectable(node), MPRIS_PATH, "org.freedesktop.DBus.Introspectable"); err != nil {
+		panic(err)
+	}
+
+	mprisPropsMux.Lock()
+	mprisProps = props
+	mprisPropsMux.Unlock()
+	mprisPropsOnce.Do(func() {
+		p.Subscribe(func(e go101Event) {
+			// Cover may be downloaded, so metadata is made before locking.
+			metadata := MprisMetadata(e.Track, e.Channel, p.ChannelURL(e.Channel.Id))
+			// Replay state isn't part of the event.
+			canSeek := p.CanSeek()
+			mprisPropsMux.Lock()
+			defer mprisPropsMux.Unlock()
+			if mprisProps == nil {
+				return
+			}
+			mprisProps.SetMust(MPRIS_PLAYER, "PlaybackStatus", MprisStatus(e.Status))
+			mprisProps.SetMust(MPRIS_PLAYER, "Metadata", metadata)
+			mprisProps.SetMust(MPRIS_PLAYER, "CanSeek", canSeek)
+		})
+	})
+	Debug("MPRIS service %s registered", name)
+
+	<-conn.Context().Done()
+	mprisPropsMux.Lock()
+	mprisProps = nil
+	mprisPropsMux.Unlock()
+}
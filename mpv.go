@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	BACKEND_MPV = "mpv"
+	// Time given to mpv to open IPC socket and to answer commands.
+	MPV_TIMEOUT = 5 * time.Second
+)
+
+// Backend controlling mpv over its JSON IPC, see https://mpv.io/manual/stable/#json-ipc.
+type go101MpvBackend struct {
+	mux    sync.Mutex
+	cmd    *exec.Cmd
+	conn   net.Conn
+	socket string
+	// Closed once the process exited.
+	exited chan struct{}
+	// Reply channels of sent commands by request ID.
+	requestId uint64
+	pending   map[uint64]chan go101MpvReply
+}
+
+// Command reply or event of mpv IPC.
+type go101MpvReply struct {
+	RequestId uint64          `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+	Event     string          `json:"event"`
+}
+
+// Starts idle mpv process and connects to its IPC socket if it isn't running. The lock must be held.
+func (b *go101MpvBackend) start() error {
+	if b.cmd != nil {
+		return nil
+	}
+	// Runtime directory is private to the user, unlike temporary one. Other 101ply processes (archive) run own mpv.
+	b.socket = filepath.Join(GetRuntimeDir(), fmt.Sprintf("mpv-%d.sock", os.Getpid()))
+	_ = os.Remove(b.socket)
+	cmd := exec.Command("mpv", "--idle=yes", "--no-video", "--no-terminal", "--input-ipc-server="+b.socket)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("couldn't start mpv: %s", err.Error())
+	}
+	Debug("mpv started, pid %d", cmd.Process.Pid)
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		Debug("mpv (pid %d) exited", cmd.Process.Pid)
+		close(exited)
+		b.mux.Lock()
+		if b.cmd == cmd {
+			_ = b.conn.Close()
+			b.cmd, b.conn = nil, nil
+		}
+		b.mux.Unlock()
+	}()
+	// Socket appears once mpv is initialized.
+	var (
+		conn net.Conn
+		err  error
+	)
+	deadline := time.Now().Add(MPV_TIMEOUT)
+	for conn == nil {
+		if conn, err = net.Dial("unix", b.socket); err == nil {
+			break
+		}
+		select {
+		case <-exited:
+			return fmt.Errorf("mpv exited on start")
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			_ = cmd.Process.Kill()
+			return fmt.Errorf("couldn't connect to mpv: %s", err.Error())
+		}
+	}
+	b.cmd, b.conn, b.exited = cmd, conn, exited
+	b.pending = make(map[uint64]chan go101MpvReply)
+	go b.read(conn)
+	return nil
+}
+
+// Dispatches command replies, events are skipped.
+func (b *go101MpvBackend) read(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var reply go101MpvReply
+		if err := json.Unmarshal(scanner.Bytes(), &reply); err != nil || reply.Event != "" {
+			continue
+		}
+		b.mux.Lock()
+		ch, ok := b.pending[reply.RequestId]
+		delete(b.pending, reply.RequestId)
+		b.mux.Unlock()
+		if ok {
+			ch <- reply
+		}
+	}
+}
+
+// Sends IPC command and waits for its reply.
+func (b *go101MpvBackend) command(args ...interface{}) (json.RawMessage, error) {
+	b.mux.Lock()
+	if err := b.start(); err != nil {
+		b.mux.Unlock()
+		return nil, err
+	}
+	b.requestId++
+	id, ch, exited := b.requestId, make(chan go101MpvReply, 1), b.exited
+	b.pending[id] = ch
+	req, _ := json.Marshal(map[string]interface{}{"command": args, "request_id": id})
+	_, err := b.conn.Write(append(req, '\n'))
+	b.mux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-ch:
+		if reply.Error != "success" {
+			return nil, fmt.Errorf("mpv command %v failed: %s", args[0], reply.Error)
+		}
+		return reply.Data, nil
+	case <-exited:
+		return nil, fmt.Errorf("mpv exited")
+	case <-time.After(MPV_TIMEOUT):
+		b.mux.Lock()
+		delete(b.pending, id)
+		b.mux.Unlock()
+		return nil, fmt.Errorf("mpv doesn't answer command %v", args[0])
+	}
+}
+
+func (b *go101MpvBackend) Play(url string) error {
+	// Mute and pause are properties of the player, not of the file, so the new stream starts unmuted and playing.
+	if _, err := b.command("set_property", "mute", false); err != nil {
+		return err
+	}
+	if _, err := b.command("set_property", "pause", false); err != nil {
+		return err
+	}
+	_, err := b.command("loadfile", url, "replace")
+	return err
+}
+
+func (b *go101MpvBackend) Mute() {
+	if _, err := b.command("set_property", "mute", true); err != nil {
+		Debug("%s", err)
+	}
+}
+
+func (b *go101MpvBackend) Unmute() {
+	if _, err := b.command("set_property", "mute", false); err != nil {
+		Debug("%s", err)
+	}
+}
+
+// Sets playback speed, mpv keeps the pitch by time-stretching (scaletempo filter). Speed is a property of the
+// player, so it stays for the next files.
+func (b *go101MpvBackend) SetSpeed(speed float64) error {
+	_, err := b.command("set_property", "speed", speed)
+	return err
+}
+
+// Pauses or resumes playback, local files continue from the same position.
+func (b *go101MpvBackend) SetPaused(paused bool) error {
+	_, err := b.command("set_property", "pause", paused)
+	return err
+}
+
+func (b *go101MpvBackend) Stop() {
+	b.mux.Lock()
+	running := b.cmd != nil
+	b.mux.Unlock()
+	if !running {
+		return
+	}
+	if _, err := b.command("stop"); err != nil {
+		Debug("%s", err)
+	}
+}
+
+// Returns volume of the player in percents.
+func (b *go101MpvBackend) Volume() (int, error) {
+	data, err := b.command("get_property", "volume")
+	if err != nil {
+		return 0, err
+	}
+	var volume float64
+	if err = json.Unmarshal(data, &volume); err != nil {
+		return 0, err
+	}
+	return int(volume + 0.5), nil
+}
+
+// Sets volume of the player in percents.
+func (b *go101MpvBackend) SetVolume(percent int) error {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	_, err := b.command("set_property", "volume", percent)
+	return err
+}
+
+// Sets bass and treble gain with ffmpeg filters, replacing the audio filter chain.
+func (b *go101MpvBackend) SetEqualizer(bass, treble float64) error {
+	af := ""
+	if bass != 0 || treble != 0 {
+		af = fmt.Sprintf("lavfi=[bass=g=%g,treble=g=%g]", bass, treble)
+	}
+	_, err := b.command("set_property", "af", af)
+	return err
+}
+
+// Returns playback time of the current stream in milliseconds.
+func (b *go101MpvBackend) Progress() (uint64, error) {
+	data, err := b.command("get_property", "playback-time")
+	if err != nil {
+		return 0, err
+	}
+	var seconds float64
+	if err = json.Unmarshal(data, &seconds); err != nil {
+		return 0, err
+	}
+	return uint64(seconds * 1000), nil
+}
+
+// Kills mpv, the next command starts a fresh one.
+func (b *go101MpvBackend) Restart() {
+	b.mux.Lock()
+	cmd, exited := b.cmd, b.exited
+	b.mux.Unlock()
+	if cmd == nil {
+		return
+	}
+	Debug("Kill mpv (pid %d)", cmd.Process.Pid)
+	_ = cmd.Process.Kill()
+	<-exited
+	b.mux.Lock()
+	if b.cmd == cmd {
+		_ = b.conn.Close()
+		b.cmd, b.conn = nil, nil
+	}
+	b.mux.Unlock()
+}
+
+// Seeks relative to the current position, works in local files only.
+func (b *go101MpvBackend) Seek(offset time.Duration) error {
+	_, err := b.command("seek", offset.Seconds(), "relative")
+	return err
+}
+
+func (b *go101MpvBackend) Close() {
+	b.mux.Lock()
+	running, exited, cmd := b.cmd != nil, b.exited, b.cmd
+	b.mux.Unlock()
+	if !running {
+		return
+	}
+	_, _ = b.command("quit")
+	select {
+	case <-exited:
+	case <-time.After(MPV_TIMEOUT):
+		Debug("mpv (pid %d) doesn't quit, kill it", cmd.Process.Pid)
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+	_ = os.Remove(b.socket)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// Channel categories with own gain profiles.
+const (
+	CATEGORY_MUSIC = "music"
+	CATEGORY_TALK  = "talk"
+)
+
+// Used when config doesn't specify own talk patterns.
+var defaultTalkPatterns = []string{"talk", "news", "разговор", "новост", "юмор", "аудиокниг", "спорт"}
+
+// Volume and equalizer applied when channel of the category starts playing.
+type go101GainProfile struct {
+	// Volume in percents, 0 keeps current.
+	Volume int `json:"volume"`
+	// Bass and treble gain in dB, ex: cut bass and lift treble for speech.
+	Bass   float64 `json:"bass"`
+	Treble float64 `json:"treble"`
+}
+
+// Detects channel category by its genres, title and group title.
+func (p *go101) ChannelCategory(gid, cid uint64) string {
+	patterns := p.Config.TalkPatterns
+	if len(patterns) == 0 {
+		patterns = defaultTalkPatterns
+	}
+	group := p.ChannelGroups[gid]
+	channel := group.Channels[cid]
+	haystack := strings.ToLower(group.Title + " " + channel.Title + " " + strings.Join(channel.Genres, " "))
+	for _, pattern := range patterns {
+		if strings.Contains(haystack, strings.ToLower(pattern)) {
+			return CATEGORY_TALK
+		}
+	}
+	return CATEGORY_MUSIC
+}
+
+// Sets volume and equalizer from gain profile of the current channel category, if category changed. Backend volume
+// is set if it has own one, system mixer volume otherwise. Equalizer needs backend having it (mpv).
+func (p *go101) ApplyGainProfile() {
+	category := p.ChannelCategory(p.GroupId(), p.ChannelId())
+	if category == p.Category {
+		return
+	}
+	p.Category = category
+	// Category without profile gets the equalizer off.
+	profile, ok := p.Config.GainProfiles[category]
+	if b, eq := BaseBackend(p.Backend).(go101EqualizerBackend); eq {
+		if err := b.SetEqualizer(profile.Bass, profile.Treble); err != nil {
+			log.Println("Couldn't set equalizer: ", err.Error())
+		}
+	} else if profile.Bass != 0 || profile.Treble != 0 {
+		Debug("%s backend has no equalizer, bass and treble of %s gain profile are ignored", p.Config.AudioBackend, category)
+	}
+	if !ok || profile.Volume <= 0 {
+		return
+	}
+	Debug("Apply %s gain profile, volume %d%%", category, profile.Volume)
+	_, set := p.VolumeControl()
+	if err := set(profile.Volume); err != nil {
+		log.Println(err)
+		return
+	}
+	// Keep quiet hours cap in effect.
+	p.Quiet.Reset()
+	p.ApplyQuietHours()
+}
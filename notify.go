@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Notification backends.
+const (
+	NOTIFIER_LIBNOTIFY = "libnotify"
+	NOTIFIER_PUSHOVER  = "pushover"
+	NOTIFIER_NTFY      = "ntfy"
+	NOTIFIER_GOTIFY    = "gotify"
+)
+
+const (
+	NOTIFY_TIMEOUT = 10 * time.Second
+	// Failing stream emits errors every few seconds, notify not more often than that.
+	NOTIFY_ERROR_INTERVAL = 10 * time.Minute
+)
+
+// Notification backend.
+type go101Notifier interface {
+	// Sends notification. Quiet notification should not make sound.
+	Notify(title, message string, quiet bool) error
+}
+
+// Notification backend able to show track cover.
+type go101CoverNotifier interface {
+	// Sends notification with cover image URL.
+	NotifyCover(title, message, cover string, quiet bool) error
+}
+
+// Notifier configuration.
+type go101NotifierConfig struct {
+	Type string `json:"type"`
+	// Server URL of ntfy and gotify (ntfy.sh by default).
+	URL   string `json:"url"`
+	Token string `json:"token"`
+	// Pushover user key.
+	User string `json:"user"`
+	// ntfy topic.
+	Topic string `json:"topic"`
+	// Events to notify about (track, error, alert, reminder, program, follow, rotation), all if empty.
+	Events []string `json:"events"`
+	// Show error and alert pop-ups of libnotify in do-not-disturb mode too.
+	DNDOverride bool `json:"dnd_override"`
+}
+
+// Returns notifier by config.
+func NewNotifier(c go101NotifierConfig) (go101Notifier, error) {
+	var err error
+	if c.Token, err = ResolveSecret(c.Token); err != nil {
+		return nil, err
+	}
+	if c.User, err = ResolveSecret(c.User); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case NOTIFIER_LIBNOTIFY:
+		return &go101Libnotify{}, nil
+	case NOTIFIER_PUSHOVER:
+		if c.Token == "" || c.User == "" {
+			return nil, fmt.Errorf("pushover notifier needs token and user")
+		}
+		return &go101Pushover{Token: c.Token, User: c.User}, nil
+	case NOTIFIER_NTFY:
+		if c.Topic == "" {
+			return nil, fmt.Errorf("ntfy notifier needs topic")
+		}
+		server := c.URL
+		if server == "" {
+			server = "https://ntfy.sh"
+		}
+		return &go101Ntfy{URL: strings.TrimRight(server, "/"), Topic: c.Topic, Token: c.Token}, nil
+	case NOTIFIER_GOTIFY:
+		if c.URL == "" || c.Token == "" {
+			return nil, fmt.Errorf("gotify notifier needs url and token")
+		}
+		return &go101Gotify{URL: strings.TrimRight(c.URL, "/"), Token: c.Token}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %s", c.Type)
+	}
+}
+
+// Checks if notifier should receive event of the type.
+func (c go101NotifierConfig) Accepts(typ string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Configured notifiers.
+type go101NotifierEntry struct {
+	Config   go101NotifierConfig
+	Notifier go101Notifier
+}
+
+var (
+	notifiers    []go101NotifierEntry
+	notifiersMux sync.Mutex
+)
+
+// Creates common and active profile notifiers.
+func (p *go101) SetNotifiers() error {
+	configs := p.Config.Notifiers
+	if p.Profile != nil {
+		configs = append(append([]go101NotifierConfig{}, configs...), p.Profile.Notifiers...)
+	}
+	entries := make([]go101NotifierEntry, 0, len(configs))
+	for _, c := range configs {
+		n, err := NewNotifier(c)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, go101NotifierEntry{c, n})
+	}
+	notifiersMux.Lock()
+	notifiers = entries
+	notifiersMux.Unlock()
+	return nil
+}
+
+// Returns current notifiers.
+func Notifiers() []go101NotifierEntry {
+	notifiersMux.Lock()
+	defer notifiersMux.Unlock()
+	return notifiers
+}
+
+// Creates configured notifiers and sends track changes and errors to them.
+func (p *go101) InitNotifiers() {
+	if err := p.SetNotifiers(); err != nil {
+		log.Fatal(err)
+	}
+	var (
+		lastError time.Time
+		mux       sync.Mutex
+	)
+	p.Subscribe(func(e go101Event) {
+		switch e.Type {
+		case EVENT_TRACK:
+			message := e.Channel.Title
+			for _, link := range p.TrackLinks(e.Track, e.Channel) {
+				message += "\n" + link.URL
+			}
+			p.notify(e.Type, e.Track.Artist+" - "+e.Track.Title, message, e.Track.Cover)
+		case EVENT_ERROR:
+			mux.Lock()
+			throttled := time.Since(lastError) < NOTIFY_ERROR_INTERVAL
+			if !throttled {
+				lastError = time.Now()
+			}
+			mux.Unlock()
+			if !throttled {
+				p.Notify(e.Type, "101ply: "+e.Channel.Title, e.Error)
+			}
+		}
+	})
+}
+
+// Sends notification to all notifiers accepting the event type. Notifications are silent during quiet hours,
+// desktop pop-ups are suppressed in do-not-disturb mode.
+func (p *go101) Notify(typ, title, message string) {
+	p.notify(typ, title, message, "")
+}
+
+func (p *go101) notify(typ, title, message, cover string) {
+	quiet := p.IsQuiet()
+	for _, n := range Notifiers() {
+		if !n.Config.Accepts(typ) {
+			continue
+		}
+		n := n
+		go Safe("notifier", func() {
+			var err error
+			if desktop, ok := n.Notifier.(*go101Libnotify); ok && DoNotDisturb() {
+				if !n.Config.DNDOverride || (typ != EVENT_ERROR && typ != EVENT_ALERT) {
+					Debug("Notification suppressed in do-not-disturb mode: %s: %s", title, message)
+					return
+				}
+				// Critical notifications are shown in do-not-disturb mode.
+				err = desktop.Urgent(title, message)
+			} else if cn, ok := n.Notifier.(go101CoverNotifier); ok && cover != "" {
+				err = cn.NotifyCover(title, message, cover, quiet)
+			} else {
+				err = n.Notifier.Notify(title, message, quiet)
+			}
+			if err != nil {
+				Debug("Notification via %s failed: %s", n.Config.Type, err)
+			}
+		})
+	}
+}
+
+// Desktop notifications via org.freedesktop.Notifications.
+type go101Libnotify struct {
+	// Notification replaced by the next one, so they don't pile up.
+	id uint32
+}
+
+func (n *go101Libnotify) Notify(title, message string, quiet bool) error {
+	hints := map[string]dbus.Variant{}
+	if quiet {
+		hints["suppress-sound"] = dbus.MakeVariant(true)
+		hints["urgency"] = dbus.MakeVariant(byte(0))
+	}
+	return n.send(title, message, hints)
+}
+
+// Sends notification with cover, downloaded to a local file: notification servers don't load remote images.
+func (n *go101Libnotify) NotifyCover(title, message, cover string, quiet bool) error {
+	filename, err := CoverFile(cover)
+	if err != nil {
+		Debug("Couldn't fetch cover for notification: %s", err)
+		return n.Notify(title, message, quiet)
+	}
+	hints := map[string]dbus.Variant{"image-path": dbus.MakeVariant("file://" + filename)}
+	if quiet {
+		hints["suppress-sound"] = dbus.MakeVariant(true)
+		hints["urgency"] = dbus.MakeVariant(byte(0))
+	}
+	return n.send(title, message, hints)
+}
+
+// Sends notification of critical urgency.
+func (n *go101Libnotify) Urgent(title, message string) error {
+	return n.send(title, message, map[string]dbus.Variant{"urgency": dbus.MakeVariant(byte(2))})
+}
+
+func (n *go101Libnotify) send(title, message string, hints map[string]dbus.Variant) error {
+	if !SessionBusAvailable() {
+		return fmt.Errorf("no session bus")
+	}
+	if UsePortals() {
+		// Notification server isn't reachable from Flatpak without extra permission, portal is.
+		priority := "normal"
+		if urgency, ok := hints["urgency"].Value().(byte); ok {
+			switch urgency {
+			case 0:
+				priority = "low"
+			case 2:
+				priority = "urgent"
+			}
+		}
+		return PortalNotify("101ply", title, message, priority)
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+	return obj.Call("org.freedesktop.Notifications.Notify", 0,
+		"101ply", n.id, "audio-x-generic", title, message, []string{}, hints, int32(-1)).Store(&n.id)
+}
+
+// Pushover (https://pushover.net) notifications.
+type go101Pushover struct {
+	Token string
+	User  string
+}
+
+func (n *go101Pushover) Notify(title, message string, quiet bool) error {
+	form := url.Values{"token": {n.Token}, "user": {n.User}, "title": {title}, "message": {message}}
+	if quiet {
+		form.Set("priority", "-1")
+	}
+	client := http.Client{Timeout: NOTIFY_TIMEOUT}
+	resp, err := client.PostForm("https://api.pushover.net/1/messages.json", form)
+	return checkNotifyResponse(resp, err)
+}
+
+// ntfy (https://ntfy.sh) notifications.
+type go101Ntfy struct {
+	URL   string
+	Topic string
+	Token string
+}
+
+func (n *go101Ntfy) Notify(title, message string, quiet bool) error {
+	return n.NotifyCover(title, message, "", quiet)
+}
+
+// Sends notification with cover as its icon, loaded by ntfy clients.
+func (n *go101Ntfy) NotifyCover(title, message, cover string, quiet bool) error {
+	req, err := http.NewRequest(http.MethodPost, n.URL+"/"+url.PathEscape(n.Topic), strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", title)
+	req.Header.Set("Tags", "radio")
+	if cover != "" {
+		req.Header.Set("Icon", cover)
+	}
+	if quiet {
+		req.Header.Set("Priority", "low")
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	client := http.Client{Timeout: NOTIFY_TIMEOUT}
+	return checkNotifyResponse(client.Do(req))
+}
+
+// Gotify (https://gotify.net) notifications.
+type go101Gotify struct {
+	URL   string
+	Token string
+}
+
+func (n *go101Gotify) Notify(title, message string, quiet bool) error {
+	return n.NotifyCover(title, message, "", quiet)
+}
+
+// Sends notification with cover, shown as big image by Gotify Android app.
+func (n *go101Gotify) NotifyCover(title, message, cover string, quiet bool) error {
+	priority := 5
+	if quiet {
+		priority = 0
+	}
+	msg := map[string]interface{}{"title": title, "message": message, "priority": priority}
+	if cover != "" {
+		msg["extras"] = map[string]interface{}{"client::notification": map[string]string{"bigImageUrl": cover}}
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.URL+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", n.Token)
+	client := http.Client{Timeout: NOTIFY_TIMEOUT}
+	return checkNotifyResponse(client.Do(req))
+}
+
+// Checks response of notification service.
+func checkNotifyResponse(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %s", resp.Status)
+	}
+	return nil
+}
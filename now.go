@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Status line shouldn't wait for the player.
+const NOW_TIMEOUT = 300 * time.Millisecond
+
+// Returns status of the running player.
+func QueryStatus(timeout time.Duration) (*go101Status, error) {
+	out, err := SendControl("status", timeout)
+	if err != nil {
+		return nil, err
+	}
+	status := &go101Status{}
+	if err = json.Unmarshal([]byte(out), status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Shortens string to n characters, marking cut with ellipsis.
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s
+	}
+	if n == 1 {
+		return "…"
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// Escapes string for tmux status line: removes control characters and doubles '#' (format prefix).
+func TmuxEscape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.Replace(s, "#", "##", -1)
+}
+
+// Print track playing by the running player.
+func CmdNow(args []string) {
+	fs := flag.NewFlagSet("now", flag.ExitOnError)
+	tmux := fs.Bool("tmux", false, "Compact escaped output for tmux status line, empty if player isn't running.")
+	max := fs.Int("max", 40, "Max length of tmux output.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	status, err := QueryStatus(NOW_TIMEOUT)
+	if *tmux {
+		if err != nil {
+			// Keep status line clean.
+			return
+		}
+		s := go101o.ConsoleText(status.Artist + " - " + status.Title)
+		if status.Status == "pause" {
+			s = "⏸ " + s
+		}
+		fmt.Println(TmuxEscape(Truncate(s, *max)))
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s (%s, %s left)\n", go101o.ConsoleText(fmt.Sprintf("%s - %s [%s]", status.Artist, status.Title, status.Channel)), status.Status, FormatTime(uint64(status.Remaining)))
+	if status.Next != nil {
+		fmt.Println(status.Next.String())
+	}
+	for _, link := range status.Links {
+		fmt.Printf("%s: %s\n", link.Name, link.URL)
+	}
+	if status.BufferedBytes > 0 || status.Underruns > 0 {
+		fmt.Printf("Buffer: %d KB, underruns: %d\n", status.BufferedBytes/1024, status.Underruns)
+	}
+}
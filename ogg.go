@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Ogg page header flags.
+const (
+	OGG_CONTINUED = 0x01
+	OGG_BOS       = 0x02
+	OGG_EOS       = 0x04
+)
+
+// CRC lookup table of Ogg (polynomial 0x04c11db7, not reflected).
+var oggCrcTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+// Writer of single logical Ogg stream, each packet is written to own page.
+type go101OggWriter struct {
+	w      io.Writer
+	serial uint32
+	seq    uint32
+}
+
+func NewOggWriter(w io.Writer, serial uint32) *go101OggWriter {
+	return &go101OggWriter{w: w, serial: serial}
+}
+
+// Writes packet as a page with given granule position and flags.
+func (o *go101OggWriter) WritePacket(packet []byte, granule uint64, flags byte) error {
+	// Lacing values: 255 for each full segment, then the rest (possibly 0).
+	segments := make([]byte, 0, len(packet)/255+1)
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+	page := make([]byte, 27+len(segments)+len(packet))
+	copy(page, "OggS")
+	page[4] = 0
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	binary.LittleEndian.PutUint32(page[14:], o.serial)
+	binary.LittleEndian.PutUint32(page[18:], o.seq)
+	page[26] = byte(len(segments))
+	copy(page[27:], segments)
+	copy(page[27+len(segments):], packet)
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCrcTable[byte(crc>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(page[22:], crc)
+	o.seq++
+	_, err := o.w.Write(page)
+	return err
+}
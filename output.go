@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Backend writing raw stream to a file or stdout instead of playing it. Tracks are appended one after another,
+// concatenated MP3 is still valid MP3. Useful for piping into sox/ffmpeg or machines without audio hardware.
+type go101OutputBackend struct {
+	Writer io.WriteCloser
+	// Re-encodes stream to Ogg Opus, if set.
+	Encoder *go101OpusEncoder
+
+	mux     sync.Mutex
+	isMuted bool
+	source  io.Closer
+}
+
+// Output encodings.
+const (
+	ENCODE_NONE = ""
+	ENCODE_OPUS = "opus"
+)
+
+// Returns output backend by spec: "file:/path/out.mp3" or "-" for stdout. Stream is written as is
+// or re-encoded to Ogg Opus with given bitrate (kbps). Files *.opus and *.ogg are always re-encoded.
+func NewOutputBackend(spec, encode string, kbps int) (*go101OutputBackend, error) {
+	b := &go101OutputBackend{}
+	switch {
+	case spec == "-":
+		// Stdout is taken by the stream, player messages go to stderr.
+		b.Writer = os.Stdout
+		os.Stdout = os.Stderr
+	case strings.HasPrefix(spec, "file:"):
+		filename := strings.TrimPrefix(spec, "file:")
+		if strings.HasSuffix(filename, ".opus") || strings.HasSuffix(filename, ".ogg") {
+			encode = ENCODE_OPUS
+		}
+		flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if encode == ENCODE_OPUS {
+			// Ogg stream can't be continued.
+			flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		}
+		file, err := os.OpenFile(filename, flags, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open output: %s", err.Error())
+		}
+		b.Writer = file
+	default:
+		return nil, fmt.Errorf("wrong output %s, expected file:/path or -", spec)
+	}
+	switch encode {
+	case ENCODE_NONE:
+	case ENCODE_OPUS:
+		enc, err := NewOpusEncoder(b.Writer, kbps)
+		if err != nil {
+			return nil, err
+		}
+		b.Encoder = enc
+	default:
+		return nil, fmt.Errorf("unknown encoding %s", encode)
+	}
+	return b, nil
+}
+
+func (b *go101OutputBackend) Play(url string) error {
+	var source io.ReadCloser
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		resp, err := http.Get(url)
+		if err != nil {
+			return err
+		}
+		if err = CheckStatus(resp); err != nil {
+			_ = resp.Body.Close()
+			return fmt.Errorf("couldn't open stream: %w", err)
+		}
+		source = resp.Body
+	} else {
+		file, err := os.Open(url)
+		if err != nil {
+			return err
+		}
+		source = file
+	}
+	b.mux.Lock()
+	b.source = source
+	b.mux.Unlock()
+	go Safe("output", func() {
+		defer func() {
+			_ = source.Close()
+		}()
+		var err error
+		if b.Encoder != nil {
+			err = b.Encoder.Transcode(source, b.muted)
+		} else {
+			_, err = io.Copy(b, source)
+		}
+		if err != nil {
+			Debug("Output stopped: %s", err)
+		}
+	})
+	return nil
+}
+
+// Writes stream data, data is dropped while muted (paused).
+func (b *go101OutputBackend) Write(p []byte) (int, error) {
+	if b.muted() {
+		return ioutil.Discard.Write(p)
+	}
+	return b.Writer.Write(p)
+}
+
+func (b *go101OutputBackend) muted() bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.isMuted
+}
+
+func (b *go101OutputBackend) Mute() {
+	b.mux.Lock()
+	b.isMuted = true
+	b.mux.Unlock()
+}
+
+func (b *go101OutputBackend) Unmute() {
+	b.mux.Lock()
+	b.isMuted = false
+	b.mux.Unlock()
+}
+
+func (b *go101OutputBackend) Stop() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.source != nil {
+		_ = b.source.Close()
+		b.source = nil
+	}
+}
+
+func (b *go101OutputBackend) Close() {
+	b.Stop()
+	if b.Encoder != nil {
+		_ = b.Encoder.Close()
+	}
+	_ = b.Writer.Close()
+}
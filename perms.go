@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// Permissions of files and directories created in config and cache: history, credentials and control
+	// socket are private to the user.
+	PRIVATE_FILE_PERM os.FileMode = 0600
+	PRIVATE_DIR_PERM  os.FileMode = 0700
+)
+
+// Makes config, cache and log files private, ex: created by older versions or copied with default umask.
+// Only access of group and others is removed. Symlinks aren't followed.
+func HardenPermissions() {
+	paths := []string{GetConfigDir(), GetCacheDir()}
+	if portableDir != "" && configDirOverride == "" && cacheDirOverride == "" {
+		paths = []string{portableDir}
+	}
+	if go101o.Config.PlayLog != nil && go101o.Config.PlayLog.Path != "" {
+		paths = append(paths, go101o.Config.PlayLog.Path)
+	}
+	repaired := 0
+	for _, root := range paths {
+		_ = filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil || fi.Mode()&os.ModeSymlink != 0 || fi.Mode().Perm()&0077 == 0 {
+				return nil
+			}
+			perm := fi.Mode().Perm() &^ 0077
+			if fi.IsDir() {
+				perm = PRIVATE_DIR_PERM
+			}
+			if err = os.Chmod(path, perm); err != nil {
+				// File system without permissions (ex: FAT of USB stick in portable mode), skip the rest.
+				log.Println("Couldn't fix permissions: ", err.Error())
+				return err
+			}
+			Debug("permissions of %s fixed: %s -> %s", path, fi.Mode().Perm(), perm)
+			repaired++
+			return nil
+		})
+	}
+	if repaired > 0 {
+		log.Printf("Permissions of %d files were fixed, they were accessible by other users", repaired)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Player status guarded against concurrent changes: hotkeys, MPRIS, control socket and the fetch loop
+// drive the player from different goroutines. Zero value is the stopped player.
+type go101PlayerState struct {
+	// Serializes stream start and stop, taken before mux.
+	stream sync.Mutex
+	// Stream is started and not stopped yet.
+	streaming bool
+	// Serializes transitions together with their backend calls.
+	mux    sync.Mutex
+	status uint64
+	// Pause requested while stopped, the next stream starts muted.
+	muted bool
+	// Track is restricted by profile and kept muted, guarded by mux.
+	restricted bool
+
+	// Guards track and channel fields of the player. The fetch loop is their only writer, so it reads them
+	// without the lock, other goroutines use accessors and pass changes to the loop by Exec.
+	data sync.RWMutex
+	// Local file is played instead of the stream: channel preview or cached track replay. Guarded by data.
+	previewing bool
+	replaying  bool
+	// Position of the favorite channel switched to last, guarded by data.
+	favorite int
+}
+
+// Allowed transitions: play of the started stream, pause and resume of the playing one, stop from any status.
+var statusTransitions = map[uint64]map[uint64]bool{
+	STATUS_STOP:  {STATUS_PLAY: true, STATUS_PAUSE: true},
+	STATUS_PLAY:  {STATUS_PAUSE: true, STATUS_STOP: true},
+	STATUS_PAUSE: {STATUS_PLAY: true, STATUS_STOP: true},
+}
+
+// Returns current player status.
+func (p *go101) Status() uint64 {
+	if status := atomic.LoadUint64(&p.state.status); status != 0 {
+		return status
+	}
+	return STATUS_STOP
+}
+
+// Checks if player is paused or the next stream starts muted.
+func (p *go101) Muted() bool {
+	p.state.mux.Lock()
+	defer p.state.mux.Unlock()
+	return p.state.muted || p.Status() == STATUS_PAUSE
+}
+
+// Changes status, the lock must be held. Disallowed transitions are refused as a bug.
+func (p *go101) setStatus(to uint64) {
+	from := p.Status()
+	if from == to {
+		return
+	}
+	if !statusTransitions[from][to] {
+		log.Printf("Couldn't change player status from %s to %s", StatusName(from), StatusName(to))
+		return
+	}
+	atomic.StoreUint64(&p.state.status, to)
+}
+
+// Notifies of the status change, must be called without the lock: listeners read the status.
+func (p *go101) statusChanged(from uint64) {
+	if p.Status() == from {
+		return
+	}
+	p.Scheduler.StatusChanged()
+	p.Emit(EVENT_STATUS)
+}
+
+// Moves player to play once the stream started, or to pause requested before.
+func (p *go101) Started() {
+	p.state.mux.Lock()
+	from := p.Status()
+	if from == STATUS_PAUSE || from == STATUS_STOP && p.state.muted {
+		p.Backend.Mute()
+		p.setStatus(STATUS_PAUSE)
+		Debug("Pause sig.")
+	} else {
+		if p.state.restricted {
+			// Track restricted by profile, keep it muted but playing to not break track change detection.
+			p.Backend.Mute()
+			Debug("Restricted track muted.")
+		}
+		p.setStatus(STATUS_PLAY)
+		Debug("Play sig.")
+	}
+	p.state.muted = false
+	p.state.mux.Unlock()
+	p.statusChanged(from)
+}
+
+// Pause playing. Pause of the stopped player applies to the next stream. Returns false if already paused.
+func (p *go101) Pause() bool {
+	p.state.mux.Lock()
+	from := p.Status()
+	changed := false
+	switch from {
+	case STATUS_STOP:
+		changed = !p.state.muted
+		p.state.muted = true
+	case STATUS_PLAY:
+		// Since we plays music from online radio station, it make sense to just mute sound.
+		// At the resume signal we will continue from actual moment of station playing.
+		if b := p.pauseBackend(); b != nil {
+			// Replay of local file continues from the same position instead.
+			if err := b.SetPaused(true); err != nil {
+				Debug("%s", err)
+			}
+		} else {
+			p.Backend.Mute()
+		}
+		p.setStatus(STATUS_PAUSE)
+		changed = true
+	}
+	p.state.mux.Unlock()
+	if changed {
+		Debug("Pause sig.")
+	}
+	p.statusChanged(from)
+	return changed
+}
+
+// Resume playing. Resume of the stopped player cancels pause of the next stream. Returns false if not paused.
+func (p *go101) Resume() bool {
+	p.state.mux.Lock()
+	from := p.Status()
+	changed := false
+	switch from {
+	case STATUS_STOP:
+		changed = p.state.muted
+		p.state.muted = false
+	case STATUS_PAUSE:
+		// See go101.Pause()
+		if b := p.pauseBackend(); b != nil {
+			if err := b.SetPaused(false); err != nil {
+				Debug("%s", err)
+			}
+		} else if !p.state.restricted {
+			p.Backend.Unmute()
+		}
+		p.setStatus(STATUS_PLAY)
+		changed = true
+	}
+	p.state.mux.Unlock()
+	if changed {
+		Debug("Resume sig.")
+	}
+	p.statusChanged(from)
+	return changed
+}
+
+// Returns backend able to pause the local file being replayed, nil if it's live stream or backend can't pause.
+func (p *go101) pauseBackend() go101PauseBackend {
+	if !p.Replaying() {
+		return nil
+	}
+	b, _ := BaseBackend(p.Backend).(go101PauseBackend)
+	return b
+}
+
+// Stop playing. Pause is kept for the next stream. Waits for the stream being started, so it's stopped too.
+func (p *go101) Stop() {
+	p.state.stream.Lock()
+	defer p.state.stream.Unlock()
+	p.state.mux.Lock()
+	from := p.Status()
+	// Stop is idempotent, backend is stopped regardless of the status.
+	p.Backend.Stop()
+	p.state.streaming = false
+	if from != STATUS_STOP {
+		p.state.muted = from == STATUS_PAUSE
+		p.setStatus(STATUS_STOP)
+	}
+	p.state.mux.Unlock()
+	Debug("Stop sig.")
+	p.statusChanged(from)
+}
+
+// Marks track restricted by profile: mutes it if playing, unmutes allowed one.
+func (p *go101) Restrict(restricted bool) {
+	p.state.mux.Lock()
+	defer p.state.mux.Unlock()
+	p.state.restricted = restricted
+	if p.Status() != STATUS_PLAY {
+		// Started and Resume take care of the rest.
+		return
+	}
+	if restricted {
+		p.Backend.Mute()
+	} else {
+		p.Backend.Unmute()
+	}
+}
+
+// Checks if the current track is restricted by profile.
+func (p *go101) Restricted() bool {
+	p.state.mux.Lock()
+	defer p.state.mux.Unlock()
+	return p.state.restricted
+}
+
+// Returns the current track.
+func (p *go101) Track() go101TrackInfo {
+	p.state.data.RLock()
+	defer p.state.data.RUnlock()
+	return p.CurrentTrack
+}
+
+// Returns ID of the current channel.
+func (p *go101) ChannelId() uint64 {
+	p.state.data.RLock()
+	defer p.state.data.RUnlock()
+	return p.CurrentChannel
+}
+
+// Returns ID of the current group.
+func (p *go101) GroupId() uint64 {
+	p.state.data.RLock()
+	defer p.state.data.RUnlock()
+	return p.CurrentGroup
+}
+
+// Returns the current channel.
+func (p *go101) Channel() go101Channel {
+	p.state.data.RLock()
+	defer p.state.data.RUnlock()
+	return p.ChannelGroups[p.CurrentGroup].Channels[p.CurrentChannel]
+}
+
+// Checks if channel preview is playing.
+func (p *go101) Previewing() bool {
+	p.state.data.RLock()
+	defer p.state.data.RUnlock()
+	return p.state.previewing
+}
+
+// Checks if cached track replay is playing.
+func (p *go101) Replaying() bool {
+	p.state.data.RLock()
+	defer p.state.data.RUnlock()
+	return p.state.replaying
+}
+
+func (p *go101) setPreviewing(previewing bool) {
+	p.state.data.Lock()
+	p.state.previewing = previewing
+	p.state.data.Unlock()
+}
+
+func (p *go101) setReplaying(replaying bool) {
+	p.state.data.Lock()
+	p.state.replaying = replaying
+	p.state.data.Unlock()
+}
+
+// Returns position of the favorite channel switched to last, 0 if none.
+func (p *go101) FavoriteCursor() int {
+	p.state.data.RLock()
+	defer p.state.data.RUnlock()
+	return p.state.favorite
+}
+
+func (p *go101) setFavoriteCursor(pos int) {
+	p.state.data.Lock()
+	p.state.favorite = pos
+	p.state.data.Unlock()
+}
+
+// Sets the current channel and forgets the played track, so the channel's track is played even if it's the same.
+// Must be called by the fetch loop or before it starts.
+func (p *go101) setChannel(cid uint64) {
+	p.state.data.Lock()
+	p.CurrentGroup = p.ChannelGroup(cid)
+	p.CurrentChannel = cid
+	p.TrackUid, p.PlayingURL = 0, ""
+	p.state.data.Unlock()
+}
+
+// Runs fn by the fetch loop: before the next fetch or during the wait. Player fields owned by the loop are
+// changed this way, so the loop reads them without the lock.
+func (p *go101) Exec(fn func()) {
+	p.Scheduler.request(fn)
+}
+
+// Makes the fetch loop play the current track again: after reconnect, replay, system resume, etc.
+func (p *go101) RestartTrack() {
+	p.Exec(func() {
+		p.state.data.Lock()
+		p.TrackUid, p.PlayingURL = 0, ""
+		p.state.data.Unlock()
+	})
+	p.Scheduler.Wake()
+}
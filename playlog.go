@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	PLAYLOG_MAX_MB = 10
+	PLAYLOG_KEEP   = 5
+)
+
+// JSON Lines log of player events, for ingestion into Loki, Elasticsearch, etc.
+type go101PlayLogConfig struct {
+	// Log file, cache/play.jsonl by default.
+	Path string `json:"path"`
+	// File is rotated after that size.
+	MaxMb int `json:"max_mb"`
+	// Number of rotated files to keep.
+	Keep int `json:"keep"`
+}
+
+// Play log record.
+type go101PlayLogRecord struct {
+	Time      string `json:"time"`
+	Event     string `json:"event"`
+	Status    string `json:"status"`
+	ChannelId uint64 `json:"channel_id"`
+	Channel   string `json:"channel"`
+	TrackUid  uint64 `json:"track_uid,omitempty"`
+	Artist    string `json:"artist,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Album     string `json:"album,omitempty"`
+	// Track duration in seconds.
+	Duration uint64 `json:"duration,omitempty"`
+	// Seconds passed since the previous event.
+	Elapsed float64 `json:"elapsed"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Rotated log file.
+type go101PlayLog struct {
+	mux    sync.Mutex
+	config go101PlayLogConfig
+	last   time.Time
+}
+
+// Returns default path of the play log.
+func GetPlayLogFile() string {
+	ps := string(os.PathSeparator)
+	return GetRuntimeDir() + ps + "play.jsonl"
+}
+
+// Appends all player events to the play log.
+func (p *go101) InitPlayLog() {
+	c := *p.Config.PlayLog
+	if c.Path == "" {
+		c.Path = GetPlayLogFile()
+	}
+	if c.MaxMb <= 0 {
+		c.MaxMb = PLAYLOG_MAX_MB
+	}
+	if c.Keep <= 0 {
+		c.Keep = PLAYLOG_KEEP
+	}
+	l := &go101PlayLog{config: c, last: time.Now()}
+	p.Subscribe(func(e go101Event) {
+		if err := l.Write(e); err != nil {
+			log.Println("Couldn't write play log: ", err.Error())
+		}
+	})
+}
+
+// Writes event to the log.
+func (l *go101PlayLog) Write(e go101Event) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	r := go101PlayLogRecord{
+		Time:      e.Time.Format(time.RFC3339Nano),
+		Event:     e.Type,
+		Status:    StatusName(e.Status),
+		ChannelId: e.Channel.Id,
+		Channel:   e.Channel.Title,
+		TrackUid:  e.Track.TrackUid,
+		Artist:    e.Track.Artist,
+		Title:     e.Track.Title,
+		Album:     e.Track.Album,
+		Elapsed:   e.Time.Sub(l.last).Seconds(),
+		Error:     e.Error,
+	}
+	if e.Track.Finish > e.Track.Start {
+		r.Duration = e.Track.Finish - e.Track.Start
+	}
+	l.last = e.Time
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err = l.rotate(); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, PRIVATE_FILE_PERM)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	_, err = file.Write(append(raw, '\n'))
+	return err
+}
+
+// Rotates log if it's too big: play.jsonl -> play.jsonl.1.gz -> play.jsonl.2.gz ...
+func (l *go101PlayLog) rotate() error {
+	fi, err := os.Stat(l.config.Path)
+	if err != nil || fi.Size() < int64(l.config.MaxMb)*1024*1024 {
+		return nil
+	}
+	_ = os.Remove(fmt.Sprintf("%s.%d.gz", l.config.Path, l.config.Keep))
+	for i := l.config.Keep - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d.gz", l.config.Path, i), fmt.Sprintf("%s.%d.gz", l.config.Path, i+1))
+	}
+	if err = os.Rename(l.config.Path, l.config.Path+".1"); err != nil {
+		return err
+	}
+	return CompressFile(l.config.Path + ".1")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const PREVIEW_DURATION = 10 * time.Second
+
+// Plays current track of the channel for a short time without switching to it. Used by the channel picker,
+// before the fetch loop starts playing.
+func (p *go101) Preview(cid uint64, d time.Duration) error {
+	trackInfo, err := p.Provider.FetchTrackOnAir(cid)
+	if err != nil {
+		return err
+	}
+	preview := go101{Provider: p.Provider, Config: p.Config}
+	if err = preview.ApplyTrackInfo(cid, trackInfo); err != nil {
+		return err
+	}
+
+	p.setPreviewing(true)
+	defer p.setPreviewing(false)
+	fmt.Printf("Preview: %s\n", p.ConsoleText(preview.CurrentTrack.Artist+" - "+preview.CurrentTrack.Title))
+	p.Stop()
+	if err = p.PlayTrack(preview.CurrentTrack); err != nil {
+		return err
+	}
+	time.Sleep(d)
+	p.Stop()
+	return nil
+}
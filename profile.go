@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// Applies profile settings: volume, hotkeys and notifiers.
+func (p *go101) ApplyProfile() {
+	if p.Profile == nil {
+		return
+	}
+	if p.Profile.Volume > 0 {
+		_, setVolume := p.VolumeControl()
+		if err := setVolume(p.Profile.Volume); err != nil {
+			log.Println(err)
+		}
+	}
+	ReloadHotkeys()
+	if err := p.SetNotifiers(); err != nil {
+		log.Println(err)
+	}
+}
+
+// Switches profile at runtime. Switches channel if profile has default one or current channel is restricted.
+// The switch is done by the fetch loop, its errors are logged.
+func (p *go101) SwitchProfile(name string) error {
+	profile, err := p.Config.Profile(name)
+	if err != nil {
+		return err
+	}
+	p.Exec(func() {
+		if err := p.switchProfile(profile); err != nil {
+			log.Println("Couldn't switch profile: ", err.Error())
+		}
+	})
+	p.Scheduler.Wake()
+	return nil
+}
+
+// Switches profile, called by the fetch loop.
+func (p *go101) switchProfile(profile *go101Profile) error {
+	p.state.data.Lock()
+	p.Profile = profile
+	p.state.data.Unlock()
+	Debug("Profile %s activated", profile.Name)
+	p.ApplyProfile()
+	switch {
+	case profile.Channel != "":
+		cid, err := p.ResolveChannel(profile.Channel)
+		if err != nil {
+			return err
+		}
+		if err = p.EnsureChannel(cid); err != nil {
+			return err
+		}
+		if cid != p.CurrentChannel {
+			p.switchChannel(cid)
+		}
+	case profile.ChannelRestricted(p.CurrentChannel):
+		cid, ok := p.StepTarget(p.CurrentChannel, 1)
+		if !ok {
+			return fmt.Errorf("all channels of the group are restricted in profile %s", profile.Name)
+		}
+		p.switchChannel(cid)
+	default:
+		// Patterns might be changed, check current track again.
+		p.Restrict(profile.TrackRestricted(p.CurrentTrack))
+	}
+	return nil
+}
+
+// Returns active profile name.
+func (p *go101) ProfileName() string {
+	p.state.data.RLock()
+	defer p.state.data.RUnlock()
+	if p.Profile == nil {
+		return ""
+	}
+	return p.Profile.Name
+}
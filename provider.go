@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	PROVIDER_101RU = "101ru"
+	PROVIDER_MOCK  = "mock"
+)
+
+// Source of channel groups, channels and on-air track info.
+type Provider interface {
+	// Fetches channel groups (without channels).
+	FetchChannelGroups() (map[uint64]go101ChannelGroup, error)
+	// Fetches channels of the given group.
+	FetchChannels(group go101ChannelGroup) (map[uint64]go101Channel, error)
+	// Fetches info about the track currently playing on the channel.
+	FetchTrackOnAir(channel uint64) (*TrackInfo, error)
+	// Fetches today's program schedule of the channel, empty if the channel has none.
+	FetchSchedule(channel uint64) ([]go101Program, error)
+	// Calls changed with track ID on every track change of the channel until stop is closed.
+	// Returns errNoPush if provider can't push track changes.
+	WatchTrackOnAir(channel uint64, stop <-chan struct{}, changed func(uid uint64)) error
+}
+
+// Provider that scrapes the site and calls the API of 101.ru (or any server mimicking it).
+type go101ruProvider struct {
+	BaseUrl string
+}
+
+// Provider description, used by help and man page.
+type go101ProviderInfo struct {
+	Name string
+	Desc string
+}
+
+var providers = []go101ProviderInfo{
+	{PROVIDER_101RU, "Scrapes 101.ru site and API (default)."},
+	{PROVIDER_MOCK, "Fake in-process 101.ru server with silent tracks, for testing without network."},
+}
+
+// Returns provider by name.
+func NewProvider(name string) (Provider, error) {
+	switch name {
+	case PROVIDER_101RU:
+		return &go101ruProvider{"https://101.ru"}, nil
+	case PROVIDER_MOCK:
+		return NewMockProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %s", name)
+	}
+}
+
+// Fetches channel groups from the top page.
+func (p *go101ruProvider) FetchChannelGroups() (map[uint64]go101ChannelGroup, error) {
+	groups := make(map[uint64]go101ChannelGroup)
+
+	doc, err := p.document(p.BaseUrl + "/radio-top")
+	if err != nil {
+		return nil, err
+	}
+	doc.Find("ul.full.list.menu li").Each(func(i int, selection *goquery.Selection) {
+		title := selection.Find("a").Text()
+		href, exists := selection.Find("a").Attr("href")
+		if exists {
+			id, _ := strconv.ParseUint(path.Base(href), 0, 64)
+			channels := make(map[uint64]go101Channel, 0)
+			groups[id] = go101ChannelGroup{
+				id, title, channels,
+			}
+		}
+	})
+	return groups, nil
+}
+
+// Fetches and parses HTML page.
+func (p *go101ruProvider) document(url string) (*goquery.Document, error) {
+	body, err := CachedGet(url)
+	if err != nil {
+		return nil, err
+	}
+	return goquery.NewDocumentFromReader(bytes.NewReader(body))
+}
+
+// Fetches channels from the group page.
+func (p *go101ruProvider) FetchChannels(group go101ChannelGroup) (map[uint64]go101Channel, error) {
+	channels := make(map[uint64]go101Channel)
+
+	doc, err := p.document(fmt.Sprintf("%s/radio-group/group/%d", p.BaseUrl, group.Id))
+	if err != nil {
+		return nil, err
+	}
+	doc.Find("ul.list.list-channels li").Each(func(i int, selection *goquery.Selection) {
+		title := selection.Find("a").Find(".h3").Text()
+		href, exists := selection.Find("a").Attr("href")
+		if exists {
+			cid, _ := strconv.ParseUint(path.Base(href), 0, 64)
+			genres := make([]string, 0)
+			selection.Find(".genre a, .tags a").Each(func(i int, genre *goquery.Selection) {
+				if g := strings.TrimSpace(genre.Text()); g != "" {
+					genres = append(genres, g)
+				}
+			})
+			description := strings.TrimSpace(selection.Find(".text, .description").First().Text())
+			logo, _ := selection.Find("img").Attr("src")
+			if strings.HasPrefix(logo, "/") {
+				logo = p.BaseUrl + logo
+			}
+			channels[cid] = go101Channel{
+				cid, title, genres, description, logo,
+			}
+		}
+	})
+	return channels, nil
+}
+
+// Fetches track info from the getTrackOnAir API method.
+func (p *go101ruProvider) FetchTrackOnAir(channel uint64) (*TrackInfo, error) {
+	playlistUrl := fmt.Sprintf("%s/api/channel/getTrackOnAir/%d/channel/?dataFormat=json", p.BaseUrl, channel)
+	b, err := CachedGet(playlistUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	var trackInfo TrackInfo
+	err = json.Unmarshal(b, &trackInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &trackInfo, nil
+}
+
+// Fetches program schedule from the channel schedule page. Times on the page are Moscow ones.
+func (p *go101ruProvider) FetchSchedule(channel uint64) ([]go101Program, error) {
+	doc, err := p.document(fmt.Sprintf("%s/radio/channel/%d/schedule", p.BaseUrl, channel))
+	if err != nil {
+		var he *go101HttpError
+		if errors.As(err, &he) && he.Code == http.StatusNotFound {
+			// Most channels are music only, without programs.
+			return nil, nil
+		}
+		return nil, err
+	}
+	loc := ScheduleLocation()
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	programs := make([]go101Program, 0)
+	doc.Find("ul.schedule li").Each(func(i int, selection *goquery.Selection) {
+		minutes, err := parseClock(strings.TrimSpace(selection.Find(".time").Text()))
+		title := strings.TrimSpace(selection.Find(".title").Text())
+		if err != nil || title == "" {
+			return
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, loc)
+		// Schedule crosses midnight.
+		if n := len(programs); n > 0 && !start.After(programs[n-1].Start) {
+			day = day.AddDate(0, 0, 1)
+			start = start.AddDate(0, 0, 1)
+		}
+		programs = append(programs, go101Program{channel, start, title})
+	})
+	return programs, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http/httptest"
+)
+
+// Mock provider, works with the fake 101.ru server started in-process.
+// Uses the same scraping and parsing code as the real provider, so the whole fetch/play cycle may be
+// exercised without network access.
+type go101MockProvider struct {
+	*go101ruProvider
+	Fake   *go101FakeServer
+	Server *httptest.Server
+}
+
+// Starts fake server and returns provider bound to it.
+func NewMockProvider() *go101MockProvider {
+	fake := NewFakeServer()
+	server := httptest.NewServer(fake)
+	Debug("Fake 101.ru server started at %s", server.URL)
+	return &go101MockProvider{
+		&go101ruProvider{server.URL},
+		fake,
+		server,
+	}
+}
+
+// Shutdown fake server. Event streams never end by themselves, so connections are closed first.
+func (p *go101MockProvider) Close() {
+	p.Server.CloseClientConnections()
+	p.Server.Close()
+}
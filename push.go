@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	PUSH_BACKOFF_MIN = 2 * time.Second
+	PUSH_BACKOFF_MAX = 2 * time.Minute
+	// Connection lasted that long is considered healthy, so backoff is reset.
+	PUSH_HEALTHY_RUN = time.Minute
+)
+
+// Provider has no push channel for the channel, polling is the only way.
+var errNoPush = errors.New("push channel isn't available")
+
+// Client of event streams, without timeout of the whole request.
+var pushClient = &http.Client{}
+
+// Track change event of the web player event stream.
+type go101PushTrack struct {
+	Uid uint64 `json:"uid"`
+}
+
+// Reads server-sent events, calls handle with event type and data of each one.
+func ReadEvents(r io.Reader, handle func(event, data string)) error {
+	scanner := bufio.NewScanner(r)
+	var (
+		event string
+		data  []string
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// Blank line dispatches the event.
+			if len(data) > 0 {
+				if event == "" {
+					event = "message"
+				}
+				handle(event, strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// Comment, used as keepalive.
+		default:
+			field, value := line, ""
+			if i := strings.IndexByte(line, ':'); i >= 0 {
+				field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+			}
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// Listens to track change events of the channel, the ones web player gets, until stop is closed.
+// Returns errNoPush if the channel has no event stream.
+func (p *go101ruProvider) WatchTrackOnAir(channel uint64, stop <-chan struct{}, changed func(uid uint64)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	url := fmt.Sprintf("%s/api/channel/trackEvents/%d/", p.BaseUrl, channel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNotImplemented {
+		return errNoPush
+	}
+	if err = CheckStatus(resp); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return errNoPush
+	}
+	err = ReadEvents(resp.Body, func(event, data string) {
+		if event != "track" {
+			return
+		}
+		var track go101PushTrack
+		if err := json.Unmarshal([]byte(data), &track); err != nil {
+			Debug("Wrong track event %q: %s", data, err)
+			return
+		}
+		changed(track.Uid)
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// Wakes up the fetch loop on track changes pushed by the provider, so track line and notifications
+// don't lag the audio until the next poll. Polling goes on anyway, as a fallback. Runs forever.
+func (p *go101) PushLoop() {
+	backoff := PUSH_BACKOFF_MIN
+	for true {
+		cid := p.ChannelId()
+		if cid == 0 {
+			time.Sleep(time.Second)
+			continue
+		}
+		// Reconnect to the new channel on switch.
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			for p.ChannelId() == cid {
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Second):
+				}
+			}
+			close(stop)
+		}()
+		started := time.Now()
+		err := p.Provider.WatchTrackOnAir(cid, stop, func(uid uint64) {
+			if uid != p.Track().TrackUid {
+				Debug("Track %d pushed on channel %d", uid, cid)
+				p.Scheduler.Wake()
+			}
+		})
+		close(done)
+		switch {
+		case errors.Is(err, errNoPush):
+			Debug("No push channel for channel %d, polling only", cid)
+			for p.ChannelId() == cid {
+				time.Sleep(time.Second)
+			}
+			continue
+		case err == nil:
+			// Channel switched.
+			backoff = PUSH_BACKOFF_MIN
+			continue
+		}
+		if time.Since(started) > PUSH_HEALTHY_RUN {
+			backoff = PUSH_BACKOFF_MIN
+		}
+		Debug("Push channel of channel %d failed: %s, reconnect in %s", cid, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > PUSH_BACKOFF_MAX {
+			backoff = PUSH_BACKOFF_MAX
+		}
+	}
+}
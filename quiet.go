@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const QUIET_CHECK_INTERVAL = 30 * time.Second
+
+// Period of the day when volume is capped, ex: 22:00-07:00.
+type go101QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Max volume in percents during quiet hours.
+	Volume int `json:"volume"`
+}
+
+// Quiet hours runtime state. Changed by quiet hours loop, hotkeys, control commands and channel switch.
+type go101Quiet struct {
+	mux sync.Mutex
+	// Quiet hours disabled manually until that moment (end of the current quiet period).
+	OverrideUntil time.Time
+	// Volume before capping, restored at the end of quiet period.
+	SavedVolume int
+	Active      bool
+}
+
+// Parses "hh:mm" to minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("wrong time %s, expected hh:mm", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Checks if the moment is in quiet period and returns end of that period.
+func (q *go101QuietHours) At(now time.Time) (bool, time.Time) {
+	if q == nil {
+		return false, time.Time{}
+	}
+	return periodAt(q.Start, q.End, now)
+}
+
+// Checks if the moment is in "hh:mm" - "hh:mm" period of the day and returns end of that period. Clocks are
+// of the moment's zone, DST shifts don't move them.
+func periodAt(startClock, endClock string, now time.Time) (bool, time.Time) {
+	start, err := parseClock(startClock)
+	if err != nil {
+		return false, time.Time{}
+	}
+	end, err := parseClock(endClock)
+	if err != nil {
+		return false, time.Time{}
+	}
+	cur := now.Hour()*60 + now.Minute()
+	if start <= end {
+		// Period within one day, ex: 13:00-15:00.
+		if cur >= start && cur < end {
+			return true, clockOn(now, end)
+		}
+		return false, time.Time{}
+	}
+	// Period over midnight, ex: 22:00-07:00.
+	if cur >= start {
+		return true, clockOn(now.AddDate(0, 0, 1), end)
+	}
+	if cur < end {
+		return true, clockOn(now, end)
+	}
+	return false, time.Time{}
+}
+
+// Checks if quiet hours are in effect now. Notification sounds should be disabled while it's true.
+func (p *go101) IsQuiet() bool {
+	quiet, _ := p.Config.QuietHours.At(p.Config.Now())
+	p.Quiet.mux.Lock()
+	defer p.Quiet.mux.Unlock()
+	return quiet && time.Now().After(p.Quiet.OverrideUntil)
+}
+
+// Toggles manual override of the current quiet period. Override ends with the period.
+func (p *go101) ToggleQuietOverride() {
+	quiet, end := p.Config.QuietHours.At(p.Config.Now())
+	if !quiet {
+		return
+	}
+	p.Quiet.mux.Lock()
+	if time.Now().Before(p.Quiet.OverrideUntil) {
+		p.Quiet.OverrideUntil = time.Time{}
+		fmt.Println("Quiet hours re-engaged.")
+	} else {
+		p.Quiet.OverrideUntil = end
+		fmt.Printf("Quiet hours disabled until %s.\n", FormatClock(end))
+	}
+	p.Quiet.mux.Unlock()
+	p.ApplyQuietHours()
+}
+
+// Caps volume at quiet hours start and restores it at the end. Runs forever.
+func (p *go101) QuietHoursLoop() {
+	for true {
+		p.ApplyQuietHours()
+		time.Sleep(QUIET_CHECK_INTERVAL)
+	}
+}
+
+// Enforces quiet hours volume cap. Volume is forgotten by Reset if it's changed on purpose. Backend volume is
+// capped if it has own one (mpv, gstreamer), so other programs keep theirs, system mixer volume otherwise.
+func (p *go101) ApplyQuietHours() {
+	quiet := p.IsQuiet()
+	get, set := p.VolumeControl()
+	p.Quiet.mux.Lock()
+	defer p.Quiet.mux.Unlock()
+	if quiet {
+		volume, err := get()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if !p.Quiet.Active {
+			p.Quiet.Active = true
+			p.Quiet.SavedVolume = volume
+			Debug("Quiet hours started, volume %d%%", volume)
+		}
+		if volume > p.Config.QuietHours.Volume {
+			if err = set(p.Config.QuietHours.Volume); err != nil {
+				log.Println(err)
+			}
+		}
+	} else if p.Quiet.Active {
+		p.Quiet.Active = false
+		Debug("Quiet hours finished, restore volume %d%%", p.Quiet.SavedVolume)
+		if err := set(p.Quiet.SavedVolume); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Forgets volume saved at quiet hours start: volume is set on purpose, ApplyQuietHours caps the new one.
+func (q *go101Quiet) Reset() {
+	q.mux.Lock()
+	q.Active = false
+	q.mux.Unlock()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_RATE_PER_MINUTE = 60
+	DEFAULT_RATE_BURST      = 10
+	DEFAULT_POLL_MIN        = 5
+	DEFAULT_POLL_MAX        = 1800
+	DEFAULT_POLL_JITTER     = 2
+	// Max interval between retries of failed fetches.
+	POLL_ERROR_MAX = 60
+)
+
+// Polling of track info and provider requests rate.
+type go101PollingConfig struct {
+	// Provider requests limit, all requests above are delayed.
+	RatePerMinute int `json:"rate_per_minute"`
+	// Requests allowed at once over the rate.
+	Burst int `json:"burst"`
+	// Floor and ceiling of the interval between track info fetches, seconds.
+	MinSeconds uint64 `json:"min_seconds"`
+	MaxSeconds uint64 `json:"max_seconds"`
+	// Random delay up to that many seconds added to every interval, so many players don't poll in sync.
+	JitterSeconds uint64 `json:"jitter_seconds"`
+}
+
+// Token bucket limiter of provider requests.
+type go101RateLimiter struct {
+	mux      sync.Mutex
+	interval time.Duration
+	burst    int
+	tokens   float64
+	last     time.Time
+
+	requests  uint64
+	throttled uint64
+}
+
+// Limiter of all provider requests, reconfigured from config on start.
+var rateLimiter = NewRateLimiter(DEFAULT_RATE_PER_MINUTE, DEFAULT_RATE_BURST)
+
+func init() {
+	// Players started at the same moment shouldn't get the same jitter.
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Returns limiter allowing perMinute requests and bursts of burst requests.
+func NewRateLimiter(perMinute, burst int) *go101RateLimiter {
+	if perMinute <= 0 {
+		perMinute = DEFAULT_RATE_PER_MINUTE
+	}
+	if burst <= 0 {
+		burst = DEFAULT_RATE_BURST
+	}
+	return &go101RateLimiter{
+		interval: time.Minute / time.Duration(perMinute),
+		burst:    burst,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Waits until request is allowed.
+func (l *go101RateLimiter) Wait() {
+	l.mux.Lock()
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+	l.tokens--
+	l.requests++
+	var delay time.Duration
+	if l.tokens < 0 {
+		// Token is borrowed, wait till it's refilled.
+		delay = time.Duration(-l.tokens * float64(l.interval))
+		l.throttled++
+	}
+	l.mux.Unlock()
+	if delay > 0 {
+		Debug("Request rate limit reached, wait %s", delay)
+		time.Sleep(delay)
+	}
+}
+
+// Returns number of requests and number of delayed ones.
+func (l *go101RateLimiter) Stats() (uint64, uint64) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.requests, l.throttled
+}
+
+// Returns polling config with defaults applied.
+func (p *go101) PollingConfig() go101PollingConfig {
+	c := go101PollingConfig{JitterSeconds: DEFAULT_POLL_JITTER}
+	if p.Config != nil && p.Config.Polling != nil {
+		c = *p.Config.Polling
+	}
+	if c.MinSeconds == 0 {
+		c.MinSeconds = DEFAULT_POLL_MIN
+	}
+	if c.MaxSeconds < c.MinSeconds {
+		c.MaxSeconds = DEFAULT_POLL_MAX
+	}
+	return c
+}
+
+// Clamps fetch interval to the configured floor and ceiling and adds jitter.
+func (p *go101) PollInterval(s uint64) uint64 {
+	c := p.PollingConfig()
+	if s < c.MinSeconds {
+		s = c.MinSeconds
+	}
+	if s > c.MaxSeconds {
+		s = c.MaxSeconds
+	}
+	if c.JitterSeconds > 0 {
+		s += uint64(rand.Int63n(int64(c.JitterSeconds) + 1))
+	}
+	return s
+}
+
+// Returns retry interval after consecutive failed fetches, doubled on every failure.
+func (p *go101) RetryInterval(failures int) uint64 {
+	s := p.PollingConfig().MinSeconds
+	for i := 1; i < failures && s < POLL_ERROR_MAX; i++ {
+		s *= 2
+	}
+	if s > POLL_ERROR_MAX {
+		s = POLL_ERROR_MAX
+	}
+	return p.PollInterval(s)
+}
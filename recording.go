@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	DEFAULT_RECORD_PATH = "{{.Artist}}/{{.Album}}/{{.Title}}.mp3"
+	// Bigger cover images are skipped.
+	COVER_MAX_SIZE = 5 * 1024 * 1024
+	// Max bytes of a path component, below NAME_MAX (255) to leave room for collision suffix and temp files.
+	RECORD_NAME_MAX = 200
+)
+
+// Per-track recording into tagged files.
+type go101RecordConfig struct {
+	// Directory of recorded files, ~/Music/101ply by default.
+	Dir string `json:"dir"`
+	// Path template relative to the directory, "{{.Artist}}/{{.Album}}/{{.Title}}.mp3" by default.
+	Path string `json:"path"`
+	// Don't embed cover image.
+	NoCover bool `json:"no_cover"`
+	// Record tracks recorded before again, replacing old files. By default they are skipped, as well as tracks
+	// with the same audio as recorded ones.
+	KeepLatest bool `json:"keep_latest"`
+	// Tag files with canonical metadata and MusicBrainz IDs found by AcoustID fingerprint.
+	Fingerprint *go101FingerprintConfig `json:"fingerprint"`
+}
+
+// Data available in record path templates, all fields are safe to use as file names.
+type go101RecordData struct {
+	Artist   string
+	Title    string
+	Album    string
+	Year     string
+	Channel  string
+	TrackUid uint64
+	// Recording date and time: "2006-01-02" and "15-04".
+	Date string
+	Time string
+}
+
+// Names reserved by Windows, files with them are inaccessible on FAT/NTFS drives.
+var reservedFileNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Returns directory of recorded files.
+func (c *go101RecordConfig) GetDir() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	if portableDir != "" {
+		return filepath.Join(portableDir, "recordings")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(GetCacheDir(), "recordings")
+	}
+	return filepath.Join(home, "Music", "101ply")
+}
+
+// Returns year part of album release date.
+func TrackYear(track go101TrackInfo) string {
+	if len(track.AlbumDate) >= 4 {
+		return track.AlbumDate[:4]
+	}
+	return ""
+}
+
+// Replaces characters not allowed in file names on Linux, Windows and macOS drives, so recordings
+// may be copied anywhere. Invalid UTF-8 is replaced too.
+func SafeFileName(s, fallback string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.ToValidUTF8(s, "_"))
+	// Leading dots would make hidden files or "..", trailing dots and spaces are dropped by Windows.
+	s = strings.TrimRight(strings.TrimLeft(strings.TrimSpace(s), "."), ". ")
+	if s == "" {
+		return fallback
+	}
+	base := s
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedFileNames[strings.ToUpper(base)] {
+		s = "_" + s
+	}
+	return s
+}
+
+// Shortens file name to max bytes, keeping extension and whole UTF-8 characters.
+func LimitFileName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) > max/2 {
+		ext = ""
+	}
+	base := name[:max-len(ext)]
+	for len(base) > 0 && !utf8.ValidString(base) {
+		base = base[:len(base)-1]
+	}
+	return strings.TrimRight(base, ". ") + ext
+}
+
+// Returns the file name, or the name with " (2)", " (3)"... suffix if the file exists. Own files are
+// returned as is, to be replaced.
+func UniqueFileName(filename string, own []string) string {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	name := filename
+	for i := 2; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		for _, path := range own {
+			if path == name {
+				return name
+			}
+		}
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// Returns path of the track file recorded at the given time.
+func (c *go101RecordConfig) TrackPath(track go101TrackInfo, channel go101Channel, at time.Time) (string, error) {
+	format := c.Path
+	if format == "" {
+		format = DEFAULT_RECORD_PATH
+	}
+	t, err := template.New("record").Parse(format)
+	if err != nil {
+		return "", fmt.Errorf("wrong record path: %s", err.Error())
+	}
+	d := go101RecordData{
+		Artist:   SafeFileName(track.Artist, "Unknown Artist"),
+		Title:    SafeFileName(track.Title, fmt.Sprintf("%d", track.TrackUid)),
+		Album:    SafeFileName(track.Album, "Unknown Album"),
+		Year:     SafeFileName(TrackYear(track), "0000"),
+		Channel:  SafeFileName(channel.Title, fmt.Sprintf("%d", channel.Id)),
+		TrackUid: track.TrackUid,
+		Date:     at.Format("2006-01-02"),
+		Time:     at.Format("15-04"),
+	}
+	var b strings.Builder
+	if err = t.Execute(&b, d); err != nil {
+		return "", fmt.Errorf("wrong record path: %s", err.Error())
+	}
+	parts := strings.Split(filepath.ToSlash(b.String()), "/")
+	for i := range parts {
+		parts[i] = LimitFileName(parts[i], RECORD_NAME_MAX)
+	}
+	dir := c.GetDir()
+	filename := filepath.Join(dir, filepath.FromSlash(strings.Join(parts, "/")))
+	if rel, err := filepath.Rel(dir, filename); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("record path %s is outside of %s", filename, dir)
+	}
+	return filename, nil
+}
+
+// Copies cached track to the recordings directory, with ID3 tags and cover image.
+func (p *go101) RecordTrack(track go101TrackInfo, channel go101Channel) error {
+	c := p.Config.Record
+	named := track
+	if p.Config.Translit != nil && p.Config.Translit.Filenames {
+		named = TranslitTrack(track)
+		channel.Title = Translit(channel.Title)
+	}
+	filename, err := c.TrackPath(named, channel, time.Now())
+	if err != nil {
+		return err
+	}
+	old, err := p.Recordings(track)
+	if err != nil {
+		return err
+	}
+	if len(old) > 0 && !c.KeepLatest {
+		Debug("Track %d is already recorded to %s", track.TrackUid, old[0])
+		return nil
+	}
+	// Other track with the same name, or file not made by the player.
+	filename = UniqueFileName(filename, old)
+	audio, err := ioutil.ReadFile(GetTrackCacheFile(track.TrackUid))
+	if err != nil {
+		return err
+	}
+	// Same audio uploaded under other ID and name.
+	if same := p.RecordedContent(ContentHash(audio)); same != "" && !c.KeepLatest {
+		Debug("Track %d has the same audio as %s", track.TrackUid, same)
+		return nil
+	}
+	tag := &go101ID3Tag{
+		Artist:   track.Artist,
+		Title:    track.Title,
+		Album:    track.Album,
+		Year:     TrackYear(track),
+		Grouping: channel.Title,
+	}
+	if c.Fingerprint != nil {
+		meta, err := c.Fingerprint.Lookup(GetTrackCacheFile(track.TrackUid))
+		if err != nil {
+			Debug("Couldn't fingerprint track %d: %s", track.TrackUid, err)
+		} else if meta != nil {
+			Debug("Track %d is %s - %s (%s)", track.TrackUid, meta.Artist, meta.Title, meta.RecordingMBID)
+			tag.ApplyAcoustID(meta)
+		}
+	}
+	if !c.NoCover && track.Cover != "" {
+		if tag.Cover, tag.CoverMime, err = LoadCover(track.Cover); err != nil {
+			// Track without cover is still worth recording.
+			Debug("Couldn't fetch cover of track %d: %s", track.TrackUid, err)
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Write(tag.Bytes())
+	buf.Write(StripID3(audio))
+	if err = WriteFileAtomic(filename, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	Debug("Track %d recorded to %s", track.TrackUid, filename)
+	if err = p.IndexRecording(filename, buf.Bytes()); err != nil {
+		return err
+	}
+	for _, path := range old {
+		if path != filename {
+			_ = os.Remove(path)
+			_, _ = p.DB.Exec(`DELETE FROM archive_files WHERE path = ?`, path)
+		}
+		if _, err = p.DB.Exec(`DELETE FROM recordings WHERE path = ?`, path); err != nil {
+			return err
+		}
+	}
+	_, err = p.DB.Exec(`INSERT OR REPLACE INTO recordings (track_uid, hash, path, recorded_at) VALUES (?, ?, ?, ?)`,
+		track.TrackUid, TrackHash(track), filename, time.Now().Unix())
+	return err
+}
+
+// Returns hash of normalized artist and title, same for the track uploaded to the provider more than once.
+func TrackHash(track go101TrackInfo) string {
+	s := strings.ToLower(strings.TrimSpace(track.Artist)) + "\x00" + strings.ToLower(strings.TrimSpace(track.Title))
+	return fmt.Sprintf("%x", sha1.Sum([]byte(s)))
+}
+
+// Returns files of earlier recordings of the track, by TrackUid or artist and title. Records of removed
+// files are forgotten, so the track is recorded again.
+func (p *go101) Recordings(track go101TrackInfo) ([]string, error) {
+	rows, err := p.DB.Query(`SELECT path FROM recordings WHERE track_uid = ? OR hash = ? ORDER BY recorded_at DESC`,
+		track.TrackUid, TrackHash(track))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err = rows.Scan(&path); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, path := range paths {
+		if _, err = os.Stat(path); err != nil {
+			_, _ = p.DB.Exec(`DELETE FROM recordings WHERE path = ?`, path)
+			continue
+		}
+		found = append(found, path)
+	}
+	return found, nil
+}
+
+// Downloads cover image, returns its data and MIME type.
+func FetchCover(url string) ([]byte, string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if err = CheckStatus(resp); err != nil {
+		return nil, "", err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, COVER_MAX_SIZE+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > COVER_MAX_SIZE {
+		return nil, "", fmt.Errorf("cover is bigger than %s", FormatSize(COVER_MAX_SIZE))
+	}
+	mime := http.DetectContentType(data)
+	if !strings.HasPrefix(mime, "image/") {
+		return nil, "", fmt.Errorf("cover isn't an image: %s", mime)
+	}
+	return data, mime, nil
+}
+
+// ID3v2.3 tag, the version most players and file managers understand.
+type go101ID3Tag struct {
+	Artist string
+	Title  string
+	Album  string
+	Year   string
+	// Stored as content group (TIT1), holds channel title.
+	Grouping  string
+	Cover     []byte
+	CoverMime string
+	// Stored as MusicBrainz unique file identifier (UFID).
+	RecordingMBID string
+	// User defined text frames (TXXX) by description.
+	Extra map[string]string
+}
+
+// Encodes the tag.
+func (t *go101ID3Tag) Bytes() []byte {
+	var frames bytes.Buffer
+	for _, f := range []struct{ id, value string }{
+		{"TPE1", t.Artist},
+		{"TIT2", t.Title},
+		{"TALB", t.Album},
+		{"TYER", t.Year},
+		{"TIT1", t.Grouping},
+	} {
+		if f.value != "" {
+			writeID3Frame(&frames, f.id, id3Text(f.value))
+		}
+	}
+	extra := make([]string, 0, len(t.Extra))
+	for desc, value := range t.Extra {
+		if value != "" {
+			extra = append(extra, desc)
+		}
+	}
+	sort.Strings(extra)
+	for _, desc := range extra {
+		b := id3Text(desc)
+		b = append(b, 0, 0)
+		// Value has own BOM, encoding byte is shared.
+		b = append(b, id3Text(t.Extra[desc])[1:]...)
+		writeID3Frame(&frames, "TXXX", b)
+	}
+	if t.RecordingMBID != "" {
+		writeID3Frame(&frames, "UFID", append([]byte("http://musicbrainz.org\x00"), t.RecordingMBID...))
+	}
+	if len(t.Cover) > 0 {
+		var b bytes.Buffer
+		// ISO-8859-1 MIME type, front cover picture type, empty description.
+		b.WriteByte(0)
+		b.WriteString(t.CoverMime)
+		b.Write([]byte{0, 3, 0})
+		b.Write(t.Cover)
+		writeID3Frame(&frames, "APIC", b.Bytes())
+	}
+	var b bytes.Buffer
+	b.Write([]byte{'I', 'D', '3', 3, 0, 0})
+	b.Write(synchsafe(uint32(frames.Len())))
+	b.Write(frames.Bytes())
+	return b.Bytes()
+}
+
+// Encodes text frame value as UTF-16 with BOM, ID3v2.3 has no UTF-8.
+func id3Text(s string) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{1, 0xFF, 0xFE})
+	for _, u := range utf16.Encode([]rune(s)) {
+		_ = binary.Write(&b, binary.LittleEndian, u)
+	}
+	return b.Bytes()
+}
+
+func writeID3Frame(w *bytes.Buffer, id string, data []byte) {
+	w.WriteString(id)
+	_ = binary.Write(w, binary.BigEndian, uint32(len(data)))
+	w.Write([]byte{0, 0})
+	w.Write(data)
+}
+
+// Encodes ID3 tag size, 7 bits per byte.
+func synchsafe(n uint32) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// Cuts ID3v2 tag from the beginning of the audio file, if any.
+func StripID3(audio []byte) []byte {
+	if len(audio) < 10 || string(audio[:3]) != "ID3" {
+		return audio
+	}
+	size := int(audio[6])<<21 | int(audio[7])<<14 | int(audio[8])<<7 | int(audio[9])
+	size += 10
+	// Footer is present.
+	if audio[5]&0x10 != 0 {
+		size += 10
+	}
+	if size > len(audio) {
+		return audio
+	}
+	return audio[size:]
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Lines of the play log tail included into report.
+	REPORT_LOG_LINES = 1000
+	// Most recent cached API responses included into report.
+	REPORT_RESPONSES = 20
+	REDACTED         = "REDACTED"
+)
+
+// Config keys holding secrets.
+var reSecretKey = regexp.MustCompile(`(?i)token|secret|password|passwd|^user$|auth|api_?key`)
+
+// Replaces secrets in JSON document: values of secret keys and paths/queries of URLs (ex: IFTTT key in path).
+func Redact(raw []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(redactValue("", doc), "", "\t")
+}
+
+func redactValue(key string, v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = redactValue(k, item)
+		}
+		return t
+	case []interface{}:
+		for i, item := range t {
+			t[i] = redactValue(key, item)
+		}
+		return t
+	case string:
+		if t == "" {
+			return t
+		}
+		if reSecretKey.MatchString(key) {
+			return REDACTED
+		}
+		if u, err := url.Parse(t); err == nil && u.Host != "" {
+			if u.User != nil || u.Path != "" && u.Path != "/" || u.RawQuery != "" {
+				return u.Scheme + "://" + u.Host + "/" + REDACTED
+			}
+		}
+		return t
+	}
+	return v
+}
+
+// Collects environment, configuration and cache details helping to reproduce issues into zip file.
+func (p *go101) Report(filename string) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, PRIVATE_FILE_PERM)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	zw := zip.NewWriter(f)
+	add := func(name string, data []byte) {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			log.Printf("Couldn't add %s to report: %s", name, err.Error())
+		}
+	}
+
+	raw, _ := json.MarshalIndent(VersionInfo(), "", "\t")
+	add("version.json", raw)
+	add("environment.txt", reportEnvironment())
+
+	// Configuration with secrets removed.
+	files := []string{GetConfigFile(), GetHotkeyConfig()}
+	if profiles, err := filepath.Glob(filepath.Join(GetProfilesDir(), "*.json")); err == nil {
+		files = append(files, profiles...)
+	}
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(GetConfigDir(), file)
+		if redacted, err := Redact(raw); err == nil {
+			add("config/"+filepath.ToSlash(rel), redacted)
+		} else {
+			add("config/"+filepath.ToSlash(rel)+".error", []byte(err.Error()))
+		}
+	}
+
+	// Logs and runtime state.
+	logFile := GetPlayLogFile()
+	if p.Config.PlayLog != nil && p.Config.PlayLog.Path != "" {
+		logFile = p.Config.PlayLog.Path
+	}
+	if tail, err := tailFile(logFile, REPORT_LOG_LINES); err == nil {
+		add("play.jsonl", tail)
+	}
+	if raw, err := ioutil.ReadFile(GetStateFile()); err == nil {
+		add("state.json", raw)
+	}
+	if status, err := QueryStatus(CONTROL_TIMEOUT); err == nil {
+		raw, _ := json.MarshalIndent(status, "", "\t")
+		add("status.json", raw)
+	}
+
+	// Cache metadata and last provider responses (they show parsing failures).
+	add("cache.txt", p.reportCache())
+	responses, _ := filepath.Glob(filepath.Join(GetHttpCacheDir(), "*.json.gz"))
+	sort.Slice(responses, func(i, j int) bool {
+		fi, _ := os.Stat(responses[i])
+		fj, _ := os.Stat(responses[j])
+		return fi != nil && fj != nil && fi.ModTime().After(fj.ModTime())
+	})
+	for i, file := range responses {
+		if i >= REPORT_RESPONSES {
+			break
+		}
+		raw, err := ReadCacheFile(strings.TrimSuffix(file, ".gz"))
+		if err != nil {
+			continue
+		}
+		entry := go101HttpCacheEntry{}
+		if json.Unmarshal(raw, &entry) != nil {
+			continue
+		}
+		add(fmt.Sprintf("responses/%02d.txt", i+1), append([]byte(entry.URL+"\n\n"), entry.Body...))
+	}
+	return zw.Close()
+}
+
+// Returns platform, session and audio tools info.
+func reportEnvironment() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Time: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Instance: %q\nPortable: %t\n", instance, portableDir != "")
+	for _, name := range []string{"DISPLAY", "WAYLAND_DISPLAY", "XDG_SESSION_TYPE", "XDG_CURRENT_DESKTOP", "LANG", "TERM", "NO_COLOR"} {
+		fmt.Fprintf(&buf, "%s=%s\n", name, os.Getenv(name))
+	}
+	fmt.Fprintf(&buf, "Session bus: %t\nSystem bus: %t\nSandbox: %s\n", SessionBusAvailable(), SystemBusAvailable(), Sandbox())
+	for _, tool := range []string{"pactl", "amixer", "mpg123"} {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			path = "not found"
+		}
+		fmt.Fprintf(&buf, "%s: %s\n", tool, path)
+	}
+	if out, err := exec.Command("uname", "-a").Output(); err == nil {
+		buf.Write(out)
+	}
+	return buf.Bytes()
+}
+
+// Returns cache files list and database tables size.
+func (p *go101) reportCache() []byte {
+	var buf bytes.Buffer
+	_ = filepath.Walk(GetCacheDir(), func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			rel, _ := filepath.Rel(GetCacheDir(), path)
+			fmt.Fprintf(&buf, "%-60s %10d %s\n", rel, fi.Size(), fi.ModTime().Format(time.RFC3339))
+		}
+		return nil
+	})
+	buf.WriteString("\n")
+	for _, table := range []string{"groups", "channels", "aliases", "favorites", "history", "hidden", "pinned_groups"} {
+		var count int
+		if err := p.DB.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count); err == nil {
+			fmt.Fprintf(&buf, "%s: %d rows\n", table, count)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Returns last n lines of the file.
+func tailFile(filename string, n int) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	lines := make([]string, 0, n)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(lines) == n {
+			lines = lines[1:]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), scanner.Err()
+}
+
+// Make bug report bundle.
+func CmdReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	out := fs.String("o", fmt.Sprintf("101ply-report-%s.zip", time.Now().Format("20060102-150405")), "Output file.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if err := go101o.Report(*out); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Report saved to %s. Secrets are removed from config, but review the file before attaching it to an issue.\n", *out)
+}
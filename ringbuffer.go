@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// Fixed size byte ring buffer. Writer blocks while buffer is full, reader blocks while it's empty.
+type go101RingBuffer struct {
+	mux    sync.Mutex
+	cond   *sync.Cond
+	buf    []byte
+	start  int
+	length int
+	closed bool
+	err    error
+	// Number of reads found buffer empty while writer was still active.
+	underruns uint64
+	// Total bytes written.
+	written int64
+}
+
+func NewRingBuffer(size int) *go101RingBuffer {
+	b := &go101RingBuffer{buf: make([]byte, size)}
+	b.cond = sync.NewCond(&b.mux)
+	return b
+}
+
+// Writes data, blocking until there is free space.
+func (b *go101RingBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	n := 0
+	for n < len(p) {
+		for b.length == len(b.buf) && !b.closed {
+			b.cond.Wait()
+		}
+		if b.closed {
+			return n, io.ErrClosedPipe
+		}
+		end := (b.start + b.length) % len(b.buf)
+		free := len(b.buf) - b.length
+		chunk := len(b.buf) - end
+		if chunk > free {
+			chunk = free
+		}
+		c := copy(b.buf[end:end+chunk], p[n:])
+		b.length += c
+		b.written += int64(c)
+		n += c
+		b.cond.Broadcast()
+	}
+	return n, nil
+}
+
+// Reads available data, blocking while buffer is empty. Returns io.EOF after writer closed the buffer.
+func (b *go101RingBuffer) Read(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.length == 0 && !b.closed {
+		b.underruns++
+	}
+	for b.length == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if b.length == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		return 0, io.EOF
+	}
+	chunk := len(b.buf) - b.start
+	if chunk > b.length {
+		chunk = b.length
+	}
+	n := copy(p, b.buf[b.start:b.start+chunk])
+	b.start = (b.start + n) % len(b.buf)
+	b.length -= n
+	b.cond.Broadcast()
+	return n, nil
+}
+
+// Waits until buffer contains at least n bytes or it's closed.
+func (b *go101RingBuffer) WaitFill(n int) {
+	if n > len(b.buf) {
+		n = len(b.buf)
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for b.length < n && !b.closed {
+		b.cond.Wait()
+	}
+}
+
+// Marks end of data, readers get the rest and then err (io.EOF if nil).
+func (b *go101RingBuffer) CloseWithError(err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.closed = true
+	b.err = err
+	b.cond.Broadcast()
+}
+
+// Returns number of buffered bytes.
+func (b *go101RingBuffer) Len() int {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.length
+}
+
+// Returns number of underruns.
+func (b *go101RingBuffer) Underruns() uint64 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.underruns
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ROTATION_CHECK_INTERVAL = 30 * time.Second
+
+// Part of the day with own channels, ex: {"name": "evenings", "start": "19:00", "end": "23:00", "genre": "jazz"}.
+// Channel of the slot is picked at random among the channels matching all given filters.
+type go101RotationSlot struct {
+	// Name used in announcements, ex: mornings.
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Group ID or part of its title.
+	Group string `json:"group"`
+	// Genre of the channels.
+	Genre string `json:"genre"`
+	// Channel ID or alias.
+	Channel string `json:"channel"`
+}
+
+// Rotation runtime state.
+type go101Rotation struct {
+	mux sync.Mutex
+	// Index of the current slot, -1 outside of all slots.
+	slot int
+	// Rotation paused by manual channel switch until that moment (end of the slot).
+	PausedUntil time.Time
+	// Rotation turned off by "rotation" action or control command.
+	Off bool
+}
+
+// Checks rotation slots: names, periods and filters.
+func (c *go101Config) ValidateRotation() error {
+	for i, s := range c.Rotation {
+		if _, err := parseClock(s.Start); err != nil {
+			return fmt.Errorf("rotation slot %d: %s", i+1, err.Error())
+		}
+		if _, err := parseClock(s.End); err != nil {
+			return fmt.Errorf("rotation slot %d: %s", i+1, err.Error())
+		}
+		if s.Group == "" && s.Genre == "" && s.Channel == "" {
+			return fmt.Errorf("rotation slot %d needs group, genre or channel", i+1)
+		}
+	}
+	return nil
+}
+
+// Returns index of the rotation slot at the moment and its end, -1 if there's none. Earlier slots take
+// precedence over overlapping later ones.
+func (p *go101) RotationSlot(now time.Time) (int, time.Time) {
+	for i, s := range p.Config.Rotation {
+		if in, end := periodAt(s.Start, s.End, now); in {
+			return i, end
+		}
+	}
+	return -1, time.Time{}
+}
+
+// Returns slot name for announcements.
+func (s go101RotationSlot) Title() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Start + "-" + s.End
+}
+
+// Checks if the channel belongs to the slot.
+func (p *go101) RotationMatches(s go101RotationSlot, cid uint64) bool {
+	gid := p.ChannelGroup(cid)
+	channel, ok := p.ChannelGroups[gid].Channels[cid]
+	if !ok {
+		return false
+	}
+	if s.Channel != "" {
+		id, err := p.ResolveChannel(s.Channel)
+		if err != nil || id != cid {
+			return false
+		}
+	}
+	if s.Group != "" && strconv.FormatUint(gid, 10) != s.Group &&
+		!strings.Contains(strings.ToLower(p.ChannelGroups[gid].Title), strings.ToLower(s.Group)) {
+		return false
+	}
+	if s.Genre != "" {
+		found := false
+		for _, genre := range channel.Genres {
+			if strings.EqualFold(genre, s.Genre) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns random unrestricted channel of the slot, 0 if slot has none.
+func (p *go101) RotationPick(s go101RotationSlot) uint64 {
+	candidates := make([]uint64, 0)
+	for _, g := range p.SortedGroups() {
+		for _, c := range g.SortedChannels() {
+			if !p.Profile.ChannelRestricted(c.Id) && p.RotationMatches(s, c.Id) {
+				candidates = append(candidates, c.Id)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return 0
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// Returns channel to start with if it isn't given: of the rotation slot at the moment, 0 if rotation has none.
+func (p *go101) StartRotation(channel string) uint64 {
+	if channel != "" {
+		return 0
+	}
+	i, _ := p.RotationSlot(p.Config.Now())
+	if i < 0 {
+		return 0
+	}
+	cid := p.RotationPick(p.Config.Rotation[i])
+	if cid != 0 {
+		fmt.Printf("%s: %s\n", Paint(theme.Info, "Rotation"), p.Config.Rotation[i].Title())
+	}
+	return cid
+}
+
+// Switches channels by rotation slots. Channel chosen on start is kept, if it doesn't match the slot, rotation
+// is paused till the slot end. Runs forever.
+func (p *go101) RotationLoop() {
+	p.Rotation.mux.Lock()
+	p.Rotation.slot, _ = p.RotationSlot(p.Config.Now())
+	p.Rotation.mux.Unlock()
+	for true {
+		time.Sleep(ROTATION_CHECK_INTERVAL)
+		p.Rotate(false)
+	}
+}
+
+// Switches to the channel of the slot started since the last check. Manual switch to a channel not matching
+// the current slot pauses rotation till the slot end. Force resumes paused rotation.
+func (p *go101) Rotate(force bool) {
+	r := &p.Rotation
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	now := p.Config.Now()
+	i, end := p.RotationSlot(now)
+	entered := i != r.slot
+	r.slot = i
+	if force {
+		r.PausedUntil = time.Time{}
+	}
+	if i < 0 || r.Off || now.Before(r.PausedUntil) {
+		return
+	}
+	slot := p.Config.Rotation[i]
+	if p.RotationMatches(slot, p.ChannelId()) {
+		return
+	}
+	if !entered && !force {
+		r.PausedUntil = end
+		fmt.Printf("\n%s paused until %s.\n", Paint(theme.Info, "Rotation"), FormatClock(end))
+		return
+	}
+	cid := p.RotationPick(slot)
+	if cid == 0 {
+		Debug("No channels of rotation slot %s", slot.Title())
+		return
+	}
+	p.SwitchChannel(cid)
+	channel := p.ChannelGroups[p.ChannelGroup(cid)].Channels[cid]
+	message := fmt.Sprintf("%s till %s: %s", slot.Title(), FormatClock(end), channel.Title)
+	fmt.Printf("%s: %s\n", Paint(theme.Info, "Rotation"), message)
+	p.Notify(EVENT_ROTATION, "101ply: "+slot.Title(), message)
+}
+
+// Turns rotation off, or back on switching to the channel of the current slot.
+func (p *go101) ToggleRotation() {
+	p.Rotation.mux.Lock()
+	off := p.Rotation.Off
+	p.Rotation.mux.Unlock()
+	p.SetRotation(off)
+}
+
+// Turns rotation on or off.
+func (p *go101) SetRotation(on bool) {
+	if len(p.Config.Rotation) == 0 {
+		Debug("Rotation isn't configured")
+		return
+	}
+	p.Rotation.mux.Lock()
+	p.Rotation.Off = !on
+	p.Rotation.mux.Unlock()
+	if !on {
+		fmt.Printf("\n%s turned off.\n", Paint(theme.Info, "Rotation"))
+		return
+	}
+	fmt.Printf("\n%s turned on.\n", Paint(theme.Info, "Rotation"))
+	p.Rotate(true)
+}
+
+// Returns rotation state for status: current slot and whether it's paused, empty if rotation isn't configured.
+func (p *go101) RotationState() string {
+	if len(p.Config.Rotation) == 0 {
+		return ""
+	}
+	p.Rotation.mux.Lock()
+	defer p.Rotation.mux.Unlock()
+	switch i, _ := p.RotationSlot(p.Config.Now()); {
+	case p.Rotation.Off:
+		return "off"
+	case i < 0:
+		return "idle"
+	case time.Now().Before(p.Rotation.PausedUntil):
+		return p.Config.Rotation[i].Title() + ", paused until " + FormatClock(p.Rotation.PausedUntil)
+	default:
+		return p.Config.Rotation[i].Title()
+	}
+}
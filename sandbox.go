@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	SANDBOX_FLATPAK  = "flatpak"
+	SANDBOX_SNAP     = "snap"
+	SANDBOX_FIREJAIL = "firejail"
+
+	PORTAL_NAME  = "org.freedesktop.portal.Desktop"
+	PORTAL_PATH  = "/org/freedesktop/portal/desktop"
+	PORTAL_IFACE = "org.freedesktop.portal."
+)
+
+var (
+	sandbox     string
+	sandboxOnce sync.Once
+)
+
+// Returns sandbox the player runs in: flatpak, snap or firejail, empty if none.
+func Sandbox() string {
+	sandboxOnce.Do(func() {
+		switch {
+		case os.Getenv("FLATPAK_ID") != "":
+			sandbox = SANDBOX_FLATPAK
+		case os.Getenv("SNAP") != "":
+			sandbox = SANDBOX_SNAP
+		case os.Getenv("container") == "firejail":
+			sandbox = SANDBOX_FIREJAIL
+		default:
+			if _, err := os.Stat("/.flatpak-info"); err == nil {
+				sandbox = SANDBOX_FLATPAK
+			}
+		}
+	})
+	return sandbox
+}
+
+// Checks if session D-Bus may be used: it's present and isn't disabled by "no_dbus" config.
+func SessionBusAvailable() bool {
+	if go101o.Config != nil && go101o.Config.NoDBus {
+		return false
+	}
+	return os.Getenv("DBUS_SESSION_BUS_ADDRESS") != ""
+}
+
+// Checks if desktop portals are the way to the desktop: Flatpak allows them without extra permissions.
+func UsePortals() bool {
+	return Sandbox() == SANDBOX_FLATPAK && SessionBusAvailable()
+}
+
+// Sends notification via desktop portal. Notification with the same ID replaces the previous one.
+// Priority is low, normal, high or urgent.
+func PortalNotify(id, title, body, priority string) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	notification := map[string]dbus.Variant{
+		"title":    dbus.MakeVariant(title),
+		"body":     dbus.MakeVariant(body),
+		"priority": dbus.MakeVariant(priority),
+	}
+	return conn.Object(PORTAL_NAME, PORTAL_PATH).Call(PORTAL_IFACE+"Notification.AddNotification", 0, id, notification).Err
+}
+
+// Inhibits suspend and idle via desktop portal, returns request to close for release.
+func PortalInhibit(reason string) (dbus.ObjectPath, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return "", err
+	}
+	// Flags: 4 - suspend, 8 - idle.
+	var request dbus.ObjectPath
+	err = conn.Object(PORTAL_NAME, PORTAL_PATH).Call(PORTAL_IFACE+"Inhibit.Inhibit", 0, "", uint32(4|8),
+		map[string]dbus.Variant{"reason": dbus.MakeVariant(reason)}).Store(&request)
+	return request, err
+}
+
+// Releases portal inhibitor.
+func PortalRelease(request dbus.ObjectPath) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	return conn.Object(PORTAL_NAME, request).Call(PORTAL_IFACE+"Request.Close", 0).Err
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Schedule is fetched again after that period.
+	SCHEDULE_TTL            = 12 * time.Hour
+	SCHEDULE_CHECK_INTERVAL = time.Minute
+	// Stale schedules fetched per check, so followed programs don't flood the provider.
+	SCHEDULE_REFRESH_BATCH = 5
+)
+
+// Program of the channel schedule.
+type go101Program struct {
+	ChannelId uint64    `json:"channel_id"`
+	Start     time.Time `json:"start"`
+	Title     string    `json:"title"`
+}
+
+// Programs followed on any channel.
+type go101ScheduleConfig struct {
+	// Program titles (case-insensitive substrings) to notify about.
+	Follow []string `json:"follow"`
+	// Notify that many minutes before the start, 0 notifies at the start.
+	NotifyMinutes int `json:"notify_minutes"`
+}
+
+// Returns time zone of the provider schedules.
+func ScheduleLocation() *time.Location {
+	if loc, err := time.LoadLocation("Europe/Moscow"); err == nil {
+		return loc
+	}
+	return time.FixedZone("MSK", 3*60*60)
+}
+
+// Returns today's schedule of the channel, fetched from the provider if the stored one is stale.
+func (p *go101) Schedule(cid uint64) ([]go101Program, error) {
+	var checked int64
+	err := p.DB.QueryRow(`SELECT checked_at FROM schedules WHERE channel_id = ?`, cid).Scan(&checked)
+	if err == nil && time.Since(time.Unix(checked, 0)) < SCHEDULE_TTL {
+		return p.storedSchedule(cid)
+	}
+	programs, err := p.Provider.FetchSchedule(cid)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.saveSchedule(cid, programs); err != nil {
+		return nil, err
+	}
+	return programs, nil
+}
+
+func (p *go101) storedSchedule(cid uint64) ([]go101Program, error) {
+	rows, err := p.DB.Query(`SELECT starts_at, title FROM programs WHERE channel_id = ? ORDER BY starts_at`, cid)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	programs := make([]go101Program, 0)
+	for rows.Next() {
+		var start int64
+		program := go101Program{ChannelId: cid}
+		if err = rows.Scan(&start, &program.Title); err != nil {
+			return nil, err
+		}
+		program.Start = time.Unix(start, 0)
+		programs = append(programs, program)
+	}
+	return programs, rows.Err()
+}
+
+// Replaces stored schedule of the channel.
+func (p *go101) saveSchedule(cid uint64, programs []go101Program) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err = tx.Exec(`DELETE FROM programs WHERE channel_id = ?`, cid); err != nil {
+		return err
+	}
+	for _, program := range programs {
+		if _, err = tx.Exec(`INSERT OR REPLACE INTO programs (channel_id, starts_at, title) VALUES (?, ?, ?)`,
+			cid, program.Start.Unix(), program.Title); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(`INSERT OR REPLACE INTO schedules (channel_id, checked_at) VALUES (?, ?)`,
+		cid, time.Now().Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Next program is looked up once a minute, status line asks for it every second.
+var nextProgramCache struct {
+	sync.Mutex
+	cid     uint64
+	program *go101Program
+	expires time.Time
+}
+
+// Returns the next program of the channel, nil if there is none.
+func (p *go101) NextProgram(cid uint64) *go101Program {
+	c := &nextProgramCache
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	if c.cid == cid && now.Before(c.expires) && (c.program == nil || c.program.Start.After(now)) {
+		return c.program
+	}
+	programs, err := p.Schedule(cid)
+	if err != nil {
+		Debug("Couldn't get schedule of channel %d: %s", cid, err)
+	}
+	c.cid, c.program, c.expires = cid, nil, now.Add(SCHEDULE_CHECK_INTERVAL)
+	for _, program := range programs {
+		if program.Start.After(now) {
+			program := program
+			c.program = &program
+			break
+		}
+	}
+	return c.program
+}
+
+// Formats program as "Up next at 18:00: <title>", time in the user's format.
+func (program *go101Program) String() string {
+	return fmt.Sprintf("Up next at %s: %s", FormatClock(program.Start), program.Title)
+}
+
+// Shows next program on channel switch.
+func (p *go101) InitSchedule() {
+	p.Subscribe(func(e go101Event) {
+		if e.Type == EVENT_CHANNEL {
+			p.ShowNextProgram(e.Channel.Id)
+		}
+	})
+}
+
+// Prints next program of the channel, if it has schedule.
+func (p *go101) ShowNextProgram(cid uint64) {
+	if next := p.NextProgram(cid); next != nil && !p.BigMode {
+		fmt.Println(Paint(theme.Info, next.String()))
+	}
+}
+
+// Checks if the program is followed.
+func (c *go101ScheduleConfig) Follows(title string) bool {
+	title = strings.ToLower(title)
+	for _, s := range c.Follow {
+		if s != "" && strings.Contains(title, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Keeps schedules of all channels fresh and notifies about followed programs. Runs forever.
+func (p *go101) ScheduleLoop() {
+	c := p.Config.Schedule
+	last := time.Now()
+	for true {
+		time.Sleep(SCHEDULE_CHECK_INTERVAL)
+		p.refreshSchedules()
+		// Programs starting since the previous check.
+		ahead := time.Duration(c.NotifyMinutes) * time.Minute
+		now := time.Now()
+		rows, err := p.DB.Query(`SELECT channel_id, starts_at, title FROM programs WHERE starts_at > ? AND starts_at <= ?`,
+			last.Add(ahead).Unix(), now.Add(ahead).Unix())
+		last = now
+		if err != nil {
+			log.Println("Couldn't read schedules: ", err.Error())
+			continue
+		}
+		programs := make([]go101Program, 0)
+		for rows.Next() {
+			var start int64
+			var program go101Program
+			if err = rows.Scan(&program.ChannelId, &start, &program.Title); err == nil && c.Follows(program.Title) {
+				program.Start = time.Unix(start, 0)
+				programs = append(programs, program)
+			}
+		}
+		_ = rows.Close()
+		for _, program := range programs {
+			p.ProgramStarts(program)
+		}
+	}
+}
+
+// Fetches a few stale schedules.
+func (p *go101) refreshSchedules() {
+	rows, err := p.DB.Query(`SELECT DISTINCT c.id FROM channels c LEFT JOIN schedules s ON s.channel_id = c.id
+		WHERE c.dead = 0 AND (s.checked_at IS NULL OR s.checked_at < ?) LIMIT ?`,
+		time.Now().Add(-SCHEDULE_TTL).Unix(), SCHEDULE_REFRESH_BATCH)
+	if err != nil {
+		log.Println("Couldn't read schedules: ", err.Error())
+		return
+	}
+	ids := make([]uint64, 0, SCHEDULE_REFRESH_BATCH)
+	for rows.Next() {
+		var cid uint64
+		if rows.Scan(&cid) == nil {
+			ids = append(ids, cid)
+		}
+	}
+	_ = rows.Close()
+	for _, cid := range ids {
+		if _, err = p.Schedule(cid); err != nil {
+			Debug("Couldn't fetch schedule of channel %d: %s", cid, err)
+		}
+	}
+}
+
+// Notifies about followed program.
+func (p *go101) ProgramStarts(program go101Program) {
+	channel := fmt.Sprintf("channel %d", program.ChannelId)
+	if c, ok := p.ChannelGroups[p.ChannelGroup(program.ChannelId)].Channels[program.ChannelId]; ok {
+		channel = c.Title
+	}
+	message := fmt.Sprintf("%s at %s on %s", program.Title, FormatClock(program.Start), channel)
+	fmt.Printf("\n%s: %s\n", Paint(theme.Info, "Program"), message)
+	p.Notify(EVENT_PROGRAM, "101ply: "+program.Title, message)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Wait of the fetch loop between polls. Zero value is ready to use.
+type go101Scheduler struct {
+	once sync.Once
+	// Fetch right now: channel switched, track change pushed, etc.
+	wake chan struct{}
+	// Player status changed, the wait is re-evaluated.
+	status chan struct{}
+	// Requests are pending, see go101.Exec.
+	pending chan struct{}
+
+	reqMux   sync.Mutex
+	requests []func()
+
+	mux     sync.Mutex
+	running bool
+	// Time of the next fetch while running, time left while paused.
+	at   time.Time
+	left time.Duration
+	// Interval of the current wait, seconds.
+	interval uint64
+}
+
+func (s *go101Scheduler) init() {
+	s.once.Do(func() {
+		// Single pending signal is enough, repeated ones are merged.
+		s.wake = make(chan struct{}, 1)
+		s.status = make(chan struct{}, 1)
+		s.pending = make(chan struct{}, 1)
+	})
+}
+
+// Interrupts the wait, the next fetch goes immediately. Wake during a fetch interrupts the next wait.
+func (s *go101Scheduler) Wake() {
+	s.init()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Notifies the wait of pause, resume or stop.
+func (s *go101Scheduler) StatusChanged() {
+	s.init()
+	select {
+	case s.status <- struct{}{}:
+	default:
+	}
+}
+
+// Queues request to the fetch loop.
+func (s *go101Scheduler) request(fn func()) {
+	s.init()
+	s.reqMux.Lock()
+	s.requests = append(s.requests, fn)
+	s.reqMux.Unlock()
+	select {
+	case s.pending <- struct{}{}:
+	default:
+	}
+}
+
+// Runs pending requests in order.
+func (s *go101Scheduler) run() {
+	s.reqMux.Lock()
+	requests := s.requests
+	s.requests = nil
+	s.reqMux.Unlock()
+	for _, fn := range requests {
+		fn()
+	}
+}
+
+// Returns interval of the current wait, seconds.
+func (s *go101Scheduler) Interval() uint64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.interval
+}
+
+// Returns time left to the next fetch, false if the loop doesn't wait now.
+func (s *go101Scheduler) Countdown() (time.Duration, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running {
+		return time.Until(s.at), !s.at.IsZero()
+	}
+	return s.left, s.left > 0
+}
+
+func (s *go101Scheduler) set(running bool, left time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.running, s.left, s.at = running, left, time.Time{}
+	if running {
+		s.at = time.Now().Add(left)
+	}
+}
+
+// Waits for the given duration of playback: the countdown is frozen on pause/stop status.
+// Returns early on Wake, requests to the loop are run meanwhile. Time is measured by the monotonic clock, so the countdown doesn't drift.
+func (p *go101) Sleep(s uint64) {
+	sc := &p.Scheduler
+	sc.init()
+	left := time.Duration(s) * time.Second
+	timer := time.NewTimer(left)
+	defer timer.Stop()
+	running := p.Status() == STATUS_PLAY
+	if !running {
+		timer.Stop()
+	}
+	since := time.Now()
+	sc.mux.Lock()
+	sc.interval = s
+	sc.mux.Unlock()
+	sc.set(running, left)
+	defer sc.set(false, 0)
+	for {
+		select {
+		case <-sc.wake:
+			return
+		case <-timer.C:
+			return
+		case <-sc.pending:
+			sc.run()
+		case <-sc.status:
+			playing := p.Status() == STATUS_PLAY
+			if playing == running {
+				continue
+			}
+			now := time.Now()
+			if running {
+				left -= now.Sub(since)
+				if !timer.Stop() {
+					// Fired meanwhile, the time is up anyway.
+					return
+				}
+			} else {
+				timer.Reset(left)
+			}
+			since, running = now, playing
+			sc.set(running, left)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Screensaver interfaces emitting ActiveChanged signal on lock/unlock.
+var screenSaverInterfaces = []string{"org.freedesktop.ScreenSaver", "org.gnome.ScreenSaver", "org.mate.ScreenSaver", "org.cinnamon.ScreenSaver"}
+
+// Pauses playback when session locks and resumes it on unlock. Runs forever.
+func (p *go101) ScreenLockLoop() {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		panic(fmt.Errorf("couldn't connect to session bus: %s", err.Error()))
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	for _, iface := range screenSaverInterfaces {
+		err = conn.AddMatchSignal(dbus.WithMatchInterface(iface), dbus.WithMatchMember("ActiveChanged"))
+		if err != nil {
+			panic(err)
+		}
+	}
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+
+	// Pause made by the lock, so unlock resumes only it and not the user's pause.
+	paused := false
+	for signal := range signals {
+		if len(signal.Body) == 0 {
+			continue
+		}
+		locked, ok := signal.Body[0].(bool)
+		if !ok {
+			continue
+		}
+		if locked && p.Status() == STATUS_PLAY {
+			Debug("Screen locked, pause")
+			paused = p.Pause()
+		} else if !locked && paused {
+			Debug("Screen unlocked, resume")
+			paused = false
+			p.Resume()
+		}
+	}
+	panic(fmt.Errorf("session bus connection closed"))
+}
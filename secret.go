@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Config value referencing secret in the secret storage, ex: "token": "secret:pushover-token".
+const SECRET_PREFIX = "secret:"
+
+var (
+	// Secrets resolved once, so the keyring locked later (ex: on screen lock) doesn't break running player.
+	secrets    = make(map[string]string)
+	secretsMux sync.Mutex
+)
+
+// Returns value of config string: reference "secret:<name>" is looked up in the secret storage, other values
+// are returned as is.
+func ResolveSecret(value string) (string, error) {
+	name := strings.TrimPrefix(value, SECRET_PREFIX)
+	if name == value {
+		return value, nil
+	}
+	secretsMux.Lock()
+	defer secretsMux.Unlock()
+	if v, ok := secrets[name]; ok {
+		return v, nil
+	}
+	k, err := OpenKeyring(go101o.Config.SecretStorage)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get secret %s: %s", name, err.Error())
+	}
+	defer k.Close()
+	v, err := k.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get secret %s: %s", name, err.Error())
+	}
+	secrets[name] = v
+	return v, nil
+}
+
+// Moves plain secrets of the config file to the secret storage, replacing them with references. Secret names are
+// made of the prefix and config path (ex: notifiers.0.token), equal values share the name. Returns moved names.
+func MigrateSecrets(k go101Keyring, file, prefix string) ([]string, error) {
+	names := make(map[string]string)
+	_, moved, err := referSecrets(file, prefix, names)
+	if err != nil || len(moved) == 0 {
+		return nil, err
+	}
+	for value, name := range names {
+		if err = k.Set(name, value); err != nil {
+			return nil, fmt.Errorf("couldn't store secret %s: %s", name, err.Error())
+		}
+	}
+	// Storage might have changed the file (encrypted credentials of config), so it's read again.
+	raw, _, err := referSecrets(file, prefix, names)
+	if err != nil {
+		return nil, err
+	}
+	return moved, WriteFileAtomic(file, raw, PRIVATE_FILE_PERM)
+}
+
+// Returns contents of the config file with plain secrets replaced by references, names of secrets are added to
+// names by value, new ones are returned.
+func referSecrets(file, prefix string, names map[string]string) ([]byte, []string, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc interface{}
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		return nil, nil, fmt.Errorf("could not parse %s: %s", file, err.Error())
+	}
+	added := make([]string, 0)
+	var walk func(path, key string, v interface{}) interface{}
+	walk = func(path, key string, v interface{}) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			// Stable names of equal values.
+			sort.Strings(keys)
+			for _, k := range keys {
+				t[k] = walk(path+"."+k, k, t[k])
+			}
+		case []interface{}:
+			for i, item := range t {
+				t[i] = walk(fmt.Sprintf("%s.%d", path, i), key, item)
+			}
+		case string:
+			// Storage option matches the pattern too.
+			if t == "" || strings.HasPrefix(t, SECRET_PREFIX) || !reSecretKey.MatchString(key) || key == "secret_storage" {
+				return t
+			}
+			name, ok := names[t]
+			if !ok {
+				name = prefix + strings.TrimPrefix(path, ".")
+				names[t] = name
+				added = append(added, name)
+			}
+			raw = bytes.ReplaceAll(raw, jsonString(t), jsonString(SECRET_PREFIX+name))
+			return SECRET_PREFIX + name
+		}
+		return v
+	}
+	doc = walk("", "", doc)
+	// Values are replaced in place to keep formatting, unless the same string is used by other keys too.
+	var check interface{}
+	if err = json.Unmarshal(raw, &check); err != nil || !reflect.DeepEqual(check, doc) {
+		raw, _ = json.MarshalIndent(doc, "", "\t")
+	}
+	return raw, added, nil
+}
+
+func jsonString(s string) []byte {
+	raw, _ := json.Marshal(s)
+	return raw
+}
+
+// Reads secret from stdin, without echo in terminal.
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if t, err := unix.IoctlGetTermios(fd, unix.TCGETS); err == nil {
+		fmt.Print(prompt)
+		noEcho := *t
+		noEcho.Lflag &^= unix.ECHO
+		if err = unix.IoctlSetTermios(fd, unix.TCSETS, &noEcho); err == nil {
+			defer func() {
+				_ = unix.IoctlSetTermios(fd, unix.TCSETS, t)
+				fmt.Println()
+			}()
+		}
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if line = strings.TrimRight(line, "\r\n"); line == "" && err != nil {
+		return "", err
+	}
+	return line, nil
+}
+
+// Manage secrets referenced from config as "secret:<name>".
+func CmdSecret(args []string) {
+	usage := "Usage: secret set <name>|rm <name>|migrate"
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+	k, err := OpenKeyring(go101o.Config.SecretStorage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer k.Close()
+	switch {
+	case args[0] == "set" && len(args) == 2:
+		value, err := readSecret(fmt.Sprintf("Value of %s: ", args[1]))
+		if err != nil || value == "" {
+			log.Fatal("Empty secret.")
+		}
+		if err = k.Set(args[1], value); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Stored, use \"%s%s\" in config.\n", SECRET_PREFIX, args[1])
+	case args[0] == "rm" && len(args) == 2:
+		if err = k.Delete(args[1]); err != nil {
+			log.Fatal(err)
+		}
+	case args[0] == "migrate" && len(args) == 1:
+		files := map[string]string{GetConfigFile(): ""}
+		profiles, _ := filepath.Glob(filepath.Join(GetProfilesDir(), "*.json"))
+		for _, file := range profiles {
+			files[file] = "profiles." + strings.TrimSuffix(filepath.Base(file), ".json") + "."
+		}
+		for file, prefix := range files {
+			moved, err := MigrateSecrets(k, file, prefix)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, name := range moved {
+				fmt.Printf("%s: %s\n", file, name)
+			}
+		}
+	default:
+		log.Fatal(usage)
+	}
+}
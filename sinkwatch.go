@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const SINK_CHECK_INTERVAL = 30 * time.Second
+
+// Pauses playback when the output stays muted or unplugged for configured time, saves bandwidth.
+// Playback is resumed by user action as usual. Runs forever.
+func (p *go101) SinkWatchLoop() {
+	limit := time.Duration(p.Config.SinkIdleMinutes) * time.Minute
+	var since time.Time
+	for true {
+		time.Sleep(SINK_CHECK_INTERVAL)
+		silent, err := SinkSilent()
+		if err != nil {
+			Debug("%s", err)
+			continue
+		}
+		if !silent || p.Status() != STATUS_PLAY {
+			since = time.Time{}
+			continue
+		}
+		if since.IsZero() {
+			since = time.Now()
+			Debug("Output is silent, pause after %s", limit)
+		}
+		if time.Since(since) >= limit {
+			fmt.Println("Nobody listening (output muted or unplugged), paused.")
+			p.Pause()
+			since = time.Time{}
+		}
+	}
+}
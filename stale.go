@@ -0,0 +1,29 @@
+package main
+
+import "time"
+
+// Track info is considered a stale copy when server time lags the local clock progress that much, seconds.
+const STALE_CLOCK_LAG = 15
+
+// Server time of the last fresh track info and local time it was received.
+type go101ServerClock struct {
+	Server uint64
+	Local  time.Time
+}
+
+// Checks if track info is a stale copy cached on the provider side: the track has finished already
+// by the server clock, or server time advanced less than local time since the previous fresh reply.
+func (p *go101) StaleTrackInfo(trackInfo *TrackInfo) bool {
+	stat := trackInfo.Result.Stat
+	if stat.FinishSong > 0 && stat.FinishSong <= stat.ServerTime {
+		return true
+	}
+	if c := p.ServerClock; !c.Local.IsZero() {
+		elapsed := uint64(time.Since(c.Local) / time.Second)
+		if stat.ServerTime+STALE_CLOCK_LAG < c.Server+elapsed {
+			return true
+		}
+	}
+	p.ServerClock = go101ServerClock{stat.ServerTime, time.Now()}
+	return false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const STATE_SAVE_INTERVAL = 5 * time.Second
+
+// Runtime state, persisted periodically to restore session after unexpected termination.
+type go101State struct {
+	Group          uint64 `json:"group"`
+	Channel        uint64 `json:"channel"`
+	Muted          bool   `json:"muted"`
+	Volume         int    `json:"volume,omitempty"`
+	Favorite       int    `json:"favorite,omitempty"`
+	SleepRemaining uint64 `json:"sleepRemaining"`
+	SavedAt        int64  `json:"savedAt"`
+}
+
+// Returns full path to the runtime state file.
+func GetStateFile() string {
+	ps := string(os.PathSeparator)
+	return GetRuntimeDir() + ps + "state.json"
+}
+
+// Takes snapshot of the current runtime state.
+func (p *go101) State() go101State {
+	state := go101State{
+		Group:    p.GroupId(),
+		Channel:  p.ChannelId(),
+		Muted:    p.Muted(),
+		Favorite: p.FavoriteCursor(),
+		SavedAt:  time.Now().Unix(),
+	}
+	get, _ := p.VolumeControl()
+	if volume, err := get(); err == nil {
+		state.Volume = volume
+	}
+	p.state.data.RLock()
+	sleepAt := p.SleepAt
+	p.state.data.RUnlock()
+	if !sleepAt.IsZero() {
+		if remaining := time.Until(sleepAt); remaining > 0 {
+			state.SleepRemaining = uint64(remaining.Seconds())
+		}
+	}
+	return state
+}
+
+// Writes state to the file every few seconds. Runs forever.
+func (p *go101) SaveStateLoop() {
+	stateFile := GetStateFile()
+	for true {
+		b, err := json.Marshal(p.State())
+		if err != nil {
+			log.Println("Couldn't encode state: ", err.Error())
+		} else if err = WriteFileAtomic(stateFile, b, PRIVATE_FILE_PERM); err != nil {
+			log.Println("Couldn't save state: ", err.Error())
+		}
+		time.Sleep(STATE_SAVE_INTERVAL)
+	}
+}
+
+// Reads state left by the previous session. Returns nil if previous session finished normally.
+func LoadState() *go101State {
+	raw, err := ioutil.ReadFile(GetStateFile())
+	if err != nil {
+		return nil
+	}
+	var state go101State
+	if err = json.Unmarshal(raw, &state); err != nil || state.Channel == 0 {
+		Debug("Ignore broken state file: %s", err)
+		return nil
+	}
+	return &state
+}
+
+// Removes state file, called on normal exit.
+func ClearState() {
+	_ = os.Remove(GetStateFile())
+}
+
+// Asks user whether previous session should be restored.
+func (p *go101) OfferRestore(state *go101State, reader *bufio.Reader) bool {
+	title := fmt.Sprintf("channel %d", state.Channel)
+	if c, ok := p.ChannelGroups[state.Group].Channels[state.Channel]; ok {
+		title = c.Title
+	}
+	fmt.Printf("Previous session was terminated unexpectedly at %s (%s).\n",
+		FormatDateTime(time.Unix(state.SavedAt, 0)), title)
+	fmt.Print("Restore it? [Y/n]: ")
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// Applies restored state: channel, mute, favorites cursor and sleep timer. Volume is restored by RestoreVolume.
+func (p *go101) Restore(state *go101State) {
+	p.setChannel(state.Channel)
+	p.setFavoriteCursor(state.Favorite)
+	if state.Muted {
+		p.Pause()
+	}
+	if state.SleepRemaining > 0 {
+		p.ArmSleepTimer(time.Duration(state.SleepRemaining) * time.Second)
+	}
+	Debug("Session restored: %#v", state)
+}
+
+// Sets volume of the restored session, after gain and profile ones, so it wins over them.
+func (p *go101) RestoreVolume(state *go101State) {
+	if state.Volume <= 0 {
+		return
+	}
+	_, set := p.VolumeControl()
+	if err := set(state.Volume); err != nil {
+		log.Println(err)
+	}
+}
+
+// Stops playing and exits after given duration.
+func (p *go101) ArmSleepTimer(d time.Duration) {
+	p.state.data.Lock()
+	p.SleepAt = time.Now().Add(d)
+	p.state.data.Unlock()
+	time.AfterFunc(d, func() {
+		fmt.Println("Sleep timer expired.")
+		Cleanup()
+		os.Exit(0)
+	})
+	Debug("Sleep timer armed for %s", d)
+}
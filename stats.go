@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Session statistics, collected for the status command and the status line.
+type go101Stats struct {
+	started    time.Time
+	tracks     uint64
+	bytes      uint64
+	reconnects uint64
+}
+
+// Session stats snapshot, part of the "status" control command output.
+type go101StatsSnapshot struct {
+	// Seconds since the player start.
+	Uptime int64  `json:"uptime"`
+	Tracks uint64 `json:"tracks"`
+	// Bytes of audio downloaded by the player itself (stream proxy, track cache).
+	Downloaded uint64 `json:"downloaded"`
+	Reconnects uint64 `json:"reconnects"`
+}
+
+// Stats of the running player.
+var stats = &go101Stats{started: time.Now()}
+
+func (s *go101Stats) AddTrack() {
+	atomic.AddUint64(&s.tracks, 1)
+}
+
+func (s *go101Stats) AddReconnect() {
+	atomic.AddUint64(&s.reconnects, 1)
+}
+
+// Counts downloaded bytes, so stats may be a tee of the stream.
+func (s *go101Stats) Write(data []byte) (int, error) {
+	atomic.AddUint64(&s.bytes, uint64(len(data)))
+	return len(data), nil
+}
+
+// Returns current stats.
+func (s *go101Stats) Snapshot() go101StatsSnapshot {
+	return go101StatsSnapshot{
+		Uptime:     int64(time.Since(s.started) / time.Second),
+		Tracks:     atomic.LoadUint64(&s.tracks),
+		Downloaded: atomic.LoadUint64(&s.bytes),
+		Reconnects: atomic.LoadUint64(&s.reconnects),
+	}
+}
+
+// Counts played tracks.
+func (p *go101) InitStats() {
+	p.Subscribe(func(e go101Event) {
+		if e.Type == EVENT_TRACK {
+			stats.AddTrack()
+		}
+	})
+}
+
+// Formats duration in seconds as "1h02m" or "5m07s".
+func FormatUptime(s int64) string {
+	if s >= 3600 {
+		return fmt.Sprintf("%dh%02dm", s/3600, s%3600/60)
+	}
+	return fmt.Sprintf("%dm%02ds", s/60, s%60)
+}
+
+// Returns one line summary of the stats.
+func (s go101StatsSnapshot) String() string {
+	return fmt.Sprintf("up %s, %d tracks, %s downloaded, %d reconnects",
+		FormatUptime(s.Uptime), s.Tracks, FormatSize(int64(s.Downloaded)), s.Reconnects)
+}
+
+// Print status of the running player, with session stats if -long is given.
+func CmdStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	long := fs.Bool("long", false, "Print session stats, buffer and polling details.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	status, err := QueryStatus(NOW_TIMEOUT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s (%s, %s left)\n", go101o.ConsoleText(fmt.Sprintf("%s - %s [%s]", status.Artist, status.Title, status.Channel)), status.Status, FormatTime(uint64(status.Remaining)))
+	if status.Next != nil {
+		fmt.Println(status.Next.String())
+	}
+	if !*long {
+		return
+	}
+	s := status.Stats
+	fmt.Printf("Uptime:     %s\n", FormatUptime(s.Uptime))
+	fmt.Printf("Tracks:     %d\n", s.Tracks)
+	fmt.Printf("Downloaded: %s\n", FormatSize(int64(s.Downloaded)))
+	fmt.Printf("Reconnects: %d\n", s.Reconnects)
+	if status.Profile != "" {
+		fmt.Printf("Profile:    %s\n", status.Profile)
+	}
+	if status.BufferedBytes > 0 || status.Underruns > 0 {
+		fmt.Printf("Buffer:     %d KB, underruns: %d\n", status.BufferedBytes/1024, status.Underruns)
+	}
+	fmt.Printf("Polling:    every %ds, %d requests, %d throttled\n", status.PollInterval, status.Requests, status.Throttled)
+}
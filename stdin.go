@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Checks if stdin is piped, then player is driven by commands read from it instead of the picker.
+func StdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
+
+// Reads command lines from stdin until "channel <id|alias>" one, returns the channel. Other commands are refused
+// since nothing is playing yet.
+func (p *go101) ReadChannelCommand(reader *bufio.Reader) uint64 {
+	fmt.Println("Waiting for \"channel <id>\" command on stdin.")
+	for {
+		line, err := reader.ReadString('\n')
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] != "channel" || len(fields) < 2:
+			log.Printf("Couldn't run stdin command %s: send \"channel <id>\" first", fields[0])
+		default:
+			cid, cerr := p.ResolveChannel(fields[1])
+			if cerr == nil {
+				cerr = p.EnsureChannel(cid)
+			}
+			if cerr == nil && p.Profile.ChannelRestricted(cid) {
+				cerr = fmt.Errorf("channel %d is restricted by profile", cid)
+			}
+			if cerr == nil {
+				return cid
+			}
+			log.Println("Couldn't run stdin command: ", cerr.Error())
+		}
+		if err != nil {
+			log.Fatal("Stdin closed before channel was chosen.")
+		}
+	}
+}
+
+// Runs command lines read from stdin, same commands as of the control socket and FIFO. Replies are printed
+// to stdout, errors to stderr. Reading stops at the end of input, playback goes on. Runs forever.
+func (p *go101) StdinLoop(reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			if reply, cerr := p.Command(line); cerr != nil {
+				log.Println("Couldn't run stdin command: ", cerr.Error())
+			} else {
+				fmt.Print(reply)
+			}
+		}
+		if err == io.EOF {
+			Debug("Stdin closed, commands are accepted by control socket and FIFO only.")
+			select {}
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DEFAULT_BUFFER_KB    = 1024
+	DEFAULT_PREBUFFER_MS = 2000
+	// Bytes per millisecond of 128 kbps stream, used to convert target latency to bytes.
+	STREAM_BYTES_PER_MS = 16
+)
+
+// Stream buffer settings.
+type go101BufferConfig struct {
+	// Ring buffer size.
+	SizeKb int `json:"size_kb"`
+	// Playback starts after that much audio is buffered (target latency).
+	PrebufferMs int `json:"prebuffer_ms"`
+}
+
+// Local HTTP proxy owning the stream buffer. Audio backend plays from the proxy, so stream is downloaded
+// in-process and buffer underruns can be counted.
+type go101StreamProxy struct {
+	SizeKb      int
+	PrebufferMs int
+
+	mux      sync.Mutex
+	listener net.Listener
+	buffer   *go101RingBuffer
+	upstream io.Closer
+	seq      uint64
+	// Underruns of all finished streams.
+	underruns uint64
+	// Raw stream copies, ex: output file.
+	tees []io.Writer
+	// Stream integrity checks, broken is called when the stream is corrupted or silent.
+	integrity *go101IntegrityConfig
+	broken    func(reason string)
+	// Bytes read by the audio backend, atomic.
+	served uint64
+}
+
+// Starts proxy server on a random local port.
+func NewStreamProxy(c *go101BufferConfig) (*go101StreamProxy, error) {
+	s := &go101StreamProxy{SizeKb: c.SizeKb, PrebufferMs: c.PrebufferMs}
+	if s.SizeKb <= 0 {
+		s.SizeKb = DEFAULT_BUFFER_KB
+	}
+	if s.PrebufferMs <= 0 {
+		s.PrebufferMs = DEFAULT_PREBUFFER_MS
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start stream proxy: %s", err.Error())
+	}
+	s.listener = listener
+	go Safe("stream proxy", func() {
+		_ = http.Serve(listener, http.HandlerFunc(s.serve))
+	})
+	return s, nil
+}
+
+// Starts downloading the URL into a new buffer and returns local URL to play it from.
+func (s *go101StreamProxy) Open(url string) (string, error) {
+	s.Close()
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	if err = CheckStatus(resp); err != nil {
+		_ = resp.Body.Close()
+		return "", fmt.Errorf("couldn't open stream: %w", err)
+	}
+	buffer := NewRingBuffer(s.SizeKb * 1024)
+	s.mux.Lock()
+	s.buffer, s.upstream = buffer, resp.Body
+	s.seq++
+	seq := s.seq
+	tees := s.tees
+	if s.integrity != nil {
+		tees = append([]io.Writer{NewFrameChecker(s.integrity, s.broken)}, tees...)
+	}
+	s.mux.Unlock()
+
+	go Safe("stream download", func() {
+		w := io.MultiWriter(append([]io.Writer{buffer, stats}, tees...)...)
+		_, err := io.Copy(w, resp.Body)
+		_ = resp.Body.Close()
+		if err != nil && err != io.ErrClosedPipe {
+			Debug("Stream download failed: %s", err)
+		}
+		buffer.CloseWithError(nil)
+	})
+	return fmt.Sprintf("http://%s/stream/%d.mp3", s.listener.Addr().String(), seq), nil
+}
+
+// Serves current buffer, waiting for prebuffer fill first.
+func (s *go101StreamProxy) serve(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	buffer := s.buffer
+	current := fmt.Sprintf("/stream/%d.mp3", s.seq)
+	s.mux.Unlock()
+	if buffer == nil || !strings.HasPrefix(r.URL.Path, current) {
+		http.NotFound(w, r)
+		return
+	}
+	buffer.WaitFill(s.PrebufferMs * STREAM_BYTES_PER_MS)
+	w.Header().Set("Content-Type", "audio/mpeg")
+	_, _ = io.Copy(&go101CountingWriter{w, &s.served}, buffer)
+}
+
+// Writer counting written bytes.
+type go101CountingWriter struct {
+	io.Writer
+	n *uint64
+}
+
+func (w *go101CountingWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	atomic.AddUint64(w.n, uint64(n))
+	return n, err
+}
+
+// Returns bytes read by the audio backend from all streams.
+func (s *go101StreamProxy) Served() uint64 {
+	return atomic.LoadUint64(&s.served)
+}
+
+// Stops current stream.
+func (s *go101StreamProxy) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.buffer != nil {
+		atomic.AddUint64(&s.underruns, s.buffer.Underruns())
+		s.buffer.CloseWithError(io.ErrClosedPipe)
+		s.buffer = nil
+	}
+	if s.upstream != nil {
+		_ = s.upstream.Close()
+		s.upstream = nil
+	}
+}
+
+// Adds writer receiving copy of the raw stream.
+func (s *go101StreamProxy) Tee(w io.Writer) {
+	s.mux.Lock()
+	s.tees = append(s.tees, w)
+	s.mux.Unlock()
+}
+
+// Enables integrity checks of every stream.
+func (s *go101StreamProxy) Monitor(c *go101IntegrityConfig, broken func(reason string)) {
+	s.mux.Lock()
+	s.integrity, s.broken = c, broken
+	s.mux.Unlock()
+}
+
+// Returns buffer stats: buffered bytes and total underruns.
+func (s *go101StreamProxy) Stats() (int, uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	underruns := atomic.LoadUint64(&s.underruns)
+	if s.buffer == nil {
+		return 0, underruns
+	}
+	return s.buffer.Len(), underruns + s.buffer.Underruns()
+}
+
+// Backend playing HTTP streams through the stream proxy.
+type go101BufferedBackend struct {
+	go101Backend
+	Proxy *go101StreamProxy
+}
+
+func (b *go101BufferedBackend) Play(url string) error {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		// Local files (ex: replay from cache) don't need buffering.
+		return b.go101Backend.Play(url)
+	}
+	local, err := b.Proxy.Open(url)
+	if err != nil {
+		return err
+	}
+	return b.go101Backend.Play(local)
+}
+
+// Returns progress of the wrapped backend, or bytes it read from the proxy if it reports none.
+func (b *go101BufferedBackend) Progress() (uint64, error) {
+	if pb, ok := b.go101Backend.(go101ProgressBackend); ok {
+		return pb.Progress()
+	}
+	return b.Proxy.Served(), nil
+}
+
+func (b *go101BufferedBackend) Restart() {
+	if rb, ok := b.go101Backend.(go101RestartBackend); ok {
+		rb.Restart()
+	}
+}
+
+func (b *go101BufferedBackend) Stop() {
+	b.go101Backend.Stop()
+	b.Proxy.Close()
+}
+
+func (b *go101BufferedBackend) Close() {
+	b.go101Backend.Close()
+	b.Proxy.Close()
+}
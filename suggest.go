@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SUGGEST_LIMIT = 5
+	// Top artists taken into account.
+	SUGGEST_ARTISTS = 20
+)
+
+// Recommended channel.
+type go101Suggestion struct {
+	Channel go101Channel
+	Score   float64
+	Reasons []string
+}
+
+// Listening statistics of the channel.
+type go101ChannelPlays struct {
+	Total int
+	// Plays within an hour from the current time of day.
+	Hour int
+}
+
+// Recommends channels user hasn't played much, based on genres and artists of the history
+// and the time of day channels usually played.
+func (p *go101) Suggest(limit int, now time.Time) ([]go101Suggestion, error) {
+	plays, err := p.channelPlays(now)
+	if err != nil {
+		return nil, err
+	}
+	artists, err := p.topArtists(SUGGEST_ARTISTS)
+	if err != nil {
+		return nil, err
+	}
+
+	// Genres weight: channels often played, especially at this time of day, make their genres heavier.
+	genres := make(map[string]float64)
+	for cid, cp := range plays {
+		g, ok := p.ChannelGroups[p.ChannelGroup(cid)]
+		if !ok {
+			continue
+		}
+		for _, genre := range g.Channels[cid].Genres {
+			genres[strings.ToLower(genre)] += float64(cp.Total + 2*cp.Hour)
+		}
+	}
+
+	suggestions := make([]go101Suggestion, 0)
+	for _, g := range p.ChannelGroups {
+		for _, c := range g.Channels {
+			if c.Id == p.ChannelId() || p.Profile.ChannelRestricted(c.Id) {
+				continue
+			}
+			s := go101Suggestion{Channel: c}
+			matched := make([]string, 0)
+			for _, genre := range c.Genres {
+				if w := genres[strings.ToLower(genre)]; w > 0 {
+					s.Score += w
+					matched = append(matched, genre)
+				}
+			}
+			if len(matched) > 0 {
+				s.Reasons = append(s.Reasons, "genres: "+strings.Join(matched, ", "))
+			}
+			// Many channels are dedicated to a single artist.
+			text := strings.ToLower(c.Title + " " + c.Description)
+			for _, a := range artists {
+				if len(a.Name) > 2 && strings.Contains(text, strings.ToLower(a.Name)) {
+					s.Score += float64(2 * a.Plays)
+					s.Reasons = append(s.Reasons, "artist: "+a.Name)
+				}
+			}
+			if s.Score == 0 {
+				continue
+			}
+			// Prefer channels rarely played.
+			cp := plays[c.Id]
+			s.Score /= float64(1 + cp.Total)
+			if cp.Total == 0 {
+				s.Reasons = append(s.Reasons, "not played yet")
+			}
+			suggestions = append(suggestions, s)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score == suggestions[j].Score {
+			return suggestions[i].Channel.Id < suggestions[j].Channel.Id
+		}
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// Returns play counts of the channels from the history.
+func (p *go101) channelPlays(now time.Time) (map[uint64]go101ChannelPlays, error) {
+	rows, err := p.DB.Query(`SELECT channel_id, COUNT(*),
+		SUM(ABS(CAST(strftime('%H', played_at, 'unixepoch', 'localtime') AS INTEGER) - ?) <= 1)
+		FROM history GROUP BY channel_id`, now.Hour())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	plays := make(map[uint64]go101ChannelPlays)
+	for rows.Next() {
+		var (
+			cid uint64
+			cp  go101ChannelPlays
+		)
+		if err = rows.Scan(&cid, &cp.Total, &cp.Hour); err != nil {
+			return nil, err
+		}
+		plays[cid] = cp
+	}
+	return plays, rows.Err()
+}
+
+// Artist with play count.
+type go101ArtistPlays struct {
+	Name  string
+	Plays int
+}
+
+// Returns most played artists.
+func (p *go101) topArtists(limit int) ([]go101ArtistPlays, error) {
+	return p.topArtistsBetween(time.Unix(0, 0), time.Now(), limit)
+}
+
+// Returns most played artists of the period.
+func (p *go101) topArtistsBetween(from, to time.Time, limit int) ([]go101ArtistPlays, error) {
+	// Spellings of the same artist are counted together.
+	rows, err := p.DB.Query(`SELECT MAX(h.artist), COUNT(*) AS n FROM history h
+		JOIN track_keys k ON k.artist = h.artist AND k.title = h.title
+		WHERE k.artist_key != '' AND h.played_at >= ? AND h.played_at < ?
+		GROUP BY k.artist_key ORDER BY n DESC LIMIT ?`, from.Unix(), to.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	artists := make([]go101ArtistPlays, 0)
+	for rows.Next() {
+		var a go101ArtistPlays
+		if err = rows.Scan(&a.Name, &a.Plays); err != nil {
+			return nil, err
+		}
+		artists = append(artists, a)
+	}
+	return artists, rows.Err()
+}
+
+// Switches to the best suggested channel.
+func (p *go101) PlaySuggestion() {
+	suggestions, err := p.Suggest(1, time.Now())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(suggestions) == 0 {
+		fmt.Println("No suggestions yet, listen a bit more.")
+		return
+	}
+	p.SwitchChannel(suggestions[0].Channel.Id)
+}
+
+// Recommend channels based on listening history.
+func CmdSuggest(args []string) {
+	fs := flag.NewFlagSet("suggest", flag.ExitOnError)
+	n := fs.Int("n", SUGGEST_LIMIT, "Number of suggestions.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	go101o.LoadChannelGroups()
+	suggestions, err := go101o.Suggest(*n, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(suggestions) == 0 {
+		fmt.Println("No suggestions yet, listen a bit more.")
+		return
+	}
+	for _, s := range suggestions {
+		fmt.Printf("%d - %s\n", s.Channel.Id, s.Channel.Summary())
+		fmt.Printf("        %s\n", strings.Join(s.Reasons, "; "))
+	}
+}
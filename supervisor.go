@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	SUPERVISOR_BACKOFF_MIN = time.Second
+	SUPERVISOR_BACKOFF_MAX = time.Minute
+	// Component that worked at least that long is considered healthy, so backoff is reset.
+	SUPERVISOR_HEALTHY_RUN = time.Minute
+)
+
+// Runs long-running component and restarts it with exponential backoff after panic or unexpected return.
+// Never returns, so should be called in own goroutine for everything except the main loop.
+func Supervise(name string, fn func()) {
+	backoff := SUPERVISOR_BACKOFF_MIN
+	for {
+		started := time.Now()
+		Safe(name, fn)
+		if time.Since(started) > SUPERVISOR_HEALTHY_RUN {
+			backoff = SUPERVISOR_BACKOFF_MIN
+		}
+		log.Printf("%s stopped, restart in %s", name, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > SUPERVISOR_BACKOFF_MAX {
+			backoff = SUPERVISOR_BACKOFF_MAX
+		}
+	}
+}
+
+// Runs function once, recovers from panic and logs it with the stack trace.
+func Safe(name string, fn func()) {
+	Block{
+		Try: fn,
+		Catch: func(e Exception) {
+			log.Printf("%s panic: %v\n%s", name, e, debug.Stack())
+		},
+	}.Do()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Checks if system D-Bus is available (might be absent in containers and minimal installs) and allowed by config.
+func SystemBusAvailable() bool {
+	if go101o.Config != nil && go101o.Config.NoDBus {
+		return false
+	}
+	if os.Getenv("DBUS_SYSTEM_BUS_ADDRESS") != "" {
+		return true
+	}
+	_, err := os.Stat("/run/dbus/system_bus_socket")
+	return err == nil
+}
+
+// Stops stream before system suspend and restarts playback after resume. Runs forever.
+func (p *go101) SuspendLoop() {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		panic(fmt.Errorf("couldn't connect to system bus: %s", err.Error()))
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(LOGIND_PATH),
+		dbus.WithMatchInterface(LOGIND_NAME+".Manager"),
+		dbus.WithMatchMember("PrepareForSleep"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+
+	// Delay lock gives time to stop the stream before suspend.
+	lock := takeDelayLock(conn)
+	for signal := range signals {
+		if signal.Name != LOGIND_NAME+".Manager.PrepareForSleep" || len(signal.Body) == 0 {
+			continue
+		}
+		sleeping, _ := signal.Body[0].(bool)
+		if sleeping {
+			Debug("System goes to sleep, stop stream")
+			p.Stop()
+			if lock >= 0 {
+				_ = syscall.Close(lock)
+				lock = -1
+			}
+			continue
+		}
+		Debug("System resumed, restart stream")
+		lock = takeDelayLock(conn)
+		// Force main loop to fetch actual track and start playing it.
+		p.RestartTrack()
+	}
+	panic(fmt.Errorf("system bus connection closed"))
+}
+
+// Takes logind delay lock, returns its descriptor or -1.
+func takeDelayLock(conn *dbus.Conn) int {
+	var fd dbus.UnixFD
+	err := conn.Object(LOGIND_NAME, LOGIND_PATH).
+		Call(LOGIND_NAME+".Manager.Inhibit", 0, "sleep", "101ply", "Stopping stream", "delay").
+		Store(&fd)
+	if err != nil {
+		Debug("Couldn't take delay lock: %s", err)
+		return -1
+	}
+	return int(fd)
+}
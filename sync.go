@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Calibration taps farther than that from the expected track change are taken for mistakes.
+const SYNC_MAX_DELTA = 30 * time.Second
+
+// Returns delay of the audio relative to track info timestamps, negative if audio is ahead.
+func (p *go101) SyncOffset() time.Duration {
+	// Temporary instances parsing track info have no config.
+	if p.Config == nil {
+		return 0
+	}
+	return time.Duration(p.Config.SyncOffsetMs) * time.Millisecond
+}
+
+// Emits track change when it's heard: offset after the track info change. Cover art is looked up first,
+// so listeners get the track with it.
+func (p *go101) EmitTrack() {
+	track := p.Track()
+	changed := time.Now()
+	go Safe("cover art", func() {
+		cover := p.Config.CoverArt.Find(track)
+		// Cover is set by the fetch loop, as the track itself.
+		p.Exec(func() {
+			// Channel switched or track skipped meanwhile, the new one is emitted by itself.
+			if p.CurrentTrack.TrackUid != track.TrackUid {
+				return
+			}
+			p.state.data.Lock()
+			p.CurrentTrack.Cover = cover
+			p.state.data.Unlock()
+			offset := p.SyncOffset() - time.Since(changed)
+			if offset <= 0 {
+				p.Emit(EVENT_TRACK)
+				return
+			}
+			time.AfterFunc(offset, func() {
+				if p.Track().TrackUid == track.TrackUid {
+					p.Emit(EVENT_TRACK)
+				}
+			})
+		})
+	})
+}
+
+// Measure delay of the audio relative to track info of the running player.
+func CmdCalibrate(args []string) {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	rounds := fs.Int("n", 3, "Number of track changes to measure.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	var (
+		sum     time.Duration
+		n       int
+		current time.Duration
+		last    int64
+	)
+	for n < *rounds {
+		status, err := QueryStatus(NOW_TIMEOUT)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Wait for the player to pick up the track just heard.
+		if d := status.Ends - last; d > -5000 && d < 5000 {
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+		last = status.Ends
+		current = time.Duration(status.SyncOffsetMs) * time.Millisecond
+		ends := time.Unix(0, status.Ends*int64(time.Millisecond))
+		fmt.Printf("Now: %s - %s. Press Enter when you hear the next track start (in about %s).\n",
+			status.Artist, status.Title, FormatTime(uint64(status.Remaining)))
+		if _, err = reader.ReadString('\n'); err != nil {
+			log.Fatal(err)
+		}
+		delta := time.Since(ends)
+		if delta > SYNC_MAX_DELTA || delta < -SYNC_MAX_DELTA {
+			fmt.Printf("%.1fs away from the expected change, skipped.\n", delta.Seconds())
+			continue
+		}
+		if delta >= 0 {
+			fmt.Printf("Heard %.1fs after the expected change.\n", delta.Seconds())
+		} else {
+			fmt.Printf("Heard %.1fs before the expected change.\n", -delta.Seconds())
+		}
+		sum += delta
+		n++
+	}
+	offset := current + sum/time.Duration(n)
+	fmt.Printf("Audio lags track info by %d ms, set \"sync_offset_ms\": %d in %s.\n",
+		offset.Milliseconds(), offset.Milliseconds(), GetConfigFile())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	DEFAULT_TRACK_FORMAT = `{{artist .Artist}} - {{title .Title}}{{if .Album}} {{album (printf "[%s]" .Album)}}{{end}} - {{time .Remaining}}`
+	STATUS_LINE_INTERVAL = time.Second
+)
+
+// Data available in track format templates.
+type go101TemplateData struct {
+	Artist  string
+	Title   string
+	Album   string
+	Channel string
+	Status  string
+	// Cover image URL, empty if no provider has it.
+	Cover string
+	// Formatted as "m:ss", "h:mm:ss" for an hour and longer.
+	Remaining string
+	Elapsed   string
+	Duration  string
+	// Played part of the track, 0..1.
+	Done float64
+	// Next program of the channel: "18:00 <title>", empty if channel has no schedule.
+	Next string
+	// Session stats: uptime ("1h02m"), tracks heard, downloaded data ("12.3 MB") and reconnects.
+	Uptime     string
+	Tracks     uint64
+	Downloaded string
+	Reconnects uint64
+	// Wall clock in the user's time format and countdown to the next track info fetch ("0:12", empty while fetching).
+	Clock     string
+	NextFetch string
+}
+
+// Template functions: theme colors and progress bar.
+var templateFuncs = template.FuncMap{
+	"artist":  func(s string) string { return Paint(theme.Artist, s) },
+	"title":   func(s string) string { return Paint(theme.Title, s) },
+	"album":   func(s string) string { return Paint(theme.Album, s) },
+	"time":    func(s string) string { return Paint(theme.Time, s) },
+	"channel": func(s string) string { return Paint(theme.Channel, s) },
+	"info":    func(s string) string { return Paint(theme.Info, s) },
+	"progress": func(done float64, width int) string {
+		return ThemeProgress(done, width)
+	},
+}
+
+// Parses track format template.
+func ParseTrackFormat(format string) (*template.Template, error) {
+	if format == "" {
+		format = DEFAULT_TRACK_FORMAT
+	}
+	t, err := template.New("track").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("wrong track format: %s", err.Error())
+	}
+	return t, nil
+}
+
+// Returns template data of the current track.
+func (p *go101) TemplateData() go101TemplateData {
+	track, channel := p.Track(), p.Channel()
+	d := go101TemplateData{
+		Artist:  p.ConsoleText(track.Artist),
+		Title:   p.ConsoleText(track.Title),
+		Album:   p.ConsoleText(track.Album),
+		Channel: p.ConsoleText(channel.Title),
+		Status:  StatusName(p.Status()),
+		Cover:   track.Cover,
+	}
+	var remaining, duration uint64
+	if left := time.Until(track.Ends); left > 0 {
+		remaining = uint64(left / time.Second)
+	}
+	if track.Finish > track.Start {
+		duration = track.Finish - track.Start
+	}
+	if remaining > duration {
+		remaining = duration
+	}
+	d.Remaining = FormatTime(remaining)
+	d.Duration = FormatTime(duration)
+	d.Elapsed = FormatTime(duration - remaining)
+	if duration > 0 {
+		d.Done = float64(duration-remaining) / float64(duration)
+	}
+	s := stats.Snapshot()
+	if next := p.NextProgram(channel.Id); next != nil {
+		d.Next = FormatClock(next.Start) + " " + next.Title
+	}
+	d.Uptime = FormatUptime(s.Uptime)
+	d.Tracks = s.Tracks
+	d.Downloaded = FormatSize(int64(s.Downloaded))
+	d.Reconnects = s.Reconnects
+	d.Clock = FormatClock(time.Now())
+	if left, ok := p.Scheduler.Countdown(); ok && left > 0 {
+		d.NextFetch = FormatTime(uint64((left + time.Second - 1) / time.Second))
+	}
+	return d
+}
+
+// Renders current track line.
+func (p *go101) TrackLine() string {
+	var b strings.Builder
+	d := p.TemplateData()
+	if err := p.TrackFormat.Execute(&b, d); err != nil {
+		return err.Error()
+	}
+	// Debug mode shows polling countdown, updated with the line.
+	if verbose && p.StatusLine && d.NextFetch != "" {
+		b.WriteString(Paint(theme.Info, fmt.Sprintf(" | next fetch %s | %s", d.NextFetch, d.Clock)))
+	}
+	return b.String()
+}
+
+// Keeps track line with remaining time up to date, rewriting it in place. Runs forever.
+func (p *go101) StatusLineLoop() {
+	for true {
+		time.Sleep(STATUS_LINE_INTERVAL)
+		if p.Status() != STATUS_STOP && !p.BigMode && !p.Previewing() && !p.Replaying() {
+			fmt.Print("\r" + p.TrackLine() + "\033[K")
+		}
+	}
+}
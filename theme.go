@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Color depth of the terminal.
+const (
+	COLOR_NONE = 0
+	COLOR_8    = 8
+	COLOR_256  = 256
+	COLOR_TRUE = 1 << 24
+)
+
+// Console colors, given as "#rrggbb" (empty means terminal default) and downgraded to the terminal color depth.
+type go101Theme struct {
+	Artist  string `json:"artist"`
+	Title   string `json:"title"`
+	Album   string `json:"album"`
+	Time    string `json:"time"`
+	Channel string `json:"channel"`
+	Info    string `json:"info"`
+	Error   string `json:"error"`
+	// Progress bar characters.
+	ProgressFill  string `json:"progress_fill"`
+	ProgressEmpty string `json:"progress_empty"`
+}
+
+// Built-in themes, see defaults/themes.json.
+var themes = loadThemes()
+
+// Parses embedded themes.
+func loadThemes() map[string]go101Theme {
+	themes := make(map[string]go101Theme)
+	if err := json.Unmarshal(DefaultFile("themes.json"), &themes); err != nil {
+		panic(err)
+	}
+	return themes
+}
+
+// Active theme and terminal color depth.
+var (
+	theme      = themes["default"]
+	colorDepth = COLOR_NONE
+)
+
+// Activates theme by name and detects color depth of the terminal.
+func SetTheme(name string) error {
+	if name == "" {
+		name = "default"
+	}
+	t, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %s", name)
+	}
+	theme = t
+	colorDepth = ColorDepth(os.Stdout)
+	return nil
+}
+
+// Detects color depth supported by the terminal. Colors are disabled if NO_COLOR is set (https://no-color.org)
+// or output isn't a terminal.
+func ColorDepth(f *os.File) int {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return COLOR_NONE
+	}
+	if fi, err := f.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return COLOR_NONE
+	}
+	term := os.Getenv("TERM")
+	switch {
+	case term == "dumb":
+		return COLOR_NONE
+	case os.Getenv("COLORTERM") == "truecolor" || os.Getenv("COLORTERM") == "24bit":
+		return COLOR_TRUE
+	case strings.Contains(term, "256color"):
+		return COLOR_256
+	default:
+		return COLOR_8
+	}
+}
+
+// Wraps text in escape sequences of the color.
+func Paint(color, s string) string {
+	code := colorCode(color, colorDepth)
+	if code == "" || s == "" {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+// Returns SGR code of "#rrggbb" color for the color depth.
+func colorCode(color string, depth int) string {
+	if depth == COLOR_NONE || len(color) != 7 || color[0] != '#' {
+		return ""
+	}
+	v, err := strconv.ParseUint(color[1:], 16, 32)
+	if err != nil {
+		return ""
+	}
+	r, g, b := int(v>>16&0xff), int(v>>8&0xff), int(v&0xff)
+	switch depth {
+	case COLOR_TRUE:
+		return fmt.Sprintf("38;2;%d;%d;%d", r, g, b)
+	case COLOR_256:
+		if r == g && g == b {
+			// Grayscale ramp.
+			if r < 8 {
+				return "38;5;16"
+			}
+			if r > 238 {
+				return "38;5;231"
+			}
+			return fmt.Sprintf("38;5;%d", 232+(r-8)/10)
+		}
+		return fmt.Sprintf("38;5;%d", 16+36*(r*5/255)+6*(g*5/255)+b*5/255)
+	default:
+		// Components close to the brightest one define the hue.
+		max := r
+		if g > max {
+			max = g
+		}
+		if b > max {
+			max = b
+		}
+		if max < 64 {
+			return "30"
+		}
+		code := 30
+		if r*4 >= max*3 {
+			code += 1
+		}
+		if g*4 >= max*3 {
+			code += 2
+		}
+		if b*4 >= max*3 {
+			code += 4
+		}
+		if max > 191 {
+			// Bright variant.
+			code += 60
+		}
+		return strconv.Itoa(code)
+	}
+}
+
+// Returns progress bar of given width.
+func ThemeProgress(done float64, width int) string {
+	if done < 0 {
+		done = 0
+	}
+	if done > 1 {
+		done = 1
+	}
+	n := int(done * float64(width))
+	return Paint(theme.Time, strings.Repeat(theme.ProgressFill, n)) + Paint(theme.Info, strings.Repeat(theme.ProgressEmpty, width-n))
+}
+
+// Writer painting log messages with theme error color.
+type go101ErrorWriter struct {
+	w io.Writer
+}
+
+func (e go101ErrorWriter) Write(b []byte) (int, error) {
+	if ColorDepth(os.Stderr) == COLOR_NONE {
+		return e.w.Write(b)
+	}
+	s := strings.TrimRight(string(b), "\n")
+	code := colorCode(theme.Error, ColorDepth(os.Stderr))
+	if code == "" {
+		return e.w.Write(b)
+	}
+	if _, err := fmt.Fprintf(e.w, "\033[%sm%s\033[0m\n", code, s); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Title of the terminal saved on start.
+var titleSaved bool
+
+// Sets terminal window title on every track change, so tmux/terminal tab bars show what's playing.
+func (p *go101) InitTerminalTitle() {
+	if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return
+	}
+	// Save current title, restored by RestoreTerminalTitle.
+	fmt.Print("\033[22;0t")
+	titleSaved = true
+	p.Subscribe(func(e go101Event) {
+		if e.Type != EVENT_TRACK {
+			return
+		}
+		SetTerminalTitle(p.ConsoleText(fmt.Sprintf("%s – %s | %s", e.Track.Artist, e.Track.Title, e.Channel.Title)))
+	})
+}
+
+// Sets terminal window title (OSC 0).
+func SetTerminalTitle(title string) {
+	// Control characters would break the escape sequence.
+	title = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, title)
+	fmt.Printf("\033]0;%s\007", title)
+}
+
+// Restores title saved on start.
+func RestoreTerminalTitle() {
+	if !titleSaved {
+		return
+	}
+	fmt.Print("\033[23;0t")
+}
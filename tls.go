@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// TLS options of provider and stream connections, ex: for corporate MITM proxies.
+type go101TLSConfig struct {
+	// PEM bundle of additional trusted CA certificates.
+	CAFile string `json:"ca_file"`
+	// Don't verify server certificates. Insecure, use only if CA bundle isn't available.
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+}
+
+// Applies TLS options to all HTTP requests of the player (provider, stream, track cache).
+func InitTLS(c *go101TLSConfig) error {
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.InsecureSkipVerify {
+		log.Println("TLS certificates verification is disabled.")
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return fmt.Errorf("couldn't read CA bundle: %s", err.Error())
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = config
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry tracing, spans are exported via OTLP/HTTP.
+type go101TracingConfig struct {
+	// Collector address, ex: localhost:4318.
+	Endpoint string `json:"endpoint"`
+	Insecure bool   `json:"insecure"`
+	// Service name, 101ply by default.
+	Service string `json:"service"`
+}
+
+// Tracer of the player. Without configured tracing it's no-op.
+var (
+	tracer          trace.Tracer = otel.Tracer("101ply")
+	tracingShutdown              = func(ctx context.Context) error { return nil }
+)
+
+// Sets up OTLP exporter.
+func InitTracing(c *go101TracingConfig) error {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(c.Endpoint)}
+	if c.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return fmt.Errorf("couldn't create OTLP exporter: %s", err.Error())
+	}
+	service := c.Service
+	if service == "" {
+		service = "101ply"
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(service))),
+	)
+	otel.SetTracerProvider(provider)
+	tracer = provider.Tracer("101ply")
+	tracingShutdown = provider.Shutdown
+	Debug("Tracing to %s enabled", c.Endpoint)
+	return nil
+}
+
+// Flushes spans on exit.
+func ShutdownTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_ = tracingShutdown(ctx)
+}
+
+// Starts span with channel and track attributes.
+func (p *go101) StartSpan(name string) (context.Context, trace.Span) {
+	return tracer.Start(context.Background(), name, trace.WithAttributes(
+		attribute.Int64("channel.id", int64(p.ChannelId())),
+		attribute.Int64("track.uid", int64(p.Track().TrackUid)),
+	))
+}
+
+// Finishes span, marking it failed if error given.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_TRACK_CACHE_MB = 100
+	TRACK_HISTORY_SIZE     = 10
+)
+
+// Recently played tracks, newest last.
+var (
+	recentTracks    []go101TrackInfo
+	recentTracksMux sync.Mutex
+)
+
+// Returns full path to the cached tracks directory.
+func GetTrackCacheDir() string {
+	ps := string(os.PathSeparator)
+	return GetCacheDir() + ps + "tracks"
+}
+
+// Returns full path to the cached track file.
+func GetTrackCacheFile(uid uint64) string {
+	ps := string(os.PathSeparator)
+	return fmt.Sprintf("%s%s%d.mp3", GetTrackCacheDir(), ps, uid)
+}
+
+// Downloads every played track to the cache, so it may be replayed.
+func (p *go101) InitTrackCache() {
+	if err := os.MkdirAll(GetTrackCacheDir(), PRIVATE_DIR_PERM); err != nil {
+		log.Println("Couldn't create track cache directory: ", err.Error())
+		return
+	}
+	p.Subscribe(func(e go101Event) {
+		// Live stream never ends, so it can't be cached.
+		if e.Type != EVENT_TRACK || e.Track.PlayURL == "" || e.Track.Live {
+			return
+		}
+		recentTracksMux.Lock()
+		recentTracks = append(recentTracks, e.Track)
+		if len(recentTracks) > TRACK_HISTORY_SIZE {
+			recentTracks = recentTracks[1:]
+		}
+		recentTracksMux.Unlock()
+		if err := CacheTrack(e.Track); err != nil {
+			Debug("Couldn't cache track: %s", err)
+			// Backend can't tell why the stream is silent, but the cache download can.
+			if IsGeoBlocked(err) {
+				cid := e.Channel.Id
+				p.Exec(func() {
+					if p.HandleGeoBlock(cid, err) {
+						p.Scheduler.Wake()
+					}
+				})
+			}
+		} else if p.Config.Record != nil {
+			if err = p.RecordTrack(e.Track, e.Channel); err != nil {
+				log.Println("Couldn't record track: ", err.Error())
+				p.RecordingFailed(e.Track.Artist+" - "+e.Track.Title, err)
+			}
+		}
+		p.TrimTrackCache()
+		p.TrimCache()
+	})
+}
+
+// Downloads track file to the cache.
+func CacheTrack(track go101TrackInfo) error {
+	filename := GetTrackCacheFile(track.TrackUid)
+	if _, err := os.Stat(filename); err == nil {
+		return nil
+	}
+	// Incomplete download never looks like cached track, it's resumed next time the track is played.
+	if err := downloader.Download(track.PlayURL, filename); err != nil {
+		return err
+	}
+	Debug("Track %d cached", track.TrackUid)
+	return nil
+}
+
+// Removes oldest cached tracks exceeding the cache size limit.
+func (p *go101) TrimTrackCache() {
+	limit := int64(p.Config.TrackCacheMb)
+	if limit <= 0 {
+		limit = DEFAULT_TRACK_CACHE_MB
+	}
+	limit *= 1024 * 1024
+	files, err := ioutil.ReadDir(GetTrackCacheDir())
+	if err != nil {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	var total int64
+	for _, fi := range files {
+		total += fi.Size()
+		if total > limit {
+			_ = os.Remove(GetTrackCacheDir() + string(os.PathSeparator) + fi.Name())
+		}
+	}
+}
+
+// Returns track played before the current one.
+func PreviousTrack() (go101TrackInfo, bool) {
+	recentTracksMux.Lock()
+	defer recentTracksMux.Unlock()
+	if len(recentTracks) < 2 {
+		return go101TrackInfo{}, false
+	}
+	return recentTracks[len(recentTracks)-2], true
+}
+
+// Plays previous track from the cache, then returns to live radio.
+func (p *go101) Replay() {
+	track, ok := PreviousTrack()
+	if !ok {
+		fmt.Println("Nothing to replay.")
+		return
+	}
+	filename := GetTrackCacheFile(track.TrackUid)
+	if _, err := os.Stat(filename); err != nil {
+		fmt.Println("Previous track isn't cached yet.")
+		return
+	}
+	TouchCacheFile(filename)
+	duration := time.Duration(track.Finish-track.Start) * time.Second
+	if duration <= 0 {
+		duration = 3 * time.Minute
+	}
+
+	p.setReplaying(true)
+	// Listeners learn that playback can seek now.
+	p.Emit(EVENT_STATUS)
+	fmt.Printf("Replay: %s\n", p.ConsoleText(track.Artist+" - "+track.Title))
+	p.Backend.Stop()
+	if err := p.Backend.Play(filename); err != nil {
+		log.Println(err)
+	}
+	time.Sleep(duration)
+	p.Backend.Stop()
+	p.setReplaying(false)
+	p.Emit(EVENT_STATUS)
+
+	// Back to live, main loop will fetch and play the current track.
+	fmt.Println("Back to live.")
+	p.RestartTrack()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Error reported by the station in getTrackOnAir reply.
+type go101ApiError struct {
+	Code    uint64
+	Message string
+}
+
+func (e *go101ApiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("station replied with error code %d", e.Code)
+	}
+	return fmt.Sprintf("station replied with error code %d: %s", e.Code, e.Message)
+}
+
+// Checks getTrackOnAir reply: station error code or reply without the track.
+func (t *TrackInfo) Check() error {
+	if t.ErrorCode != 0 {
+		return &go101ApiError{t.ErrorCode, t.ErrorMessage}
+	}
+	about := t.Result.About
+	if len(about.Audio) == 0 && about.Title == "" && about.Artist == "" {
+		return fmt.Errorf("empty track info")
+	}
+	return nil
+}
+
+// Returns the first audio of the track having a file. Audio of partial reply may be empty or lack file names.
+func (t *TrackInfo) AudioFile() (TrackInfo__Result__About__Audio, bool) {
+	for _, a := range t.Result.About.Audio {
+		if a.Filename != "" {
+			return a, true
+		}
+	}
+	return TrackInfo__Result__About__Audio{}, false
+}
+
+// Returns ID of the track: of any audio entry or, if there's none, track start moment.
+func (t *TrackInfo) TrackUid() uint64 {
+	for _, a := range t.Result.About.Audio {
+		if a.TrackUid != 0 {
+			return a.TrackUid
+		}
+	}
+	return t.Result.Stat.StartSong
+}
+
+// Returns live stream URL of the channel by "stream_url" template, played when track has no audio file.
+func (p *go101) ChannelStreamURL(cid uint64) (string, error) {
+	if p.Config == nil || p.Config.StreamURL == "" {
+		return "", fmt.Errorf("no audio file of the track on channel %d", cid)
+	}
+	// Not a format string: URL may have other percent signs, ex: escaped characters.
+	url := strings.Replace(p.Config.StreamURL, "%d", strconv.FormatUint(cid, 10), -1)
+	if !regexp.MustCompile(`^https?://`).MatchString(url) {
+		url = p.BaseUrl() + url
+	}
+	return url, nil
+}
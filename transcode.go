@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	gomp3 "github.com/hajimehoshi/go-mp3"
+	"github.com/hraban/opus"
+)
+
+const (
+	OPUS_SAMPLE_RATE = 48000
+	OPUS_CHANNELS    = 2
+	// 20ms frame.
+	OPUS_FRAME_SIZE      = OPUS_SAMPLE_RATE / 50
+	OPUS_PRE_SKIP        = 312
+	OPUS_MAX_PACKET      = 4000
+	DEFAULT_OPUS_BITRATE = 64
+)
+
+// Transcodes MP3 tracks to a single Ogg Opus stream.
+type go101OpusEncoder struct {
+	mux     sync.Mutex
+	ogg     *go101OggWriter
+	enc     *opus.Encoder
+	pending []int16
+	granule uint64
+	packet  []byte
+}
+
+// Creates encoder and writes Ogg Opus headers.
+func NewOpusEncoder(w io.Writer, kbps int) (*go101OpusEncoder, error) {
+	if kbps <= 0 {
+		kbps = DEFAULT_OPUS_BITRATE
+	}
+	enc, err := opus.NewEncoder(OPUS_SAMPLE_RATE, OPUS_CHANNELS, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create opus encoder: %s", err.Error())
+	}
+	if err = enc.SetBitrate(kbps * 1000); err != nil {
+		return nil, err
+	}
+	e := &go101OpusEncoder{
+		ogg:     NewOggWriter(w, uint32(time.Now().UnixNano())),
+		enc:     enc,
+		granule: OPUS_PRE_SKIP,
+		packet:  make([]byte, OPUS_MAX_PACKET),
+	}
+	// Identification header, see RFC 7845.
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = OPUS_CHANNELS
+	binary.LittleEndian.PutUint16(head[10:], OPUS_PRE_SKIP)
+	binary.LittleEndian.PutUint32(head[12:], OPUS_SAMPLE_RATE)
+	if err = e.ogg.WritePacket(head, 0, OGG_BOS); err != nil {
+		return nil, err
+	}
+	// Comment header with vendor string and no comments.
+	vendor := "101ply"
+	tags := make([]byte, 8+4+len(vendor)+4)
+	copy(tags, "OpusTags")
+	binary.LittleEndian.PutUint32(tags[8:], uint32(len(vendor)))
+	copy(tags[12:], vendor)
+	if err = e.ogg.WritePacket(tags, 0, 0); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Decodes MP3 track and encodes it to Opus. Frames are dropped while skip returns true (paused).
+func (e *go101OpusEncoder) Transcode(r io.Reader, skip func() bool) error {
+	dec, err := gomp3.NewDecoder(r)
+	if err != nil {
+		return fmt.Errorf("couldn't decode mp3: %s", err.Error())
+	}
+	rate := dec.SampleRate()
+	// Decoder gives 16-bit little endian stereo samples.
+	buf := make([]byte, 4*1152)
+	// Position in the source samples for resampling to 48kHz.
+	var (
+		pos  float64
+		prev [2]int16
+		step = float64(rate) / OPUS_SAMPLE_RATE
+	)
+	for {
+		n, err := io.ReadFull(dec, buf)
+		if n > 0 {
+			frames := n / 4
+			samples := make([]int16, 0, int(float64(frames)/step)*2+4)
+			// Linear interpolation between source samples.
+			for ; pos < float64(frames); pos += step {
+				i := int(pos)
+				frac := pos - float64(i)
+				for c := 0; c < 2; c++ {
+					cur := int16(binary.LittleEndian.Uint16(buf[i*4+c*2:]))
+					a := prev[c]
+					if i > 0 {
+						a = int16(binary.LittleEndian.Uint16(buf[(i-1)*4+c*2:]))
+					}
+					samples = append(samples, int16(float64(a)+(float64(cur)-float64(a))*frac))
+				}
+			}
+			pos -= float64(frames)
+			prev[0] = int16(binary.LittleEndian.Uint16(buf[(frames-1)*4:]))
+			prev[1] = int16(binary.LittleEndian.Uint16(buf[(frames-1)*4+2:]))
+			if !skip() {
+				if err := e.write(samples); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Encodes samples by full frames, the rest waits for the next call.
+func (e *go101OpusEncoder) write(samples []int16) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	e.pending = append(e.pending, samples...)
+	for len(e.pending) >= OPUS_FRAME_SIZE*OPUS_CHANNELS {
+		if err := e.encodeFrame(e.pending[:OPUS_FRAME_SIZE*OPUS_CHANNELS], 0); err != nil {
+			return err
+		}
+		e.pending = e.pending[OPUS_FRAME_SIZE*OPUS_CHANNELS:]
+	}
+	return nil
+}
+
+func (e *go101OpusEncoder) encodeFrame(frame []int16, flags byte) error {
+	n, err := e.enc.Encode(frame, e.packet)
+	if err != nil {
+		return err
+	}
+	e.granule += OPUS_FRAME_SIZE
+	return e.ogg.WritePacket(e.packet[:n], e.granule, flags)
+}
+
+// Encodes the rest padded with silence and ends the stream.
+func (e *go101OpusEncoder) Close() error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	frame := make([]int16, OPUS_FRAME_SIZE*OPUS_CHANNELS)
+	copy(frame, e.pending)
+	e.pending = nil
+	return e.encodeFrame(frame, OGG_EOS)
+}
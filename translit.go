@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Cyrillic to Latin transliteration of artists and titles, for each sink separately.
+type go101TranslitConfig struct {
+	// Track line, big mode, terminal title and commands output.
+	Console bool `json:"console"`
+	// Recorded track files.
+	Filenames bool `json:"filenames"`
+	// Track info sent to webhooks.
+	Webhooks bool `json:"webhooks"`
+}
+
+// Transliteration table of Russian passports (ICAO Doc 9303) with Ukrainian and Belarusian letters.
+var translitTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "ie", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'і': "i", 'ї': "i", 'є': "ie", 'ґ': "g", 'ў': "u",
+}
+
+// Transliterates Cyrillic letters to Latin, other characters are kept. Capital letter gives
+// capitalized transliteration ("Ж" - "Zh"), unless the word is in upper case ("ЖУК" - "ZHUK").
+func Translit(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		lower := unicode.ToLower(r)
+		latin, ok := translitTable[lower]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		if r == lower || latin == "" {
+			b.WriteString(latin)
+			continue
+		}
+		upper := (i+1 < len(runes) && unicode.IsUpper(runes[i+1])) ||
+			(i > 0 && unicode.IsUpper(runes[i-1]) && (i+1 == len(runes) || !unicode.IsLetter(runes[i+1])))
+		if upper {
+			b.WriteString(strings.ToUpper(latin))
+		} else {
+			b.WriteString(strings.ToUpper(latin[:1]) + latin[1:])
+		}
+	}
+	return b.String()
+}
+
+// Returns track with transliterated artist, title and album.
+func TranslitTrack(track go101TrackInfo) go101TrackInfo {
+	track.Artist = Translit(track.Artist)
+	track.Title = Translit(track.Title)
+	track.Album = Translit(track.Album)
+	return track
+}
+
+// Transliterates text printed to the console, if configured.
+func (p *go101) ConsoleText(s string) string {
+	if p.Config.Translit != nil && p.Config.Translit.Console {
+		return Translit(s)
+	}
+	return s
+}
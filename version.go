@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// Build info, stamped by the linker:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%F)"
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// Version and build features of the binary.
+type go101Version struct {
+	Version       string          `json:"version"`
+	Commit        string          `json:"commit,omitempty"`
+	Date          string          `json:"date,omitempty"`
+	Go            string          `json:"go"`
+	Platform      string          `json:"platform"`
+	AudioBackends []string        `json:"audio_backends"`
+	Providers     []string        `json:"providers"`
+	Features      map[string]bool `json:"features"`
+}
+
+// Returns version info, falls back to module build info if binary isn't stamped.
+func VersionInfo() go101Version {
+	v := go101Version{
+		Version:       version,
+		Commit:        commit,
+		Date:          date,
+		Go:            runtime.Version(),
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
+		AudioBackends: audioBackends,
+		Features: map[string]bool{
+			"x11":     true,
+			"wayland": false,
+			"mpris":   true,
+			"opus":    true,
+		},
+	}
+	for _, p := range providers {
+		v.Providers = append(v.Providers, p.Name)
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && v.Commit == "":
+				v.Commit = s.Value
+				if len(v.Commit) > 12 {
+					v.Commit = v.Commit[:12]
+				}
+			case s.Key == "vcs.time" && v.Date == "":
+				v.Date = s.Value
+			}
+		}
+	}
+	return v
+}
+
+// Returns one line version, ex: "101ply 1.2.0 (abc123, 2024-01-01) go1.21.0 linux/amd64".
+func (v go101Version) String() string {
+	build := make([]string, 0, 2)
+	if v.Commit != "" {
+		build = append(build, v.Commit)
+	}
+	if v.Date != "" {
+		build = append(build, v.Date)
+	}
+	s := "101ply " + v.Version
+	if len(build) > 0 {
+		s += " (" + strings.Join(build, ", ") + ")"
+	}
+	return s + " " + v.Go + " " + v.Platform
+}
+
+// Print version, build features and credits.
+func CmdVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJson := fs.Bool("json", false, "Print JSON.")
+	credits := fs.Bool("credits", false, "Print used libraries.")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	v := VersionInfo()
+	if *asJson {
+		raw, _ := json.MarshalIndent(v, "", "\t")
+		fmt.Println(string(raw))
+		return
+	}
+	fmt.Println(v.String())
+	fmt.Printf("Audio backends: %s\n", strings.Join(v.AudioBackends, ", "))
+	fmt.Printf("Providers: %s\n", strings.Join(v.Providers, ", "))
+	features := make([]string, 0, len(v.Features))
+	for name, enabled := range v.Features {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(features)
+	fmt.Printf("Features: %s\n", strings.Join(features, ", "))
+	if !*credits {
+		return
+	}
+	fmt.Println("\nBuilt with:")
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			fmt.Printf("  %s %s\n", dep.Path, dep.Version)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const WATCHDOG_CHECK_INTERVAL = 5 * time.Second
+
+// Restarts audio pipeline which stopped consuming audio while player is playing: hung mpg123 or mpv, dead
+// audio device. Runs forever.
+func (p *go101) WatchdogLoop() {
+	limit := time.Duration(p.Config.WatchdogSeconds) * time.Second
+	backend := p.Backend.(go101ProgressBackend)
+	var (
+		last  uint64
+		track uint64
+		since = time.Now()
+	)
+	for true {
+		time.Sleep(WATCHDOG_CHECK_INTERVAL)
+		// Preview and replay play local files, they aren't watched. Stream may end a bit before the track
+		// does, the next track starts soon anyway.
+		current := p.Track()
+		if p.Status() != STATUS_PLAY || p.Previewing() || p.Replaying() || current.TrackUid != track ||
+			time.Until(current.Ends) < limit {
+			track, since = current.TrackUid, time.Now()
+			continue
+		}
+		progress, err := backend.Progress()
+		if err == nil && progress != last {
+			last, since = progress, time.Now()
+			continue
+		}
+		if err != nil {
+			Debug("Couldn't get audio progress: %s", err)
+		}
+		if stalled := time.Since(since); stalled >= limit {
+			p.RestartAudio(stalled.Round(time.Second))
+			since = time.Now()
+		}
+	}
+}
+
+// Kills hung audio process and starts the stream again. Reported as error event with the track and channel, so
+// it reaches notifiers, webhooks and play log.
+func (p *go101) RestartAudio(stalled time.Duration) {
+	backend := p.Config.AudioBackend
+	if backend == "" {
+		backend = BACKEND_MP3LIB
+	}
+	err := fmt.Errorf("audio watchdog: no audio consumed for %s by %s backend, pipeline restarted", stalled, backend)
+	log.Printf("%s (channel %s, track %d)", err.Error(), p.Channel().Title, p.Track().TrackUid)
+	p.EmitError(err)
+	if b, ok := p.Backend.(go101RestartBackend); ok {
+		b.Restart()
+	}
+	stats.AddReconnect()
+	// Main loop fetches and plays the current track again.
+	p.RestartTrack()
+}
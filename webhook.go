@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	WEBHOOK_TIMEOUT = 10 * time.Second
+	WEBHOOK_RETRIES = 3
+)
+
+// Webhook payload formats.
+const (
+	WEBHOOK_FORMAT_JSON = "json"
+	// Flat payload of IFTTT Webhooks service: value1 - artist, value2 - title, value3 - channel.
+	WEBHOOK_FORMAT_IFTTT = "ifttt"
+)
+
+// Webhook called on player events.
+type go101Webhook struct {
+	URL string `json:"url"`
+	// Events to send (track, status, channel), all if empty.
+	Events []string `json:"events"`
+	// Payload is signed by HMAC-SHA256 with that secret, signature is sent in X-101ply-Signature header.
+	Secret  string `json:"secret"`
+	Retries int    `json:"retries"`
+	// Payload format: json (default) or ifttt.
+	Format string `json:"format"`
+	// Send track events only for these artists (case insensitive substrings), all if empty.
+	Artists []string `json:"artists"`
+}
+
+// Flat payload for IFTTT Webhooks.
+type go101IftttPayload struct {
+	Value1 string `json:"value1"`
+	Value2 string `json:"value2"`
+	Value3 string `json:"value3"`
+}
+
+// Webhook payload.
+type go101WebhookPayload struct {
+	Event   string              `json:"event"`
+	Time    int64               `json:"time"`
+	Status  string              `json:"status"`
+	Channel go101WebhookChannel `json:"channel"`
+	Track   go101WebhookTrack   `json:"track"`
+}
+
+type go101WebhookChannel struct {
+	Id    uint64 `json:"id"`
+	Title string `json:"title"`
+}
+
+type go101WebhookTrack struct {
+	Uid    uint64 `json:"uid"`
+	Artist string `json:"artist"`
+	Title  string `json:"title"`
+	Album  string `json:"album"`
+	// Server timestamps of the track start and finish.
+	Start  uint64 `json:"start"`
+	Finish uint64 `json:"finish"`
+}
+
+// Sends player events to configured webhooks.
+func (p *go101) InitWebhooks() {
+	p.Subscribe(func(e go101Event) {
+		// Artists filter is matched against the original spelling.
+		sent := e
+		if p.Config.Translit != nil && p.Config.Translit.Webhooks {
+			sent.Track = TranslitTrack(e.Track)
+			sent.Channel.Title = Translit(e.Channel.Title)
+		}
+		for _, hook := range p.Config.Webhooks {
+			if !hook.Accepts(e) {
+				continue
+			}
+			// Slow webhook shouldn't delay others.
+			hook := hook
+			go Safe("webhook", func() {
+				if err := hook.Send(sent); err != nil {
+					log.Printf("Webhook %s failed: %s", hook.URL, err.Error())
+				}
+			})
+		}
+	})
+}
+
+// Checks if webhook should receive the event.
+func (w go101Webhook) Accepts(e go101Event) bool {
+	if len(w.Artists) > 0 {
+		if e.Type != EVENT_TRACK || !w.MatchArtist(e.Track.Artist) {
+			return false
+		}
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, typ := range w.Events {
+		if typ == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if artist is in the webhook artists list.
+func (w go101Webhook) MatchArtist(artist string) bool {
+	artist = strings.ToLower(artist)
+	for _, a := range w.Artists {
+		if a != "" && strings.Contains(artist, strings.ToLower(a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns payload of the event in webhook format.
+func (w go101Webhook) Payload(e go101Event) ([]byte, error) {
+	switch w.Format {
+	case WEBHOOK_FORMAT_JSON, "":
+		return json.Marshal(NewWebhookPayload(e))
+	case WEBHOOK_FORMAT_IFTTT:
+		return json.Marshal(go101IftttPayload{e.Track.Artist, e.Track.Title, e.Channel.Title})
+	default:
+		return nil, fmt.Errorf("unknown webhook format %s", w.Format)
+	}
+}
+
+// Returns webhook payload of the event.
+func NewWebhookPayload(e go101Event) go101WebhookPayload {
+	return go101WebhookPayload{
+		Event:   e.Type,
+		Time:    e.Time.Unix(),
+		Status:  StatusName(e.Status),
+		Channel: go101WebhookChannel{e.Channel.Id, e.Channel.Title},
+		Track: go101WebhookTrack{
+			Uid:    e.Track.TrackUid,
+			Artist: e.Track.Artist,
+			Title:  e.Track.Title,
+			Album:  e.Track.Album,
+			Start:  e.Track.Start,
+			Finish: e.Track.Finish,
+		},
+	}
+}
+
+// Posts event to the webhook, retrying with exponential backoff.
+func (w go101Webhook) Send(e go101Event) error {
+	body, err := w.Payload(e)
+	if err != nil {
+		return err
+	}
+	retries := w.Retries
+	if retries <= 0 {
+		retries = WEBHOOK_RETRIES
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		if err = w.post(body); err == nil || attempt >= retries {
+			return err
+		}
+		Debug("Webhook %s failed, retry after %s: %s", w.URL, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Makes single webhook request.
+func (w go101Webhook) post(body []byte) error {
+	// URL might be a secret too, ex: IFTTT key in path.
+	target, err := ResolveSecret(w.URL)
+	if err != nil {
+		return err
+	}
+	secret, err := ResolveSecret(w.Secret)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "101ply")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-101ply-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	client := http.Client{Timeout: WEBHOOK_TIMEOUT}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %s", resp.Status)
+	}
+	return nil
+}